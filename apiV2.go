@@ -0,0 +1,632 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// /api/v2 exposes the same features as v1 as resources with proper verbs. Every
+// error uses one envelope, and the OpenAPI document is generated from the route
+// table below, so it can't drift from what is served. The v1 routes remain for
+// existing clients and share the implementations.
+
+const API_V2_PREFIX = "/api/v2"
+
+// apiParam is a path or query parameter of a v2 route
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // OpenAPI type: string, integer, boolean
+	Description string
+}
+
+// apiRoute is one v2 operation. Scope is scopeRead, scopeAdmin or "" for
+// public routes.
+type apiRoute struct {
+	Method   string
+	Path     string // relative to API_V2_PREFIX, fiber syntax (/data/:key)
+	Scope    string
+	Summary  string
+	Params   []apiParam
+	Body     string // schema name of the JSON request body, a media type like application/zip, "" for none
+	Response string // schema name of the JSON response, or a media type like image/png
+	Handler  fiber.Handler
+}
+
+var (
+	pageIDParam      = []apiParam{{"id", "path", "string", "page id, e.g. page0"}}
+	profileNameParam = []apiParam{{"name", "path", "string", "profile name, e.g. vehicle"}}
+	assetParams      = []apiParam{{"kind", "path", "string", "icons or fonts"}, {"name", "path", "string", "file name, e.g. logo.svg"}}
+	elementParams    = append([]apiParam{{"index", "path", "integer", "position of the element on the page"}}, pageIDParam...)
+)
+
+func apiV2Routes() []apiRoute {
+	return []apiRoute{
+		{Method: "GET", Path: "/openapi.json", Summary: "This document", Response: "object", Handler: serveOpenAPI},
+		{Method: "GET", Path: "/status", Scope: scopeRead, Summary: "Liveness check", Response: "Ok", Handler: getStatus},
+
+		{Method: "GET", Path: "/data", Scope: scopeRead, Summary: "All data values", Response: "DataValues", Handler: getData,
+			Params: []apiParam{{"meta", "query", "boolean", "return full entries with type, unit, timestamps and errors"}}},
+		{Method: "PATCH", Path: "/data", Scope: scopeAdmin, Summary: "Set data values", Body: "DataValues", Response: "Ok", Handler: patchDataV2},
+		{Method: "GET", Path: "/data/:key", Scope: scopeRead, Summary: "One data entry", Response: "DataEntry", Handler: getDataKeyV2,
+			Params: []apiParam{{"key", "path", "string", "data key, e.g. BatterySoc"}}},
+
+		{Method: "GET", Path: "/config", Scope: scopeAdmin, Summary: "Effective config, defaults with the user config applied", Response: "Config", Handler: getConfig},
+		{Method: "GET", Path: "/config/default", Scope: scopeAdmin, Summary: "Default config", Response: "Config", Handler: getDefaultConfigV2},
+		{Method: "GET", Path: "/config/user", Scope: scopeAdmin, Summary: "User config overrides", Response: "Config", Handler: getUserConfigV2},
+		{Method: "PUT", Path: "/config/user", Scope: scopeAdmin, Summary: "Replace the user config", Body: "Config", Response: "Config", Handler: putUserConfigV2},
+		{Method: "PATCH", Path: "/config/user", Scope: scopeAdmin, Summary: "Deep-merge into the user config", Body: "Config", Response: "Config", Handler: patchUserConfigV2},
+		{Method: "DELETE", Path: "/config/user", Scope: scopeAdmin, Summary: "Reset to the default config", Response: "Ok", Handler: deleteUserConfigV2},
+		{Method: "GET", Path: "/config/schema", Scope: scopeRead, Summary: "JSON Schema of display_template", Response: "object", Handler: getTemplateSchema},
+		{Method: "POST", Path: "/config/validate", Scope: scopeRead, Summary: "Check a user config against the defaults without saving it", Body: "Config", Response: "Validation", Handler: postValidateConfig},
+		{Method: "GET", Path: "/config/export", Scope: scopeAdmin, Summary: "Zip of the user config over the active profile, with the icons and fonts it uses", Response: "application/zip", Handler: exportConfigV2},
+		{Method: "POST", Path: "/config/import", Scope: scopeAdmin, Summary: "Replace the user config and add the assets from an exported zip", Body: "application/zip", Response: "BundleImport", Handler: importConfigV2,
+			Params: []apiParam{{"on_conflict", "query", "string", "for files that exist with other content: fail (default), keep, overwrite (uploads only) or rename"}}},
+		{Method: "GET", Path: "/config/reload", Scope: scopeRead, Summary: "Config file watcher and the last reload or reload error", Response: "ConfigReload", Handler: getConfigReload},
+		{Method: "POST", Path: "/config/reload", Scope: scopeAdmin, Summary: "Reload the config files now", Response: "ConfigReload", Handler: postConfigReload},
+
+		{Method: "GET", Path: "/profiles", Scope: scopeRead, Summary: "Saved config profiles and the active one", Response: "Profiles", Handler: getProfiles},
+		{Method: "PUT", Path: "/profiles/active", Scope: scopeAdmin, Summary: "Switch profile; kept across restarts", Body: "ProfileSwitch", Response: "Profiles", Handler: putActiveProfile},
+		{Method: "GET", Path: "/profiles/:name", Scope: scopeAdmin, Summary: "Config fields a profile sets", Response: "Config", Handler: getProfile, Params: profileNameParam},
+		{Method: "PUT", Path: "/profiles/:name", Scope: scopeAdmin, Summary: "Create or replace a profile", Body: "Config", Response: "Config", Handler: putProfile, Params: profileNameParam},
+		{Method: "DELETE", Path: "/profiles/:name", Scope: scopeAdmin, Summary: "Remove a profile that is not active", Response: "Ok", Handler: deleteProfile, Params: profileNameParam},
+
+		{Method: "GET", Path: "/assets", Scope: scopeRead, Summary: "Uploaded icons and fonts", Response: "Assets", Handler: listAssetsV2,
+			Params: []apiParam{{"kind", "query", "string", "icons or fonts, default both"}}},
+		{Method: "GET", Path: "/assets/:kind/:name", Scope: scopeRead, Summary: "An uploaded file", Response: "application/octet-stream", Handler: getAssetV2, Params: assetParams},
+		{Method: "PUT", Path: "/assets/:kind/:name", Scope: scopeAdmin, Summary: "Upload an icon or font; SVGs are sanitised", Body: "application/octet-stream", Response: "Asset", Handler: putAssetV2, Params: assetParams},
+		{Method: "DELETE", Path: "/assets/:kind/:name", Scope: scopeAdmin, Summary: "Remove an upload neither the current layout nor a saved profile uses", Response: "Ok", Handler: deleteAssetV2, Params: assetParams},
+
+		{Method: "GET", Path: "/display/frame.png", Scope: scopeRead, Summary: "Current screen", Response: "image/png", Handler: serveFrame},
+		{Method: "GET", Path: "/display/stream.mjpeg", Scope: scopeRead, Summary: "Live MJPEG stream of the screen", Response: "multipart/x-mixed-replace", Handler: serveStream},
+		{Method: "GET", Path: "/display/recording.gif", Scope: scopeRead, Summary: "Record the screen as an animated GIF", Response: "image/gif", Handler: serveRecording,
+			Params: []apiParam{{"seconds", "query", "integer", fmt.Sprintf("length, 1-%d, default 5", maxRecordSeconds)}}},
+		{Method: "POST", Path: "/display/next-page", Scope: scopeAdmin, Summary: "Slide to the next page", Response: "Ok", Handler: nextPageV2},
+		{Method: "POST", Path: "/display/previous-page", Scope: scopeAdmin, Summary: "Slide back to the previous page", Response: "Ok", Handler: previousPageV2},
+		{Method: "GET", Path: "/display/page", Scope: scopeRead, Summary: "The page on screen", Response: "PageState", Handler: getDisplayPage},
+		{Method: "PUT", Path: "/display/page", Scope: scopeAdmin, Summary: "Go to a page by index or id, or to the first SMS page", Body: "PageJump", Response: "Ok", Handler: putDisplayPage},
+		{Method: "PUT", Path: "/display/pin", Scope: scopeAdmin, Summary: "Keep the current page: the button and auto rotation stop changing it", Response: "PageState", Handler: pinPage},
+		{Method: "DELETE", Path: "/display/pin", Scope: scopeAdmin, Summary: "Unpin the page", Response: "PageState", Handler: unpinPage},
+		{Method: "GET", Path: "/display/rotation", Scope: scopeRead, Summary: "Auto rotation settings and whether it is running", Response: "RotationState", Handler: getRotation},
+		{Method: "PATCH", Path: "/display/rotation", Scope: scopeAdmin, Summary: "Change auto rotation; saved to the user config", Body: "Rotation", Response: "RotationState", Handler: patchRotation},
+		{Method: "POST", Path: "/display/text", Scope: scopeAdmin, Summary: "Pause the pages and show text, or a test pattern for empty text", Body: "DisplayText", Response: "DisplayText", Handler: postDisplayTextV2},
+		{Method: "DELETE", Path: "/display/text", Scope: scopeAdmin, Summary: "Remove the text and resume the pages", Response: "Ok", Handler: makeItRun},
+
+		{Method: "GET", Path: "/events", Scope: scopeRead, Summary: "Server-Sent Events: snapshot, data, page, idle, sms", Response: "text/event-stream", Handler: serveEvents,
+			Params: []apiParam{
+				{"events", "query", "string", "comma-separated event types to receive"},
+				{"meta", "query", "boolean", "send full data entries"},
+			}},
+
+		{Method: "GET", Path: "/pages", Scope: scopeRead, Summary: "All pages in display order, hidden ones included", Response: "Pages", Handler: listPages},
+		{Method: "POST", Path: "/pages", Scope: scopeAdmin, Summary: "Add a page; id is generated when left out", Body: "NewPage", Response: "Page", Handler: createPage},
+		{Method: "PUT", Path: "/pages/order", Scope: scopeAdmin, Summary: "Reorder pages", Body: "PageOrder", Response: "Pages", Handler: reorderPages},
+		{Method: "GET", Path: "/pages/:id", Scope: scopeRead, Summary: "One page", Response: "Page", Handler: getPage, Params: pageIDParam},
+		{Method: "PATCH", Path: "/pages/:id", Scope: scopeAdmin, Summary: "Change title, enabled or the whole element list", Body: "Page", Response: "Page", Handler: patchPage, Params: pageIDParam},
+		{Method: "DELETE", Path: "/pages/:id", Scope: scopeAdmin, Summary: "Remove a page", Response: "Ok", Handler: deletePage, Params: pageIDParam},
+		{Method: "GET", Path: "/pages/:id/elements", Scope: scopeRead, Summary: "Elements of a page", Response: "Elements", Handler: listElements, Params: pageIDParam},
+		{Method: "POST", Path: "/pages/:id/elements", Scope: scopeAdmin, Summary: "Add an element", Body: "Element", Response: "Element", Handler: createElement,
+			Params: append([]apiParam{{"index", "query", "integer", "insert before this element instead of appending"}}, pageIDParam...)},
+		{Method: "GET", Path: "/pages/:id/elements/:index", Scope: scopeRead, Summary: "One element", Response: "Element", Handler: getElement, Params: elementParams},
+		{Method: "PUT", Path: "/pages/:id/elements/:index", Scope: scopeAdmin, Summary: "Replace an element", Body: "Element", Response: "Element", Handler: putElement, Params: elementParams},
+		{Method: "PATCH", Path: "/pages/:id/elements/:index", Scope: scopeAdmin, Summary: "Change some fields of an element", Body: "Element", Response: "Element", Handler: patchElement, Params: elementParams},
+		{Method: "DELETE", Path: "/pages/:id/elements/:index", Scope: scopeAdmin, Summary: "Remove an element", Response: "Ok", Handler: deleteElement, Params: elementParams},
+
+		{Method: "GET", Path: "/collectors", Scope: scopeRead, Summary: "Collector health", Response: "Collectors", Handler: getCollectorsV2},
+		{Method: "PATCH", Path: "/collectors/:name", Scope: scopeAdmin, Summary: "Enable or disable a collector until restart", Body: "CollectorPatch", Response: "CollectorHealth", Handler: patchCollectorV2,
+			Params: []apiParam{{"name", "path", "string", "collector name"}}},
+	}
+}
+
+// registerAPIv2 mounts the v2 routes behind the auth middleware
+func registerAPIv2(app *fiber.App, read, admin, limit fiber.Handler) {
+	for _, r := range apiV2Routes() {
+		handlers := []fiber.Handler{}
+		switch r.Scope {
+		case scopeRead:
+			handlers = append(handlers, read)
+		case scopeAdmin:
+			handlers = append(handlers, admin)
+			if r.Method != "GET" {
+				handlers = append(handlers, limit)
+			}
+		}
+		app.Add(r.Method, API_V2_PREFIX+r.Path, append(handlers, r.Handler)...)
+	}
+}
+
+// apiError writes the error envelope: {"status": "error", "code": "not_found",
+// "message": "..."}. code is the HTTP status text in snake case.
+func apiError(c *fiber.Ctx, status int, message string) error {
+	code := strings.ToLower(strings.ReplaceAll(utils.StatusMessage(status), " ", "_"))
+	return c.Status(status).JSON(fiber.Map{"status": "error", "code": code, "message": message})
+}
+
+// apiErrorHandler renders fiber's own errors under /api/v2 (unknown route,
+// wrong method, oversized body) as the error envelope
+func apiErrorHandler(c *fiber.Ctx, err error) error {
+	if !strings.HasPrefix(c.Path(), API_V2_PREFIX+"/") {
+		return fiber.DefaultErrorHandler(c, err)
+	}
+	status := fiber.StatusInternalServerError
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		status = fe.Code
+	}
+	return apiError(c, status, err.Error())
+}
+
+// bodyObject decodes a JSON object request body
+func bodyObject(c *fiber.Ctx) (map[string]interface{}, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(c.Body(), &obj); err != nil {
+		return nil, fmt.Errorf("body must be a JSON object: %v", err)
+	}
+	if obj == nil {
+		return nil, errors.New("body must be a JSON object")
+	}
+	return obj, nil
+}
+
+// PATCH /api/v2/data
+func patchDataV2(c *fiber.Ctx) error {
+	payload, err := bodyObject(c)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	data := globalData.Source("api")
+	for k, v := range payload {
+		data.Store(k, v)
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// GET /api/v2/data/:key
+func getDataKeyV2(c *fiber.Ctx) error {
+	entry, ok := globalData.Snapshot()[c.Params("key")]
+	if !ok {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no data key %q", c.Params("key")))
+	}
+	return c.JSON(entry)
+}
+
+// GET /api/v2/config/default
+func getDefaultConfigV2(c *fiber.Ctx) error {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return c.JSON(dftCfg)
+}
+
+// GET /api/v2/config/user
+func getUserConfigV2(c *fiber.Ctx) error {
+	overrides, err := readUserOverrides()
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(overrides)
+}
+
+// PUT /api/v2/config/user
+func putUserConfigV2(c *fiber.Ctx) error {
+	return saveUserConfigV2(c, applyUserOverrides)
+}
+
+// PATCH /api/v2/config/user
+func patchUserConfigV2(c *fiber.Ctx) error {
+	return saveUserConfigV2(c, patchUserOverrides)
+}
+
+// saveUserConfigV2 answers 422 for configs that parse but don't validate, and
+// returns the saved user config on success
+func saveUserConfigV2(c *fiber.Ctx, save func(map[string]interface{}) error) error {
+	if err := validateJSON(c.Body()); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	payload, err := bodyObject(c)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := save(payload); err != nil {
+		return apiConfigError(c, err, c.Body())
+	}
+	return getUserConfigV2(c)
+}
+
+// DELETE /api/v2/config/user
+func deleteUserConfigV2(c *fiber.Ctx) error {
+	if err := applyUserOverrides(map[string]interface{}{}); err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// POST /api/v2/display/next-page
+func nextPageV2(c *fiber.Ctx) error {
+	triggerPageChange()
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// POST /api/v2/display/text
+func postDisplayTextV2(c *fiber.Ctx) error {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return apiError(c, fiber.StatusBadRequest, "body must be {\"text\": \"...\"}")
+		}
+	}
+	now := showText(req.Text)
+	return c.JSON(fiber.Map{"status": "ok", "text": req.Text, "time": now})
+}
+
+// GET /api/v2/collectors
+func getCollectorsV2(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"collectors": collectors.Health()})
+}
+
+// PATCH /api/v2/collectors/:name
+func patchCollectorV2(c *fiber.Ctx) error {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil || req.Enabled == nil {
+		return apiError(c, fiber.StatusBadRequest, "body must be {\"enabled\": true|false}")
+	}
+	name := c.Params("name")
+	if err := collectors.SetEnabled(name, *req.Enabled); err != nil {
+		return apiError(c, fiber.StatusNotFound, err.Error())
+	}
+	for _, h := range collectors.Health() {
+		if h.Name == name {
+			return c.JSON(h)
+		}
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// GET /api/v2/openapi.json
+func serveOpenAPI(c *fiber.Ctx) error {
+	return c.JSON(openAPIDocument(apiV2Routes()))
+}
+
+var (
+	fiberPathParam = regexp.MustCompile(`:(\w+)`)
+	pathWord       = regexp.MustCompile(`[A-Za-z0-9]+`)
+)
+
+// openAPIDocument describes the routes as OpenAPI 3.0
+func openAPIDocument(routes []apiRoute) map[string]interface{} {
+	paths := map[string]interface{}{}
+	for _, r := range routes {
+		path := fiberPathParam.ReplaceAllString(API_V2_PREFIX+r.Path, "{$1}")
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = openAPIOperation(r)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "photonicat2 mini display",
+			"version": "2",
+			"description": "Requests from the device itself need no token. Read routes need the read or admin token, " +
+				"admin routes the admin token; see `pcat2_mini_display token`. Requests may instead be signed with " +
+				headerTimestamp + " and " + headerSignature + ".",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearer":     map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"queryToken": map[string]interface{}{"type": "apiKey", "in": "query", "name": "token"},
+			},
+			"schemas": openAPISchemas,
+		},
+	}
+}
+
+func openAPIOperation(r apiRoute) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":     r.Summary,
+		"operationId": openAPIOperationID(r),
+	}
+
+	var params []interface{}
+	for _, p := range r.Params {
+		params = append(params, map[string]interface{}{
+			"name":        p.Name,
+			"in":          p.In,
+			"required":    p.In == "path",
+			"description": p.Description,
+			"schema":      map[string]interface{}{"type": p.Type},
+		})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+	if strings.Contains(r.Body, "/") {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{r.Body: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}},
+		}
+	} else if r.Body != "" {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef(r.Body)}},
+		}
+	}
+
+	var content map[string]interface{}
+	if strings.Contains(r.Response, "/") {
+		content = map[string]interface{}{r.Response: map[string]interface{}{}}
+	} else {
+		content = map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef(r.Response)}}
+	}
+	op["responses"] = map[string]interface{}{
+		"200": map[string]interface{}{"description": "OK", "content": content},
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef("Error")}},
+		},
+	}
+
+	switch r.Scope {
+	case "":
+		op["security"] = []interface{}{}
+	case scopeAdmin:
+		op["description"] = "Requires the admin token."
+		op["security"] = []interface{}{map[string]interface{}{"bearer": []string{}}}
+	case scopeRead:
+		schemes := []interface{}{map[string]interface{}{"bearer": []string{}}}
+		if r.Method == fiber.MethodGet {
+			schemes = append(schemes, map[string]interface{}{"queryToken": []string{}})
+		}
+		op["security"] = schemes
+	}
+	return op
+}
+
+// openAPIOperationID turns "PATCH /collectors/:name" into "patchCollectorsName"
+func openAPIOperationID(r apiRoute) string {
+	id := strings.ToLower(r.Method)
+	for _, word := range pathWord.FindAllString(r.Path, -1) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+func schemaRef(name string) map[string]interface{} {
+	if name == "object" {
+		return map[string]interface{}{"type": "object"}
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+var openAPISchemas = map[string]interface{}{
+	"Error": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"status", "code", "message"},
+		"properties": map[string]interface{}{
+			"status":    map[string]interface{}{"type": "string", "enum": []string{"error"}},
+			"code":      map[string]interface{}{"type": "string", "example": "not_found"},
+			"message":   map[string]interface{}{"type": "string"},
+			"issues":    map[string]interface{}{"type": "array", "items": schemaRef("TemplateIssue"), "description": "invalid display templates only"},
+			"conflicts": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "config imports refused for files that exist"},
+		},
+	},
+	"Ok": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"status": map[string]interface{}{"type": "string", "enum": []string{"ok"}}},
+	},
+	"DataValues": map[string]interface{}{
+		"type":                 "object",
+		"description":          "data key to value, e.g. {\"BatterySoc\": 76}",
+		"additionalProperties": map[string]interface{}{},
+	},
+	"DataEntry": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"value":      map[string]interface{}{},
+			"text":       map[string]interface{}{"type": "string"},
+			"type":       map[string]interface{}{"type": "string"},
+			"unit":       map[string]interface{}{"type": "string"},
+			"source":     map[string]interface{}{"type": "string"},
+			"updated_at": map[string]interface{}{"type": "string", "format": "date-time"},
+			"error":      map[string]interface{}{"type": "string"},
+			"error_at":   map[string]interface{}{"type": "string", "format": "date-time"},
+			"stale":      map[string]interface{}{"type": "boolean"},
+		},
+	},
+	"Config": map[string]interface{}{
+		"type":        "object",
+		"description": "config.json format; the user config holds only the fields it overrides",
+	},
+	"DisplayText": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{"type": "string"},
+			"time": map[string]interface{}{"type": "string", "readOnly": true},
+		},
+	},
+	"Element": map[string]interface{}{
+		"type":        "object",
+		"description": "a display_template element: type (text, fixed_text, icon, graph), position, font, color, data_key, icon_path, ...; enable defaults to 1",
+		"required":    []string{"type"},
+	},
+	"Elements": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"elements": map[string]interface{}{"type": "array", "items": schemaRef("Element")}},
+	},
+	"Page": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "string", "pattern": pageIDPattern.String()},
+			"title":    map[string]interface{}{"type": "string"},
+			"enabled":  map[string]interface{}{"type": "boolean"},
+			"elements": map[string]interface{}{"type": "array", "items": schemaRef("Element")},
+		},
+	},
+	"NewPage": map[string]interface{}{
+		"allOf": []interface{}{
+			schemaRef("Page"),
+			map[string]interface{}{"properties": map[string]interface{}{
+				"position": map[string]interface{}{"type": "integer", "description": "index in the page list, default last"},
+			}},
+		},
+	},
+	"Pages": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"pages": map[string]interface{}{"type": "array", "items": schemaRef("Page")}},
+	},
+	"PageOrder": map[string]interface{}{
+		"type":       "object",
+		"required":   []string{"order"},
+		"properties": map[string]interface{}{"order": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+	},
+	"PageState": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"index":  map[string]interface{}{"type": "integer", "description": "config pages first, then SMS pages"},
+			"total":  map[string]interface{}{"type": "integer"},
+			"id":     map[string]interface{}{"type": "string", "description": "config pages only"},
+			"sms":    map[string]interface{}{"type": "boolean"},
+			"pinned": map[string]interface{}{"type": "boolean"},
+		},
+	},
+	"PageJump": map[string]interface{}{
+		"type":        "object",
+		"description": "exactly one of index, id or sms",
+		"properties": map[string]interface{}{
+			"index": map[string]interface{}{"type": "integer"},
+			"id":    map[string]interface{}{"type": "string"},
+			"sms":   map[string]interface{}{"type": "boolean", "description": "the first SMS page"},
+			"pin":   map[string]interface{}{"type": "boolean", "description": "also pin the page"},
+		},
+	},
+	"TemplateIssue": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":     map[string]interface{}{"type": "string", "description": "e.g. display_template.elements.page0[2].font"},
+			"line":     map[string]interface{}{"type": "integer"},
+			"column":   map[string]interface{}{"type": "integer"},
+			"severity": map[string]interface{}{"type": "string", "enum": []string{"error", "warning"}},
+			"message":  map[string]interface{}{"type": "string"},
+		},
+	},
+	"Validation": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"valid":   map[string]interface{}{"type": "boolean"},
+			"message": map[string]interface{}{"type": "string", "description": "set when the config fails outside the template"},
+			"issues":  map[string]interface{}{"type": "array", "items": schemaRef("TemplateIssue")},
+		},
+	},
+	"Profiles": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"active":   map[string]interface{}{"type": "string", "description": "empty when no profile is active"},
+			"profiles": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	},
+	"ProfileSwitch": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"name"},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string", "description": "profile to apply, empty for none"},
+		},
+	},
+	"BundleImport": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"written": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"skipped": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "identical already, or kept"},
+			"renamed": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}, "description": "bundle path to the path it was written to"},
+		},
+	},
+	"Asset": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"kind":     map[string]interface{}{"type": "string", "enum": []string{"icons", "fonts"}},
+			"name":     map[string]interface{}{"type": "string"},
+			"path":     map[string]interface{}{"type": "string", "description": "icon_path for icons, user/icons/<name>"},
+			"font":     map[string]interface{}{"type": "string", "description": "font name for templates, fonts only"},
+			"size":     map[string]interface{}{"type": "integer"},
+			"modified": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"Assets": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"assets": map[string]interface{}{"type": "array", "items": schemaRef("Asset")}},
+	},
+	"ConfigReload": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"files":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"watching":    map[string]interface{}{"type": "boolean"},
+			"reloads":     map[string]interface{}{"type": "integer"},
+			"last_reload": map[string]interface{}{"type": "string", "format": "date-time"},
+			"last_error":  map[string]interface{}{"type": "string", "description": "the last good config stays in use"},
+			"error_at":    map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"Rotation": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"enabled":                    map[string]interface{}{"type": "boolean"},
+			"dwell_seconds":              map[string]interface{}{"type": "number", "description": "default 10"},
+			"page_dwell_seconds":         map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "number"}, "description": "by page id, \"sms\" for the SMS pages"},
+			"skip_sms":                   map[string]interface{}{"type": "boolean"},
+			"skip_on_battery":            map[string]interface{}{"type": "boolean"},
+			"pause_after_button_seconds": map[string]interface{}{"type": "number", "description": "default 30"},
+			"kiosk":                      map[string]interface{}{"type": "boolean", "description": "always rotate and never dim the screen"},
+		},
+	},
+	"RotationState": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"config":         schemaRef("Rotation"),
+			"rotating":       map[string]interface{}{"type": "boolean"},
+			"paused_seconds": map[string]interface{}{"type": "number", "description": "left of the pause after a button press"},
+			"pinned":         map[string]interface{}{"type": "boolean"},
+		},
+	},
+	"CollectorPatch": map[string]interface{}{
+		"type":       "object",
+		"required":   []string{"enabled"},
+		"properties": map[string]interface{}{"enabled": map[string]interface{}{"type": "boolean"}},
+	},
+	"CollectorHealth": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":                 map[string]interface{}{"type": "string"},
+			"enabled":              map[string]interface{}{"type": "boolean"},
+			"running":              map[string]interface{}{"type": "boolean"},
+			"interval_ms":          map[string]interface{}{"type": "integer"},
+			"timeout_ms":           map[string]interface{}{"type": "integer"},
+			"runs":                 map[string]interface{}{"type": "integer"},
+			"failures":             map[string]interface{}{"type": "integer"},
+			"consecutive_failures": map[string]interface{}{"type": "integer"},
+			"last_run":             map[string]interface{}{"type": "string", "format": "date-time"},
+			"last_duration_ms":     map[string]interface{}{"type": "integer"},
+			"last_success":         map[string]interface{}{"type": "string", "format": "date-time"},
+			"last_error":           map[string]interface{}{"type": "string"},
+			"last_error_at":        map[string]interface{}{"type": "string", "format": "date-time"},
+			"next_run":             map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"Collectors": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"collectors": map[string]interface{}{"type": "array", "items": schemaRef("CollectorHealth")},
+		},
+	},
+}
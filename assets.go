@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/srwiley/oksvg"
+	"golang.org/x/image/font/opentype"
+)
+
+// Uploaded icons and fonts live in a user asset dir next to the user config,
+// /etc/pcat2_mini_display-user_assets, since assetsPrefix belongs to the
+// package. Templates refer to them as user/icons/<name> and fonts by file name.
+const (
+	userAssetPrefix     = "user/"
+	maxIconAssetSize    = 2 << 20
+	maxFontAssetSize    = 12 << 20
+	maxIconDimension    = 2048 // pixels, either side
+	defaultUserFontSize = 18   // like "reg"
+)
+
+var (
+	assetKinds = map[string][]string{
+		"icons": iconExtensions,
+		"fonts": fontExtensions,
+	}
+	fontExtensions   = []string{".ttf", ".otf", ".ttc"}
+	assetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+)
+
+// AssetInfo describes an uploaded file
+type AssetInfo struct {
+	Kind     string    `json:"kind"` // icons or fonts
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`           // icon_path for icons
+	Font     string    `json:"font,omitempty"` // font name to use in templates
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func userAssetsDir() string {
+	path := userConfigFile
+	if strings.HasSuffix(path, "user_config.json") {
+		return strings.TrimSuffix(path, "user_config.json") + "user_assets"
+	}
+	return filepath.Join(filepath.Dir(path), "user_assets")
+}
+
+// assetPath resolves an icon_path or bundle path: user/... in the user asset
+// dir, anything else under assetsPrefix
+func assetPath(rel string) string {
+	if strings.HasPrefix(rel, userAssetPrefix) {
+		return filepath.Join(userAssetsDir(), strings.TrimPrefix(rel, userAssetPrefix))
+	}
+	return filepath.Join(assetsPrefix, rel)
+}
+
+// assetRelPath is the inverse of assetPath for files in either dir
+func assetRelPath(abs string) (string, bool) {
+	if rel, err := filepath.Rel(userAssetsDir(), abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return userAssetPrefix + filepath.ToSlash(rel), true
+	}
+	if rel, err := filepath.Rel(assetsPrefix, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel), true
+	}
+	return "", false
+}
+
+func userAssetPath(kind, name string) string {
+	return filepath.Join(userAssetsDir(), kind, name)
+}
+
+// userFontName is the name an uploaded font goes by in templates
+func userFontName(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+func validateAssetName(kind, name string) error {
+	exts, ok := assetKinds[kind]
+	if !ok {
+		return fmt.Errorf("asset kind must be icons or fonts, got %q", kind)
+	}
+	if !assetNamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("asset name %q must be 1-64 letters, digits, _, - or .", name)
+	}
+	if !containsString(exts, strings.ToLower(path.Ext(name))) {
+		return fmt.Errorf("%s must end in %s, got %q", kind, strings.Join(exts, ", "), name)
+	}
+	return nil
+}
+
+// checkUserAsset makes sure data is what its name says and safe to render.
+// SVGs come back sanitised.
+func checkUserAsset(kind, name string, data []byte) ([]byte, error) {
+	if err := validateAssetName(kind, name); err != nil {
+		return nil, err
+	}
+	return checkAssetData(kind, name, data)
+}
+
+// assetKind tells icons from fonts by the file extension
+func assetKind(name string) (string, bool) {
+	ext := strings.ToLower(path.Ext(name))
+	for kind, exts := range assetKinds {
+		if containsString(exts, ext) {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// checkAssetData is checkUserAsset for a name that was checked already
+func checkAssetData(kind, name string, data []byte) ([]byte, error) {
+	ext := strings.ToLower(path.Ext(name))
+	if kind == "fonts" {
+		if len(data) > maxFontAssetSize {
+			return nil, fmt.Errorf("fonts may be at most %d MB", maxFontAssetSize>>20)
+		}
+		var err error
+		if ext == ".ttc" {
+			_, err = opentype.ParseCollection(data)
+		} else {
+			_, err = opentype.Parse(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a usable font: %v", err)
+		}
+		return data, nil
+	}
+
+	if len(data) > maxIconAssetSize {
+		return nil, fmt.Errorf("icons may be at most %d MB", maxIconAssetSize>>20)
+	}
+	var w, h int
+	if ext == ".svg" {
+		clean, err := sanitizeSVG(data)
+		if err != nil {
+			return nil, err
+		}
+		icon, err := oksvg.ReadIconStream(bytes.NewReader(clean))
+		if err != nil {
+			return nil, fmt.Errorf("not a usable SVG: %v", err)
+		}
+		data, w, h = clean, int(icon.ViewBox.W), int(icon.ViewBox.H)
+	} else {
+		conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("not an image: %v", err)
+		}
+		if want := strings.TrimPrefix(strings.Replace(ext, "jpg", "jpeg", 1), "."); format != want {
+			return nil, fmt.Errorf("%s holds a %s image", name, format)
+		}
+		w, h = conf.Width, conf.Height
+	}
+	if w <= 0 || h <= 0 || w > maxIconDimension || h > maxIconDimension {
+		return nil, fmt.Errorf("icons must be 1-%d pixels on each side, got %dx%d", maxIconDimension, w, h)
+	}
+	return data, nil
+}
+
+// svgDroppedElements can run code or pull in other documents
+var svgDroppedElements = map[string]bool{
+	"script": true, "foreignobject": true, "iframe": true, "object": true, "embed": true, "style": true,
+}
+
+// sanitizeSVG drops scripts, event handlers and references to anything but
+// the document itself. Documents with a DOCTYPE are refused, which rules out
+// entity expansion.
+func sanitizeSVG(data []byte) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+	var out bytes.Buffer
+	skip := 0 // depth inside a dropped element
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("not a valid SVG: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 || svgDroppedElements[strings.ToLower(t.Name.Local)] {
+				skip++
+				continue
+			}
+			out.WriteString("<" + xmlName(t.Name))
+			for _, attr := range t.Attr {
+				if !svgAttrAllowed(attr) {
+					continue
+				}
+				out.WriteString(" " + xmlName(attr.Name) + `="`)
+				xml.EscapeText(&out, []byte(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			out.WriteString("</" + xmlName(t.Name) + ">")
+		case xml.CharData:
+			if skip == 0 {
+				xml.EscapeText(&out, t)
+			}
+		case xml.ProcInst:
+			if t.Target == "xml" && skip == 0 {
+				out.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+		case xml.Directive:
+			return nil, fmt.Errorf("SVGs with a DOCTYPE or entities are not accepted")
+		}
+	}
+	if !bytes.Contains(out.Bytes(), []byte("<svg")) {
+		return nil, fmt.Errorf("not a valid SVG: no <svg> element")
+	}
+	return out.Bytes(), nil
+}
+
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+func svgAttrAllowed(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	value := strings.ToLower(strings.TrimSpace(attr.Value))
+	if strings.HasPrefix(name, "on") || strings.Contains(value, "javascript:") {
+		return false
+	}
+	if name == "href" && !strings.HasPrefix(value, "#") {
+		return false
+	}
+	// url(...) may only point inside the document
+	for rest := value; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			break
+		}
+		rest = strings.TrimLeft(rest[i+4:], ` '"`)
+		if !strings.HasPrefix(rest, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// listUserAssets returns the uploaded files of a kind, "" for all
+func listUserAssets(kind string) ([]AssetInfo, error) {
+	kinds := []string{"fonts", "icons"}
+	if kind != "" {
+		kinds = []string{kind}
+	}
+	assets := []AssetInfo{}
+	for _, k := range kinds {
+		entries, err := os.ReadDir(filepath.Join(userAssetsDir(), k))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || validateAssetName(k, e.Name()) != nil {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			assets = append(assets, assetInfo(k, e.Name(), info))
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Path < assets[j].Path })
+	return assets, nil
+}
+
+func assetInfo(kind, name string, info os.FileInfo) AssetInfo {
+	a := AssetInfo{Kind: kind, Name: name, Path: userAssetPrefix + kind + "/" + name, Size: info.Size(), Modified: info.ModTime()}
+	if kind == "fonts" {
+		a.Font = userFontName(name)
+	}
+	return a
+}
+
+// assetUsers lists the elements and fonts that need the asset, in the
+// config in use and in every saved profile, as switching to one would bring
+// them back
+func assetUsers(kind, name string) []string {
+	configMutex.RLock()
+	users := configAssetUsers(cfg, kind, name, "")
+	configMutex.RUnlock()
+
+	profiles, err := listProfiles()
+	if err != nil {
+		log.Printf("asset users: %v", err)
+	}
+	for _, profile := range profiles {
+		p, err := readProfile(profile)
+		if err != nil {
+			log.Printf("asset users: profile %s: %v", profile, err)
+			continue
+		}
+		users = append(users, configAssetUsers(p.conf, kind, name, "profiles."+profile+".")...)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// configAssetUsers lists the elements and fonts of c that need the asset,
+// each path prefixed with prefix
+func configAssetUsers(c Config, kind, name, prefix string) []string {
+	iconPath, fontName := userAssetPrefix+kind+"/"+name, userFontName(name)
+	var users []string
+	for id, elems := range c.DisplayTemplate.Elements {
+		for i, e := range elems {
+			if kind == "icons" && e.Type == "icon" && e.IconPath == iconPath ||
+				kind == "fonts" && e.Type != "icon" && (e.Font == fontName || e.UnitsFont == fontName) {
+				users = append(users, fmt.Sprintf("%sdisplay_template.elements.%s[%d]", prefix, id, i))
+			}
+		}
+	}
+	for font, def := range c.Fonts {
+		if def.Path == iconPath {
+			users = append(users, fmt.Sprintf("%sfonts.%s.path", prefix, font))
+		} else if kind == "fonts" && containsString(def.Fallback, fontName) {
+			users = append(users, fmt.Sprintf("%sfonts.%s.fallback", prefix, font))
+		}
+	}
+	return users
+}
+
+// assetsChanged makes new and replaced files show on the next frame
+func assetsChanged(kind string) {
+	if kind == "fonts" {
+		initFonts()
+	}
+	invalidateRenderCaches()
+}
+
+// GET /api/v2/assets?kind=icons
+func listAssetsV2(c *fiber.Ctx) error {
+	kind := c.Query("kind")
+	if _, ok := assetKinds[kind]; kind != "" && !ok {
+		return apiError(c, fiber.StatusBadRequest, fmt.Sprintf("kind must be icons or fonts, got %q", kind))
+	}
+	assets, err := listUserAssets(kind)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"assets": assets})
+}
+
+// GET /api/v2/assets/:kind/:name
+func getAssetV2(c *fiber.Ctx) error {
+	kind, name := c.Params("kind"), c.Params("name")
+	if err := validateAssetName(kind, name); err != nil {
+		return apiError(c, fiber.StatusNotFound, err.Error())
+	}
+	data, err := os.ReadFile(userAssetPath(kind, name))
+	if os.IsNotExist(err) {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no %s/%s", kind, name))
+	} else if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	c.Type(strings.TrimPrefix(path.Ext(name), "."))
+	return c.Send(data)
+}
+
+// PUT /api/v2/assets/:kind/:name
+// Body: the file itself
+func putAssetV2(c *fiber.Ctx) error {
+	kind, name := c.Params("kind"), c.Params("name")
+	if err := validateAssetName(kind, name); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if kind == "fonts" {
+		if _, ok := builtinFonts()[userFontName(name)]; ok {
+			return apiError(c, fiber.StatusConflict, fmt.Sprintf("%q is a built-in font name", userFontName(name)))
+		}
+	}
+	data, err := checkUserAsset(kind, name, c.Body())
+	if err != nil {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	if _, err := writeAssetFiles(map[string][]byte{userAssetPrefix + kind + "/" + name: data}); err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	assetsChanged(kind)
+	info, err := os.Stat(userAssetPath(kind, name))
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(assetInfo(kind, name, info))
+}
+
+// DELETE /api/v2/assets/:kind/:name
+func deleteAssetV2(c *fiber.Ctx) error {
+	kind, name := c.Params("kind"), c.Params("name")
+	if err := validateAssetName(kind, name); err != nil {
+		return apiError(c, fiber.StatusNotFound, err.Error())
+	}
+	if users := assetUsers(kind, name); len(users) > 0 {
+		return apiError(c, fiber.StatusConflict, fmt.Sprintf("%s/%s is used by %s", kind, name, strings.Join(users, ", ")))
+	}
+	if err := os.Remove(userAssetPath(kind, name)); os.IsNotExist(err) {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no %s/%s", kind, name))
+	} else if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	assetsChanged(kind)
+	return c.JSON(fiber.Map{"status": "ok"})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const (
+	ETC_AUTH_TOKENS_PATH = "/etc/pcat2_mini_display-auth.json"
+
+	scopeRead  = "read"
+	scopeAdmin = "admin"
+
+	defaultRateLimitPerMinute = 30
+	// signed requests older or newer than this are refused
+	hmacMaxSkew = 5 * time.Minute
+
+	headerTimestamp = "X-Pcat-Timestamp"
+	headerSignature = "X-Pcat-Signature"
+)
+
+// AuthConfig is the "auth" config section. Tokens are not part of the config,
+// which the API serves back; they live in authTokensPath.
+type AuthConfig struct {
+	Enabled            *bool `json:"enabled,omitempty"`         // default true
+	AllowLocalhost     *bool `json:"allow_localhost,omitempty"` // default true, requests from the device itself need no token
+	PublicRead         *bool `json:"public_read,omitempty"`     // read-only endpoints need no token
+	RateLimitPerMinute int   `json:"rate_limit_per_minute,omitempty"`
+}
+
+func (a AuthConfig) enabled() bool        { return a.Enabled == nil || *a.Enabled }
+func (a AuthConfig) allowLocalhost() bool { return a.AllowLocalhost == nil || *a.AllowLocalhost }
+func (a AuthConfig) publicRead() bool     { return a.PublicRead != nil && *a.PublicRead }
+
+func (a AuthConfig) rateLimit() int {
+	if a.RateLimitPerMinute > 0 {
+		return a.RateLimitPerMinute
+	}
+	return defaultRateLimitPerMinute
+}
+
+// authSettings returns the auth section of the merged config
+func authSettings() AuthConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return cfg.Auth
+}
+
+// AuthTokens are the shared secrets, one per scope. The admin token also
+// grants read access.
+type AuthTokens struct {
+	Admin string `json:"admin_token"`
+	Read  string `json:"read_token"`
+}
+
+var (
+	authTokensMu   sync.RWMutex
+	authTokens     AuthTokens // guarded by authTokensMu
+	authTokensPath = ETC_AUTH_TOKENS_PATH
+)
+
+func currentAuthTokens() AuthTokens {
+	authTokensMu.RLock()
+	defer authTokensMu.RUnlock()
+	return authTokens
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadOrCreateAuthTokens reads the token file, creating it with fresh tokens on
+// first run. Missing tokens in an existing file are filled in.
+func loadOrCreateAuthTokens(path string) (AuthTokens, error) {
+	var tokens AuthTokens
+	raw, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(raw, &tokens); err != nil {
+			return AuthTokens{}, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if tokens.Admin != "" && tokens.Read != "" {
+			return tokens, nil
+		}
+	case !os.IsNotExist(err):
+		return AuthTokens{}, err
+	}
+
+	for _, t := range []*string{&tokens.Admin, &tokens.Read} {
+		if *t == "" {
+			if *t, err = generateToken(); err != nil {
+				return AuthTokens{}, err
+			}
+		}
+	}
+	out, _ := json.MarshalIndent(tokens, "", "    ")
+	if err := os.WriteFile(path, out, 0600); err != nil {
+		return AuthTokens{}, fmt.Errorf("write %s: %w", path, err)
+	}
+	log.Printf("🔑 Generated API tokens in %s", path)
+	return tokens, nil
+}
+
+// applyAuth loads the tokens once auth is on, so a reload that turns it on
+// doesn't leave every request that needs a token refused
+func applyAuth(auth AuthConfig) {
+	if auth.enabled() && currentAuthTokens() == (AuthTokens{}) {
+		initAuth()
+	}
+}
+
+// initAuth loads the tokens when auth is on. Without tokens every request that
+// needs one is refused.
+func initAuth() {
+	if !authSettings().enabled() {
+		log.Println("⚠️ HTTP API authentication is disabled")
+		return
+	}
+	tokens, err := loadOrCreateAuthTokens(authTokensPath)
+	if err != nil {
+		log.Printf("❌ API tokens unavailable, only unauthenticated access that the config allows will work: %v", err)
+		return
+	}
+	authTokensMu.Lock()
+	authTokens = tokens
+	authTokensMu.Unlock()
+}
+
+// tokenScope returns the scope a token grants, or "" for no match
+func tokenScope(token string) string {
+	authTokens := currentAuthTokens()
+	switch {
+	case token == "":
+		return ""
+	case authTokens.Admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(authTokens.Admin)) == 1:
+		return scopeAdmin
+	case authTokens.Read != "" && subtle.ConstantTimeCompare([]byte(token), []byte(authTokens.Read)) == 1:
+		return scopeRead
+	}
+	return ""
+}
+
+// requestSignature is hex(HMAC-SHA256(token, METHOD \n URI \n timestamp \n hex(SHA256(body))))
+func requestSignature(token, method, uri, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(token))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, uri, timestamp, hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureScope checks a signed request against both tokens
+func signatureScope(method, uri, timestamp, signature string, body []byte, now time.Time) (string, error) {
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("bad %s", headerTimestamp)
+	}
+	if skew := now.Sub(time.Unix(secs, 0)); skew > hmacMaxSkew || skew < -hmacMaxSkew {
+		return "", errors.New("request timestamp too far from the device clock")
+	}
+	authTokens := currentAuthTokens()
+	for _, candidate := range []struct{ token, scope string }{
+		{authTokens.Admin, scopeAdmin},
+		{authTokens.Read, scopeRead},
+	} {
+		if candidate.token == "" {
+			continue
+		}
+		want := requestSignature(candidate.token, method, uri, timestamp, body)
+		if hmac.Equal([]byte(strings.ToLower(signature)), []byte(want)) {
+			return candidate.scope, nil
+		}
+	}
+	return "", errors.New("bad signature")
+}
+
+// requestScope works out what the caller may do. Bearer tokens and signatures
+// are accepted everywhere; ?token= only on GET, for <img> and EventSource,
+// which can't set headers. A token in the URL ends up in logs and browser
+// history, and some v1 admin actions are GETs, so it never grants more than
+// read.
+func requestScope(c *fiber.Ctx, auth AuthConfig) (string, error) {
+	if auth.allowLocalhost() {
+		if ip := net.ParseIP(c.IP()); ip != nil && ip.IsLoopback() {
+			return scopeAdmin, nil
+		}
+	}
+	if sig := c.Get(headerSignature); sig != "" {
+		return signatureScope(c.Method(), c.OriginalURL(), c.Get(headerTimestamp), sig, c.Body(), time.Now())
+	}
+	token, inQuery := "", false
+	if h := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	} else if c.Method() == fiber.MethodGet {
+		token, inQuery = c.Query("token"), true
+	}
+	if token == "" {
+		return "", nil
+	}
+	scope := tokenScope(token)
+	if scope == "" {
+		return "", errors.New("invalid token")
+	}
+	if inQuery {
+		return scopeRead, nil
+	}
+	return scope, nil
+}
+
+// requireScope guards a route: 401 without a valid token, 403 when a read
+// token is used on an admin route
+func requireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		auth := authSettings()
+		if !auth.enabled() {
+			return c.Next()
+		}
+		granted, err := requestScope(c, auth)
+		if err != nil {
+			return apiError(c, fiber.StatusUnauthorized, err.Error())
+		}
+		if granted == "" && scope == scopeRead && auth.publicRead() {
+			return c.Next()
+		}
+		switch {
+		case granted == "":
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="pcat2"`)
+			return apiError(c, fiber.StatusUnauthorized, "token required")
+		case scope == scopeAdmin && granted != scopeAdmin:
+			return apiError(c, fiber.StatusForbidden, "admin token required")
+		}
+		return c.Next()
+	}
+}
+
+// adminRateLimiter caps how often one client may call mutating endpoints. A
+// reload that changes rate_limit_per_minute starts a new limiter.
+func adminRateLimiter() fiber.Handler {
+	var (
+		mu      sync.Mutex
+		max     int
+		handler fiber.Handler
+	)
+	return func(c *fiber.Ctx) error {
+		limit := authSettings().rateLimit()
+		mu.Lock()
+		if handler == nil || limit != max {
+			max, handler = limit, newRateLimiter(limit)
+		}
+		h := handler
+		mu.Unlock()
+		return h(c)
+	}
+}
+
+func newRateLimiter(max int) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: time.Minute,
+		Next: func(c *fiber.Ctx) bool {
+			auth := authSettings()
+			if !auth.enabled() {
+				return true
+			}
+			ip := net.ParseIP(c.IP())
+			return auth.allowLocalhost() && ip != nil && ip.IsLoopback()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return apiError(c, fiber.StatusTooManyRequests, "too many requests, slow down")
+		},
+	})
+}
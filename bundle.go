@@ -0,0 +1,515 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// A bundle moves a layout between devices: a zip of the user config and the
+// icon and font files it uses, stored by their path under assetsPrefix or,
+// for uploads, as user/icons/... and user/fonts/...
+const (
+	bundleConfigName  = "user_config.json"
+	maxBundleSize     = 16 << 20 // the zip as uploaded
+	maxBundleExpanded = 64 << 20 // all files unpacked
+	maxBundleFiles    = 256
+)
+
+var bundleAssetExtensions = []string{".svg", ".png", ".jpg", ".jpeg", ".gif", ".ttf", ".otf", ".ttc"}
+
+// what import does with a file that exists with other content
+const (
+	conflictFail      = "fail" // refuse the import, the default
+	conflictKeep      = "keep"
+	conflictOverwrite = "overwrite" // uploads only; files under assets/ stay conflicts
+	conflictRename    = "rename"    // import as name-2.svg and point the config there
+)
+
+var conflictModes = []string{conflictFail, conflictKeep, conflictOverwrite, conflictRename}
+
+// BundleImport is what an import did with the files in the bundle
+type BundleImport struct {
+	Written []string          `json:"written"`
+	Skipped []string          `json:"skipped"` // identical already, or kept
+	Renamed map[string]string `json:"renamed,omitempty"`
+}
+
+// bundleConflicts lists the files an import refused to replace
+type bundleConflicts []string
+
+func (e bundleConflicts) Error() string {
+	return fmt.Sprintf("%d files exist with other content: %s", len(e), strings.Join(e, ", "))
+}
+
+// bundleConfigError is a bundle whose config doesn't validate
+type bundleConfigError struct{ err error }
+
+func (e bundleConfigError) Error() string { return bundleConfigName + ": " + e.err.Error() }
+func (e bundleConfigError) Unwrap() error { return e.err }
+
+// bundleAssets returns the asset files that user needs: its icons, and the
+// files of fonts it defines or uses, and their fallbacks, that don't ship with
+// the display
+func bundleAssets(user Config) ([]string, error) {
+	stock := make(map[string]bool)
+	for _, f := range builtinFonts() {
+		stock[f.FontPath] = true
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	add := func(rel string) error {
+		rel = filepath.ToSlash(filepath.Clean(rel))
+		if seen[rel] {
+			return nil
+		}
+		if err := checkBundlePath(rel); err != nil {
+			return err
+		}
+		if _, err := os.Stat(assetPath(rel)); err != nil {
+			return err
+		}
+		seen[rel] = true
+		files = append(files, rel)
+		return nil
+	}
+	fontTable, err := buildFontTable(mergeFontDefs(dftCfg.Fonts, user.Fonts))
+	if err != nil {
+		return nil, err
+	}
+	addFontFile := func(name string) error {
+		f, ok := fontTable[name]
+		if name == "" || !ok || stock[f.FontPath] {
+			return nil
+		}
+		rel, ok := assetRelPath(f.FontPath)
+		if !ok {
+			return fmt.Errorf("font %s: %s is outside %s and %s", name, f.FontPath, assetsPrefix, userAssetsDir())
+		}
+		return add(rel)
+	}
+	// a font and its fallbacks, which may be new even for built-in fonts
+	addFont := func(name string) error {
+		if err := addFontFile(name); err != nil {
+			return err
+		}
+		for _, fb := range fontTable[name].Fallback {
+			if err := addFontFile(fb); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for id, elems := range user.DisplayTemplate.Elements {
+		for i, e := range elems {
+			var err error
+			switch e.Type {
+			case "icon":
+				err = add(e.IconPath)
+			case "text":
+				if err = addFont(e.Font); err == nil {
+					err = addFont(e.UnitsFont)
+				}
+			case "fixed_text":
+				err = addFont(e.Font)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("display_template.elements.%s[%d]: %w", id, i, err)
+			}
+		}
+	}
+	// fonts defined for pages to come, or for other profiles, travel too
+	fontNames := make([]string, 0, len(user.Fonts))
+	for name := range user.Fonts {
+		fontNames = append(fontNames, name)
+	}
+	sort.Strings(fontNames)
+	for _, name := range fontNames {
+		if err := addFont(name); err != nil {
+			return nil, fmt.Errorf("fonts.%s: %w", name, err)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// checkBundlePath accepts relative paths below assets/ with an asset
+// extension, and uploads as user/<kind>/<name>
+func checkBundlePath(rel string) error {
+	if !path.IsAbs(rel) && path.Clean(rel) == rel && strings.HasPrefix(rel, userAssetPrefix) {
+		dir, name := path.Split(strings.TrimPrefix(rel, userAssetPrefix))
+		return validateAssetName(strings.TrimSuffix(dir, "/"), name)
+	}
+	if path.IsAbs(rel) || path.Clean(rel) != rel || !strings.HasPrefix(rel, "assets/") {
+		return fmt.Errorf("%q is not a path under assets/ or user/", rel)
+	}
+	if !containsString(bundleAssetExtensions, strings.ToLower(path.Ext(rel))) {
+		return fmt.Errorf("%q: only %s files can be bundled", rel, strings.Join(bundleAssetExtensions, ", "))
+	}
+	return nil
+}
+
+// writeBundle zips userRaw, a user config, with the assets it uses
+func writeBundle(w io.Writer, userRaw []byte) error {
+	var user Config
+	if err := secureUnmarshal(userRaw, &user); err != nil {
+		return err
+	}
+	files, err := bundleAssets(user)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	add := func(name string, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	if err := add(bundleConfigName, userRaw); err != nil {
+		return err
+	}
+	for _, rel := range files {
+		data, err := os.ReadFile(assetPath(rel))
+		if err != nil {
+			return err
+		}
+		if err := add(rel, data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// readBundle unpacks a bundle, refusing anything but the user config and
+// asset files, and archives that unpack too large
+func readBundle(data []byte) ([]byte, map[string][]byte, error) {
+	if len(data) > maxBundleSize {
+		return nil, nil, fmt.Errorf("bundle is larger than %d MB", maxBundleSize>>20)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	if len(zr.File) > maxBundleFiles+1 {
+		return nil, nil, fmt.Errorf("bundle has %d files, at most %d assets are allowed", len(zr.File), maxBundleFiles)
+	}
+
+	var userRaw []byte
+	files := make(map[string][]byte)
+	var total int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Name != bundleConfigName {
+			if err := checkBundlePath(f.Name); err != nil {
+				return nil, nil, err
+			}
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		// the header sizes can lie, so count what is actually read
+		content, err := io.ReadAll(io.LimitReader(rc, maxBundleExpanded-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if total += int64(len(content)); total > maxBundleExpanded {
+			return nil, nil, fmt.Errorf("bundle unpacks to more than %d MB", maxBundleExpanded>>20)
+		}
+		if f.Name == bundleConfigName {
+			userRaw = content
+			continue
+		}
+		// every asset gets the checks an upload through the API gets
+		kind, ok := assetKind(f.Name)
+		if !ok {
+			return nil, nil, fmt.Errorf("%q is not an icon or font", f.Name)
+		}
+		if content, err = checkAssetData(kind, f.Name, content); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		files[f.Name] = content
+	}
+	if userRaw == nil {
+		return nil, nil, fmt.Errorf("bundle has no %s", bundleConfigName)
+	}
+	if err := validateJSON(userRaw); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", bundleConfigName, err)
+	}
+	return userRaw, files, nil
+}
+
+// importBundle writes the bundle's assets where they belong and makes its
+// config the user config. If the config doesn't validate, the assets written
+// are taken back.
+func importBundle(data []byte, onConflict string) (BundleImport, error) {
+	result := BundleImport{Written: []string{}, Skipped: []string{}}
+	if onConflict == "" {
+		onConflict = conflictFail
+	}
+	if !containsString(conflictModes, onConflict) {
+		return result, fmt.Errorf("on_conflict must be one of %s, got %q", strings.Join(conflictModes, ", "), onConflict)
+	}
+	userRaw, files, err := readBundle(data)
+	if err != nil {
+		return result, err
+	}
+	overrides := map[string]interface{}{}
+	if err := secureUnmarshal(userRaw, &overrides); err != nil {
+		return result, fmt.Errorf("%s: %w", bundleConfigName, err)
+	}
+	if err := checkNoExternalCollectors(overrides); err != nil {
+		return result, fmt.Errorf("%s: %w", bundleConfigName, err)
+	}
+
+	names := make([]string, 0, len(files))
+	for rel := range files {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+
+	writes := make(map[string][]byte)
+	var conflicts bundleConflicts
+	for _, rel := range names {
+		existing, err := os.ReadFile(assetPath(rel))
+		switch {
+		case os.IsNotExist(err):
+			writes[rel] = files[rel]
+		case err != nil:
+			return result, err
+		case sameAsset(rel, existing, files[rel]):
+			result.Skipped = append(result.Skipped, rel)
+		case onConflict == conflictKeep:
+			result.Skipped = append(result.Skipped, rel)
+		case onConflict == conflictOverwrite && strings.HasPrefix(rel, userAssetPrefix):
+			// files under assets/ ship with the display, so only uploads are replaced
+			writes[rel] = files[rel]
+		case onConflict == conflictRename:
+			renamed := freeAssetPath(rel, files)
+			writes[renamed] = files[rel]
+			if result.Renamed == nil {
+				result.Renamed = make(map[string]string)
+			}
+			result.Renamed[rel] = renamed
+			replaceStrings(overrides, rel, renamed)
+			if strings.HasPrefix(rel, userAssetPrefix+"fonts/") {
+				replaceFontName(overrides, userFontName(path.Base(rel)), userFontName(path.Base(renamed)))
+			}
+		default:
+			conflicts = append(conflicts, rel)
+		}
+	}
+	if conflicts != nil {
+		return result, conflicts
+	}
+
+	restore, err := writeAssetFiles(writes)
+	if err != nil {
+		restore()
+		return result, err
+	}
+	if err := applyUserOverrides(overrides); err != nil {
+		restore()
+		if templateErrs, ok := err.(TemplateErrors); ok {
+			locateIssues(templateErrs, userRaw, bundleConfigName)
+		}
+		return result, bundleConfigError{err}
+	}
+	for rel := range writes {
+		result.Written = append(result.Written, rel)
+	}
+	sort.Strings(result.Written)
+	invalidateRenderCaches()
+	return result, nil
+}
+
+// sameAsset tells whether the file on disk is the bundled one. Bundled SVGs
+// are sanitised, so an SVG on disk that sanitises to the same counts too.
+func sameAsset(rel string, existing, bundled []byte) bool {
+	if bytes.Equal(existing, bundled) {
+		return true
+	}
+	if strings.ToLower(path.Ext(rel)) != ".svg" {
+		return false
+	}
+	clean, err := sanitizeSVG(existing)
+	return err == nil && bytes.Equal(clean, bundled)
+}
+
+// freeAssetPath returns rel with a -N suffix that is neither on disk nor in
+// the bundle
+func freeAssetPath(rel string, bundled map[string][]byte) string {
+	ext := path.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, n, ext)
+		if _, inBundle := bundled[candidate]; inBundle {
+			continue
+		}
+		if _, err := os.Stat(assetPath(candidate)); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// replaceStrings replaces every string value old in a decoded JSON value
+func replaceStrings(v interface{}, old, new string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && s == old {
+				v[key] = new
+			} else {
+				replaceStrings(item, old, new)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if s, ok := item.(string); ok && s == old {
+				v[i] = new
+			} else {
+				replaceStrings(item, old, new)
+			}
+		}
+	}
+}
+
+// replaceFontName points the font fields naming old at new
+func replaceFontName(v interface{}, old, new string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && s == old && (key == "font" || key == "units_font") {
+				v[key] = new
+			} else {
+				replaceFontName(item, old, new)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			replaceFontName(item, old, new)
+		}
+	}
+}
+
+// writeAssetFiles writes files by their bundle path. restore puts back what
+// was there before.
+func writeAssetFiles(files map[string][]byte) (restore func(), err error) {
+	type previous struct {
+		data    []byte
+		existed bool
+	}
+	saved := make(map[string]previous)
+	restore = func() {
+		for dst, prev := range saved {
+			if prev.existed {
+				os.WriteFile(dst, prev.data, 0644)
+			} else {
+				os.Remove(dst)
+			}
+		}
+	}
+
+	for rel, data := range files {
+		dst := assetPath(rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return restore, err
+		}
+		old, readErr := os.ReadFile(dst)
+		saved[dst] = previous{data: old, existed: readErr == nil}
+		tmpPath := dst + ".tmp"
+		if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+			return restore, err
+		}
+		if err := os.Rename(tmpPath, dst); err != nil {
+			os.Remove(tmpPath)
+			return restore, err
+		}
+	}
+	return restore, nil
+}
+
+// GET /api/v2/config/export
+// The user config over the active profile, with the assets it uses.
+func exportConfigV2(c *fiber.Ctx) error {
+	overrides, err := exportOverrides()
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	userRaw, err := json.MarshalIndent(overrides, "", "    ")
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, userRaw); err != nil {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="pcat2_display_layout.zip"`)
+	return c.Send(buf.Bytes())
+}
+
+// exportOverrides returns what the display shows on top of config.json: the
+// user config laid over the active profile, as page edits made under a profile
+// are saved in the profile
+func exportOverrides() (map[string]interface{}, error) {
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	user, err := readUserOverrides()
+	if err != nil {
+		return nil, err
+	}
+	name := activeProfileName()
+	if name == "" {
+		return user, nil
+	}
+	profile, err := readProfileOverrides(name)
+	if err != nil {
+		return nil, err
+	}
+	delete(profile, "external_collectors")
+	overrides := deepMerge(profile, user)
+	if mqtt, ok := user["mqtt"]; ok {
+		// the user's mqtt section replaces the profile's as a whole
+		overrides["mqtt"] = mqtt
+	}
+	return overrides, nil
+}
+
+// POST /api/v2/config/import?on_conflict=fail|keep|overwrite|rename
+// Body: a bundle from /config/export. Replaces the user config.
+func importConfigV2(c *fiber.Ctx) error {
+	result, err := importBundle(c.Body(), c.Query("on_conflict"))
+	if conflicts, ok := err.(bundleConflicts); ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status": "error", "code": "conflict", "message": err.Error(), "conflicts": []string(conflicts),
+		})
+	}
+	if configErr, ok := err.(bundleConfigError); ok {
+		return apiConfigError(c, configErr.err, nil)
+	}
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	return c.JSON(result)
+}
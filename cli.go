@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// runSubcommand dispatches `pcat2_mini_display <name> ...` invocations that run
+// once and exit instead of starting the display service. It reports whether
+// name was a known subcommand.
+func runSubcommand(name string, args []string) bool {
+	var err error
+	switch name {
+	case "render":
+		err = runRenderCommand(args)
+	case "record":
+		err = runRecordCommand(args)
+	case "token":
+		err = runTokenCommand(args)
+	case "validate":
+		err = runValidateCommand(args)
+	case "export":
+		err = runExportCommand(args)
+	case "import":
+		err = runImportCommand(args)
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return true
+}
+
+// runRenderCommand renders one config page, with top bar and footer, to a PNG.
+// No hardware is opened and no collectors are started; values come from --data.
+func runRenderCommand(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "default config to render")
+	userPath := fs.String("user", "", "optional user config overlaid on --config, as on the device")
+	dataPath := fs.String("data", "", "JSON snapshot of data values, e.g. saved from /api/v1/go_data.json")
+	page := fs.Int("page", 0, "index of the config page to render")
+	out := fs.String("out", "", "output PNG (default page<N>.png)")
+	assets := fs.String("assets", "", "directory containing assets/ (default: auto-detect)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *assets != "" {
+		assetsPrefix = *assets
+	} else {
+		resolveAssetsPrefix()
+	}
+	initFonts()
+	imageCache = make(map[string]*image.RGBA)
+
+	var err error
+	if dftCfg, err = loadConfig(*configPath); err != nil {
+		return fmt.Errorf("load %s: %w", *configPath, err)
+	}
+	userCfg = Config{}
+	if *userPath != "" {
+		if userCfg, err = loadConfig(*userPath); err != nil {
+			return fmt.Errorf("load %s: %w", *userPath, err)
+		}
+	}
+	if err := mergeConfigs(); err != nil {
+		return fmt.Errorf("merge configs: %w", err)
+	}
+
+	if *page < 0 || *page >= cfgNumPages {
+		return fmt.Errorf("page %d out of range, config has %d pages", *page, cfgNumPages)
+	}
+
+	if *dataPath != "" {
+		snapshot, err := loadDataSnapshot(*dataPath)
+		if err != nil {
+			return err
+		}
+		data := globalData.Source("snapshot")
+		for key, value := range snapshot {
+			data.Store(key, value)
+		}
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("page%d.png", *page)
+	}
+
+	// Push the three areas through the normal send path into a virtual display,
+	// so the composite is exactly what the panel would receive.
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+
+	topBar := image.NewRGBA(image.Rect(0, 0, topBarFrameWidth, topBarFrameHeight))
+	drawTopBar(vd, topBar)
+
+	middle := image.NewRGBA(image.Rect(0, 0, middleFrameWidth, middleFrameHeight))
+	clearFrame(middle, middleFrameWidth, middleFrameHeight)
+	renderMiddle(middle, &cfg, false, *page)
+	sendMiddle(vd, middle)
+
+	footer := image.NewRGBA(image.Rect(0, 0, footerFrameWidth, footerFrameHeight))
+	drawFooter(vd, footer, *page, cfgNumPages, false)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, vd.Snapshot()); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", *out, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Saved %s", *out)
+	return nil
+}
+
+// runRecordCommand asks a running instance for a GIF recording of its screen.
+// With --change-page it also triggers a page change so the transition is captured.
+func runRecordCommand(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8081", "address of the running display service")
+	seconds := fs.Int("seconds", 5, fmt.Sprintf("recording length, 1-%d", maxRecordSeconds))
+	out := fs.String("out", "recording.gif", "output GIF")
+	changePage := fs.Bool("change-page", false, "trigger a page change shortly after recording starts")
+	token := fs.String("token", "", "API token; not needed on the device itself, --change-page needs the admin token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *seconds < 1 || *seconds > maxRecordSeconds {
+		return fmt.Errorf("--seconds must be between 1 and %d", maxRecordSeconds)
+	}
+
+	client := &http.Client{Timeout: time.Duration(*seconds)*time.Second + 30*time.Second}
+	base := "http://" + *addr
+	get := func(url string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if *token != "" {
+			req.Header.Set("Authorization", "Bearer "+*token)
+		}
+		return client.Do(req)
+	}
+
+	if *changePage {
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			if resp, err := get(base + "/api/v1/go_changePage"); err == nil {
+				resp.Body.Close()
+			} else {
+				log.Printf("change page: %v", err)
+			}
+		}()
+	}
+
+	resp, err := get(fmt.Sprintf("%s/api/v1/go_record.gif?seconds=%d", base, *seconds))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Saved %s (%d KB)", *out, n/1024)
+	return nil
+}
+
+// runTokenCommand prints the API tokens, generating them if the service hasn't
+// run yet. Only root can read the token file.
+func runTokenCommand(args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	path := fs.String("file", ETC_AUTH_TOKENS_PATH, "token file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tokens, err := loadOrCreateAuthTokens(*path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("admin: %s\nread:  %s\n", tokens.Admin, tokens.Read)
+	return nil
+}
+
+// runValidateCommand checks a config, and the user config overlaid on it, the
+// way the service does on load and on save. Problems are printed as
+// file:line:col: path: severity: message; only errors fail the command.
+func runValidateCommand(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "default config to check")
+	userPath := fs.String("user", "", "optional user config overlaid on --config")
+	profilePath := fs.String("profile", "", "optional profile file between --config and --user")
+	assets := fs.String("assets", "", "directory containing assets/ (default: auto-detect)")
+	schema := fs.Bool("schema", false, "print the JSON Schema of display_template and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// a file named without --user would otherwise go unchecked and pass
+	if fs.NArg() > 0 {
+		return fmt.Errorf("validate takes no arguments, got %q; pass a user config with --user", fs.Arg(0))
+	}
+
+	if *assets != "" {
+		assetsPrefix = *assets
+	} else {
+		resolveAssetsPrefix()
+	}
+	initFonts()
+	if *schema {
+		out, err := json.MarshalIndent(templateSchema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	dft, dftRaw, err := readConfigFile(*configPath, false)
+	if err != nil {
+		return err
+	}
+	profileRaw := []byte("{}")
+	if *profilePath != "" {
+		var profile Config
+		if profile, profileRaw, err = readConfigFile(*profilePath, false); err != nil {
+			return err
+		}
+		var keys map[string]interface{}
+		json.Unmarshal(profileRaw, &keys)
+		_, hasShowSms := keys["show_sms"]
+		dft = overlayConfig(dft, profile, hasShowSms)
+	}
+	var user Config
+	userRaw := []byte("{}")
+	if *userPath != "" {
+		if user, userRaw, err = readConfigFile(*userPath, false); err != nil {
+			return err
+		}
+	}
+	var keys map[string]interface{}
+	json.Unmarshal(userRaw, &keys)
+	_, hasShowSms := keys["show_sms"]
+
+	merged, err := buildConfig(dft, user, hasShowSms)
+	var issues TemplateErrors
+	if !errors.As(err, &issues) {
+		if err != nil {
+			return err
+		}
+		issues = templateIssues(merged)
+	}
+	if *userPath != "" {
+		locateIssues(issues, userRaw, *userPath)
+	}
+	if *profilePath != "" {
+		locateIssues(issues, profileRaw, *profilePath)
+	}
+	locateIssues(issues, dftRaw, *configPath)
+
+	errCount := 0
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if issue.Severity == "error" {
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("%d errors in the display template", errCount)
+	}
+	return nil
+}
+
+// runExportCommand writes a user config and the assets it uses to a zip
+// that import, or POST /api/v2/config/import, takes on another device
+func runExportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	userPath := fs.String("user", ETC_USER_CONFIG_PATH, "user config to export")
+	out := fs.String("out", "layout.zip", "output zip")
+	assets := fs.String("assets", "", "directory containing assets/ (default: auto-detect)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *assets != "" {
+		assetsPrefix = *assets
+	} else {
+		resolveAssetsPrefix()
+	}
+	initFonts()
+
+	userRaw, err := os.ReadFile(*userPath)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, userRaw); err != nil {
+		return fmt.Errorf("%s: %w", *userPath, err)
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Printf("Saved %s (%d KB)", *out, buf.Len()/1024)
+	return nil
+}
+
+// runImportCommand unpacks an exported zip into the assets dir and makes its
+// config the user config. A running service picks the change up on its own.
+func runImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fs.String("in", "layout.zip", "zip written by export")
+	configPath := fs.String("config", ETC_CONFIG_PATH, "default config the user config is checked against")
+	userPath := fs.String("user", ETC_USER_CONFIG_PATH, "user config to replace")
+	assets := fs.String("assets", "", "directory containing assets/ (default: auto-detect)")
+	onConflict := fs.String("on-conflict", conflictFail, "for files that exist with other content: "+strings.Join(conflictModes, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *assets != "" {
+		assetsPrefix = *assets
+	} else {
+		resolveAssetsPrefix()
+	}
+	initFonts()
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	if dftCfg, err = loadConfig(*configPath); err != nil {
+		return fmt.Errorf("load %s: %w", *configPath, err)
+	}
+	userConfigFile = *userPath
+	result, err := importBundle(data, *onConflict)
+	if err != nil {
+		return err
+	}
+	for _, rel := range result.Written {
+		fmt.Println("written:", rel)
+	}
+	for _, rel := range result.Skipped {
+		fmt.Println("skipped:", rel)
+	}
+	for from, to := range result.Renamed {
+		fmt.Printf("renamed: %s -> %s\n", from, to)
+	}
+	log.Printf("Imported %s into %s", *in, *userPath)
+	return nil
+}
+
+// loadDataSnapshot reads a key/value JSON object in the format served by
+// /api/v1/go_data.json. Whole numbers become int, as the collectors store them.
+func loadDataSnapshot(path string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateJSON(raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var snapshot map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, value := range snapshot {
+		if num, ok := value.(json.Number); ok {
+			snapshot[key] = jsonNumberValue(num)
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCollectorTimeout    = 30 * time.Second
+	defaultCollectorMaxBackoff = 2 * time.Minute
+	// jitter added to each wait, as a fraction of the interval, so collectors
+	// started together don't keep hitting the CPU in the same tick
+	defaultCollectorJitter = 0.1
+	// how often a disabled collector checks whether it was turned back on
+	disabledCollectorPoll = time.Second
+)
+
+// Collector gathers one group of readings into globalData. Collect returning an
+// error means the source as a whole was unavailable; the scheduler then backs off.
+// Failures of single readings are recorded per key in the data store instead.
+type Collector interface {
+	Name() string
+	Interval() time.Duration
+	Collect(ctx context.Context) error
+}
+
+// CollectorConfig overrides a collector's schedule, keyed by collector name in
+// the "collectors" config section. Zero values keep the built-in defaults.
+type CollectorConfig struct {
+	Enabled           *bool   `json:"enabled,omitempty"`
+	IntervalSeconds   float64 `json:"interval_seconds,omitempty"`
+	TimeoutSeconds    float64 `json:"timeout_seconds,omitempty"`
+	JitterSeconds     float64 `json:"jitter_seconds,omitempty"`
+	MaxBackoffSeconds float64 `json:"max_backoff_seconds,omitempty"`
+}
+
+// mergeCollectorConfigs overlays the fields set in user onto base, per collector
+func mergeCollectorConfigs(base, user map[string]CollectorConfig) map[string]CollectorConfig {
+	out := make(map[string]CollectorConfig, len(base)+len(user))
+	for name, cc := range base {
+		out[name] = cc
+	}
+	for name, uc := range user {
+		cc := out[name]
+		if uc.Enabled != nil {
+			cc.Enabled = uc.Enabled
+		}
+		if uc.IntervalSeconds > 0 {
+			cc.IntervalSeconds = uc.IntervalSeconds
+		}
+		if uc.TimeoutSeconds > 0 {
+			cc.TimeoutSeconds = uc.TimeoutSeconds
+		}
+		if uc.JitterSeconds > 0 {
+			cc.JitterSeconds = uc.JitterSeconds
+		}
+		if uc.MaxBackoffSeconds > 0 {
+			cc.MaxBackoffSeconds = uc.MaxBackoffSeconds
+		}
+		out[name] = cc
+	}
+	return out
+}
+
+// collectorFunc adapts a plain function to Collector
+type collectorFunc struct {
+	name     string
+	interval time.Duration
+	collect  func(ctx context.Context) error
+}
+
+func (c collectorFunc) Name() string                      { return c.name }
+func (c collectorFunc) Interval() time.Duration           { return c.interval }
+func (c collectorFunc) Collect(ctx context.Context) error { return c.collect(ctx) }
+
+// builtinCollectors returns the collectors main() schedules. Names match the data
+// store sources they write, so /api/v1/go_data.json?meta=1 and the collector
+// health line up.
+func builtinCollectors() []Collector {
+	return []Collector{
+		collectorFunc{"battery", batteryDataInterval, func(context.Context) error {
+			return collectBatteryData()
+		}},
+		collectorFunc{"linux", dataGatherInterval, func(context.Context) error {
+			collectLinuxData(cfg)
+			return nil
+		}},
+		collectorFunc{"network", dataGatherInterval, func(context.Context) error {
+			collectNetworkData(cfg)
+			return nil
+		}},
+		collectorFunc{"pcat_web", INTERVAL_PCAT_WEB_COLLECT, getInfoFromPcatWeb},
+		collectorFunc{"wan_speed", networkGatherInterval, func(context.Context) error {
+			return collectWANNetworkSpeed()
+		}},
+	}
+}
+
+// CollectorHealth is what /api/v1/go_collectors.json reports for one collector
+type CollectorHealth struct {
+	Name                string    `json:"name"`
+	Enabled             bool      `json:"enabled"`
+	Running             bool      `json:"running"`
+	IntervalMs          int64     `json:"interval_ms"`
+	TimeoutMs           int64     `json:"timeout_ms"`
+	Runs                int       `json:"runs"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastRun             time.Time `json:"last_run,omitempty"`
+	LastDurationMs      int64     `json:"last_duration_ms"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorAt         time.Time `json:"last_error_at,omitempty"`
+	NextRun             time.Time `json:"next_run,omitempty"`
+}
+
+// MarshalJSON leaves out times that were never set
+func (h CollectorHealth) MarshalJSON() ([]byte, error) {
+	type plain CollectorHealth
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	return json.Marshal(struct {
+		plain
+		LastRun     *time.Time `json:"last_run,omitempty"`
+		LastSuccess *time.Time `json:"last_success,omitempty"`
+		LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+		NextRun     *time.Time `json:"next_run,omitempty"`
+	}{plain(h), optional(h.LastRun), optional(h.LastSuccess), optional(h.LastErrorAt), optional(h.NextRun)})
+}
+
+// collectorSchedule is the effective schedule of one collector
+type collectorSchedule struct {
+	enabled    bool
+	interval   time.Duration
+	timeout    time.Duration
+	jitter     time.Duration
+	maxBackoff time.Duration
+}
+
+type scheduledCollector struct {
+	collector Collector
+	override  *bool // set through the API, wins over the config until restart
+	health    CollectorHealth
+	stop      context.CancelFunc
+}
+
+// CollectorScheduler runs every registered collector in its own goroutine
+type CollectorScheduler struct {
+	mu         sync.Mutex
+	collectors []*scheduledCollector
+	started    context.Context
+	loops      sync.WaitGroup
+}
+
+var collectors = NewCollectorScheduler()
+
+// NewCollectorScheduler creates a scheduler with no collectors
+func NewCollectorScheduler() *CollectorScheduler {
+	return &CollectorScheduler{}
+}
+
+// Add registers c. Collectors added after Start begin running right away.
+func (s *CollectorScheduler) Add(c Collector) {
+	s.mu.Lock()
+	sc := &scheduledCollector{collector: c, health: CollectorHealth{Name: c.Name()}}
+	s.collectors = append(s.collectors, sc)
+	var ctx context.Context
+	if s.started != nil {
+		ctx = s.stoppable(s.started, sc)
+	}
+	s.mu.Unlock()
+
+	if ctx != nil {
+		s.run(ctx, sc)
+	}
+}
+
+// Start runs all collectors until ctx is cancelled
+func (s *CollectorScheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.started = ctx
+	pending := append([]*scheduledCollector(nil), s.collectors...)
+	loopCtxs := make([]context.Context, len(pending))
+	for i, sc := range pending {
+		loopCtxs[i] = s.stoppable(ctx, sc)
+	}
+	s.mu.Unlock()
+
+	for i, sc := range pending {
+		s.run(loopCtxs[i], sc)
+	}
+}
+
+// stoppable returns the context sc's loop runs under, which Remove cancels.
+// The caller holds s.mu.
+func (s *CollectorScheduler) stoppable(ctx context.Context, sc *scheduledCollector) context.Context {
+	ctx, sc.stop = context.WithCancel(ctx)
+	return ctx
+}
+
+// Remove stops the named collector and forgets it. It reports whether
+// there was one.
+func (s *CollectorScheduler) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sc := range s.collectors {
+		if sc.collector.Name() == name {
+			if sc.stop != nil {
+				sc.stop()
+			}
+			s.collectors = append(s.collectors[:i], s.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until every collector loop has returned after the context
+// given to Start is cancelled
+func (s *CollectorScheduler) Wait() {
+	s.loops.Wait()
+}
+
+func (s *CollectorScheduler) run(ctx context.Context, sc *scheduledCollector) {
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Done()
+		s.loop(ctx, sc)
+	}()
+}
+
+// SetEnabled turns a collector on or off at runtime
+func (s *CollectorScheduler) SetEnabled(name string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range s.collectors {
+		if sc.collector.Name() == name {
+			sc.override = &enabled
+			sc.health.Enabled = enabled
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown collector %q", name)
+}
+
+// Health returns the state of every collector in registration order
+func (s *CollectorScheduler) Health() []CollectorHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]CollectorHealth, 0, len(s.collectors))
+	for _, sc := range s.collectors {
+		out = append(out, sc.health)
+	}
+	return out
+}
+
+// schedule merges the collector's defaults with the config and API overrides
+func (s *CollectorScheduler) schedule(sc *scheduledCollector) collectorSchedule {
+	interval := sc.collector.Interval()
+	sched := collectorSchedule{
+		enabled:    true,
+		interval:   interval,
+		timeout:    defaultCollectorTimeout,
+		jitter:     time.Duration(float64(interval) * defaultCollectorJitter),
+		maxBackoff: defaultCollectorMaxBackoff,
+	}
+
+	configMutex.RLock()
+	cc, ok := cfg.Collectors[sc.collector.Name()]
+	configMutex.RUnlock()
+	if ok {
+		if cc.Enabled != nil {
+			sched.enabled = *cc.Enabled
+		}
+		if cc.IntervalSeconds > 0 {
+			sched.interval = secondsToDuration(cc.IntervalSeconds)
+			sched.jitter = time.Duration(float64(sched.interval) * defaultCollectorJitter)
+		}
+		if cc.TimeoutSeconds > 0 {
+			sched.timeout = secondsToDuration(cc.TimeoutSeconds)
+		}
+		if cc.JitterSeconds > 0 {
+			sched.jitter = secondsToDuration(cc.JitterSeconds)
+		}
+		if cc.MaxBackoffSeconds > 0 {
+			sched.maxBackoff = secondsToDuration(cc.MaxBackoffSeconds)
+		}
+	}
+
+	if sched.interval <= 0 {
+		sched.interval = time.Second
+	}
+
+	s.mu.Lock()
+	if sc.override != nil {
+		sched.enabled = *sc.override
+	}
+	s.mu.Unlock()
+	return sched
+}
+
+func (s *CollectorScheduler) loop(ctx context.Context, sc *scheduledCollector) {
+	// spread the first runs so collectors don't all start in the same instant
+	if !sleepCtx(ctx, randomDuration(s.schedule(sc).jitter)) {
+		return
+	}
+
+	for {
+		sched := s.schedule(sc)
+		s.mu.Lock()
+		sc.health.Enabled = sched.enabled
+		sc.health.IntervalMs = sched.interval.Milliseconds()
+		sc.health.TimeoutMs = sched.timeout.Milliseconds()
+		// checked under s.mu so a collector Remove just stopped can't set
+		// its threshold again after the caller cleared it
+		if ctx.Err() == nil {
+			setStaleAfter(sc.collector.Name(), stalePolls*sched.interval)
+		}
+		s.mu.Unlock()
+
+		if !sched.enabled {
+			s.setNextRun(sc, time.Time{})
+			if !sleepCtx(ctx, disabledCollectorPoll) {
+				return
+			}
+			continue
+		}
+
+		failures := s.runOnce(ctx, sc, sched.timeout)
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := collectorBackoff(sched.interval, failures, sched.maxBackoff) + randomDuration(sched.jitter)
+		s.setNextRun(sc, time.Now().Add(wait))
+		if !sleepCtx(ctx, wait) {
+			return
+		}
+	}
+}
+
+// runOnce runs one collection and returns the number of consecutive failures.
+// A collector that overruns its timeout is reported as failed straight away, but
+// the next run only starts once it has actually returned, so a hung source never
+// piles up goroutines.
+func (s *CollectorScheduler) runOnce(ctx context.Context, sc *scheduledCollector, timeout time.Duration) int {
+	start := time.Now()
+	s.mu.Lock()
+	sc.health.Running = true
+	sc.health.LastRun = start
+	s.mu.Unlock()
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- sc.collector.Collect(runCtx)
+	}()
+
+	var err error
+	timedOut := false
+	select {
+	case err = <-done:
+	case <-runCtx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+		timedOut = true
+	}
+	failures := s.recordRun(sc, start, err)
+
+	if timedOut {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	s.mu.Lock()
+	sc.health.Running = false
+	s.mu.Unlock()
+	return failures
+}
+
+func (s *CollectorScheduler) recordRun(sc *scheduledCollector, start time.Time, err error) int {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := &sc.health
+	h.Runs++
+	h.LastDurationMs = now.Sub(start).Milliseconds()
+	if err != nil {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastError, h.LastErrorAt = err.Error(), now
+		if h.ConsecutiveFailures == 1 {
+			log.Printf("⚠️ collector %s failed: %v", h.Name, err)
+		}
+	} else {
+		if h.ConsecutiveFailures > 0 {
+			log.Printf("✅ collector %s recovered after %d failures", h.Name, h.ConsecutiveFailures)
+		}
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+	}
+	return h.ConsecutiveFailures
+}
+
+func (s *CollectorScheduler) setNextRun(sc *scheduledCollector, t time.Time) {
+	s.mu.Lock()
+	sc.health.NextRun = t
+	s.mu.Unlock()
+}
+
+// collectorBackoff doubles the interval for every consecutive failure, up to
+// max. A failing collector is never polled sooner than its interval, even when
+// that is longer than max.
+func collectorBackoff(interval time.Duration, failures int, max time.Duration) time.Duration {
+	if max < interval {
+		max = interval
+	}
+	wait := interval
+	for i := 0; i < failures && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+func secondsToDuration(secs float64) time.Duration {
+	return time.Duration(secs * float64(time.Second))
+}
+
+// sleepCtx waits for d and reports false if ctx was cancelled first
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
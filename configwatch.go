@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// configReloadDebounce lets editors finish writing (truncate, write, rename)
+// before the files are read
+const configReloadDebounce = 300 * time.Millisecond
+
+// ConfigReloadStatus is what GET /api/v2/config/reload reports
+type ConfigReloadStatus struct {
+	Files      []string  `json:"files"`
+	Watching   bool      `json:"watching"`
+	Reloads    int       `json:"reloads"`
+	LastReload time.Time `json:"last_reload"`
+	// the last failed reload; the config in use is the last good one
+	LastError string    `json:"last_error,omitempty"`
+	ErrorAt   time.Time `json:"error_at"`
+}
+
+var (
+	// default config in use, config.json during development
+	defaultConfigFile = ETC_CONFIG_PATH
+
+	reloadMu     sync.Mutex
+	reloadStatus ConfigReloadStatus
+
+	// set when a reload may have changed icons or layout; the main loop drops
+	// the caches it owns at the start of its next frame
+	renderCachesStale atomic.Bool
+)
+
+// readConfigFile decodes a config file into a fresh Config. A missing file
+// is an empty config when optional.
+func readConfigFile(path string, optional bool) (Config, []byte, error) {
+	var conf Config
+	raw, err := os.ReadFile(path)
+	if optional && os.IsNotExist(err) {
+		return conf, []byte("{}"), nil
+	} else if err != nil {
+		return conf, nil, err
+	}
+	if err := secureUnmarshal(raw, &conf); err != nil {
+		return conf, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return conf, raw, nil
+}
+
+// reloadConfigs re-reads the default and user configs and applies them. A
+// config that doesn't load or validate is reported and the last good one
+// stays in use.
+func reloadConfigs() error {
+	err := applyConfigFiles()
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if err != nil {
+		log.Printf("config reload failed, keeping the last good config: %v", err)
+		reloadStatus.LastError = err.Error()
+		reloadStatus.ErrorAt = time.Now()
+		return err
+	}
+	log.Printf("config reloaded from %s and %s, profile %q", defaultConfigFile, userConfigFile, activeProfileName())
+	reloadStatus.Reloads++
+	reloadStatus.LastReload = time.Now()
+	reloadStatus.LastError = ""
+	return nil
+}
+
+func applyConfigFiles() error {
+	dft, _, err := readConfigFile(defaultConfigFile, false)
+	if err != nil {
+		return err
+	}
+	user, raw, err := readConfigFile(userConfigFile, true)
+	if err != nil {
+		return err
+	}
+	overrides := map[string]interface{}{}
+	if err := secureUnmarshal(raw, &overrides); err != nil {
+		return err
+	}
+	profile, err := readActiveProfile()
+	if err != nil {
+		return err
+	}
+
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	prevDft, prevUser := dftCfg, userCfg
+	dftCfg, userCfg = dft, user
+	prevProfile := setProfile(profile)
+	if err := mergeConfigs(); err != nil {
+		dftCfg, userCfg = prevDft, prevUser
+		setProfile(prevProfile)
+		return err
+	}
+	configMutex.Lock()
+	userOverrides = overrides
+	userJsonConfig = string(raw)
+	configMutex.Unlock()
+
+	invalidateRenderCaches()
+	return nil
+}
+
+// runtimeConfigStarted is set once main has started the services that only
+// read their config when started; from then on mergeConfigs reapplies them
+var runtimeConfigStarted atomic.Bool
+
+// startRuntimeConfig starts the external collectors, the MQTT publisher and
+// the API tokens from the merged config
+func startRuntimeConfig() {
+	runtimeConfigStarted.Store(true)
+	configMutex.RLock()
+	next := cfg
+	configMutex.RUnlock()
+	applyRuntimeConfig(next)
+}
+
+// applyRuntimeConfig brings those services in line with next. Each one
+// restarts only when its own section changed.
+func applyRuntimeConfig(next Config) {
+	applyExternalCollectors(collectors, next.ExternalCollectors)
+	startMQTT(next.MQTT)
+	applyAuth(next.Auth)
+}
+
+// invalidateRenderCaches makes fonts, icons, the top bar and the footer load
+// and draw again
+func invalidateRenderCaches() {
+	fontCacheMu.Lock()
+	for name := range fontCache {
+		delete(fontCache, name)
+	}
+	fontCacheMu.Unlock()
+	renderCachesStale.Store(true)
+}
+
+// dropStaleRenderCaches runs on the main loop, which owns these caches
+func dropStaleRenderCaches() {
+	if !renderCachesStale.Swap(false) {
+		return
+	}
+	imageCache = make(map[string]*image.RGBA)
+	svgCache = make(map[string]*image.RGBA)
+	cacheTopBarStr = ""
+	cacheFooterStr = ""
+}
+
+// startConfigWatcher watches the config files loadAllConfigsToVariables read,
+// and the profiles dir as a whole so profiles saved later are watched too
+func startConfigWatcher() {
+	files := []string{defaultConfigFile, userConfigFile}
+	var dirs map[string]func(name string) bool
+	if err := os.MkdirAll(profilesDir(), 0755); err != nil {
+		log.Printf("config profiles not watched: %v", err)
+	} else {
+		dirs = map[string]func(name string) bool{profilesDir(): isProfileFileName}
+	}
+	if _, err := watchConfigFiles(files, dirs); err != nil {
+		log.Printf("config hot reload disabled: %v", err)
+	}
+}
+
+// GET /api/v2/config/reload
+func getConfigReload(c *fiber.Ctx) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return c.JSON(reloadStatus)
+}
+
+// POST /api/v2/config/reload
+func postConfigReload(c *fiber.Ctx) error {
+	if err := reloadConfigs(); err != nil {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+	return getConfigReload(c)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchConfigFiles reloads the configs whenever one of files changes, or an
+// entry of one of dirs that the dir's match func accepts by name. It watches
+// the files' directories, since editors and writeUserConfigFile replace the
+// files by renaming. stop ends the watch.
+func watchConfigFiles(files []string, dirs map[string]func(name string) bool) (stop func(), err error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+
+	watched := make(map[string]bool, len(files))
+	matchers := make(map[string]func(name string) bool, len(dirs))
+	wds := make(map[int32]string)
+	addWatch := func(dir string) error {
+		wd, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_CREATE|unix.IN_DELETE)
+		if err != nil {
+			return fmt.Errorf("watch %s: %w", dir, err)
+		}
+		wds[int32(wd)] = dir
+		return nil
+	}
+	paths := append([]string{}, files...)
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err == nil {
+			watched[abs] = true
+			err = addWatch(filepath.Dir(abs))
+		}
+		if err != nil {
+			unix.Close(fd)
+			return nil, err
+		}
+	}
+	for dir, match := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err == nil {
+			matchers[abs] = match
+			err = addWatch(abs)
+		}
+		if err != nil {
+			unix.Close(fd)
+			return nil, err
+		}
+		paths = append(paths, dir)
+	}
+
+	reloadMu.Lock()
+	reloadStatus.Files = paths
+	reloadStatus.Watching = true
+	reloadMu.Unlock()
+	log.Printf("watching %s for config changes", strings.Join(paths, ", "))
+
+	var stopped atomic.Bool
+	go func() {
+		defer unix.Close(fd)
+		var timer *time.Timer
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			n, err := unix.Read(fd, buf)
+			if err == unix.EINTR {
+				continue
+			}
+			if stopped.Load() || err != nil || n <= 0 {
+				if timer != nil {
+					timer.Stop()
+				}
+				log.Printf("config watcher stopped: %v", err)
+				reloadMu.Lock()
+				reloadStatus.Watching = false
+				reloadMu.Unlock()
+				return
+			}
+			changed := false
+			for off := 0; off+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameStart := off + unix.SizeofInotifyEvent
+				name := strings.TrimRight(string(buf[nameStart:nameStart+int(ev.Len)]), "\x00")
+				off = nameStart + int(ev.Len)
+				dir := wds[ev.Wd]
+				if watched[filepath.Join(dir, name)] || matchers[dir] != nil && matchers[dir](name) {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(configReloadDebounce, func() { reloadConfigs() })
+			} else {
+				timer.Reset(configReloadDebounce)
+			}
+		}
+	}()
+
+	// removing the watches queues IN_IGNORED, which wakes the blocked read
+	stop = func() {
+		stopped.Store(true)
+		for wd := range wds {
+			unix.InotifyRmWatch(fd, uint32(wd))
+		}
+	}
+	return stop, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// watchConfigFiles needs inotify; elsewhere the configs only reload through
+// POST /api/v2/config/reload
+func watchConfigFiles(files []string, dirs map[string]func(name string) bool) (stop func(), err error) {
+	return nil, fmt.Errorf("hot reload unavailable on %s", runtime.GOOS)
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DataType is the declared type of a data key
+type DataType string
+
+const (
+	DataInt    DataType = "int"
+	DataFloat  DataType = "float"
+	DataString DataType = "string"
+	DataBool   DataType = "bool"
+	DataList   DataType = "list"
+	DataObject DataType = "object"
+)
+
+// dataKeySpec declares what a key holds. Values written to the store are
+// converted to Type, so readers never have to guess between int, int64,
+// float64 and numeric strings.
+type dataKeySpec struct {
+	Type DataType
+	Unit string
+}
+
+// dataKeySpecs lists every key the collectors produce. Keys not listed here
+// (e.g. posted through the API) get their type from the first value stored.
+var dataKeySpecs = map[string]dataKeySpec{
+	// battery
+	"BatterySoc":      {DataInt, "%"},
+	"BatteryCharging": {DataBool, ""},
+
+	// linux
+	"Uptime":         {DataString, ""},
+	"BatteryVoltage": {DataFloat, "V"},
+	"BatteryCurrent": {DataFloat, "A"},
+	"BatteryWattage": {DataFloat, "W"},
+	"DCVoltage":      {DataFloat, "V"},
+	"CpuTemp":        {DataFloat, "°C"},
+	"CpuUsage":       {DataInt, "%"},
+	"MemUsage":       {DataString, "GB"},
+	"DiskData":       {DataObject, ""},
+	"FanRPM":         {DataInt, "RPM"},
+
+	// network
+	"SessionDataUsage": {DataFloat, "GB"},
+	"DailyDataUsage":   {DataFloat, "GB"},
+	"WeeklyDataUsage":  {DataFloat, "GB"},
+	"MonthlyDataUsage": {DataFloat, "GB"},
+	"LastMonthUsage":   {DataFloat, "GB"},
+	"LAN_IP":           {DataString, ""},
+	"WAN_IP":           {DataString, ""},
+	"PUBLIC_IP":        {DataString, ""},
+	"PublicIPv6":       {DataString, ""},
+	"SSID":             {DataString, ""},
+	"SSID2":            {DataString, ""},
+	"DHCPClients":      {DataList, ""},
+	"WifiClients":      {DataString, ""},
+	"Ping0":            {DataInt, "ms"},
+	"Ping1":            {DataInt, "ms"},
+	"Ping0Rate":        {DataInt, "%"},
+	"Ping1Rate":        {DataInt, "%"},
+
+	// WAN speed, the unit is chosen per reading and stored in the _Unit keys
+	"WanUP":        {DataFloat, ""},
+	"WanDOWN":      {DataFloat, ""},
+	"WanUP_Unit":   {DataString, ""},
+	"WanDOWN_Unit": {DataString, ""},
+
+	// pcat-manager web API
+	"BoardTemperature":    {DataInt, "°C"},
+	"Carrier":             {DataString, ""},
+	"GatewayDevice":       {DataString, ""},
+	"DHCPClientsCount":    {DataInt, ""},
+	"FirmwareVersion":     {DataString, ""},
+	"ISPName":             {DataString, ""},
+	"Model":               {DataString, ""},
+	"ModemModel":          {DataString, ""},
+	"ModemSignalStrength": {DataInt, "%"},
+	"SdState":             {DataString, ""},
+	"ServerLocation":      {DataString, ""},
+	"SimNumber":           {DataString, ""},
+	"SimState":            {DataString, ""},
+	"WiFiClientsCount":    {DataInt, ""},
+	"WiFiInterfaces":      {DataList, ""},
+	"WiFiSSIDs":           {DataList, ""},
+	"PublicIP":            {DataString, ""},
+	"UpSpeedBps":          {DataFloat, "B/s"},
+	"DownSpeedBps":        {DataFloat, "B/s"},
+	"OSVersion":           {DataString, ""},
+	"CellCarrierInfo":     {DataString, ""},
+	"ModemFirmwareVer":    {DataString, ""},
+	"IMEINum":             {DataString, ""},
+	"ModemCellID":         {DataString, ""},
+	"ModemCellInfo":       {DataString, ""},
+	"ModemSignals":        {DataString, ""},
+	"ModemISPDetails":     {DataString, ""},
+	"ModemNetworkInfo":    {DataString, ""},
+	"ModemRoamPref":       {DataString, ""},
+	"ModemServingInfo":    {DataString, ""},
+	"ModemServingQual":    {DataString, ""},
+	"ModemUSBSpeed":       {DataString, ""},
+	"ModemUSBNetMode":     {DataString, ""},
+	"ModemValid":          {DataBool, ""},
+	"PolicyLTEBands":      {DataString, ""},
+	"PolicyNR5GBands":     {DataString, ""},
+	"SelectedLTEBands":    {DataString, ""},
+	"SelectedNR5GBands":   {DataString, ""},
+	"SMSCheckInterval":    {DataInt, "s"},
+	"SMSForward":          {DataBool, ""},
+	"SMSForwardTo":        {DataString, ""},
+	"ModemTemperature":    {DataObject, "°C"},
+
+	// fixed
+	"Kernel": {DataString, ""},
+	"SN":     {DataString, ""},
+}
+
+// DataEntry is one key in the data store. Value has the declared type, or is nil
+// when no reading has succeeded yet. Text is the value as the collector formatted
+// it for the screen ("7.71"), so display precision stays with the collector.
+// A failed reading sets Error and keeps the last good Value and UpdatedAt.
+// Stale is worked out when the entry is read, see staleAfter.
+type DataEntry struct {
+	Value     interface{}
+	Text      string
+	Type      DataType
+	Unit      string
+	Source    string
+	UpdatedAt time.Time
+	Error     string
+	ErrorAt   time.Time
+	Stale     bool
+}
+
+// stalePolls is how many polls a value may miss before it is shown as stale
+const stalePolls = 3
+
+// staleAfterFloor is the least time a value of these sources may go without
+// an update before it is stale, so quick collectors don't flag a value over
+// one slow read. It is also the threshold until the collector is scheduled.
+var staleAfterFloor = map[string]time.Duration{
+	"battery":   30 * time.Second,
+	"linux":     30 * time.Second,
+	"wan_speed": 30 * time.Second,
+	"pcat_web":  time.Minute,
+	"network":   2 * time.Minute,
+}
+
+// staleAfterBySource is how long a value may go without an update before it is
+// shown as stale, stalePolls polls of the collector that writes it. The
+// scheduler sets it from the effective interval. "fixed" values and keys
+// posted through the API never go stale. Guarded by staleAfterMu.
+var staleAfterBySource = map[string]time.Duration{}
+
+// staleThresholds is stale_data.thresholds of the merged config, copied by
+// mergeConfigs so readers don't need configMutex. Guarded by staleAfterMu.
+var staleThresholds map[string]int
+
+var staleAfterMu sync.RWMutex
+
+// setStaleAfter sets the threshold for the values written by source, no
+// lower than its floor
+func setStaleAfter(source string, limit time.Duration) {
+	staleAfterMu.Lock()
+	defer staleAfterMu.Unlock()
+	if floor := staleAfterFloor[source]; limit < floor {
+		limit = floor
+	}
+	staleAfterBySource[source] = limit
+}
+
+// clearStaleAfter forgets the threshold of a source that is no longer collected
+func clearStaleAfter(source string) {
+	staleAfterMu.Lock()
+	defer staleAfterMu.Unlock()
+	delete(staleAfterBySource, source)
+}
+
+// setStaleThresholds replaces the per-key thresholds from the config
+func setStaleThresholds(thresholds map[string]int) {
+	staleAfterMu.Lock()
+	defer staleAfterMu.Unlock()
+	staleThresholds = thresholds
+}
+
+// staleAfter returns the threshold for key, 0 meaning it never goes stale.
+// stale_data.thresholds in the config overrides the per-source default.
+func staleAfter(key, source string) time.Duration {
+	staleAfterMu.RLock()
+	defer staleAfterMu.RUnlock()
+	if secs, ok := staleThresholds[key]; ok {
+		return time.Duration(secs) * time.Second
+	}
+	if limit, ok := staleAfterBySource[source]; ok {
+		return limit
+	}
+	return staleAfterFloor[source]
+}
+
+// checkStale sets Stale on a copy of the entry for key
+func (e *DataEntry) checkStale(key string, now time.Time) {
+	if e.Value == nil || e.UpdatedAt.IsZero() {
+		return
+	}
+	limit := staleAfter(key, e.Source)
+	e.Stale = limit > 0 && now.Sub(e.UpdatedAt) > limit
+}
+
+// MarshalJSON leaves out times that were never set
+func (e DataEntry) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{
+		"value": e.Value,
+		"text":  e.Text,
+		"type":  e.Type,
+	}
+	if e.Unit != "" {
+		out["unit"] = e.Unit
+	}
+	if e.Source != "" {
+		out["source"] = e.Source
+	}
+	if !e.UpdatedAt.IsZero() {
+		out["updated_at"] = e.UpdatedAt
+	}
+	if e.Error != "" {
+		out["error"] = e.Error
+		out["error_at"] = e.ErrorAt
+	}
+	if e.Stale {
+		out["stale"] = true
+	}
+	return json.Marshal(out)
+}
+
+// DataStore holds the latest reading of every data key
+type DataStore struct {
+	mu      sync.RWMutex
+	entries map[string]*DataEntry
+
+	observers      map[int]func(key string, entry DataEntry)
+	nextObserverID int
+	observersMu    sync.Mutex
+}
+
+// NewDataStore creates an empty store
+func NewDataStore() *DataStore {
+	return &DataStore{entries: make(map[string]*DataEntry)}
+}
+
+// Store records a successful reading with no source attribution
+func (ds *DataStore) Store(key string, value interface{}) {
+	ds.store(key, value, "")
+}
+
+// StoreError records that reading key failed. The previous value is kept so
+// consumers can keep showing it and judge its age.
+func (ds *DataStore) StoreError(key string, err error) {
+	ds.storeError(key, err, "")
+}
+
+// Source returns a writer that tags every value with the collector that produced it
+func (ds *DataStore) Source(name string) DataSource {
+	return DataSource{store: ds, name: name}
+}
+
+// DataSource writes to a DataStore on behalf of one collector
+type DataSource struct {
+	store *DataStore
+	name  string
+}
+
+// Store records a successful reading from this source
+func (src DataSource) Store(key string, value interface{}) {
+	src.store.store(key, value, src.name)
+}
+
+// StoreError records a failed reading from this source
+func (src DataSource) StoreError(key string, err error) {
+	src.store.storeError(key, err, src.name)
+}
+
+// StoreErrors records the same failure for several keys, e.g. every field of an
+// API response that could not be fetched
+func (src DataSource) StoreErrors(err error, keys ...string) {
+	for _, key := range keys {
+		src.store.storeError(key, err, src.name)
+	}
+}
+
+func (ds *DataStore) store(key string, value interface{}, source string) {
+	if entry, changed := ds.update(key, value, source); changed {
+		ds.notifyObservers(key, entry)
+	}
+}
+
+func (ds *DataStore) update(key string, value interface{}, source string) (DataEntry, bool) {
+	now := time.Now()
+	spec, known := dataKeySpecs[key]
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	entry := ds.entries[key]
+	if entry == nil {
+		entry = &DataEntry{Type: spec.Type, Unit: spec.Unit}
+		ds.entries[key] = entry
+	}
+	before := *entry
+	if !known && value != nil {
+		// undeclared keys take whatever type they are given
+		entry.Type = inferDataType(value)
+	}
+	if source != "" {
+		entry.Source = source
+	}
+
+	if value == nil {
+		entry.Value, entry.Text = nil, ""
+		entry.UpdatedAt, entry.Error = now, ""
+		return *entry, entryChanged(before, *entry)
+	}
+
+	converted, err := convertDataValue(value, entry.Type)
+	if err != nil {
+		// like StoreError: the last good value stays, with its age
+		entry.Error, entry.ErrorAt = err.Error(), now
+		return *entry, entryChanged(before, *entry)
+	}
+	entry.Value = converted
+	entry.Text = dataValueText(value)
+	entry.UpdatedAt, entry.Error = now, ""
+	return *entry, entryChanged(before, *entry)
+}
+
+func (ds *DataStore) storeError(key string, err error, source string) {
+	spec, known := dataKeySpecs[key]
+
+	ds.mu.Lock()
+	entry := ds.entries[key]
+	if entry == nil {
+		entry = &DataEntry{Type: spec.Type, Unit: spec.Unit}
+		if !known {
+			entry.Type = DataString
+		}
+		ds.entries[key] = entry
+	}
+	before := *entry
+	if source != "" {
+		entry.Source = source
+	}
+	entry.Error, entry.ErrorAt = err.Error(), time.Now()
+	after := *entry
+	ds.mu.Unlock()
+
+	if entryChanged(before, after) {
+		ds.notifyObservers(key, after)
+	}
+}
+
+// entryChanged reports whether a write changed what readers see. A repeat of the
+// same reading or the same error only moves the timestamps.
+func entryChanged(before, after DataEntry) bool {
+	return before.Text != after.Text ||
+		before.Error != after.Error ||
+		before.Type != after.Type ||
+		(before.Value == nil) != (after.Value == nil)
+}
+
+// Observe registers fn to run after every write that changes an entry. fn is
+// called on the collector's goroutine with the store unlocked and must be quick.
+// The returned func unregisters fn.
+func (ds *DataStore) Observe(fn func(key string, entry DataEntry)) func() {
+	ds.observersMu.Lock()
+	defer ds.observersMu.Unlock()
+
+	if ds.observers == nil {
+		ds.observers = make(map[int]func(string, DataEntry))
+	}
+	id := ds.nextObserverID
+	ds.nextObserverID++
+	ds.observers[id] = fn
+
+	return func() {
+		ds.observersMu.Lock()
+		delete(ds.observers, id)
+		ds.observersMu.Unlock()
+	}
+}
+
+func (ds *DataStore) notifyObservers(key string, entry DataEntry) {
+	ds.observersMu.Lock()
+	if len(ds.observers) == 0 {
+		ds.observersMu.Unlock()
+		return
+	}
+	fns := make([]func(string, DataEntry), 0, len(ds.observers))
+	for _, fn := range ds.observers {
+		fns = append(fns, fn)
+	}
+	ds.observersMu.Unlock()
+
+	for _, fn := range fns {
+		fn(key, entry)
+	}
+}
+
+// Get returns a copy of the entry for key
+func (ds *DataStore) Get(key string) (DataEntry, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	entry, ok := ds.entries[key]
+	if !ok {
+		return DataEntry{}, false
+	}
+	out := *entry
+	out.checkStale(key, time.Now())
+	return out, true
+}
+
+// Load returns the typed value of key. ok is false when the key is unknown or
+// has no value yet.
+func (ds *DataStore) Load(key string) (interface{}, bool) {
+	entry, ok := ds.Get(key)
+	if !ok || entry.Value == nil {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Int returns key as an int; floats are truncated
+func (ds *DataStore) Int(key string) (int, bool) {
+	v, ok := ds.Load(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// Float returns key as a float64
+func (ds *DataStore) Float(key string) (float64, bool) {
+	v, ok := ds.Load(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// String returns key formatted the way its collector wrote it
+func (ds *DataStore) String(key string) (string, bool) {
+	entry, ok := ds.Get(key)
+	if !ok || entry.Value == nil {
+		return "", false
+	}
+	return entry.Text, true
+}
+
+// Bool returns key as a bool
+func (ds *DataStore) Bool(key string) (bool, bool) {
+	v, ok := ds.Load(key)
+	if !ok {
+		return false, false
+	}
+	b, ok := v.(bool)
+	return b, ok
+}
+
+// Delete forgets key
+func (ds *DataStore) Delete(key string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	delete(ds.entries, key)
+}
+
+// Reset forgets every key
+func (ds *DataStore) Reset() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.entries = make(map[string]*DataEntry)
+}
+
+// Snapshot returns a copy of every entry
+func (ds *DataStore) Snapshot() map[string]DataEntry {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	now := time.Now()
+	out := make(map[string]DataEntry, len(ds.entries))
+	for k, e := range ds.entries {
+		entry := *e
+		entry.checkStale(k, now)
+		out[k] = entry
+	}
+	return out
+}
+
+// Values returns key → typed value, nil for keys without a reading
+func (ds *DataStore) Values() map[string]interface{} {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	out := make(map[string]interface{}, len(ds.entries))
+	for k, e := range ds.entries {
+		out[k] = e.Value
+	}
+	return out
+}
+
+func inferDataType(value interface{}) DataType {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return DataInt
+	case float32, float64, json.Number:
+		return DataFloat
+	case bool:
+		return DataBool
+	case string, nil:
+		return DataString
+	case []string, []interface{}:
+		return DataList
+	}
+	return DataObject
+}
+
+// convertDataValue converts value to t, parsing strings where needed
+func convertDataValue(value interface{}, t DataType) (interface{}, error) {
+	switch t {
+	case DataInt:
+		switch n := value.(type) {
+		case int:
+			return n, nil
+		case int32:
+			return int(n), nil
+		case int64:
+			return int(n), nil
+		case uint32:
+			return int(n), nil
+		case uint64:
+			return int(n), nil
+		case float64:
+			if n == math.Trunc(n) {
+				return int(n), nil
+			}
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return int(i), nil
+			}
+		case string:
+			if i, err := strconv.Atoi(strings.TrimSpace(n)); err == nil {
+				return i, nil
+			}
+		}
+	case DataFloat:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case float32:
+			return float64(n), nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case json.Number:
+			if f, err := n.Float64(); err == nil {
+				return f, nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil {
+				return f, nil
+			}
+		}
+	case DataBool:
+		switch b := value.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+	case DataString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("expected %s, got %T %v", t, value, value)
+}
+
+func dataValueText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"sync"
+)
+
+// DisplaySink is anything the send* functions can push framebuffers to.
+// *gc9307.Device satisfies it for the real panel, VirtualDisplay keeps the
+// pixels in memory so the app can run on machines without SPI hardware.
+type DisplaySink interface {
+	FillRectangleWithImage(x, y, width, height int16, fb *image.RGBA) error
+}
+
+// VirtualDisplay is an in-memory display used when running headless
+type VirtualDisplay struct {
+	frame  *image.RGBA
+	writes int
+	mu     sync.RWMutex
+
+	observers      map[int]func(*VirtualDisplay)
+	nextObserverID int
+	observersMu    sync.Mutex
+}
+
+// NewVirtualDisplay creates a virtual display of the given size, cleared to black
+func NewVirtualDisplay(width, height int) *VirtualDisplay {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(frame, frame.Bounds(), image.NewUniform(PCAT_BLACK), image.Point{}, draw.Src)
+	return &VirtualDisplay{frame: frame}
+}
+
+// FillRectangleWithImage copies fb into the virtual framebuffer at (x, y).
+// It rejects the same out-of-range and size-mismatch cases as the gc9307 driver
+// so bugs show up identically with and without hardware.
+func (vd *VirtualDisplay) FillRectangleWithImage(x, y, width, height int16, fb *image.RGBA) error {
+	if fb == nil {
+		return errors.New("nil framebuffer")
+	}
+
+	vd.mu.Lock()
+	w, h := int16(vd.frame.Bounds().Dx()), int16(vd.frame.Bounds().Dy())
+	if x < 0 || y < 0 || width <= 0 || height <= 0 ||
+		x >= w || (x+width) > w || y >= h || (y+height) > h {
+		vd.mu.Unlock()
+		return errors.New("rectangle coordinates outside display area")
+	}
+	if int16(fb.Bounds().Dx()) != width || int16(fb.Bounds().Dy()) != height {
+		vd.mu.Unlock()
+		return errors.New("image dimensions do not match rectangle size")
+	}
+
+	dst := image.Rect(int(x), int(y), int(x+width), int(y+height))
+	draw.Draw(vd.frame, dst, fb, fb.Bounds().Min, draw.Src)
+	vd.writes++
+	vd.mu.Unlock()
+
+	vd.notifyObservers()
+	return nil
+}
+
+// Observe registers fn to run after every successful write. fn is called on the
+// writer's goroutine with the framebuffer unlocked, so it may call Snapshot, but
+// it must be quick: it delays the next frame. The returned func unregisters fn.
+func (vd *VirtualDisplay) Observe(fn func(*VirtualDisplay)) func() {
+	vd.observersMu.Lock()
+	defer vd.observersMu.Unlock()
+
+	if vd.observers == nil {
+		vd.observers = make(map[int]func(*VirtualDisplay))
+	}
+	id := vd.nextObserverID
+	vd.nextObserverID++
+	vd.observers[id] = fn
+
+	return func() {
+		vd.observersMu.Lock()
+		delete(vd.observers, id)
+		vd.observersMu.Unlock()
+	}
+}
+
+func (vd *VirtualDisplay) notifyObservers() {
+	vd.observersMu.Lock()
+	if len(vd.observers) == 0 {
+		vd.observersMu.Unlock()
+		return
+	}
+	fns := make([]func(*VirtualDisplay), 0, len(vd.observers))
+	for _, fn := range vd.observers {
+		fns = append(fns, fn)
+	}
+	vd.observersMu.Unlock()
+
+	for _, fn := range fns {
+		fn(vd)
+	}
+}
+
+// Snapshot returns a copy of what is currently shown on the virtual display
+func (vd *VirtualDisplay) Snapshot() *image.RGBA {
+	vd.mu.RLock()
+	defer vd.mu.RUnlock()
+
+	snap := image.NewRGBA(vd.frame.Bounds())
+	copy(snap.Pix, vd.frame.Pix)
+	return snap
+}
+
+// Writes returns how many rectangles have been pushed to the virtual display
+func (vd *VirtualDisplay) Writes() int {
+	vd.mu.RLock()
+	defer vd.mu.RUnlock()
+	return vd.writes
+}
+
+// MirrorDisplay forwards every write to a real panel and keeps a composited copy
+// of the screen in its embedded VirtualDisplay, so the web mirror and recordings
+// see transitions and text overlays exactly as the LCD shows them.
+type MirrorDisplay struct {
+	*VirtualDisplay
+	device DisplaySink
+}
+
+// NewMirrorDisplay wraps device with an in-memory copy of the given size
+func NewMirrorDisplay(device DisplaySink, width, height int) *MirrorDisplay {
+	return &MirrorDisplay{
+		VirtualDisplay: NewVirtualDisplay(width, height),
+		device:         device,
+	}
+}
+
+// FillRectangleWithImage sends fb to the panel, then updates the mirror.
+// The panel's error is returned; the mirror is updated even if the SPI write failed.
+func (md *MirrorDisplay) FillRectangleWithImage(x, y, width, height int16, fb *image.RGBA) error {
+	err := md.device.FillRectangleWithImage(x, y, width, height, fb)
+	md.VirtualDisplay.FillRectangleWithImage(x, y, width, height, fb)
+	return err
+}
+
+// screenMirror returns the in-memory copy of the screen, or nil when the display
+// keeps none.
+func screenMirror() *VirtualDisplay {
+	switch d := display.(type) {
+	case *VirtualDisplay:
+		return d
+	case *MirrorDisplay:
+		return d.VirtualDisplay
+	}
+	return nil
+}
@@ -19,7 +19,6 @@ import (
 	"strconv"
 	"path/filepath"
 	"regexp"
-	gc9307 "github.com/photonicat/periph.io-gc9307"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
@@ -35,6 +34,9 @@ var (
 	cacheTopBar *image.RGBA
 	cacheFooterStr string
 	cacheFooter *image.RGBA
+
+	// timeNow is the clock used for on-screen times, swappable for reproducible renders
+	timeNow = time.Now
 )
 
 //---------------- Drawing Functions ----------------
@@ -195,7 +197,7 @@ func copyImageToFrameBuffer(img *image.RGBA, frame []color.RGBA) {
 	}
 }
 
-func sendTopBar(display gc9307.Device, frame *image.RGBA) {
+func sendTopBar(display DisplaySink, frame *image.RGBA) {
 	// Early exit for nil frames
 	if frame == nil {
 		return
@@ -213,7 +215,7 @@ func sendTopBar(display gc9307.Device, frame *image.RGBA) {
 	}
 }
 
-func sendFooter(display gc9307.Device, frame *image.RGBA) {
+func sendFooter(display DisplaySink, frame *image.RGBA) {
 	// Early exit for nil frames
 	if frame == nil {
 		return
@@ -276,7 +278,7 @@ func isBackground(c color.Color, bg color.Color) bool {
 }
 
 
-func sendMiddlePartial(display gc9307.Device, frame *image.RGBA) {
+func sendMiddlePartial(display DisplaySink, frame *image.RGBA) {
 	// Crop the frame to the region with content.
 	croppedFrame := cropToContent(frame, color.Black) // assuming black is the background
 	if croppedFrame.Bounds().Empty() {
@@ -327,7 +329,7 @@ var (
 )
 
 // sendMiddle sends the middle frame area with performance optimizations
-func sendMiddle(display gc9307.Device, frame *image.RGBA) {
+func sendMiddle(display DisplaySink, frame *image.RGBA) {
 	// Early exit for nil frames
 	if frame == nil {
 		return
@@ -393,7 +395,7 @@ func areFramesIdentical(frame1, frame2 *image.RGBA) bool {
 }
 
 // sendMiddleOptimized sends middle frame only if it has changed from the last frame
-func sendMiddleOptimized(display gc9307.Device, frame *image.RGBA) {
+func sendMiddleOptimized(display DisplaySink, frame *image.RGBA) {
 	// Early exit for nil frames
 	if frame == nil {
 		return
@@ -421,7 +423,7 @@ func sendMiddleOptimized(display gc9307.Device, frame *image.RGBA) {
 	copy(lastMiddleFrame.Pix, frame.Pix)
 }
 
-func sendFull(display gc9307.Device, frame *image.RGBA) {
+func sendFull(display DisplaySink, frame *image.RGBA) {
 	// Early exit for nil frames
 	if frame == nil {
 		return
@@ -1048,10 +1050,10 @@ func drawBattery(w, h int, soc float64, isCharging bool, x0, y0 int) *image.RGBA
 }
 
 
-func drawTopBar(display gc9307.Device, frame *image.RGBA) {
+func drawTopBar(display DisplaySink, frame *image.RGBA) {
 	var timeStr string
 	var networkStr string
-	currDateTime := time.Now()
+	currDateTime := timeNow()
 
 	if currDateTime.Year() < 2025 {
 		timeStr = "--:--"
@@ -1059,8 +1061,8 @@ func drawTopBar(display gc9307.Device, frame *image.RGBA) {
 		timeStr = fmt.Sprintf("%02d:%02d", currDateTime.Hour(), currDateTime.Minute())
 	}
 
-	gatewayDevice, _ := globalData.Load("GatewayDevice")
-	carrier, _ := globalData.Load("Carrier")
+	gatewayDevice, _ := globalData.String("GatewayDevice")
+	carrier, _ := globalData.String("Carrier")
 	
 	if gatewayDevice == "mobile"{
 		if carrier == "5G"{
@@ -1110,15 +1112,14 @@ func drawTopBar(display gc9307.Device, frame *image.RGBA) {
 		copyImageToImageAt(frame, eth, x0+80, y0+2)
 
 	}else if networkStr == "4" || networkStr == "5" || networkStr == "3" {
-		signalStrengthInt, ok := globalData.Load("ModemSignalStrength")
+		signalStrengthInt, ok := globalData.Int("ModemSignalStrength")
 		if !ok {
 			fmt.Println("ModemSignalStrength not found, use default 0")
-			signalStrength = 0.0
 		}
 
 		fmt.Println("ModemSignalStrength:", signalStrengthInt)
 
-		signalStrength = float64(signalStrengthInt.(int)) / 100.0
+		signalStrength = float64(signalStrengthInt) / 100.0
 		//draw signal strength
 		if fiveGonTop {
 			drawSignalStrength(frame, x0+80, y0, signalStrength)
@@ -1137,14 +1138,9 @@ func drawTopBar(display gc9307.Device, frame *image.RGBA) {
 	}
 
 	//draw Battery
-	socValue, _ := globalData.Load("BatterySoc") //it is int
-	socInt, _ := socValue.(int)
-	socFloat := float64(socInt) // now convert int to float64
-	charging, _ := globalData.Load("BatteryCharging")
-	chargingBool, ok := charging.(bool) // Type assertion to bool
-	if !ok {
-		chargingBool = false // Default value if assertion fails
-	}
+	socInt, _ := globalData.Int("BatterySoc")
+	socFloat := float64(socInt)
+	chargingBool, _ := globalData.Bool("BatteryCharging") // false when unknown
 	if fiveGonTop {
 		img := drawBattery(50, 19, socFloat, chargingBool, x0, y0)
 		copyImageToImageAt(frame, img, x0+108, y0)
@@ -1186,7 +1182,11 @@ func renderMiddle(frame *image.RGBA, cfg *Config, isSMS bool, pageIdx int) {
 		return
 	}
 
-	page := cfg.DisplayTemplate.Elements["page"+strconv.Itoa(pageIdx)]
+	page, ok := cfg.DisplayTemplate.pageElements(pageIdx)
+	if !ok {
+		log.Printf("renderMiddle: invalid page index %d", pageIdx)
+		return
+	}
 
 	// Process each element.
 	for _, element := range page {
@@ -1198,54 +1198,60 @@ func renderMiddle(frame *image.RGBA, cfg *Config, isSMS bool, pageIdx int) {
 		switch element.Type {
 		case "text":
 			// Determine the text to display first (moved up to use for font selection)
-			textValue, exists := globalData.Load(element.DataKey)
+			entry, exists := globalData.Get(element.DataKey)
 			var textToDisplay string
 			var isPingTimeout bool = false
 			
-			if exists {
-				if textValue == nil {
-					textToDisplay = "-"
-				} else {
-					// Special handling for ping timeout (-2) and errors
-					if (element.DataKey == "Ping0" || element.DataKey == "Ping1") {
-						// Handle both int64 and int types for ping values
-						var pingVal int64
-						var validPingValue bool
-						
-						if val, ok := textValue.(int64); ok {
-							pingVal = val
-							validPingValue = true
-						} else if val, ok := textValue.(int); ok {
-							pingVal = int64(val)
-							validPingValue = true
-						}
-						
-						if validPingValue {
-							if pingVal == -2 || pingVal == -1 {
-								// Both timeout (-2) and other failures (-1) show red X
-								textToDisplay = "X"
-								isPingTimeout = true
-							} else if pingVal >= 0 {
-								textToDisplay = fmt.Sprintf("%d", pingVal)
-							} else {
-								// Any other negative value should not happen, but show as red X
-								textToDisplay = "X"
-								isPingTimeout = true
-							}
-						} else {
-							// If not a numeric type, show as error
-							textToDisplay = "-"
-						}
+			if exists && entry.Value != nil {
+				// Special handling for ping timeout (-2) and errors
+				if (element.DataKey == "Ping0" || element.DataKey == "Ping1") {
+					if pingVal, ok := globalData.Int(element.DataKey); !ok {
+						// If not a numeric type, show as error
+						textToDisplay = "-"
+					} else if pingVal == -2 || pingVal == -1 {
+						// Both timeout (-2) and other failures (-1) show red X
+						textToDisplay = "X"
+						isPingTimeout = true
+					} else if pingVal >= 0 {
+						textToDisplay = fmt.Sprintf("%d", pingVal)
 					} else {
-						textToDisplay = fmt.Sprintf("%v", textValue)
+						// Any other negative value should not happen, but show as red X
+						textToDisplay = "X"
+						isPingTimeout = true
 					}
+				} else {
+					textToDisplay = entry.Text
 				}
 			} else {
-				textToDisplay = "-" // or any default value you prefer
+				textToDisplay = "-" // no reading yet, or the last one failed to parse
+			}
+
+			// The collector behind a stale value has stopped updating it, so don't
+			// let it pass for a live reading.
+			staleStyle := ""
+			if exists && entry.Stale {
+				staleStyle = cfg.StaleData.Style
+				if staleStyle == "" {
+					staleStyle = "grey"
+				}
+			}
+			switch staleStyle {
+			case "marker":
+				marker := cfg.StaleData.Marker
+				if marker == "" {
+					marker = "*"
+				}
+				textToDisplay += marker
+			case "placeholder":
+				textToDisplay = cfg.StaleData.Placeholder
+				if textToDisplay == "" {
+					textToDisplay = "--"
+				}
+				isPingTimeout = false
 			}
 			
-			// Get the font face for the main text (choose Chinese font if needed)
-			face, _, err := getFontFaceForText(element.Font, textToDisplay)
+			// Get the font face for the main text; its fallbacks cover Chinese
+			face, _, err := getFontFace(element.Font)
 			if err != nil {
 				log.Printf("Error getting font face for %s: %v", element.Font, err)
 				continue
@@ -1275,6 +1281,9 @@ func renderMiddle(frame *image.RGBA, cfg *Config, isSMS bool, pageIdx int) {
 			if isPingTimeout {
 				clr = PCAT_RED
 			}
+			if staleStyle == "grey" || staleStyle == "placeholder" {
+				clr = PCAT_GREY
+			}
 
 			// Draw the main text.
 			// The drawText function uses the provided y plus the font ascent as the baseline.
@@ -1291,10 +1300,8 @@ func renderMiddle(frame *image.RGBA, cfg *Config, isSMS bool, pageIdx int) {
 			if !isPingTimeout {
 				unitText := element.Units
 				//check if there is a override unit
-				theKey := element.DataKey + "_Unit"
-				if _, ok := globalData.Load(theKey); ok {
-					unitTextVal, _ := globalData.Load(theKey)
-					unitText = unitTextVal.(string)
+				if unitOverride, ok := globalData.String(element.DataKey + "_Unit"); ok {
+					unitText = unitOverride
 				}
 				drawText(frame, unitText, xMain+1, unitY, unitFace, clr, false)
 			}
@@ -1302,7 +1309,7 @@ func renderMiddle(frame *image.RGBA, cfg *Config, isSMS bool, pageIdx int) {
 		case "icon":
 			var iconImg *image.RGBA
 			var err error
-			iconImg, _, _, err = loadImage(assetsPrefix + "/" + element.IconPath)
+			iconImg, _, _, err = loadImage(assetPath(element.IconPath))
 			if err != nil {
 				log.Printf("Error loading icon from %s: %v", element.IconPath, err)
 				continue
@@ -1394,7 +1401,7 @@ func renderMiddle(frame *image.RGBA, cfg *Config, isSMS bool, pageIdx int) {
 	}
 }
 
-func drawFooter(display gc9307.Device, frame *image.RGBA, currPage int, numOfPages int, isSMS bool) {
+func drawFooter(display DisplaySink, frame *image.RGBA, currPage int, numOfPages int, isSMS bool) {
 	magicStr:= strconv.Itoa(currPage) + " " + strconv.Itoa(numOfPages) + " " + strconv.FormatBool(isSMS)
 	if cacheFooterStr == magicStr {
 		return //no need to refresh
@@ -1445,7 +1452,7 @@ func drawFooter(display gc9307.Device, frame *image.RGBA, currPage int, numOfPag
 	sendFooter(display, frame)
 }
 
-func showWelcome(display gc9307.Device, width, height int, duration time.Duration) {
+func showWelcome(display DisplaySink, width, height int, duration time.Duration) {
 	radiusBarCorner := 5
 	spaceBetweenLogoAndBar := 28
 	barWidth := 82
@@ -1525,7 +1532,7 @@ func showWelcome(display gc9307.Device, width, height int, duration time.Duratio
     }
 }
 
-func showWelcomeForced(display gc9307.Device, width, height int, duration time.Duration) {
+func showWelcomeForced(display DisplaySink, width, height int, duration time.Duration) {
 	frame := image.NewRGBA(image.Rect(0, 0, width, height))
 	clearFrame(frame, width, height)
 	
@@ -1548,7 +1555,7 @@ func showWelcomeForced(display gc9307.Device, width, height int, duration time.D
 
 
 
-func showCiao(display gc9307.Device, width, height int, duration time.Duration) {
+func showCiao(display DisplaySink, width, height int, duration time.Duration) {
 	spaceBetweenLogoAndText := 28
 	textHeight := 12
 	frame := image.NewRGBA(image.Rect(0, 0, width, height))
@@ -1573,7 +1580,7 @@ func showCiao(display gc9307.Device, width, height int, duration time.Duration)
 
 }
 
-func showCiaoInstant(display gc9307.Device, width, height int) {
+func showCiaoInstant(display DisplaySink, width, height int) {
 	spaceBetweenLogoAndText := 28
 	textHeight := 12
 	frame := image.NewRGBA(image.Rect(0, 0, width, height))
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// data changes arriving within this window go out as one delta; collectors
+	// write many keys in a burst
+	eventDataWindow   = 250 * time.Millisecond
+	eventClientBuffer = 64
+	maxEventClients   = 16
+	eventKeepAlive    = 15 * time.Second
+)
+
+const (
+	EventSnapshot = "snapshot"
+	EventData     = "data"
+	EventPage     = "page"
+	EventIdle     = "idle"
+	EventSMS      = "sms"
+)
+
+var errTooManyEventClients = errors.New("too many event clients")
+
+// Event is one server-sent event
+type Event struct {
+	ID   uint64
+	Type string
+	Data interface{}
+}
+
+// eventClient is one connected stream. types is nil when every type is wanted.
+type eventClient struct {
+	ch    chan Event
+	types map[string]bool
+	meta  bool
+}
+
+func (ec *eventClient) wants(eventType string) bool {
+	return ec.types == nil || ec.types[eventType] || eventType == EventSnapshot
+}
+
+// EventHub fans events out to the /api/v1/go_events streams. The latest page
+// and idle events are kept so new clients start from the current state.
+type EventHub struct {
+	mu      sync.Mutex
+	clients map[*eventClient]struct{}
+	nextID  uint64
+	latest  map[string]interface{}
+
+	pending    map[string]DataEntry
+	flushTimer *time.Timer
+}
+
+var events = NewEventHub()
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		clients: make(map[*eventClient]struct{}),
+		latest:  make(map[string]interface{}),
+		pending: make(map[string]DataEntry),
+	}
+}
+
+// Publish sends an event to every client that asked for its type. A client
+// whose buffer is full is disconnected rather than sent an incomplete delta;
+// EventSource reconnects on its own and starts over from a snapshot.
+func (h *EventHub) Publish(eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if eventType == EventPage || eventType == EventIdle {
+		h.latest[eventType] = data
+	}
+	h.publishLocked(eventType, data)
+}
+
+func (h *EventHub) publishLocked(eventType string, data interface{}) {
+	h.nextID++
+	ev := Event{ID: h.nextID, Type: eventType, Data: data}
+	for ec := range h.clients {
+		if !ec.wants(eventType) {
+			continue
+		}
+		select {
+		case ec.ch <- ev:
+		default:
+			log.Printf("📨 events: client fell behind, disconnecting it")
+			delete(h.clients, ec)
+			close(ec.ch)
+		}
+	}
+}
+
+// dataChanged queues a changed key for the next delta
+func (h *EventHub) dataChanged(key string, entry DataEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) == 0 {
+		return
+	}
+	h.pending[key] = entry
+	if h.flushTimer == nil {
+		h.flushTimer = time.AfterFunc(eventDataWindow, h.flushData)
+	}
+}
+
+func (h *EventHub) flushData() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flushTimer = nil
+	if len(h.pending) == 0 {
+		return
+	}
+	delta := h.pending
+	h.pending = make(map[string]DataEntry)
+	h.publishLocked(EventData, delta)
+}
+
+// subscribe registers a client and queues its snapshot: all data plus the
+// latest page and idle state
+func (h *EventHub) subscribe(types []string, meta bool) (*eventClient, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) >= maxEventClients {
+		return nil, errTooManyEventClients
+	}
+	ec := &eventClient{ch: make(chan Event, eventClientBuffer), meta: meta}
+	if len(types) > 0 {
+		ec.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			ec.types[t] = true
+		}
+	}
+
+	snapshot := map[string]interface{}{"data": globalData.Snapshot()}
+	for eventType, data := range h.latest {
+		snapshot[eventType] = data
+	}
+	h.nextID++
+	ec.ch <- Event{ID: h.nextID, Type: EventSnapshot, Data: snapshot}
+
+	h.clients[ec] = struct{}{}
+	return ec, nil
+}
+
+func (h *EventHub) unsubscribe(ec *eventClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[ec]; ok {
+		delete(h.clients, ec)
+		close(ec.ch)
+	}
+}
+
+// serve writes events as text/event-stream until the client goes away or
+// falls behind
+func (h *EventHub) serve(w *bufio.Writer, ec *eventClient) {
+	defer h.unsubscribe(ec)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev, ok := <-ec.ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, ev, ec.meta); err != nil {
+				log.Printf("📨 events: %v", err)
+				continue
+			}
+		case <-keepAlive.C:
+			w.WriteString(": keep-alive\n\n")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent formats one event. Data entries are sent as plain values like
+// go_data.json, or with timestamps and errors when meta is set.
+func writeEvent(w *bufio.Writer, ev Event, meta bool) error {
+	payload, err := json.Marshal(eventPayload(ev, meta))
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", ev.Type, err)
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, payload)
+	return nil
+}
+
+func eventPayload(ev Event, meta bool) interface{} {
+	switch data := ev.Data.(type) {
+	case map[string]DataEntry:
+		if meta {
+			return data
+		}
+		return entryValues(data)
+	case map[string]interface{}:
+		if entries, ok := data["data"].(map[string]DataEntry); ok && !meta {
+			out := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				out[k] = v
+			}
+			out["data"] = entryValues(entries)
+			return out
+		}
+	}
+	return ev.Data
+}
+
+func entryValues(entries map[string]DataEntry) map[string]interface{} {
+	out := make(map[string]interface{}, len(entries))
+	for key, entry := range entries {
+		out[key] = entry.Value
+	}
+	return out
+}
+
+// parseEventTypes reads the ?events=data,page filter
+func parseEventTypes(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var types []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.TrimSpace(t)
+		switch t {
+		case EventData, EventPage, EventIdle, EventSMS:
+			types = append(types, t)
+		default:
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return types, nil
+}
+
+// pageEvent describes the page on screen; index counts config pages first,
+// then SMS pages
+func pageEvent(index, total int, sms bool) map[string]interface{} {
+	return map[string]interface{}{"index": index, "total": total, "sms": sms}
+}
+
+// startEvents feeds data changes into the hub
+func startEvents() {
+	globalData.Observe(events.dataChanged)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultExternalInterval = 10 * time.Second
+	defaultExternalTimeout  = 5 * time.Second
+	// command output and files beyond this are cut off before parsing
+	maxExternalOutput = 64 * 1024
+)
+
+// externalCommandDir is the only place external collector commands may live.
+// They run as root, so installing a program there is the opt-in.
+var externalCommandDir = "/usr/local/libexec/pcat2_mini_display"
+
+// errExternalCollectorsLocal refuses external collectors outside config.json
+var errExternalCollectorsLocal = errors.New("external_collectors can only be set in config.json")
+
+// ExternalCollectorConfig declares a value read from a command or file, e.g.
+//
+//	{"data_key": "VpnState", "command": "/usr/local/libexec/pcat2_mini_display/wg-endpoint",
+//	 "parser": "regex", "regex": "\\s(\\S+):\\d+", "interval_seconds": 30}
+//
+// The value is stored under DataKey and can be shown by any "text" element.
+// Only config.json declares them; the user config, profiles and bundles can't.
+type ExternalCollectorConfig struct {
+	Name            string   `json:"name,omitempty"` // collector name in /api/v1/go_collectors.json, defaults to data_key
+	DataKey         string   `json:"data_key"`
+	Command         string   `json:"command,omitempty"`
+	Args            []string `json:"args,omitempty"`
+	File            string   `json:"file,omitempty"`
+	IntervalSeconds float64  `json:"interval_seconds,omitempty"`
+	TimeoutSeconds  float64  `json:"timeout_seconds,omitempty"`
+	Parser          string   `json:"parser,omitempty"` // "plain" (default), "json" or "regex"
+	Path            string   `json:"path,omitempty"`   // for "json": dot separated keys and list indexes, "peers.0.rx"
+	Regex           string   `json:"regex,omitempty"`  // for "regex": the first capture group, or the whole match
+}
+
+// externalCollector runs one ExternalCollectorConfig on the collector scheduler
+type externalCollector struct {
+	def ExternalCollectorConfig
+	re  *regexp.Regexp
+}
+
+// newExternalCollector checks def and prepares its parser
+func newExternalCollector(def ExternalCollectorConfig) (*externalCollector, error) {
+	if err := validateExternalCollector(def); err != nil {
+		return nil, err
+	}
+	ec := &externalCollector{def: def}
+	if def.Parser == "regex" {
+		ec.re = regexp.MustCompile(def.Regex) // compiled once already by the validation
+	}
+	return ec, nil
+}
+
+// validateExternalCollector reports the first problem with def
+func validateExternalCollector(def ExternalCollectorConfig) error {
+	if def.DataKey == "" {
+		return errors.New("data_key is required")
+	}
+	if (def.Command == "") == (def.File == "") {
+		return fmt.Errorf("%s: set exactly one of command and file", def.DataKey)
+	}
+	if def.Command != "" && (!filepath.IsAbs(def.Command) || filepath.Clean(def.Command) != def.Command ||
+		filepath.Dir(def.Command) != externalCommandDir) {
+		return fmt.Errorf("%s: command must be a program in %s, got %q", def.DataKey, externalCommandDir, def.Command)
+	}
+	if def.Command != "" {
+		if _, err := sanitizeCommand(def.Command, def.Args); err != nil {
+			return fmt.Errorf("%s: %v", def.DataKey, err)
+		}
+	}
+	if def.IntervalSeconds < 0 || def.TimeoutSeconds < 0 {
+		return fmt.Errorf("%s: interval_seconds and timeout_seconds must be ≥ 0", def.DataKey)
+	}
+	switch def.Parser {
+	case "", "plain":
+	case "json":
+		if def.Path == "" {
+			return fmt.Errorf("%s: the json parser needs a path", def.DataKey)
+		}
+	case "regex":
+		if _, err := regexp.Compile(def.Regex); err != nil || def.Regex == "" {
+			return fmt.Errorf("%s: invalid regex %q", def.DataKey, def.Regex)
+		}
+	default:
+		return fmt.Errorf("%s: parser must be plain, json or regex, got %q", def.DataKey, def.Parser)
+	}
+	return nil
+}
+
+// collectorName is the name the collector is scheduled and reported under
+func (def ExternalCollectorConfig) collectorName() string {
+	if def.Name != "" {
+		return def.Name
+	}
+	return def.DataKey
+}
+
+func (ec *externalCollector) Name() string { return ec.def.collectorName() }
+
+func (ec *externalCollector) Interval() time.Duration {
+	if ec.def.IntervalSeconds > 0 {
+		return secondsToDuration(ec.def.IntervalSeconds)
+	}
+	return defaultExternalInterval
+}
+
+// Collect reads and parses the source and stores the result
+func (ec *externalCollector) Collect(ctx context.Context) error {
+	data := globalData.Source(ec.Name())
+
+	raw, err := ec.read(ctx)
+	var value interface{}
+	if err == nil {
+		value, err = ec.parse(raw)
+	}
+	if err != nil {
+		data.StoreError(ec.def.DataKey, err)
+		return err
+	}
+	data.Store(ec.def.DataKey, value)
+	return nil
+}
+
+func (ec *externalCollector) read(ctx context.Context) ([]byte, error) {
+	timeout := defaultExternalTimeout
+	if ec.def.TimeoutSeconds > 0 {
+		timeout = secondsToDuration(ec.def.TimeoutSeconds)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if ec.def.File != "" {
+		f, err := os.Open(ec.def.File)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(io.LimitReader(f, maxExternalOutput))
+	}
+
+	out, err := secureExecCommandContext(ctx, maxExternalOutput, ec.def.Command, ec.def.Args...)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", ec.def.Command, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ec.def.Command, err)
+	}
+	return out, nil
+}
+
+func (ec *externalCollector) parse(raw []byte) (interface{}, error) {
+	switch ec.def.Parser {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("parse json: %v", err)
+		}
+		return lookupJSONPath(doc, ec.def.Path)
+	case "regex":
+		m := ec.re.FindSubmatch(raw)
+		if m == nil {
+			return nil, fmt.Errorf("regex %q did not match", ec.def.Regex)
+		}
+		if len(m) > 1 {
+			return strings.TrimSpace(string(m[1])), nil
+		}
+		return strings.TrimSpace(string(m[0])), nil
+	default:
+		return strings.TrimSpace(string(raw)), nil
+	}
+}
+
+// lookupJSONPath walks doc along path. Segments are object keys, or indexes
+// into lists. Numbers come back as int when whole, float64 otherwise.
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			next, ok := node[seg]
+			if !ok {
+				return nil, fmt.Errorf("path %s: no key %q", path, seg)
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("path %s: no index %q in list of %d", path, seg, len(node))
+			}
+			cur = node[i]
+		default:
+			return nil, fmt.Errorf("path %s: %q is not an object or list", path, seg)
+		}
+	}
+	if num, ok := cur.(json.Number); ok {
+		return jsonNumberValue(num), nil
+	}
+	return cur, nil
+}
+
+// jsonNumberValue turns a decoded json.Number into an int if it is whole
+func jsonNumberValue(num json.Number) interface{} {
+	if i, err := num.Int64(); err == nil {
+		return int(i)
+	}
+	if f, err := num.Float64(); err == nil {
+		return f
+	}
+	return num.String()
+}
+
+// checkNoExternalCollectors refuses user config, profile or bundle overrides
+// that declare external collectors
+func checkNoExternalCollectors(overrides map[string]interface{}) error {
+	if _, ok := overrides["external_collectors"]; ok {
+		return errExternalCollectorsLocal
+	}
+	return nil
+}
+
+// externalApplied is what applyExternalCollectors last scheduled. Guarded by
+// externalMu.
+var (
+	externalMu      sync.Mutex
+	externalApplied struct {
+		done  bool
+		defs  []ExternalCollectorConfig
+		names []string
+	}
+)
+
+// applyExternalCollectors schedules defs on s, replacing the external
+// collectors an earlier call scheduled when the definitions changed
+func applyExternalCollectors(s *CollectorScheduler, defs []ExternalCollectorConfig) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+	if externalApplied.done && reflect.DeepEqual(defs, externalApplied.defs) {
+		return
+	}
+	for _, name := range externalApplied.names {
+		s.Remove(name)
+		clearStaleAfter(name)
+	}
+	externalApplied.done = true
+	externalApplied.defs = defs
+	externalApplied.names = addExternalCollectors(s, defs)
+}
+
+// addExternalCollectors schedules every external collector in defs and
+// returns the names it scheduled. Broken definitions are logged and skipped
+// so one typo doesn't stop the others.
+func addExternalCollectors(s *CollectorScheduler, defs []ExternalCollectorConfig) []string {
+	taken := make(map[string]bool)
+	for _, h := range s.Health() {
+		taken[h.Name] = true
+	}
+	var names []string
+	for _, def := range defs {
+		ec, err := newExternalCollector(def)
+		if err != nil {
+			log.Printf("external collector %s skipped: %v", def.collectorName(), err)
+			continue
+		}
+		if taken[ec.Name()] {
+			log.Printf("external collector %s skipped: name already in use", ec.Name())
+			continue
+		}
+		taken[ec.Name()] = true
+		s.Add(ec)
+		names = append(names, ec.Name())
+	}
+	return names
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// FontDef is an entry of the fonts section of the config: a new named font,
+// or changes to a built-in or uploaded one, where fields left out keep
+// their value
+type FontDef struct {
+	Path     string   `json:"path,omitempty"`     // under the assets dir, or user/fonts/<file>
+	Size     float64  `json:"size,omitempty"`     // points
+	Weight   string   `json:"weight,omitempty"`   // the face to use from a collection, e.g. Bold
+	Hinting  string   `json:"hinting,omitempty"`  // full (default), vertical or none
+	Fallback []string `json:"fallback,omitempty"` // fonts for characters this one lacks, in order
+}
+
+var fontHintings = map[string]font.Hinting{
+	"":         font.HintingFull,
+	"full":     font.HintingFull,
+	"vertical": font.HintingVertical,
+	"none":     font.HintingNone,
+}
+
+// parsedFonts caches font files by path and weight, as one CJK collection
+// backs the fallback of every font size. Guarded by fontCacheMu.
+var parsedFonts = make(map[string]*opentype.Font)
+
+// mergeFontDefs lays the user's font entries over the default ones, field
+// by field
+func mergeFontDefs(base, user map[string]FontDef) map[string]FontDef {
+	out := make(map[string]FontDef, len(base)+len(user))
+	for name, def := range base {
+		out[name] = def
+	}
+	for name, ud := range user {
+		def := out[name]
+		if ud.Path != "" {
+			def.Path = ud.Path
+		}
+		if ud.Size != 0 {
+			def.Size = ud.Size
+		}
+		if ud.Weight != "" {
+			def.Weight = ud.Weight
+		}
+		if ud.Hinting != "" {
+			def.Hinting = ud.Hinting
+		}
+		if ud.Fallback != nil {
+			def.Fallback = ud.Fallback
+		}
+		out[name] = def
+	}
+	return out
+}
+
+// buildFontTable is the font table for a config: the built-in fonts, the
+// uploaded ones and defs on top
+func buildFontTable(defs map[string]FontDef) (map[string]FontConfig, error) {
+	table := builtinFonts()
+	uploaded, err := listUserAssets("fonts")
+	if err != nil {
+		log.Printf("user fonts not loaded: %v", err)
+	}
+	for _, a := range uploaded {
+		if _, ok := table[a.Font]; ok {
+			log.Printf("user font %s: %q is a built-in font name", a.Name, a.Font)
+			continue
+		}
+		table[a.Font] = FontConfig{FontPath: userAssetPath("fonts", a.Name), FontSize: defaultUserFontSize}
+	}
+
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := defs[name]
+		f, exists := table[name]
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("fonts: font names can't be empty")
+		}
+		if !exists && (def.Path == "" || def.Size == 0) {
+			return nil, fmt.Errorf("fonts.%s: a new font needs a path and a size", name)
+		}
+		if def.Path != "" {
+			if !containsString(fontExtensions, strings.ToLower(path.Ext(def.Path))) {
+				return nil, fmt.Errorf("fonts.%s.path must end in %s, got %q", name, strings.Join(fontExtensions, ", "), def.Path)
+			}
+			if _, err := os.Stat(assetPath(def.Path)); err != nil {
+				return nil, fmt.Errorf("fonts.%s.path: %q not found at %s", name, def.Path, assetPath(def.Path))
+			}
+			f.FontPath = assetPath(def.Path)
+		}
+		if def.Size < 0 || def.Size > 200 {
+			return nil, fmt.Errorf("fonts.%s.size must be 1-200, got %g", name, def.Size)
+		} else if def.Size > 0 {
+			f.FontSize = def.Size
+		}
+		if _, ok := fontHintings[def.Hinting]; !ok {
+			return nil, fmt.Errorf("fonts.%s.hinting must be full, vertical or none, got %q", name, def.Hinting)
+		} else if def.Hinting != "" {
+			f.Hinting = def.Hinting
+		}
+		if def.Weight != "" {
+			f.Weight = def.Weight
+		}
+		if def.Fallback != nil {
+			f.Fallback = def.Fallback
+		}
+		table[name] = f
+	}
+
+	for _, name := range names {
+		f := table[name]
+		for _, fb := range f.Fallback {
+			if _, ok := table[fb]; !ok || fb == name {
+				return nil, fmt.Errorf("fonts.%s.fallback: %q is not another font", name, fb)
+			}
+		}
+		if f.Weight != "" {
+			if _, err := loadFontFile(f.FontPath, f.Weight); err != nil {
+				return nil, fmt.Errorf("fonts.%s.weight: %v", name, err)
+			}
+		}
+	}
+	return table, nil
+}
+
+// setFonts replaces the font table the screen draws with
+func setFonts(table map[string]FontConfig) {
+	fontsMu.Lock()
+	fonts = table
+	fontsMu.Unlock()
+	fontCacheMu.Lock()
+	for name := range fontCache {
+		delete(fontCache, name)
+	}
+	parsedFonts = make(map[string]*opentype.Font)
+	fontCacheMu.Unlock()
+}
+
+// loadFontFile parses a TTF/OTF file, or picks the face named weight (first
+// face if "") from a TTC collection
+func loadFontFile(fontPath, weight string) (*opentype.Font, error) {
+	key := fontPath + "\x00" + weight
+	fontCacheMu.Lock()
+	f, ok := parsedFonts[key]
+	fontCacheMu.Unlock()
+	if ok {
+		return f, nil
+	}
+
+	fontBytes, err := os.ReadFile(fontPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading font file: %v", err)
+	}
+	var faces []*opentype.Font
+	// Handle TrueType Collections (.ttc files)
+	if strings.HasSuffix(fontPath, ".ttc") {
+		collection, err := opentype.ParseCollection(fontBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing font collection: %v", err)
+		}
+		for i := 0; i < collection.NumFonts(); i++ {
+			face, err := collection.Font(i)
+			if err != nil {
+				return nil, fmt.Errorf("error getting font from collection: %v", err)
+			}
+			faces = append(faces, face)
+		}
+	} else {
+		// Handle single font files (.ttf, .otf)
+		face, err := opentype.Parse(fontBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing font: %v", err)
+		}
+		faces = append(faces, face)
+	}
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("%s holds no fonts", fontPath)
+	}
+
+	f = faces[0]
+	if weight != "" {
+		f = nil
+		var have []string
+		var buf sfnt.Buffer
+		for _, face := range faces {
+			sub, _ := face.Name(&buf, sfnt.NameIDSubfamily)
+			if strings.EqualFold(sub, weight) {
+				f = face
+				break
+			}
+			have = append(have, sub)
+		}
+		if f == nil {
+			return nil, fmt.Errorf("%s has no %s face, only %s", path.Base(fontPath), weight, strings.Join(have, ", "))
+		}
+	}
+	fontCacheMu.Lock()
+	parsedFonts[key] = f
+	fontCacheMu.Unlock()
+	return f, nil
+}
+
+// fallbackFace draws each character with the first face that has a glyph
+// for it. Metrics are the first face's, so line heights don't change.
+type fallbackFace []font.Face
+
+func (f fallbackFace) pick(r rune) font.Face {
+	for _, face := range f {
+		if _, ok := face.GlyphAdvance(r); ok {
+			return face
+		}
+	}
+	return f[0]
+}
+
+// Close is a no-op, as it is for opentype faces
+func (f fallbackFace) Close() error { return nil }
+
+func (f fallbackFace) Metrics() font.Metrics { return f[0].Metrics() }
+
+func (f fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.pick(r0)
+	if face != f.pick(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
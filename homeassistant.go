@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const defaultDiscoveryPrefix = "homeassistant"
+
+// haEntity describes one Home Assistant entity backed by a data key topic
+type haEntity struct {
+	Component     string // "sensor" or "binary_sensor"
+	Key           string
+	Name          string
+	DeviceClass   string
+	Unit          string
+	StateClass    string
+	Icon          string
+	ValueTemplate string
+}
+
+// pingTemplate turns the -1/-2 failure codes into "unknown" instead of a latency
+const pingTemplate = "{{ value | int if value | int(-1) >= 0 else none }}"
+
+var haEntities = []haEntity{
+	{"sensor", "BatterySoc", "Battery", "battery", "%", "measurement", "", ""},
+	{"binary_sensor", "BatteryCharging", "Charging", "battery_charging", "", "", "", ""},
+	{"sensor", "BatteryWattage", "Battery Power", "power", "W", "measurement", "", ""},
+	{"sensor", "ModemSignalStrength", "Signal Strength", "", "%", "measurement", "mdi:signal-cellular-3", ""},
+	{"sensor", "DailyDataUsage", "Data Usage Today", "data_size", "GB", "total_increasing", "", ""},
+	{"sensor", "MonthlyDataUsage", "Data Usage This Month", "data_size", "GB", "total_increasing", "", ""},
+	{"sensor", "Ping0", "Ping Site 0", "duration", "ms", "measurement", "", pingTemplate},
+	{"sensor", "Ping1", "Ping Site 1", "duration", "ms", "measurement", "", pingTemplate},
+	{"sensor", "CpuTemp", "CPU Temperature", "temperature", "°C", "measurement", "", ""},
+	{"sensor", "FanRPM", "Fan Speed", "", "RPM", "measurement", "mdi:fan", ""},
+}
+
+var haNodeIDRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// haNodeID is the client id made safe for discovery topics and unique ids
+func (p *MQTTPublisher) haNodeID() string {
+	return haNodeIDRe.ReplaceAllString(p.conf.ClientID, "_")
+}
+
+func (p *MQTTPublisher) discoveryPrefix() string {
+	if p.conf.DiscoveryPrefix != "" {
+		return strings.TrimSuffix(p.conf.DiscoveryPrefix, "/")
+	}
+	return defaultDiscoveryPrefix
+}
+
+func (p *MQTTPublisher) commandTopic(name string) string { return p.prefix + "/cmd/" + name }
+func (p *MQTTPublisher) brightnessTopic() string         { return p.prefix + "/state/brightness" }
+
+// haDevice groups every entity under one device in Home Assistant
+func (p *MQTTPublisher) haDevice() map[string]interface{} {
+	device := map[string]interface{}{
+		"identifiers":  []string{p.haNodeID()},
+		"name":         "Photonicat 2",
+		"manufacturer": "Photonicat",
+		"model":        "Photonicat 2",
+	}
+	if model, ok := globalData.String("Model"); ok && model != "" {
+		device["model"] = model
+	}
+	if fw, ok := globalData.String("FirmwareVersion"); ok && fw != "" {
+		device["sw_version"] = fw
+	}
+	return device
+}
+
+// haDiscovery returns discovery topic → config payload for every sensor and command
+func (p *MQTTPublisher) haDiscovery() map[string]map[string]interface{} {
+	node := p.haNodeID()
+	device := p.haDevice()
+	out := make(map[string]map[string]interface{})
+
+	base := func(objectID, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":                  name,
+			"unique_id":             node + "_" + objectID,
+			"object_id":             node + "_" + objectID,
+			"availability_topic":    p.statusTopic(),
+			"payload_available":     mqttOnline,
+			"payload_not_available": mqttOffline,
+			"device":                device,
+		}
+	}
+	topic := func(component, objectID string) string {
+		return p.discoveryPrefix() + "/" + component + "/" + node + "/" + objectID + "/config"
+	}
+
+	for _, e := range haEntities {
+		objectID := strings.ToLower(e.Key)
+		conf := base(objectID, e.Name)
+		conf["state_topic"] = p.keyTopic(e.Key)
+		if e.Component == "binary_sensor" {
+			conf["payload_on"] = "true"
+			conf["payload_off"] = "false"
+		}
+		if e.DeviceClass != "" {
+			conf["device_class"] = e.DeviceClass
+		}
+		if e.Unit != "" {
+			conf["unit_of_measurement"] = e.Unit
+		}
+		if e.StateClass != "" {
+			conf["state_class"] = e.StateClass
+		}
+		if e.Icon != "" {
+			conf["icon"] = e.Icon
+		}
+		if e.ValueTemplate != "" {
+			conf["value_template"] = e.ValueTemplate
+		}
+		out[topic(e.Component, objectID)] = conf
+	}
+
+	next := base("next_page", "Next Page")
+	next["command_topic"] = p.commandTopic("change_page")
+	next["icon"] = "mdi:page-next"
+	out[topic("button", "next_page")] = next
+
+	text := base("show_text", "Show Text")
+	text["command_topic"] = p.commandTopic("show_text")
+	text["max"] = 64
+	text["icon"] = "mdi:message-text"
+	out[topic("text", "show_text")] = text
+
+	resume := base("resume", "Resume Pages")
+	resume["command_topic"] = p.commandTopic("resume")
+	resume["icon"] = "mdi:play"
+	out[topic("button", "resume")] = resume
+
+	brightness := base("brightness", "Screen Brightness")
+	brightness["command_topic"] = p.commandTopic("brightness")
+	brightness["state_topic"] = p.brightnessTopic()
+	brightness["min"] = 0
+	brightness["max"] = 100
+	brightness["unit_of_measurement"] = "%"
+	brightness["icon"] = "mdi:brightness-6"
+	out[topic("number", "brightness")] = brightness
+
+	return out
+}
+
+// publishDiscovery announces every entity; retained so Home Assistant finds
+// them after its own restarts too
+func (p *MQTTPublisher) publishDiscovery() {
+	for topic, conf := range p.haDiscovery() {
+		raw, err := json.Marshal(conf)
+		if err != nil {
+			log.Printf("📡 MQTT: marshal discovery for %s: %v", topic, err)
+			continue
+		}
+		p.publish(topic, string(raw))
+	}
+}
+
+// publishBrightness reports the backlight level after clamping to the configured range
+func (p *MQTTPublisher) publishBrightness() {
+	mu.Lock()
+	level := lastLogical
+	mu.Unlock()
+	p.publish(p.brightnessTopic(), strconv.Itoa(level))
+}
+
+// subscribeHomeAssistant listens for commands and for Home Assistant coming
+// back online, which asks devices to announce themselves again
+func (p *MQTTPublisher) subscribeHomeAssistant(c mqtt.Client) {
+	qos := byte(p.conf.QoS)
+	c.Subscribe(p.commandTopic("+"), qos, func(_ mqtt.Client, msg mqtt.Message) {
+		p.handleCommand(strings.TrimPrefix(msg.Topic(), p.commandTopic("")), string(msg.Payload()))
+	})
+	c.Subscribe(p.discoveryPrefix()+"/status", qos, func(_ mqtt.Client, msg mqtt.Message) {
+		if string(msg.Payload()) == mqttOnline {
+			go p.publishDiscovery()
+		}
+	})
+}
+
+// haCommandHandlers maps a command topic to what the HTTP API does for it.
+// Handlers run on the MQTT client's goroutine and must not block for long.
+var haCommandHandlers = map[string]func(p *MQTTPublisher, payload string){
+	"change_page": func(p *MQTTPublisher, payload string) {
+		triggerPageChange()
+	},
+	"show_text": func(p *MQTTPublisher, payload string) {
+		go showText(payload)
+	},
+	"resume": func(p *MQTTPublisher, payload string) {
+		resumeMainLoop()
+	},
+	"brightness": func(p *MQTTPublisher, payload string) {
+		level, err := strconv.ParseFloat(strings.TrimSpace(payload), 64)
+		if err != nil {
+			log.Printf("📡 MQTT brightness: %q is not a number", payload)
+			return
+		}
+		setBacklight(int(level))
+		// publishing waits for the broker, which a message handler must not do
+		go p.publishBrightness()
+	},
+}
+
+func (p *MQTTPublisher) handleCommand(name, payload string) {
+	handler, ok := haCommandHandlers[name]
+	if !ok {
+		log.Printf("📡 MQTT: unknown command %q", name)
+		return
+	}
+	log.Printf("📡 MQTT command %s %q", name, payload)
+	handler(p, payload)
+}
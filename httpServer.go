@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"image/gif"
 	"image/png"
+	"io"
 	"log"
 	"math"
 	"math/rand"
@@ -66,12 +70,26 @@ var (
 	defaultConfig  Config                 // loaded from default_config.json
 	userOverrides  map[string]interface{} // raw overrides from user_config.json
 	userJsonConfig = ""
+	// every read and write of the user config goes through this path
+	userConfigFile = ETC_USER_CONFIG_PATH
+	userConfigMu   sync.Mutex // serializes applyUserOverrides
 )
 
 func serveFrame(c *fiber.Ctx) error {
 	var err error
 	var buf bytes.Buffer
 
+	// The screen mirror holds the composited screen, including transitions,
+	// welcome/ciao and text overlays that bypass the framebuffers
+	if vd := screenMirror(); vd != nil {
+		if err = png.Encode(&buf, vd.Snapshot()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to encode image")
+		}
+		c.Set("Content-Type", "image/png")
+		c.Set("Content-Length", strconv.Itoa(buf.Len()))
+		return c.Send(buf.Bytes())
+	}
+
 	if webFrame == nil {
 		webFrame = GetFrameBuffer(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
 		clearFrame(webFrame, PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
@@ -143,40 +161,99 @@ func indexHandler(c *fiber.Ctx) error {
 	return c.SendFile("assets/html/index.html")
 }
 
+// GET /api/v1/go_stream.mjpeg
+// Live MJPEG stream of the screen, pushed as the main loop draws. Works directly
+// as an <img> src, so the web mirror needs no polling.
+func serveStream(c *fiber.Ctx) error {
+	if liveStream == nil {
+		return apiError(c, fiber.StatusServiceUnavailable, errNoScreenCopy.Error())
+	}
+	ch, err := liveStream.subscribe()
+	if err != nil {
+		return apiError(c, fiber.StatusServiceUnavailable, err.Error())
+	}
+
+	c.Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+	c.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		liveStream.serve(w, ch)
+	})
+	return nil
+}
+
+// GET /api/v1/go_events?events=data,page,idle,sms&meta=1
+// Server-Sent Events: a snapshot first, then data deltas, page changes, idle
+// state changes and new SMS as they happen.
+func serveEvents(c *fiber.Ctx) error {
+	types, err := parseEventTypes(c.Query("events"))
+	if err != nil {
+		return apiError(c, 400, err.Error())
+	}
+	ec, err := events.subscribe(types, c.QueryBool("meta"))
+	if err != nil {
+		return apiError(c, fiber.StatusServiceUnavailable, err.Error())
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		events.serve(w, ec)
+	})
+	return nil
+}
+
+// GET /api/v1/go_record.gif?seconds=N
+// Blocks for N seconds (default 5) while recording the screen, then returns an
+// animated GIF. Trigger page changes meanwhile to capture transitions.
+func serveRecording(c *fiber.Ctx) error {
+	seconds := c.QueryInt("seconds", 5)
+	if seconds < 1 || seconds > maxRecordSeconds {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("seconds must be between 1 and %d", maxRecordSeconds),
+		})
+	}
+
+	anim, err := recordScreen(screenMirror(), time.Duration(seconds)*time.Second)
+	if errors.Is(err, errRecordingBusy) {
+		return apiError(c, fiber.StatusConflict, err.Error())
+	} else if err != nil {
+		return apiError(c, fiber.StatusServiceUnavailable, err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to encode recording")
+	}
+	log.Printf("🎥 Recorded %d frames in %ds (%d KB)", len(anim.Image), seconds, buf.Len()/1024)
+
+	c.Set("Content-Type", "image/gif")
+	c.Set("Content-Length", strconv.Itoa(buf.Len()))
+	return c.Send(buf.Bytes())
+}
+
 // GET  /api/v1/changePage
 func changePage(c *fiber.Ctx) error {
-	lastActivityMu.Lock()
-	httpChangePageTriggered = true
-	lastActivity = time.Now() // Set to current time to avoid triggering fade-in
-	lastActivityMu.Unlock()
-	
-	// Signal the main loop to interrupt FPS sleep
-	signalPageChange()
-	
-	// Set swippingScreen to prevent backlight fade-in during HTTP page changes
-	swippingScreen = true
-	
-	// Invalidate pre-calculated data since page is changing via HTTP
-	// invalidatePreCalculatedData() // Function temporarily disabled
-	
+	triggerPageChange()
 	return c.JSON(fiber.Map{"status": "page change triggered"})
 }
 
+// triggerPageChange makes the main loop slide to the next page as if the button
+// had been pressed
+func triggerPageChange() {
+	requestPage(pageTarget{step: 1})
+}
+
 // GET  /api/v1/data.json
+// Returns key → value. With ?meta=1 each key maps to its full entry instead:
+// value, display text, type, unit, source, updated_at and any error.
 func getData(c *fiber.Ctx) error {
-	// 1) Build a plain map from the sync.Map
-	out := make(map[string]interface{})
-
-	globalData.Range(func(key, value interface{}) bool {
-		// assume your keys are strings
-		if ks, ok := key.(string); ok {
-			out[ks] = value
-		}
-		return true // continue iteration
-	})
-
-	// 2) Return that map as JSON
-	return c.JSON(out)
+	if c.QueryBool("meta") {
+		return c.JSON(globalData.Snapshot())
+	}
+	return c.JSON(globalData.Values())
 }
 
 // loadUserConfig reads existing file into globalData
@@ -184,7 +261,7 @@ func loadUserConfig() string {
 	if userJsonConfig != "" {
 		return userJsonConfig
 	}
-	path := ETC_USER_CONFIG_PATH
+	path := userConfigFile
 	raw, err := os.ReadFile(path)
 
 	if err != nil {
@@ -206,15 +283,16 @@ func loadUserConfig() string {
 		return "{}"
 	}
 
+	data := globalData.Source("user_config")
 	for k, v := range m {
-		globalData.Store(k, v)
+		data.Store(k, v)
 	}
 	log.Printf("loaded %d entries from user config", len(m))
 	userJsonConfig = string(raw)
 	return userJsonConfig
 }
 
-// saveUserConfigToFile writes the userCfg struct to ETC_USER_CONFIG_PATH atomically.
+// saveUserConfigToFile writes the userCfg struct to userConfigFile atomically.
 // Returns true on success, false on any error.
 func saveUserConfigToFile() bool {
 	// 1) Marshal with indentation
@@ -225,20 +303,20 @@ func saveUserConfigToFile() bool {
 	}
 
 	// 2) Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(ETC_USER_CONFIG_PATH), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(userConfigFile), 0755); err != nil {
 		log.Printf("could not create config dir: %v", err)
 		return false
 	}
 
 	// 3) Write to temp file
-	tmpPath := ETC_USER_CONFIG_PATH + ".tmp"
+	tmpPath := userConfigFile + ".tmp"
 	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
 		log.Printf("could not write temp user config: %v", err)
 		return false
 	}
 
 	// 4) Rename temp file into place
-	if err := os.Rename(tmpPath, ETC_USER_CONFIG_PATH); err != nil {
+	if err := os.Rename(tmpPath, userConfigFile); err != nil {
 		log.Printf("could not rename temp config file: %v", err)
 		return false
 	}
@@ -266,8 +344,8 @@ func saveUserConfigFromStr(str string) bool {
 	// 3) Write the prettified JSON to disk atomically
 	//    (we skip updating userCfg here since you may not have a struct to unmarshal into;
 	//     if you do, unmarshal into it before step 1 and assign to userCfg)
-	tmpPath := ETC_USER_CONFIG_PATH + ".tmp"
-	if err := os.MkdirAll(filepath.Dir(ETC_USER_CONFIG_PATH), 0755); err != nil {
+	tmpPath := userConfigFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(userConfigFile), 0755); err != nil {
 		log.Printf("could not create config dir: %v", err)
 		return false
 	}
@@ -275,7 +353,7 @@ func saveUserConfigFromStr(str string) bool {
 		log.Printf("could not write temp config: %v", err)
 		return false
 	}
-	if err := os.Rename(tmpPath, ETC_USER_CONFIG_PATH); err != nil {
+	if err := os.Rename(tmpPath, userConfigFile); err != nil {
 		log.Printf("could not rename temp config into place: %v", err)
 		return false
 	}
@@ -293,9 +371,10 @@ func updateData(c *fiber.Ctx) error {
 			JSON(fiber.Map{"error": "invalid JSON"})
 	}
 
-	// 2. Store each entry into the sync.Map
+	// 2. Store each entry, converted to the key's declared type
+	data := globalData.Source("api")
 	for k, v := range payload {
-		globalData.Store(k, v)
+		data.Store(k, v)
 	}
 
 	// 3. Return a success response
@@ -309,7 +388,7 @@ func getDefaultConfig(c *fiber.Ctx) error {
 // GET /api/v1/get_user_config.json
 func getUserConfig(c *fiber.Ctx) error {
 	// 1) Read the file
-	data, err := os.ReadFile(ETC_USER_CONFIG_PATH)
+	data, err := os.ReadFile(userConfigFile)
 	if err != nil {
 		log.Printf("could not read user config: %v", err)
 		return c.
@@ -328,55 +407,44 @@ func getUserConfig(c *fiber.Ctx) error {
 // saveUserConfigFromWeb handles a JSON payload, validates & saves it,
 // and returns appropriate HTTP statuses.
 func saveUserConfigFromWeb(c *fiber.Ctx) error {
-	body := string(c.Body())
+	// Refuse what a reload would refuse, before it replaces the file
+	if issues, err := validateUserConfig(c.Body()); err != nil {
+		resp := fiber.Map{"status": "error", "message": err.Error()}
+		if issues != nil {
+			resp["issues"] = issues
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(resp)
+	}
 
-	// Attempt to save; this returns false on any validation/write error.
-	if ok := saveUserConfigFromStr(body); !ok {
-		// Distinguish “invalid JSON” vs “disk/write error”?
-		// If you need that, change saveUserConfigFromStr to return (bool, error).
-		// For now, we’ll lump all failures under 400 Bad Request.
+	overrides := map[string]interface{}{}
+	if err := secureUnmarshal(c.Body(), &overrides); err != nil {
 		return c.Status(fiber.StatusBadRequest).
-			JSON(fiber.Map{"status": "error", "message": "invalid JSON or unable to save config"})
+			JSON(fiber.Map{"status": "error", "message": "invalid JSON: " + err.Error()})
+	}
+	// Save and apply under userConfigMu, so page edits in flight aren't lost;
+	// a config that doesn't apply leaves the previous file in place
+	if err := applyUserOverrides(overrides); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error()})
 	}
-
-	// Success
-	//loadAllConfigsToVariables() //TODO: this is probably not needed, but it's a good idea to reload the configs
 	return c.JSON(fiber.Map{"status": "ok"})
 }
 
 // POST /api/v1/set_user_config.json
+// Deep-merges the body into the user config.
 func setUserConfig(c *fiber.Ctx) error {
-	// 1) Parse incoming JSON into a generic map
 	var payload map[string]interface{}
 	if err := c.BodyParser(&payload); err != nil {
 		return c.
 			Status(fiber.StatusBadRequest).
 			JSON(fiber.Map{"error": "invalid JSON"})
 	}
-
-	// 2) Merge into the in-memory overrides under lock
-	configMutex.Lock()
-	userOverrides = deepMerge(userOverrides, payload)
-	configMutex.Unlock()
-
-	// 3) Persist back to disk
-	raw, err := json.MarshalIndent(userOverrides, "", "  ")
-	if err != nil {
-		log.Printf("warning: could not marshal user_config.json: %v", err)
+	if err := patchUserOverrides(payload); err != nil {
+		log.Printf("warning: could not save user config: %v", err)
 		return c.
-			Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"error": "could not save config"})
-	}
-	if err := os.WriteFile("config/user_config.json", raw, 0644); err != nil {
-		log.Printf("warning: could not write user_config.json: %v", err)
-		return c.
-			Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"error": "could not save config"})
+			Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
 	}
-
-	// 4) Rebuild merged cfg
-	mergeConfigs()
-
 	return c.JSON(fiber.Map{"status": "ok"})
 }
 
@@ -389,30 +457,104 @@ func getConfig(c *fiber.Ctx) error {
 
 // POST /api/v1/set_config.json
 func setConfig(c *fiber.Ctx) error {
-	// Parse incoming JSON as generic map
-	var payload map[string]interface{}
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).
-			JSON(fiber.Map{"error": "invalid JSON"})
+	return setUserConfig(c)
+}
+
+// readUserOverrides returns the user config file as raw keys, so fields the
+// Config struct doesn't know survive a rewrite. A missing file is empty.
+func readUserOverrides() (map[string]interface{}, error) {
+	raw, err := os.ReadFile(userConfigFile)
+	if os.IsNotExist(err) {
+		return map[string]interface{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	overrides := map[string]interface{}{}
+	if err := secureUnmarshal(raw, &overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", userConfigFile, err)
+	}
+	// an older user config may carry external collectors, which are ignored
+	// there; drop them so the next write doesn't trip over them
+	delete(overrides, "external_collectors")
+	return overrides, nil
+}
+
+// patchUserOverrides deep-merges patch into the saved user config and applies it
+func patchUserOverrides(patch map[string]interface{}) error {
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	overrides, err := readUserOverrides()
+	if err != nil {
+		return err
 	}
+	return applyUserOverridesLocked(deepMerge(overrides, patch))
+}
 
-	configMutex.Lock()
-	defer configMutex.Unlock()
+// applyUserOverrides replaces the user config and rebuilds cfg. The new config
+// must parse and pass mergeConfigs' validation; otherwise the previous file and
+// cfg are put back and the validation error is returned.
+func applyUserOverrides(overrides map[string]interface{}) error {
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	return applyUserOverridesLocked(overrides)
+}
 
-	// Merge new values into overrides
-	userOverrides = deepMerge(userOverrides, payload)
+func applyUserOverridesLocked(overrides map[string]interface{}) error {
+	if err := checkNoExternalCollectors(overrides); err != nil {
+		return err
+	}
+	pretty, err := json.MarshalIndent(overrides, "", "    ")
+	if err != nil {
+		return err
+	}
+	var next Config
+	if err := json.Unmarshal(pretty, &next); err != nil {
+		return fmt.Errorf("invalid user config: %w", err)
+	}
+	_, hasShowSms := overrides["show_sms"]
+	if _, err := buildConfig(baseConfig(dftCfg), next, hasShowSms); err != nil {
+		return err
+	}
 
-	// Persist userOverrides back to disk
-	if raw, err := json.MarshalIndent(userOverrides, "", "  "); err != nil {
-		log.Printf("warning: could not marshal user_config.json: %v", err)
-	} else if err := os.WriteFile("config/user_config.json", raw, 0644); err != nil {
-		log.Printf("warning: could not write user_config.json: %v", err)
+	previous, readErr := os.ReadFile(userConfigFile)
+	if err := writeUserConfigFile(pretty); err != nil {
+		return err
+	}
+	prevCfg := userCfg
+	userCfg = next
+	if err := mergeConfigs(); err != nil {
+		// mergeConfigs reads show_sms from the file, so restore that too
+		if readErr == nil {
+			writeUserConfigFile(previous)
+		} else {
+			os.Remove(userConfigFile)
+		}
+		userCfg = prevCfg
+		mergeConfigs()
+		return err
 	}
 
-	// Rebuild merged cfg
-	mergeConfigs()
+	configMutex.Lock()
+	userOverrides = overrides
+	userJsonConfig = string(pretty)
+	configMutex.Unlock()
+	log.Printf("saved user config to %s", userConfigFile)
+	return nil
+}
 
-	return c.JSON(fiber.Map{"status": "ok"})
+// writeUserConfigFile replaces userConfigFile atomically
+func writeUserConfigFile(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(userConfigFile), 0755); err != nil {
+		return fmt.Errorf("could not create config dir: %w", err)
+	}
+	tmpPath := userConfigFile + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("could not write temp user config: %w", err)
+	}
+	if err := os.Rename(tmpPath, userConfigFile); err != nil {
+		return fmt.Errorf("could not rename temp user config into place: %w", err)
+	}
+	return nil
 }
 
 // deepMerge merges src into dest (in-place) for nested maps
@@ -454,10 +596,30 @@ func getStatus(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "ok"})
 }
 
+// GET /api/v1/go_collectors.json
+func getCollectors(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok", "collectors": collectors.Health()})
+}
+
+// POST /api/v1/go_set_collector, form values name and enabled. Lasts until restart;
+// use the "collectors" section of the user config to make it permanent.
+func setCollectorEnabled(c *fiber.Ctx) error {
+	name := c.FormValue("name")
+	raw := strings.ToLower(c.FormValue("enabled"))
+	if raw != "true" && raw != "false" {
+		return apiError(c, 400, "enabled must be boolean")
+	}
+	if err := collectors.SetEnabled(name, raw == "true"); err != nil {
+		return apiError(c, 404, err.Error())
+	}
+	log.Printf("collector %s enabled=%s via API", name, raw)
+	return c.JSON(fiber.Map{"status": "ok", "name": name, "enabled": raw == "true"})
+}
+
 func resetConfig(c *fiber.Ctx) error {
-	cfg = dftCfg
-	userCfg = Config{}
-	saveUserConfigToFile()
+	if err := applyUserOverrides(map[string]interface{}{}); err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
 	return c.JSON(fiber.Map{"status": "ok"})
 }
 
@@ -486,14 +648,27 @@ func hsvToRgb(h, s, v float64) (r, g, b float64) {
 }
 
 func httpDrawText(c *fiber.Ctx) error {
+	// 1) Grab the "text" query (empty if missing)
+	text := c.Query("text", "")
+
+	now := showText(text)
+
+	// 6) JSON response
+	return c.JSON(fiber.Map{
+		"status": "ok",
+		"text":   text,
+		"time":   now,
+	})
+}
+
+// showText pauses the main loop and fills the screen with text, or a test pattern
+// when text is empty. It returns the time shown on the pattern.
+func showText(text string) string {
 	// Acquire lock (blocks if another request is drawing)
 	now := time.Now().Format("2025-01-01 15:04:05")
 	drawMu.Lock()
 	defer drawMu.Unlock()
 
-	// 1) Grab the "text" query (empty if missing)
-	text := c.Query("text", "")
-
 	// 2) Load your tiny font
 	faceTiny, _, err := getFontFace("tiny")
 	if err != nil {
@@ -551,19 +726,18 @@ func httpDrawText(c *fiber.Ctx) error {
 	// 5) Push to display
 	time.Sleep(50 * time.Millisecond) //wait other goroutine to finish, TODO use mutex
 	sendFull(display, frame)
-
-	// 6) JSON response
-	return c.JSON(fiber.Map{
-		"status": "ok",
-		"text":   text,
-		"time":   now,
-	})
+	return now
 }
 
 func makeItRun(c *fiber.Ctx) error {
+	resumeMainLoop()
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// resumeMainLoop hands the screen back to the pages after showText
+func resumeMainLoop() {
 	weAreRunning = true
 	runMainLoop = true
-	return c.JSON(fiber.Map{"status": "ok"})
 }
 
 func setPingSites(c *fiber.Ctx) error {
@@ -583,12 +757,12 @@ func setScreenDimmerTime(c *fiber.Ctx) error {
 
 	onBatterySecondsInt, err := strconv.Atoi(onBatterySeconds)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "Invalid screen_dimmer_time_on_battery_seconds"})
+		return apiError(c, 400, "Invalid screen_dimmer_time_on_battery_seconds")
 	}
 
 	onDCSecondsInt, err := strconv.Atoi(onDCSeconds)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "Invalid screen_dimmer_time_on_dc_seconds"})
+		return apiError(c, 400, "Invalid screen_dimmer_time_on_dc_seconds")
 	}
 
 	configMutex.Lock()
@@ -620,30 +794,90 @@ func setShowSMS(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "ok", "showSMS": raw})
 }
 
+// requestBodyLimit is the largest body a route takes: layout zips and asset
+// uploads may be up to maxBundleSize, everything else keeps fiber's default
+func requestBodyLimit(c *fiber.Ctx) int {
+	switch {
+	case c.Method() == fiber.MethodPost && c.Path() == API_V2_PREFIX+"/config/import",
+		c.Method() == fiber.MethodPut && strings.HasPrefix(c.Path(), API_V2_PREFIX+"/assets/"):
+		return maxBundleSize
+	}
+	return fiber.DefaultBodyLimit
+}
+
+// limitBody reads the streamed request body up to requestBodyLimit, or
+// answers 413. The server streams bodies beyond fiber's default limit instead
+// of refusing them, so this is what holds every other route to it.
+func limitBody(c *fiber.Ctx) error {
+	limit := requestBodyLimit(c)
+	tooLarge := func() error {
+		c.Context().SetConnectionClose()
+		return apiError(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d MB", limit>>20))
+	}
+	req := c.Request()
+	if req.Header.ContentLength() > limit {
+		return tooLarge()
+	}
+	stream := req.BodyStream()
+	if stream == nil {
+		return c.Next()
+	}
+	body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if len(body) > limit {
+		return tooLarge()
+	}
+	req.SetBody(body)
+	return c.Next()
+}
+
 func httpServer(port string) {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: apiErrorHandler, StreamRequestBody: true})
+	app.Use(limitBody)
+
+	if screen := screenMirror(); screen != nil {
+		liveStream = newFrameStream(screen)
+	}
+
+	// Routes. read needs any token, admin the admin token; admin routes change
+	// the screen or config and are rate limited. Configs hold secrets such as
+	// the MQTT password, so reading them needs the admin token too. main
+	// loaded the tokens with the rest of the runtime config.
+	read := requireScope(scopeRead)
+	admin := requireScope(scopeAdmin)
+	limit := adminRateLimiter() // one budget per client across all admin routes
 
-	// Routes
 	app.Get("/", indexHandler)
-	app.Get("/api/v1/go_frame.png", serveFrame)
-	app.Get("/api/v1/go_data.json", getData)     //TODO: add content
-	app.Post("/api/v1/go_data.json", updateData) //TODO: add content
-	app.Get("/api/v1/go_changePage", changePage)
-	app.Get("/api/v1/go_display_text.json", httpDrawText)
-	app.Get("/api/v1/go_make_it_run", makeItRun)
+	app.Get("/api/v1/go_frame.png", read, serveFrame)
+	app.Get("/api/v1/go_stream.mjpeg", read, serveStream)
+	app.Get("/api/v1/go_record.gif", read, serveRecording)
+	app.Get("/api/v1/go_events", read, serveEvents)
+	app.Get("/api/v1/go_data.json", read, getData)             //TODO: add content
+	app.Post("/api/v1/go_data.json", admin, limit, updateData) //TODO: add content
+	app.Get("/api/v1/go_changePage", admin, limit, changePage)
+	app.Get("/api/v1/go_display_text.json", admin, limit, httpDrawText)
+	app.Get("/api/v1/go_make_it_run", admin, limit, makeItRun)
 	//get/set configs (json)
-	app.Get("/api/v1/go_get_default_config.json", getDefaultConfig)
-	app.Get("/api/v1/go_get_config.json", getConfig)
-	app.Get("/api/v1/go_get_user_config.json", getUserConfig)
-	app.Post("/api/v1/go_save_user_config.json", saveUserConfigFromWeb)
-	app.Post("/api/v1/go_set_user_config.json", setUserConfig)
-	app.Get("/api/v1/go_get_status.json", getStatus)
-	app.Get("/api/v1/go_reset_config", resetConfig)
+	app.Get("/api/v1/go_get_default_config.json", admin, getDefaultConfig)
+	app.Get("/api/v1/go_get_config.json", admin, getConfig)
+	app.Get("/api/v1/go_get_user_config.json", admin, getUserConfig)
+	app.Post("/api/v1/go_save_user_config.json", admin, limit, saveUserConfigFromWeb)
+	app.Post("/api/v1/go_set_user_config.json", admin, limit, setUserConfig)
+	app.Get("/api/v1/go_get_status.json", read, getStatus)
+	app.Get("/api/v1/go_reset_config", admin, limit, resetConfig)
 
 	//get/set individual configs
-	app.Post("/api/v1/go_set_ping_sites", setPingSites)
-	app.Post("/api/v1/go_set_screen_dimmer_time", setScreenDimmerTime)
-	app.Post("/api/v1/go_set_show_sms", setShowSMS)
+	app.Post("/api/v1/go_set_ping_sites", admin, limit, setPingSites)
+	app.Post("/api/v1/go_set_screen_dimmer_time", admin, limit, setScreenDimmerTime)
+	app.Post("/api/v1/go_set_show_sms", admin, limit, setShowSMS)
+
+	app.Get("/metrics", read, serveMetrics)
+	app.Get("/api/v1/go_collectors.json", read, getCollectors)
+	app.Post("/api/v1/go_set_collector", admin, limit, setCollectorEnabled)
+
+	registerAPIv2(app, read, admin, limit)
 
 	// Start server, retry if failed
 	var ln net.Listener
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image"
@@ -56,6 +57,9 @@ const (
 
 	ETC_USER_CONFIG_PATH = "/etc/pcat2_mini_display-user_config.json"
 	ETC_CONFIG_PATH      = "/etc/pcat2_mini_display-config.json"
+
+	BACKLIGHT_BRIGHTNESS_PATH = "/sys/class/backlight/backlight/brightness"
+	MOVEMENT_TRIGGER_PATH     = "/sys/kernel/photonicat-pm/movement_trigger"
 )
 
 var (
@@ -85,19 +89,19 @@ var (
 
 	frameMutex sync.RWMutex
 	// Optimized buffer manager
-	bufferManager   *BufferManager
-	frames          int
-	dataMutex       sync.RWMutex
-	dynamicData     map[string]string
-	imageCache      map[string]*image.RGBA
-	cfg             Config
-	dftCfg          Config
-	userCfg         Config
-	currPageIdx     int
-	fonts           map[string]FontConfig
-	assetsPrefix    = "."
-	globalData      sync.Map
-	autoRotatePages = false
+	bufferManager *BufferManager
+	frames        int
+	dataMutex     sync.RWMutex
+	dynamicData   map[string]string
+	imageCache    map[string]*image.RGBA
+	cfg           Config
+	dftCfg        Config
+	userCfg       Config
+	currPageIdx   int
+	fonts         map[string]FontConfig
+	assetsPrefix  = "."
+	sysRoot       = "/" // root that /sys, /proc and /etc lookups are resolved against
+	globalData    = NewDataStore()
 
 	// Frame buffer pool is now managed by BufferManager
 
@@ -131,11 +135,10 @@ var (
 
 	smsPagesImages []*image.RGBA
 
-	httpChangePageTriggered = false
-	changePageTriggered     = false
-	lastButtonPress         = time.Time{}
-	buttonDebounceDelay     = 40 * time.Millisecond
-	buttonPressInProgress   = false
+	changePageTriggered   = false
+	lastButtonPress       = time.Time{}
+	buttonDebounceDelay   = 40 * time.Millisecond
+	buttonPressInProgress = false
 	// Signal channel for interrupting FPS sleep on page changes
 	pageChangeSignal = make(chan struct{}, 1)
 	// Button timing tracking
@@ -176,9 +179,11 @@ var (
 	croppedFrameBuffer     *image.RGBA
 
 	// Performance optimization
-	easingLookup  []int
-	cachedFPSText string
-	lastFPSUpdate time.Time
+	easingLookup []int
+	// easingLookup mirrored, for slides from left to right
+	reverseEasingLookup []int
+	cachedFPSText       string
+	lastFPSUpdate       time.Time
 
 	topBarFrameWidth  = PCAT2_LCD_WIDTH
 	topBarFrameHeight = PCAT2_TOP_BAR_HEIGHT
@@ -195,8 +200,9 @@ var (
 	footerFramebuffers [2]*image.RGBA
 
 	lenSmsPagesImages = 1
-	display           gc9307.Device
+	display           DisplaySink
 	displayWrapper    *DisplayWrapper
+	virtualMode       = false
 
 	cfgNumPages = 0
 
@@ -274,27 +280,47 @@ type GraphConfig struct {
 	TimeFrameMins int    `json:"time_frame_mins"` // time frame in minutes
 }
 
-// DisplayTemplate holds pages of elements.
+// DisplayTemplate holds pages of elements. Pages, when set, orders, names
+// and hides them; otherwise every key of Elements is shown in number order.
 type DisplayTemplate struct {
 	Elements map[string][]DisplayElement `json:"elements"`
+	Pages    []PageMeta                  `json:"pages,omitempty"`
 }
 
 // Config represents the overall config JSON.
 type Config struct {
-	ScreenDimmerTimeOnBatterySeconds int             `json:"screen_dimmer_time_on_battery_seconds"`
-	ScreenDimmerTimeOnDCSeconds      int             `json:"screen_dimmer_time_on_dc_seconds"`
-	ScreenMaxBrightness              int             `json:"screen_max_brightness"`
-	ScreenMinBrightness              int             `json:"screen_min_brightness"`
-	PingSite0                        string          `json:"ping_site0"`
-	PingSite1                        string          `json:"ping_site1"`
-	DisplayTemplate                  DisplayTemplate `json:"display_template"`
-	ShowSms                          bool            `json:"show_sms"`
+	ScreenDimmerTimeOnBatterySeconds int                        `json:"screen_dimmer_time_on_battery_seconds"`
+	ScreenDimmerTimeOnDCSeconds      int                        `json:"screen_dimmer_time_on_dc_seconds"`
+	ScreenMaxBrightness              int                        `json:"screen_max_brightness"`
+	ScreenMinBrightness              int                        `json:"screen_min_brightness"`
+	PingSite0                        string                     `json:"ping_site0"`
+	PingSite1                        string                     `json:"ping_site1"`
+	DisplayTemplate                  DisplayTemplate            `json:"display_template"`
+	ShowSms                          bool                       `json:"show_sms"`
+	StaleData                        StaleDataConfig            `json:"stale_data"`
+	Collectors                       map[string]CollectorConfig `json:"collectors,omitempty"`
+	ExternalCollectors               []ExternalCollectorConfig  `json:"external_collectors,omitempty"`
+	MQTT                             MQTTConfig                 `json:"mqtt"`
+	Auth                             AuthConfig                 `json:"auth"`
+	Rotation                         RotationConfig             `json:"rotation"`
+	Fonts                            map[string]FontDef         `json:"fonts,omitempty"`
+}
+
+// StaleDataConfig controls how text elements show values that stopped updating.
+type StaleDataConfig struct {
+	Style       string         `json:"style,omitempty"`       // "grey" (default), "marker", "placeholder" or "off"
+	Placeholder string         `json:"placeholder,omitempty"` // shown instead of the value with style "placeholder"
+	Marker      string         `json:"marker,omitempty"`      // appended to the value with style "marker"
+	Thresholds  map[string]int `json:"thresholds,omitempty"`  // per data key, seconds; 0 never marks the key stale
 }
 
 // FontConfig holds parameters for a font.
 type FontConfig struct {
-	FontPath string  // path to TTF file
-	FontSize float64 // in points
+	FontPath string   // path to TTF file
+	FontSize float64  // in points
+	Weight   string   // face of a TTC collection, "" for the first
+	Hinting  string   // key of fontHintings
+	Fallback []string // font names for characters this font lacks
 }
 
 // checkDMAAvailability checks if SPI DMA channels are available
@@ -354,12 +380,12 @@ func logSPIMode() {
 
 // DisplayWrapper provides optimized display operations based on DMA mode
 type DisplayWrapper struct {
-	device gc9307.Device
+	device DisplaySink
 	config SPIConfig
 }
 
 // NewDisplayWrapper creates a new display wrapper with DMA optimization
-func NewDisplayWrapper(device gc9307.Device) *DisplayWrapper {
+func NewDisplayWrapper(device DisplaySink) *DisplayWrapper {
 	return &DisplayWrapper{
 		device: device,
 		config: getSPIConfig(),
@@ -416,12 +442,19 @@ func (dw *DisplayWrapper) GetTransferStats() map[string]interface{} {
 }
 
 func main() {
+	if len(os.Args) > 1 && runSubcommand(os.Args[1], os.Args[2:]) {
+		return
+	}
+
 	var wg sync.WaitGroup
 	all := flag.Bool("all", false, "if set, listen on all network interfaces (0.0.0.0)")
 	port := flag.Int("port", 8081, "TCP port to listen on")
 	forceColdBoot := flag.Bool("force-cold-boot", false, "force showing welcome screen even on warm boot")
 	useDMA := flag.Bool("dma", true, "enable DMA mode for SPI transfers (default: true)")
+	virtual := flag.Bool("virtual", false, "render into an in-memory display instead of the SPI panel (no hardware needed)")
+	flag.StringVar(&sysRoot, "sysroot", "/", "filesystem root for /sys, /proc and /etc reads (e.g. tests/fixtures/sysroot)")
 	flag.Parse()
+	virtualMode = *virtual
 
 	// Build the listen address:
 	var addr string
@@ -431,91 +464,30 @@ func main() {
 		addr = fmt.Sprintf("127.0.0.1:%d", *port) // localhost only
 	}
 
-	// Set DMA mode from command line flag
-	dmaMode = *useDMA
-	if dmaMode {
-		log.Println("\033[32mSPI DMA mode: ENABLED\033[0m")
-	} else {
-		log.Println("\033[31mSPI DMA mode: DISABLED\033[0m")
-	}
-
-	// Check if DMA channels are available
-	if err := checkDMAAvailability(); err != nil {
-		log.Printf("\033[31mDMA not available, falling back to non-DMA mode: %v\033[0m", err)
-		dmaMode = false
-		spiTransferOptimized = false
-	} else {
-		spiTransferOptimized = dmaMode
-		if dmaMode {
-			log.Println("\033[32mDMA channels detected and enabled for optimized transfers\033[0m")
-		}
-	}
-
-	// Log the current SPI configuration
-	logSPIMode()
-
 	//rm pcat_display_initialized
 	os.Remove("/tmp/pcat_display_initialized")
-	// Initialize board.
-	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
-	}
 	rand.Seed(time.Now().UnixNano())
-	// Open SPI.
-	spiPort, err := spireg.Open("SPI1.0")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer spiPort.Close()
 
-	conn, err := spiPort.Connect(120000*physic.KiloHertz, spi.Mode0, 8)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	//if assetsFolder not exists, use /usr/local/share/pcat2_mini_display
-	if _, err := os.Stat("assets"); os.IsNotExist(err) {
-		assetsPrefix = "/usr/local/share/pcat2_mini_display"
-	}
-
-	if _, err := os.Stat(assetsPrefix + "/assets"); os.IsNotExist(err) {
-		assetsPrefix = "/usr/share/pcat2_mini_display"
-	}
-
-	// For demonstration, we create a mapping from font names to font configurations.
-	fonts = map[string]FontConfig{
-		"clock":     {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Medium.ttf", FontSize: 20},
-		"clockBold": {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 17},
-		"reg":       {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 18},
-		"big":       {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 25},
-		"unit":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Medium.ttf", FontSize: 15},
-		"tiny":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Regular.ttf", FontSize: 12},
-		"micro":     {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Regular.ttf", FontSize: 10},
-		"thin":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Regular.ttf", FontSize: 18},
-		"huge":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 34},
-		"gigantic":  {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 48},
-		// Chinese font variants
-		"unit_cjk": {FontPath: assetsPrefix + "/assets/fonts/NotoSansMonoCJK-VF.ttf.ttc", FontSize: 15},
-	}
+	resolveAssetsPrefix()
+	initFonts()
 
 	imageCache = make(map[string]*image.RGBA)
 
 	// Setup display.
-	display = gc9307.New(conn, gpioreg.ByName(RST_PIN), gpioreg.ByName(DC_PIN), gpioreg.ByName(CS_PIN), gpioreg.ByName(BL_PIN))
-	display.Configure(gc9307.Config{
-		Width:        PCAT2_LCD_WIDTH,
-		Height:       PCAT2_LCD_HEIGHT,
-		Rotation:     gc9307.ROTATION_180,
-		RowOffset:    0,
-		ColumnOffset: PCAT2_X_OFFSET,
-		FrameRate:    gc9307.FRAMERATE_60,
-		VSyncLines:   gc9307.MAX_VSYNC_SCANLINES,
-		UseCS:        false,
-	})
+	if virtualMode {
+		log.Println("\033[33mVirtual display mode: no SPI/GPIO access, frames stay in memory\033[0m")
+		display = NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	} else {
+		closeDisplay := openHardwareDisplay(*useDMA)
+		defer closeDisplay()
 
-	// Initialize display wrapper with DMA optimization
-	displayWrapper = NewDisplayWrapper(display)
-	log.Printf("Display wrapper initialized with transfer stats: %+v", displayWrapper.GetTransferStats())
+		// Keep a copy of what the panel shows for the web mirror and recordings
+		display = NewMirrorDisplay(display, PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+
+		// Initialize display wrapper with DMA optimization
+		displayWrapper = NewDisplayWrapper(display)
+		log.Printf("Display wrapper initialized with transfer stats: %+v", displayWrapper.GetTransferStats())
+	}
 
 	// Initialize shutdown monitoring (temporarily disabled for testing)
 	// This monitors system shutdown/restart before SIGTERM is sent
@@ -574,42 +546,16 @@ func main() {
 	}()
 
 	loadAllConfigsToVariables() //load user, default configs
+	loadActiveProfile()         //and the profile between them
+	startConfigWatcher()        //reload them when edited
 
 	//collect data for middle and footer, non-blocking
-	go func() {
-		for {
-			collectLinuxData(cfg)
-			time.Sleep(dataGatherInterval)
-		}
-	}()
-
-	go func() {
-		for {
-			collectNetworkData(cfg)
-			time.Sleep(dataGatherInterval)
-		}
-	}()
-
-	go func() {
-		for {
-			collectBatteryData()
-			time.Sleep(batteryDataInterval)
-		}
-	}()
-
-	go func() {
-		for {
-			getInfoFromPcatWeb()
-			time.Sleep(INTERVAL_PCAT_WEB_COLLECT)
-		}
-	}()
-
-	go func() {
-		for {
-			collectWANNetworkSpeed()
-			time.Sleep(networkGatherInterval)
-		}
-	}()
+	for _, c := range builtinCollectors() {
+		collectors.Add(c)
+	}
+	startEvents()
+	startRuntimeConfig() //external collectors, MQTT and API tokens, reapplied on reloads
+	collectors.Start(context.Background())
 
 	go collectFixedData()
 	go getSmsPages()
@@ -639,6 +585,63 @@ func main() {
 	select {} //blocking for sigterm processing
 }
 
+// openHardwareDisplay initializes the board, the SPI bus and the gc9307 panel,
+// then stores the device in the display global. The returned func closes the SPI port.
+func openHardwareDisplay(useDMA bool) func() {
+	// Set DMA mode from command line flag
+	dmaMode = useDMA
+	if dmaMode {
+		log.Println("\033[32mSPI DMA mode: ENABLED\033[0m")
+	} else {
+		log.Println("\033[31mSPI DMA mode: DISABLED\033[0m")
+	}
+
+	// Check if DMA channels are available
+	if err := checkDMAAvailability(); err != nil {
+		log.Printf("\033[31mDMA not available, falling back to non-DMA mode: %v\033[0m", err)
+		dmaMode = false
+		spiTransferOptimized = false
+	} else {
+		spiTransferOptimized = dmaMode
+		if dmaMode {
+			log.Println("\033[32mDMA channels detected and enabled for optimized transfers\033[0m")
+		}
+	}
+
+	// Log the current SPI configuration
+	logSPIMode()
+
+	// Initialize board.
+	if _, err := host.Init(); err != nil {
+		log.Fatal(err)
+	}
+	// Open SPI.
+	spiPort, err := spireg.Open("SPI1.0")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	conn, err := spiPort.Connect(120000*physic.KiloHertz, spi.Mode0, 8)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dev := gc9307.New(conn, gpioreg.ByName(RST_PIN), gpioreg.ByName(DC_PIN), gpioreg.ByName(CS_PIN), gpioreg.ByName(BL_PIN))
+	dev.Configure(gc9307.Config{
+		Width:        PCAT2_LCD_WIDTH,
+		Height:       PCAT2_LCD_HEIGHT,
+		Rotation:     gc9307.ROTATION_180,
+		RowOffset:    0,
+		ColumnOffset: PCAT2_X_OFFSET,
+		FrameRate:    gc9307.FRAMERATE_60,
+		VSyncLines:   gc9307.MAX_VSYNC_SCANLINES,
+		UseCS:        false,
+	})
+	display = &dev
+
+	return func() { spiPort.Close() }
+}
+
 func registerExitHandler() {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
@@ -655,6 +658,8 @@ func registerExitHandler() {
 			}
 		*/
 
+		stopMQTT()
+
 		time.Sleep(200 * time.Millisecond)
 
 		// Different behavior for SIGTERM vs SIGINT
@@ -692,6 +697,10 @@ func prepareMainLoop() {
 
 	// Initialize performance optimization
 	easingLookup = preCalculateEasing(numIntermediatePages, middleFrameWidth)
+	reverseEasingLookup = make([]int, len(easingLookup))
+	for i, x := range easingLookup {
+		reverseEasingLookup[i] = middleFrameWidth - x
+	}
 	lastFPSUpdate = time.Now()
 }
 
@@ -712,6 +721,7 @@ func mainLoop() {
 	if err != nil {
 		log.Fatalf("Failed to load font: %v", err)
 	}
+	events.Publish(EventPage, pageEvent(currPageIdx, totalNumPages, isSMS))
 
 	for weAreRunning {
 		if middleFrames%300 == 0 { // Log less frequently
@@ -719,10 +729,21 @@ func mainLoop() {
 		}
 		if runMainLoop {
 			start := time.Now()
-			if changePageTriggered || httpChangePageTriggered { //CHANGE PAGE
+			dropStaleRenderCaches()
+			if changePageTriggered || pageChangePending() { //CHANGE PAGE
 				if buttonPressInProgress { // Too soon, skip this press
 					changePageTriggered = false
-					httpChangePageTriggered = false
+					continue
+				}
+				target, ok := takePageTarget(changePageTriggered)
+				changePageTriggered = false
+				if !ok { // pinned
+					continue
+				}
+				currPageIdx = currPageIdx % totalNumPages
+				var reverse bool
+				nextPageIdx, reverse = target.resolve(currPageIdx, totalNumPages)
+				if nextPageIdx == currPageIdx {
 					continue
 				}
 
@@ -732,14 +753,13 @@ func mainLoop() {
 				// Mark button press in progress and immediately set activity
 				buttonPressInProgress = true
 				lastButtonPress = now
-				lastActivityMu.Lock()
-				lastActivity = now
-				lastActivityMu.Unlock()
+				if !target.auto { // rotation alone should not keep the screen on
+					lastActivityMu.Lock()
+					lastActivity = now
+					lastActivityMu.Unlock()
+				}
 
 				// Optimize page calculations - calculate once and reuse
-				currPageIdx = currPageIdx % totalNumPages
-				nextPageIdx = (currPageIdx + 1) % totalNumPages
-
 				// Pre-calculate SMS status to avoid redundant checks
 				isSMS = cfg.ShowSms && currPageIdx >= cfgNumPages
 				isNextPageSMS = cfg.ShowSms && nextPageIdx >= cfgNumPages
@@ -781,13 +801,22 @@ func mainLoop() {
 				stitchStart := time.Now()
 				stitchStartTime = stitchStart // Record stitch start for button timing
 
+				// Forward slides run over [current | next], reverse ones over
+				// [next | current] with the easing mirrored
+				leftFrame, rightFrame := middleFramebuffers[(middleFrames+1)%2], nextPageIdxFrameBuffer
+				easing := easingLookup
+				if reverse {
+					leftFrame, rightFrame = rightFrame, leftFrame
+					easing = reverseEasingLookup
+				}
+
 				// Use optimized stitching for better performance
-				err := stitchFramesOptimized(stitchedFrame, middleFramebuffers[(middleFrames+1)%2], nextPageIdxFrameBuffer)
+				err := stitchFramesOptimized(stitchedFrame, leftFrame, rightFrame)
 				if err != nil {
 					// Fallback to original method if optimized fails
 					log.Printf("⚠️ Optimized stitch failed, using fallback: %v", err)
-					copyImageToImageAt(stitchedFrame, middleFramebuffers[(middleFrames+1)%2], 0, 0) //current frame
-					copyImageToImageAt(stitchedFrame, nextPageIdxFrameBuffer, middleFrameWidth, 0)  //next frame
+					copyImageToImageAt(stitchedFrame, leftFrame, 0, 0)
+					copyImageToImageAt(stitchedFrame, rightFrame, middleFrameWidth, 0)
 				}
 
 				stitchEnd := time.Now()
@@ -799,7 +828,7 @@ func mainLoop() {
 					log.Printf("🔧 Stitch: %.1fms", durationToMs(stitchDuration))
 				}
 
-				calculateTransitionFramesAsync(stitchedFrame, easingLookup)
+				calculateTransitionFramesAsync(stitchedFrame, easing)
 
 				// Initialize frame timing tracking
 				frameTimestamps[0] = time.Now() // Start of transition
@@ -816,7 +845,7 @@ func mainLoop() {
 						} else {
 							nextPageLength = cfgNumPages
 						}
-						drawFooter(display, footerFramebuffers[middleFrames%2], nextPageIdx, nextPageLength, isNextPageSMS)
+						drawFooter(display, footerFramebuffers[middleFrames%2], nextLocalIdx, nextPageLength, isNextPageSMS)
 					}
 
 					// Try to use pre-calculated frame, fallback to real-time calculation
@@ -862,7 +891,7 @@ func mainLoop() {
 						// Fallback: calculate frame on-demand if not pre-calculated
 						log.Printf("🔨 Frame not ready")
 						copyStart := time.Now()
-						xPos := easingLookup[i]
+						xPos := easing[i]
 						copyImageRegion(croppedFrameBuffer, stitchedFrame, xPos, 0, middleFrameWidth, middleFrameHeight)
 						copyEnd := time.Now()
 						copyTimings[i] = int(copyEnd.Sub(copyStart).Microseconds())
@@ -937,10 +966,10 @@ func mainLoop() {
 					maxFrameTime = 0
 				}
 
-				// Calculate button press to transition finish timing
+				// Calculate button release (the page changes on release) to transition finish timing
 				var buttonToFinishMs float64
-				if !buttonKeydownTime.IsZero() {
-					buttonToFinishMs = durationToMs(pageChangeEnd.Sub(buttonKeydownTime))
+				if !buttonKeyupTime.IsZero() {
+					buttonToFinishMs = durationToMs(pageChangeEnd.Sub(buttonKeyupTime))
 				}
 
 				// Simple consolidated timing print
@@ -967,9 +996,11 @@ func mainLoop() {
 				}
 				//=============== end of performance printing ===============
 
+				renderStats.observePageChange(start, pageChangeEnd, buttonKeyupTime, frameDurations)
+				events.Publish(EventPage, pageEvent(currPageIdx, totalNumPages, isSMS))
+
 				// Mark button press complete
 				buttonPressInProgress = false
-				httpChangePageTriggered = false
 				changePageTriggered = false
 			} else { //normal page rendering
 				// Only update top bar and footer when needed (every few frames) to save CPU
@@ -1021,12 +1052,12 @@ func mainLoop() {
 				}
 			}
 
-			if middleFrames%100 == 0 {
-				if autoRotatePages {
-					changePageTriggered = true
-					// Signal the main loop to interrupt FPS sleep
-					signalPageChange()
+			if idleState == STATE_ACTIVE {
+				if target, ok := rotator.next(cfg.Rotation, currPageIdx, time.Now()); ok {
+					rotatePage(target)
 				}
+			}
+			if middleFrames%100 == 0 {
 				now := time.Now()
 				fps = 100 / now.Sub(lastUpdate).Seconds()
 				log.Printf("FPS: %0.1f, Total Frames: %d\n", fps, middleFrames)
@@ -1034,6 +1065,7 @@ func mainLoop() {
 				log.Printf("Pages: total=%d, current=%d, cfg=%d, sms=%d, showSms=%t",
 					totalNumPages, currPageIdx, cfgNumPages, lenSmsPagesImages, cfg.ShowSms)
 			}
+			renderStats.observeFrames(middleFrames, fps)
 		} else {
 			time.Sleep(50 * time.Millisecond) //not inf loop
 		}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	contentTypePrometheus  = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	bytesPerGiB = 1 << 30
+	bytesPerMiB = 1 << 20
+)
+
+// dataMetric exports one numeric data key under a Prometheus name. Scale
+// converts the stored unit to the base unit the name promises.
+type dataMetric struct {
+	Key    string
+	Name   string
+	Help   string
+	Labels []string // name/value pairs
+	Scale  float64
+}
+
+var dataMetrics = []dataMetric{
+	{"BatteryVoltage", "pcat2_battery_voltage_volts", "Battery voltage.", nil, 1},
+	{"BatteryCurrent", "pcat2_battery_current_amperes", "Battery current, negative while discharging.", nil, 1},
+	{"BatteryWattage", "pcat2_battery_power_watts", "Battery power.", nil, 1},
+	{"BatterySoc", "pcat2_battery_soc_percent", "Battery state of charge.", nil, 1},
+	{"BatteryCharging", "pcat2_battery_charging", "1 while the battery is charging.", nil, 1},
+	{"DCVoltage", "pcat2_dc_voltage_volts", "DC input voltage.", nil, 1},
+	{"CpuUsage", "pcat2_cpu_usage_percent", "CPU usage.", nil, 1},
+	{"CpuTemp", "pcat2_cpu_temperature_celsius", "CPU temperature.", nil, 1},
+	{"BoardTemperature", "pcat2_board_temperature_celsius", "Board temperature reported by pcat-manager.", nil, 1},
+	{"FanRPM", "pcat2_fan_rpm", "Fan speed.", nil, 1},
+	{"Ping0", "pcat2_ping_rtt_seconds", "Round trip time to the ping site, absent while it fails.", []string{"site", "0"}, 0.001},
+	{"Ping1", "pcat2_ping_rtt_seconds", "", []string{"site", "1"}, 0.001},
+	{"Ping0Rate", "pcat2_ping_success_ratio", "Share of recent pings that were answered.", []string{"site", "0"}, 0.01},
+	{"Ping1Rate", "pcat2_ping_success_ratio", "", []string{"site", "1"}, 0.01},
+	{"WanUP", "pcat2_wan_speed_bits_per_second", "Current WAN throughput.", []string{"direction", "up"}, 1e6},
+	{"WanDOWN", "pcat2_wan_speed_bits_per_second", "", []string{"direction", "down"}, 1e6},
+	{"SessionDataUsage", "pcat2_data_usage_bytes", "Mobile data used per period.", []string{"period", "session"}, bytesPerGiB},
+	{"DailyDataUsage", "pcat2_data_usage_bytes", "", []string{"period", "day"}, bytesPerGiB},
+	{"WeeklyDataUsage", "pcat2_data_usage_bytes", "", []string{"period", "week"}, bytesPerGiB},
+	{"MonthlyDataUsage", "pcat2_data_usage_bytes", "", []string{"period", "month"}, bytesPerGiB},
+	{"LastMonthUsage", "pcat2_data_usage_bytes", "", []string{"period", "last_month"}, bytesPerGiB},
+	{"ModemSignalStrength", "pcat2_modem_signal_strength_percent", "Modem signal strength.", nil, 1},
+	{"DHCPClientsCount", "pcat2_dhcp_clients", "Number of DHCP leases.", nil, 1},
+	{"WiFiClientsCount", "pcat2_wifi_clients", "Number of connected WiFi clients.", nil, 1},
+}
+
+// histogram counts observations into fixed buckets; callers hold the lock
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] holds observations ≤ bounds[i] and > bounds[i-1]; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) clone() *histogram {
+	c := *h
+	c.counts = append([]uint64(nil), h.counts...)
+	return &c
+}
+
+// RenderStats collects what the main loop knows about its own speed
+type RenderStats struct {
+	mu                sync.Mutex
+	frames            int
+	fps               float64
+	pageChanges       uint64
+	lastPageChangeEnd time.Time
+	pageChange        *histogram // start of the change to the last transition frame
+	buttonLatency     *histogram // button release to the last transition frame
+	transitionFrame   *histogram
+}
+
+var renderStats = NewRenderStats()
+
+func NewRenderStats() *RenderStats {
+	return &RenderStats{
+		pageChange:      newHistogram(0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 0.75, 1, 2),
+		buttonLatency:   newHistogram(0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 0.75, 1, 2),
+		transitionFrame: newHistogram(0.002, 0.005, 0.01, 0.015, 0.02, 0.03, 0.05, 0.1),
+	}
+}
+
+// observeFrames records the frame counter and the last measured FPS
+func (s *RenderStats) observeFrames(frames int, fps float64) {
+	s.mu.Lock()
+	s.frames = frames
+	s.fps = fps
+	s.mu.Unlock()
+}
+
+// observePageChange records one finished page change. buttonUp, the release
+// that changes the page, only counts when it happened after the previous
+// change, otherwise this one came from the API or auto rotation.
+func (s *RenderStats) observePageChange(start, end, buttonUp time.Time, frameMicros []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageChanges++
+	s.pageChange.observe(end.Sub(start).Seconds())
+	if !buttonUp.IsZero() && buttonUp.After(s.lastPageChangeEnd) && !buttonUp.After(end) {
+		s.buttonLatency.observe(end.Sub(buttonUp).Seconds())
+	}
+	for _, us := range frameMicros {
+		s.transitionFrame.observe(float64(us) / 1e6)
+	}
+	s.lastPageChangeEnd = end
+}
+
+// metricsWriter writes the Prometheus text format, or OpenMetrics when the
+// scraper asks for it. The two differ only in counter names and the EOF marker.
+type metricsWriter struct {
+	buf         bytes.Buffer
+	openMetrics bool
+	declared    map[string]bool
+}
+
+func newMetricsWriter(openMetrics bool) *metricsWriter {
+	return &metricsWriter{openMetrics: openMetrics, declared: make(map[string]bool)}
+}
+
+// family writes the HELP and TYPE lines once per metric name
+func (w *metricsWriter) family(name, typ, help string) {
+	if w.declared[name] {
+		return
+	}
+	w.declared[name] = true
+	if typ == "counter" && !w.openMetrics {
+		name += "_total"
+	}
+	if help != "" {
+		fmt.Fprintf(&w.buf, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(&w.buf, "# TYPE %s %s\n", name, typ)
+}
+
+func (w *metricsWriter) sample(name string, labels []string, value float64) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(formatMetricValue(value))
+	w.buf.WriteByte('\n')
+}
+
+func (w *metricsWriter) gauge(name, help string, labels []string, value float64) {
+	w.family(name, "gauge", help)
+	w.sample(name, labels, value)
+}
+
+func (w *metricsWriter) counter(name, help string, labels []string, value float64) {
+	w.family(name, "counter", help)
+	w.sample(name+"_total", labels, value)
+}
+
+func (w *metricsWriter) histogram(name, help string, h *histogram) {
+	w.family(name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		w.sample(name+"_bucket", []string{"le", formatMetricValue(bound)}, float64(cumulative))
+	}
+	w.sample(name+"_bucket", []string{"le", "+Inf"}, float64(h.count))
+	w.sample(name+"_sum", nil, h.sum)
+	w.sample(name+"_count", nil, float64(h.count))
+}
+
+func (w *metricsWriter) bytes() []byte {
+	if w.openMetrics {
+		w.buf.WriteString("# EOF\n")
+	}
+	return w.buf.Bytes()
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricFloat converts a stored value to a sample value
+func metricFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// writeDataMetrics exports globalData. Keys without a reading, stale keys and
+// the ping failure codes are left out, so a dead collector shows up as a gap
+// rather than a flat line. Numeric keys that aren't in dataMetrics (posted
+// through the API or from external collectors) are exported as pcat2_data.
+func writeDataMetrics(w *metricsWriter) {
+	snapshot := globalData.Snapshot()
+	fresh := func(key string) (DataEntry, bool) {
+		e, ok := snapshot[key]
+		return e, ok && e.Value != nil && !e.Stale
+	}
+
+	known := map[string]bool{"MemUsage": true, "DiskData": true}
+	for _, m := range dataMetrics {
+		known[m.Key] = true
+		w.family(m.Name, "gauge", m.Help)
+		e, ok := fresh(m.Key)
+		if !ok {
+			continue
+		}
+		v, ok := metricFloat(e.Value)
+		if !ok || (strings.HasPrefix(m.Key, "Ping") && v < 0) {
+			continue
+		}
+		w.sample(m.Name, m.Labels, v*m.Scale)
+	}
+
+	// "1.2/4", GB as shown on screen
+	if e, ok := fresh("MemUsage"); ok {
+		if used, total, found := strings.Cut(e.Text, "/"); found {
+			if v, err := strconv.ParseFloat(used, 64); err == nil {
+				w.gauge("pcat2_memory_used_bytes", "Memory in use, to 0.1 GB.", nil, v*bytesPerGiB)
+			}
+			if v, err := strconv.ParseFloat(total, 64); err == nil {
+				w.gauge("pcat2_memory_total_bytes", "Memory size, rounded up to whole GB.", nil, v*bytesPerGiB)
+			}
+		}
+	}
+	if e, ok := fresh("DiskData"); ok {
+		if disk, ok := e.Value.(map[string]interface{}); ok {
+			for _, field := range []string{"Total", "Used", "Free"} {
+				if mb, ok := metricFloat(disk[field]); ok {
+					w.gauge("pcat2_disk_bytes", "Root filesystem size, used and free space.", []string{"kind", strings.ToLower(field)}, mb*bytesPerMiB)
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if known[key] {
+			continue
+		}
+		e, ok := fresh(key)
+		if !ok || (e.Type != DataInt && e.Type != DataFloat && e.Type != DataBool) {
+			continue
+		}
+		if v, ok := metricFloat(e.Value); ok {
+			w.gauge("pcat2_data", "Other numeric data keys, in the unit they are stored in.", []string{"key", key, "unit", e.Unit}, v)
+		}
+	}
+}
+
+func writeRenderMetrics(w *metricsWriter) {
+	renderStats.mu.Lock()
+	frames, fps, pageChanges := renderStats.frames, renderStats.fps, renderStats.pageChanges
+	pageChange := renderStats.pageChange.clone()
+	buttonLatency := renderStats.buttonLatency.clone()
+	transitionFrame := renderStats.transitionFrame.clone()
+	renderStats.mu.Unlock()
+
+	w.gauge("pcat2_fps", "Frames per second over the last 100 frames.", nil, fps)
+	w.counter("pcat2_middle_frames", "Frames sent for the middle of the screen, transitions included.", nil, float64(frames))
+	w.counter("pcat2_page_changes", "Completed page changes.", nil, float64(pageChanges))
+	w.histogram("pcat2_page_change_duration_seconds", "Time from picking up a page change to its last frame.", pageChange)
+	w.histogram("pcat2_page_change_latency_seconds", "Time from the button release to the last frame of the page change.", buttonLatency)
+	w.histogram("pcat2_transition_frame_seconds", "Time between transition frames.", transitionFrame)
+}
+
+// displayMetricHelp describes the numeric GetTransferStats fields
+var displayMetricHelp = map[string]string{
+	"dma_enabled":       "1 when SPI transfers use DMA.",
+	"max_transfer_size": "Largest SPI transfer in bytes.",
+	"use_chunking":      "1 when frames are sent to the panel in chunks.",
+	"chunk_size":        "Bytes per chunk when chunking.",
+}
+
+// writeDisplayMetrics exports GetTransferStats; numbers and flags become
+// gauges, strings become labels of pcat2_display_spi_config
+func writeDisplayMetrics(w *metricsWriter) {
+	if displayWrapper == nil {
+		return
+	}
+	stats := displayWrapper.GetTransferStats()
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var info []string
+	for _, key := range keys {
+		if s, ok := stats[key].(string); ok {
+			info = append(info, key, s)
+			continue
+		}
+		if v, ok := metricFloat(stats[key]); ok {
+			help := displayMetricHelp[key]
+			if help == "" {
+				help = "SPI transfer setting " + key + "."
+			}
+			w.gauge("pcat2_display_"+key, help, nil, v)
+		}
+	}
+	if len(info) > 0 {
+		// an info-style gauge: the Prometheus text format has no info type
+		w.gauge("pcat2_display_spi_config", "SPI transfer settings as labels, always 1.", info, 1)
+	}
+}
+
+// writeCollectorMetrics goes metric by metric, the text format wants all
+// samples of a metric together
+func writeCollectorMetrics(w *metricsWriter) {
+	health := collectors.Health()
+	for _, h := range health {
+		up := 0.0
+		if h.Runs > 0 && h.ConsecutiveFailures == 0 {
+			up = 1
+		}
+		w.gauge("pcat2_collector_up", "1 if the collector's last run succeeded.", []string{"collector", h.Name}, up)
+	}
+	for _, h := range health {
+		w.counter("pcat2_collector_runs", "Collector runs.", []string{"collector", h.Name}, float64(h.Runs))
+	}
+	for _, h := range health {
+		w.counter("pcat2_collector_failures", "Collector runs that failed.", []string{"collector", h.Name}, float64(h.Failures))
+	}
+	for _, h := range health {
+		w.gauge("pcat2_collector_last_duration_seconds", "How long the last run took.", []string{"collector", h.Name}, float64(h.LastDurationMs)/1000)
+	}
+}
+
+// GET /metrics
+func serveMetrics(c *fiber.Ctx) error {
+	openMetrics := strings.Contains(c.Get(fiber.HeaderAccept), "application/openmetrics-text")
+	w := newMetricsWriter(openMetrics)
+	writeDataMetrics(w)
+	writeRenderMetrics(w)
+	writeDisplayMetrics(w)
+	writeCollectorMetrics(w)
+
+	if openMetrics {
+		c.Set(fiber.HeaderContentType, contentTypeOpenMetrics)
+	} else {
+		c.Set(fiber.HeaderContentType, contentTypePrometheus)
+	}
+	return c.Send(w.bytes())
+}
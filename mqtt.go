@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultMQTTInterval = 10 * time.Second
+	mqttConnectTimeout  = 10 * time.Second
+	// how long to wait for a publish to be handed to the broker
+	mqttPublishTimeout = 5 * time.Second
+
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+)
+
+// MQTTConfig is the "mqtt" config section. Publishing is off unless enabled.
+type MQTTConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Broker          string  `json:"broker,omitempty"` // tcp://host:1883, ssl://host:8883 or ws://host:9001
+	ClientID        string  `json:"client_id,omitempty"`
+	Username        string  `json:"username,omitempty"`
+	Password        string  `json:"password,omitempty"`
+	TopicPrefix     string  `json:"topic_prefix,omitempty"`
+	QoS             int     `json:"qos,omitempty"`
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+	// announce sensors and commands to Home Assistant through MQTT discovery
+	HomeAssistant   bool   `json:"home_assistant,omitempty"`
+	DiscoveryPrefix string `json:"discovery_prefix,omitempty"`
+}
+
+// MQTTPublisher mirrors globalData to a broker:
+//
+//	<prefix>/status       "online", or "offline" through the Last Will
+//	<prefix>/data/<Key>   one retained topic per data key
+//	<prefix>/data         every value as one JSON object
+type MQTTPublisher struct {
+	conf     MQTTConfig
+	prefix   string
+	client   mqtt.Client
+	interval time.Duration
+
+	mu        sync.Mutex
+	published map[string]string // last payload per key topic, unchanged values aren't resent
+}
+
+// the running publisher, its ticker's cancel and the config it was started
+// with. Guarded by mqttMu.
+var (
+	mqttMu        sync.Mutex
+	mqttPublisher *MQTTPublisher
+	mqttCancel    context.CancelFunc
+	mqttApplied   *MQTTConfig
+)
+
+// validateMQTTConfig reports the first problem with an enabled mqtt section
+func validateMQTTConfig(conf MQTTConfig) error {
+	if !conf.Enabled {
+		return nil
+	}
+	if conf.Broker == "" {
+		return errors.New("mqtt.broker is required when mqtt is enabled")
+	}
+	if conf.QoS < 0 || conf.QoS > 2 {
+		return fmt.Errorf("mqtt.qos must be 0, 1 or 2, got %d", conf.QoS)
+	}
+	if conf.IntervalSeconds < 0 {
+		return fmt.Errorf("mqtt.interval_seconds must be ≥ 0, got %v", conf.IntervalSeconds)
+	}
+	if strings.ContainsAny(conf.TopicPrefix, "+#") {
+		return fmt.Errorf("mqtt.topic_prefix must not contain wildcards, got %q", conf.TopicPrefix)
+	}
+	return nil
+}
+
+// newMQTTPublisher fills in defaults; nothing is connected yet
+func newMQTTPublisher(conf MQTTConfig) *MQTTPublisher {
+	if conf.ClientID == "" {
+		host, _ := os.Hostname()
+		conf.ClientID = "pcat2-" + host
+	}
+	prefix := strings.TrimSuffix(conf.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = "photonicat2/" + conf.ClientID
+	}
+	interval := defaultMQTTInterval
+	if conf.IntervalSeconds > 0 {
+		interval = secondsToDuration(conf.IntervalSeconds)
+	}
+	return &MQTTPublisher{
+		conf:      conf,
+		prefix:    prefix,
+		interval:  interval,
+		published: make(map[string]string),
+	}
+}
+
+func (p *MQTTPublisher) statusTopic() string { return p.prefix + "/status" }
+func (p *MQTTPublisher) bundleTopic() string { return p.prefix + "/data" }
+
+// keyTopic is the topic of one data key. Characters MQTT treats specially
+// are replaced so API-posted keys can't spill into other topics.
+func (p *MQTTPublisher) keyTopic(key string) string {
+	return p.prefix + "/data/" + strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(key)
+}
+
+// clientOptions sets up auth, reconnects and the Last Will
+func (p *MQTTPublisher) clientOptions() *mqtt.ClientOptions {
+	opts := mqtt.NewClientOptions().
+		AddBroker(p.conf.Broker).
+		SetClientID(p.conf.ClientID).
+		SetUsername(p.conf.Username).
+		SetPassword(p.conf.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(mqttConnectTimeout).
+		SetWill(p.statusTopic(), mqttOffline, byte(p.conf.QoS), true)
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		log.Printf("📡 MQTT connected to %s, publishing under %s", p.conf.Broker, p.prefix)
+		// a new session may be on a broker that lost its retained messages
+		p.mu.Lock()
+		p.published = make(map[string]string)
+		p.mu.Unlock()
+		p.publish(p.statusTopic(), mqttOnline)
+		if p.conf.HomeAssistant {
+			p.publishDiscovery()
+			p.publishBrightness()
+			p.subscribeHomeAssistant(c)
+		}
+		p.publishData()
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		log.Printf("📡 MQTT connection lost: %v", err)
+	})
+	return opts
+}
+
+// Start connects in the background and publishes every interval until ctx ends.
+// An unreachable broker is retried; it never blocks the caller.
+func (p *MQTTPublisher) Start(ctx context.Context) {
+	if p.client == nil {
+		p.client = mqtt.NewClient(p.clientOptions())
+	}
+	p.client.Connect() // with ConnectRetry the token only completes once connected
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if p.client.IsConnectionOpen() {
+					p.publishData()
+				}
+			}
+		}
+	}()
+}
+
+// Stop marks the device offline and disconnects, or gives up connecting. The
+// Last Will only fires on unclean disconnects, so a normal shutdown has to say
+// it itself.
+func (p *MQTTPublisher) Stop() {
+	if p.client == nil {
+		return
+	}
+	if p.client.IsConnectionOpen() {
+		p.publish(p.statusTopic(), mqttOffline)
+	}
+	p.client.Disconnect(250)
+}
+
+// publishData sends every key whose payload changed, then the bundle
+func (p *MQTTPublisher) publishData() {
+	snapshot := globalData.Snapshot()
+	bundle := make(map[string]interface{}, len(snapshot))
+
+	for key, entry := range snapshot {
+		bundle[key] = entry.Value
+		if entry.Value == nil {
+			continue
+		}
+		payload := mqttPayload(entry)
+		topic := p.keyTopic(key)
+
+		p.mu.Lock()
+		unchanged := p.published[topic] == payload
+		p.mu.Unlock()
+		if unchanged {
+			continue
+		}
+		if p.publish(topic, payload) {
+			p.mu.Lock()
+			p.published[topic] = payload
+			p.mu.Unlock()
+		}
+	}
+
+	raw, err := json.Marshal(bundle)
+	if err != nil {
+		log.Printf("📡 MQTT: marshal data bundle: %v", err)
+		return
+	}
+	p.publish(p.bundleTopic(), string(raw))
+}
+
+// publish sends a retained message and reports whether the broker took it
+func (p *MQTTPublisher) publish(topic, payload string) bool {
+	token := p.client.Publish(topic, byte(p.conf.QoS), true, payload)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		log.Printf("📡 MQTT publish to %s timed out", topic)
+		return false
+	}
+	if err := token.Error(); err != nil {
+		log.Printf("📡 MQTT publish to %s: %v", topic, err)
+		return false
+	}
+	return true
+}
+
+// mqttPayload is the value as shown on screen, or JSON for lists and objects
+func mqttPayload(entry DataEntry) string {
+	if entry.Type == DataList || entry.Type == DataObject {
+		if raw, err := json.Marshal(entry.Value); err == nil {
+			return string(raw)
+		}
+	}
+	return entry.Text
+}
+
+// startMQTT starts publishing if the config asks for it. Called again with a
+// changed config it stops the running publisher first.
+func startMQTT(conf MQTTConfig) {
+	mqttMu.Lock()
+	defer mqttMu.Unlock()
+	if mqttApplied != nil && *mqttApplied == conf {
+		return
+	}
+	stopMQTTLocked()
+	mqttApplied = &conf
+	if !conf.Enabled {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	mqttPublisher, mqttCancel = newMQTTPublisher(conf), cancel
+	mqttPublisher.Start(ctx)
+}
+
+// stopMQTT stops the publisher, if one is running
+func stopMQTT() {
+	mqttMu.Lock()
+	defer mqttMu.Unlock()
+	stopMQTTLocked()
+}
+
+func stopMQTTLocked() {
+	if mqttPublisher == nil {
+		return
+	}
+	mqttCancel()
+	mqttPublisher.Stop()
+	mqttPublisher, mqttCancel = nil, nil
+}
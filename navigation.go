@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// pageTarget is where a page change goes. Page indexes count config pages
+// first, then SMS pages, like currPageIdx.
+type pageTarget struct {
+	step  int // +1 next, -1 previous; 0 for an absolute index
+	index int
+	auto  bool // auto rotation, not user activity
+}
+
+var (
+	navMu       sync.Mutex
+	pendingPage *pageTarget // queued by the API, taken by the main loop
+	pagePinned  bool        // button presses and auto rotation leave the page alone
+)
+
+// resolve returns the page to slide to and whether the slide runs backwards,
+// right to left. Jumps to a lower index slide backwards too.
+func (t pageTarget) resolve(curr, total int) (next int, reverse bool) {
+	if total <= 0 {
+		return 0, false
+	}
+	if t.step != 0 {
+		next = ((curr+t.step)%total + total) % total
+		return next, t.step < 0
+	}
+	next = t.index % total
+	return next, next < curr
+}
+
+// requestPage queues a page change for the main loop and wakes it. API
+// requests go through even while the page is pinned.
+func requestPage(t pageTarget) {
+	navMu.Lock()
+	pendingPage = &t
+	navMu.Unlock()
+
+	lastActivityMu.Lock()
+	lastActivity = time.Now() // avoid triggering fade-in
+	lastActivityMu.Unlock()
+	// prevent backlight fade-in during the slide
+	swippingScreen = true
+	signalPageChange()
+}
+
+// rotatePage queues an auto rotation step unless the page is pinned or
+// another change is waiting. It doesn't wake the screen.
+func rotatePage(t pageTarget) {
+	navMu.Lock()
+	queued := !pagePinned && pendingPage == nil
+	if queued {
+		pendingPage = &t
+	}
+	navMu.Unlock()
+	if queued {
+		signalPageChange()
+	}
+}
+
+// takePageTarget returns the page change the main loop should make, if any.
+// pressed is a button press or auto rotation, a step forward unless pinned.
+func takePageTarget(pressed bool) (pageTarget, bool) {
+	navMu.Lock()
+	defer navMu.Unlock()
+	if pendingPage != nil {
+		t := *pendingPage
+		pendingPage = nil
+		return t, true
+	}
+	if pressed && !pagePinned {
+		return pageTarget{step: 1}, true
+	}
+	return pageTarget{}, false
+}
+
+func pageChangePending() bool {
+	navMu.Lock()
+	defer navMu.Unlock()
+	return pendingPage != nil
+}
+
+func setPagePinned(pinned bool) {
+	navMu.Lock()
+	pagePinned = pinned
+	navMu.Unlock()
+	log.Printf("📌 page pinned=%t", pinned)
+}
+
+func isPagePinned() bool {
+	navMu.Lock()
+	defer navMu.Unlock()
+	return pagePinned
+}
+
+var errNoSmsPages = errors.New("no SMS pages are shown")
+
+// pageIndexByID finds a shown config page by id
+func pageIndexByID(id string) (int, error) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	for i, shown := range cfg.DisplayTemplate.shownPages() {
+		if shown == id {
+			return i, nil
+		}
+	}
+	for _, p := range cfg.DisplayTemplate.pageList() {
+		if p.ID == id {
+			return -1, fmt.Errorf("page %q is disabled", id)
+		}
+	}
+	return -1, fmt.Errorf("no page %q", id)
+}
+
+// firstSmsPage is the index of the first SMS page
+func firstSmsPage() (int, error) {
+	if !cfg.ShowSms || totalNumPages <= cfgNumPages {
+		return -1, errNoSmsPages
+	}
+	return cfgNumPages, nil
+}
+
+// currentPageState describes the page on screen for the API
+func currentPageState() fiber.Map {
+	idx, total := currPageIdx, totalNumPages
+	state := fiber.Map{"index": idx, "total": total, "sms": cfg.ShowSms && idx >= cfgNumPages, "pinned": isPagePinned()}
+	if ids := cfg.DisplayTemplate.shownPages(); idx >= 0 && idx < len(ids) {
+		state["id"] = ids[idx]
+	}
+	return state
+}
+
+// GET /api/v2/display/page
+func getDisplayPage(c *fiber.Ctx) error {
+	return c.JSON(currentPageState())
+}
+
+// PUT /api/v2/display/page
+// Body: one of {"index": 3}, {"id": "page2"} or {"sms": true} for the first
+// SMS page; "pin": true also pins it.
+func putDisplayPage(c *fiber.Ctx) error {
+	var req struct {
+		Index *int   `json:"index"`
+		ID    string `json:"id"`
+		SMS   bool   `json:"sms"`
+		Pin   bool   `json:"pin"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "body must be {\"index\": n}, {\"id\": \"...\"} or {\"sms\": true}")
+	}
+
+	var target int
+	switch {
+	case req.Index != nil:
+		if *req.Index < 0 || *req.Index >= totalNumPages {
+			return apiError(c, fiber.StatusNotFound, fmt.Sprintf("index must be between 0 and %d", totalNumPages-1))
+		}
+		target = *req.Index
+	case req.ID != "":
+		i, err := pageIndexByID(req.ID)
+		if err != nil {
+			return apiError(c, fiber.StatusNotFound, err.Error())
+		}
+		target = i
+	case req.SMS:
+		i, err := firstSmsPage()
+		if err != nil {
+			return apiError(c, fiber.StatusConflict, err.Error())
+		}
+		target = i
+	default:
+		return apiError(c, fiber.StatusBadRequest, "one of index, id or sms is required")
+	}
+
+	if req.Pin {
+		setPagePinned(true)
+	}
+	if target != currPageIdx {
+		requestPage(pageTarget{index: target})
+	}
+	return c.JSON(fiber.Map{"status": "ok", "index": target, "pinned": isPagePinned()})
+}
+
+// POST /api/v2/display/previous-page
+func previousPageV2(c *fiber.Ctx) error {
+	requestPage(pageTarget{step: -1})
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// PUT /api/v2/display/pin
+func pinPage(c *fiber.Ctx) error {
+	setPagePinned(true)
+	return c.JSON(currentPageState())
+}
+
+// DELETE /api/v2/display/pin
+func unpinPage(c *fiber.Ctx) error {
+	setPagePinned(false)
+	return c.JSON(currentPageState())
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PageMeta orders and names a page. Its elements are
+// display_template.elements[ID].
+type PageMeta struct {
+	ID      string `json:"id"`
+	Title   string `json:"title,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty"` // default true
+}
+
+func (p PageMeta) enabled() bool { return p.Enabled == nil || *p.Enabled }
+
+// Page is a page as the page API reads and writes it
+type Page struct {
+	ID       string           `json:"id"`
+	Title    string           `json:"title,omitempty"`
+	Enabled  bool             `json:"enabled"`
+	Elements []DisplayElement `json:"elements"`
+}
+
+var (
+	pageIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+	elementTypes  = []string{"text", "fixed_text", "icon", "graph"}
+)
+
+// pageList returns every page, shown or not, in display order. Without a
+// "pages" list that is every key of elements, page2 before page10.
+func (t DisplayTemplate) pageList() []PageMeta {
+	if len(t.Pages) > 0 {
+		return t.Pages
+	}
+	keys := make([]string, 0, len(t.Elements))
+	for key := range t.Elements {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return pageKeyLess(keys[i], keys[j]) })
+	pages := make([]PageMeta, len(keys))
+	for i, key := range keys {
+		pages[i] = PageMeta{ID: key}
+	}
+	return pages
+}
+
+// shownPages returns the ids of the enabled pages in display order; page
+// indexes everywhere else count into this list
+func (t DisplayTemplate) shownPages() []string {
+	var ids []string
+	for _, p := range t.pageList() {
+		if p.enabled() {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// pageElements returns the elements of the pageIdx-th shown page
+func (t DisplayTemplate) pageElements(pageIdx int) ([]DisplayElement, bool) {
+	ids := t.shownPages()
+	if pageIdx < 0 || pageIdx >= len(ids) {
+		return nil, false
+	}
+	return t.Elements[ids[pageIdx]], true
+}
+
+// pageKeyLess sorts keys by their number, so page10 follows page9; keys
+// without one go last, by name
+func pageKeyLess(a, b string) bool {
+	na, errA := strconv.Atoi(strings.TrimPrefix(a, "page"))
+	nb, errB := strconv.Atoi(strings.TrimPrefix(b, "page"))
+	switch {
+	case errA == nil && errB == nil && na != nb:
+		return na < nb
+	case errA == nil && errB != nil:
+		return true
+	case errA != nil && errB == nil:
+		return false
+	}
+	return a < b
+}
+
+// validatePages checks the "pages" list against the merged elements. A
+// missing list shows every page; an empty one is refused.
+func validatePages(t DisplayTemplate) error {
+	if t.Pages == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(t.Pages))
+	shown := 0
+	for i, p := range t.Pages {
+		if !pageIDPattern.MatchString(p.ID) {
+			return fmt.Errorf("display_template.pages[%d]: id %q must be 1-32 letters, digits, _ or -", i, p.ID)
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("display_template.pages[%d]: duplicate id %q", i, p.ID)
+		}
+		seen[p.ID] = true
+		if _, ok := t.Elements[p.ID]; !ok {
+			return fmt.Errorf("display_template.pages[%d]: no elements for page %q", i, p.ID)
+		}
+		if p.enabled() {
+			shown++
+		}
+	}
+	if shown == 0 {
+		return errors.New("display_template.pages must enable at least one page")
+	}
+	return nil
+}
+
+// validateElement checks an element written through the API. Configs on
+// disk are more lenient: unknown types are skipped when drawing.
+func validateElement(e DisplayElement) error {
+	known := false
+	for _, t := range elementTypes {
+		known = known || e.Type == t
+	}
+	switch {
+	case !known:
+		return fmt.Errorf("element type must be one of %s, got %q", strings.Join(elementTypes, ", "), e.Type)
+	case e.Type == "text" && e.DataKey == "":
+		return errors.New("text elements need a data_key")
+	case e.Type == "icon" && e.IconPath == "":
+		return errors.New("icon elements need an icon_path")
+	case e.Type == "graph" && e.GraphConfig == nil:
+		return errors.New("graph elements need a graph_config")
+	}
+	return nil
+}
+
+// currentPages returns every page of the effective config in display order
+func currentPages() []Page {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return templatePages(cfg.DisplayTemplate)
+}
+
+func templatePages(t DisplayTemplate) []Page {
+	var pages []Page
+	for _, meta := range t.pageList() {
+		elems := append([]DisplayElement{}, t.Elements[meta.ID]...)
+		pages = append(pages, Page{ID: meta.ID, Title: meta.Title, Enabled: meta.enabled(), Elements: elems})
+	}
+	return pages
+}
+
+func findPage(pages []Page, id string) int {
+	for i, p := range pages {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// savePages runs edit on the pages of the saved configs and saves what it
+// returns, along with the ids of the pages whose elements it changed. The
+// edits go into the active profile, so switching profile takes them along,
+// or into the user config without one. It holds userConfigMu from the read
+// to the write, so concurrent edits don't undo each other.
+func savePages(edit func(pages []Page) ([]Page, []string, error)) error {
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	overrides, err := readUserOverrides()
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	var user Config
+	if err := json.Unmarshal(raw, &user); err != nil {
+		return fmt.Errorf("invalid user config: %w", err)
+	}
+	_, hasShowSms := overrides["show_sms"]
+
+	base := dftCfg
+	name := activeProfileName()
+	var profile map[string]interface{}
+	if name != "" {
+		if profile, err = readProfileOverrides(name); err != nil {
+			return err
+		}
+		p, _, err := decodeProfile(name, profile)
+		if err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		base = overlayConfig(dftCfg, p.conf, p.showSms)
+	}
+	saved := overlayConfig(base, user, hasShowSms)
+
+	before := pageMetas(templatePages(saved.DisplayTemplate))
+	pages, edited, err := edit(templatePages(saved.DisplayTemplate))
+	if err != nil {
+		return err
+	}
+	listChanged := !reflect.DeepEqual(before, pageMetas(pages))
+	if profile == nil {
+		writePages(overrides, pages, edited, listChanged)
+		return applyUserOverridesLocked(overrides)
+	}
+
+	// the user config is laid over the profile, so what it sets would hide
+	// the edit
+	if listChanged && user.DisplayTemplate.Pages != nil {
+		return pageError{fiber.StatusConflict, fmt.Sprintf("the user config sets the page list, which overrides profile %q's", name)}
+	}
+	for _, id := range edited {
+		if _, ok := user.DisplayTemplate.Elements[id]; ok {
+			return pageError{fiber.StatusConflict, fmt.Sprintf("the user config sets the elements of page %q, which override profile %q's", id, name)}
+		}
+	}
+	writePages(profile, pages, edited, listChanged)
+	return saveProfileLocked(name, profile)
+}
+
+// pageMetas returns the page list entries of pages
+func pageMetas(pages []Page) []PageMeta {
+	metas := make([]PageMeta, len(pages))
+	for i, p := range pages {
+		metas[i] = PageMeta{ID: p.ID, Title: p.Title}
+		if !p.Enabled {
+			metas[i].Enabled = new(bool)
+		}
+	}
+	return metas
+}
+
+// writePages writes the elements of the edited pages into a user config or
+// profile, and the page list only when it changed, so element edits don't
+// pin the list. Pages nobody edited keep following the configs below; when
+// the list is written, elements of pages no longer listed are dropped.
+func writePages(overrides map[string]interface{}, pages []Page, edited []string, listChanged bool) {
+	template, _ := overrides["display_template"].(map[string]interface{})
+	if template == nil {
+		template = map[string]interface{}{}
+	}
+	elements, _ := template["elements"].(map[string]interface{})
+	if elements == nil {
+		elements = map[string]interface{}{}
+	}
+
+	for _, id := range edited {
+		if i := findPage(pages, id); i >= 0 {
+			elements[id] = append([]DisplayElement{}, pages[i].Elements...)
+		}
+	}
+	if listChanged {
+		for id := range elements {
+			if findPage(pages, id) < 0 {
+				delete(elements, id)
+			}
+		}
+		template["pages"] = pageMetas(pages)
+	}
+	if len(elements) > 0 {
+		template["elements"] = elements
+	}
+	if len(template) > 0 {
+		overrides["display_template"] = template
+	}
+}
+
+// newPageID picks the next free pageN, skipping ids of hidden default pages
+func newPageID(pages []Page) string {
+	configMutex.RLock()
+	taken := make(map[string]bool, len(cfg.DisplayTemplate.Elements))
+	for id := range cfg.DisplayTemplate.Elements {
+		taken[id] = true
+	}
+	configMutex.RUnlock()
+	for _, p := range pages {
+		taken[p.ID] = true
+	}
+	for n := len(pages); ; n++ {
+		if id := "page" + strconv.Itoa(n); !taken[id] {
+			return id
+		}
+	}
+}
+
+// pageError is a problem with the request found while looking at the pages,
+// answered with its own status
+type pageError struct {
+	status  int
+	message string
+}
+
+func (e pageError) Error() string { return e.message }
+
+// pagesError answers a pageError with its status, and any other error, from
+// config validation refusing the edit, with 422
+func pagesError(c *fiber.Ctx, err error) error {
+	var pe pageError
+	if errors.As(err, &pe) {
+		return apiError(c, pe.status, pe.message)
+	}
+	return apiConfigError(c, err, nil)
+}
+
+// pageIndex looks up the :id page, a 404 pageError when there is none
+func pageIndex(c *fiber.Ctx, pages []Page) (int, error) {
+	i := findPage(pages, c.Params("id"))
+	if i < 0 {
+		return -1, pageError{fiber.StatusNotFound, fmt.Sprintf("no page %q", c.Params("id"))}
+	}
+	return i, nil
+}
+
+// elementIndex parses :index of a page's elements, a 404 pageError when it is out of range
+func elementIndex(c *fiber.Ctx, page Page) (int, error) {
+	i, err := strconv.Atoi(c.Params("index"))
+	if err != nil || i < 0 || i >= len(page.Elements) {
+		return -1, pageError{fiber.StatusNotFound, fmt.Sprintf("page %q has no element %q", page.ID, c.Params("index"))}
+	}
+	return i, nil
+}
+
+// decodeElement reads an element body; enable defaults to 1 so new elements show
+func decodeElement(raw []byte, base DisplayElement) (DisplayElement, error) {
+	e := base
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return e, fmt.Errorf("body must be an element object: %v", err)
+	}
+	return e, validateElement(e)
+}
+
+// GET /api/v2/pages
+func listPages(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"pages": currentPages()})
+}
+
+// POST /api/v2/pages
+// Body: a page, with optional "position" in the list (default last). id is
+// generated when left out.
+func createPage(c *fiber.Ctx) error {
+	var req struct {
+		ID       string           `json:"id"`
+		Title    string           `json:"title"`
+		Enabled  *bool            `json:"enabled"`
+		Elements []DisplayElement `json:"elements"`
+		Position *int             `json:"position"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "body must be a page object: "+err.Error())
+	}
+	if req.ID != "" && !pageIDPattern.MatchString(req.ID) {
+		return apiError(c, fiber.StatusBadRequest, "id must be 1-32 letters, digits, _ or -")
+	}
+	page := Page{ID: req.ID, Title: req.Title, Enabled: req.Enabled == nil || *req.Enabled, Elements: req.Elements}
+	if page.Elements == nil {
+		page.Elements = []DisplayElement{}
+	}
+	for i, e := range page.Elements {
+		if err := validateElement(e); err != nil {
+			return apiError(c, fiber.StatusUnprocessableEntity, fmt.Sprintf("elements[%d]: %v", i, err))
+		}
+	}
+
+	err := savePages(func(pages []Page) ([]Page, []string, error) {
+		if page.ID == "" {
+			page.ID = newPageID(pages)
+		} else if findPage(pages, page.ID) >= 0 {
+			return nil, nil, pageError{fiber.StatusConflict, fmt.Sprintf("page %q exists", page.ID)}
+		}
+		pos := len(pages)
+		if req.Position != nil {
+			if *req.Position < 0 || *req.Position > len(pages) {
+				return nil, nil, pageError{fiber.StatusBadRequest, fmt.Sprintf("position must be between 0 and %d", len(pages))}
+			}
+			pos = *req.Position
+		}
+		return append(pages[:pos], append([]Page{page}, pages[pos:]...)...), []string{page.ID}, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(page)
+}
+
+// GET /api/v2/pages/:id
+func getPage(c *fiber.Ctx) error {
+	pages := currentPages()
+	i, err := pageIndex(c, pages)
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(pages[i])
+}
+
+// PATCH /api/v2/pages/:id
+// Body: any of title, enabled and elements (which replaces the list)
+func patchPage(c *fiber.Ctx) error {
+	var req struct {
+		Title    *string           `json:"title"`
+		Enabled  *bool             `json:"enabled"`
+		Elements *[]DisplayElement `json:"elements"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "body must be a page object: "+err.Error())
+	}
+	if req.Elements != nil {
+		for j, e := range *req.Elements {
+			if err := validateElement(e); err != nil {
+				return apiError(c, fiber.StatusUnprocessableEntity, fmt.Sprintf("elements[%d]: %v", j, err))
+			}
+		}
+	}
+
+	var page Page
+	err := savePages(func(pages []Page) ([]Page, []string, error) {
+		i, err := pageIndex(c, pages)
+		if err != nil {
+			return nil, nil, err
+		}
+		var edited []string
+		if req.Title != nil {
+			pages[i].Title = *req.Title
+		}
+		if req.Enabled != nil {
+			pages[i].Enabled = *req.Enabled
+		}
+		if req.Elements != nil {
+			pages[i].Elements = append([]DisplayElement{}, *req.Elements...)
+			edited = append(edited, pages[i].ID)
+		}
+		page = pages[i]
+		return pages, edited, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(page)
+}
+
+// DELETE /api/v2/pages/:id
+func deletePage(c *fiber.Ctx) error {
+	err := savePages(func(pages []Page) ([]Page, []string, error) {
+		i, err := pageIndex(c, pages)
+		if err != nil {
+			return nil, nil, err
+		}
+		shown := 0
+		for _, p := range pages {
+			if p.Enabled {
+				shown++
+			}
+		}
+		if pages[i].Enabled && shown == 1 {
+			return nil, nil, pageError{fiber.StatusConflict, fmt.Sprintf("page %q is the last shown page", pages[i].ID)}
+		}
+		return append(pages[:i], pages[i+1:]...), nil, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// PUT /api/v2/pages/order
+// Body: {"order": ["page2", "page0", ...]}, every page id exactly once
+func reorderPages(c *fiber.Ctx) error {
+	var req struct {
+		Order []string `json:"order"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "body must be {\"order\": [page ids]}")
+	}
+	err := savePages(func(pages []Page) ([]Page, []string, error) {
+		if len(req.Order) != len(pages) {
+			return nil, nil, pageError{fiber.StatusBadRequest, fmt.Sprintf("order must list all %d pages", len(pages))}
+		}
+		reordered := make([]Page, 0, len(pages))
+		for _, id := range req.Order {
+			i := findPage(pages, id)
+			if i < 0 {
+				return nil, nil, pageError{fiber.StatusBadRequest, fmt.Sprintf("unknown page %q in order", id)}
+			}
+			if findPage(reordered, id) >= 0 {
+				return nil, nil, pageError{fiber.StatusBadRequest, fmt.Sprintf("page %q listed twice", id)}
+			}
+			reordered = append(reordered, pages[i])
+		}
+		return reordered, nil, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return listPages(c)
+}
+
+// GET /api/v2/pages/:id/elements
+func listElements(c *fiber.Ctx) error {
+	pages := currentPages()
+	i, err := pageIndex(c, pages)
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(fiber.Map{"elements": pages[i].Elements})
+}
+
+// POST /api/v2/pages/:id/elements?index=N
+// Appends the element, or inserts it before index N
+func createElement(c *fiber.Ctx) error {
+	elem, err := decodeElement(c.Body(), DisplayElement{Enable: 1})
+	if err != nil {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+	err = savePages(func(pages []Page) ([]Page, []string, error) {
+		i, err := pageIndex(c, pages)
+		if err != nil {
+			return nil, nil, err
+		}
+		elems := pages[i].Elements
+		at := c.QueryInt("index", len(elems))
+		if at < 0 || at > len(elems) {
+			return nil, nil, pageError{fiber.StatusBadRequest, fmt.Sprintf("index must be between 0 and %d", len(elems))}
+		}
+		pages[i].Elements = append(elems[:at], append([]DisplayElement{elem}, elems[at:]...)...)
+		return pages, []string{pages[i].ID}, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(elem)
+}
+
+// GET /api/v2/pages/:id/elements/:index
+func getElement(c *fiber.Ctx) error {
+	pages := currentPages()
+	i, err := pageIndex(c, pages)
+	if err != nil {
+		return pagesError(c, err)
+	}
+	j, err := elementIndex(c, pages[i])
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(pages[i].Elements[j])
+}
+
+// PUT /api/v2/pages/:id/elements/:index replaces the element
+func putElement(c *fiber.Ctx) error {
+	return writeElement(c, func(DisplayElement) DisplayElement { return DisplayElement{Enable: 1} })
+}
+
+// PATCH /api/v2/pages/:id/elements/:index changes the fields given, e.g.
+// {"position": {"x": 10, "y": 40}}
+func patchElement(c *fiber.Ctx) error {
+	return writeElement(c, func(current DisplayElement) DisplayElement { return current })
+}
+
+func writeElement(c *fiber.Ctx, base func(DisplayElement) DisplayElement) error {
+	var elem DisplayElement
+	err := savePages(func(pages []Page) ([]Page, []string, error) {
+		i, err := pageIndex(c, pages)
+		if err != nil {
+			return nil, nil, err
+		}
+		j, err := elementIndex(c, pages[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		elem, err = decodeElement(c.Body(), base(pages[i].Elements[j]))
+		if err != nil {
+			return nil, nil, pageError{fiber.StatusUnprocessableEntity, err.Error()}
+		}
+		pages[i].Elements[j] = elem
+		return pages, []string{pages[i].ID}, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(elem)
+}
+
+// DELETE /api/v2/pages/:id/elements/:index
+func deleteElement(c *fiber.Ctx) error {
+	err := savePages(func(pages []Page) ([]Page, []string, error) {
+		i, err := pageIndex(c, pages)
+		if err != nil {
+			return nil, nil, err
+		}
+		j, err := elementIndex(c, pages[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		pages[i].Elements = append(pages[i].Elements[:j], pages[i].Elements[j+1:]...)
+		return pages, []string{pages[i].ID}, nil
+	})
+	if err != nil {
+		return pagesError(c, err)
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
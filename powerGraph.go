@@ -7,7 +7,6 @@ import (
 	"log"
 	"math"
 	"os"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -61,23 +60,16 @@ func initPowerDataRecording() {
 
 // recordPowerSample records current power reading
 func recordPowerSample() {
-	// Get current battery wattage from global data
-	wattageInterface, exists := globalData.Load("BatteryWattage")
-	if !exists {
+	// Get current battery wattage from global data. A failed reading leaves
+	// the last value in the store, which must not be plotted again.
+	if entry, _ := globalData.Get("BatteryWattage"); entry.Error != "" {
 		return
 	}
-	
-	wattageStr, ok := wattageInterface.(string)
+	wattage, ok := globalData.Float("BatteryWattage")
 	if !ok {
 		return
 	}
 	
-	wattage, err := strconv.ParseFloat(wattageStr, 64)
-	if err != nil {
-		log.Printf("Failed to parse battery wattage: %v", err)
-		return
-	}
-	
 	powerData.mu.Lock()
 	defer powerData.mu.Unlock()
 	
@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -39,6 +41,10 @@ var localHTTPClient = &http.Client{
 	Timeout: 15 * time.Second,
 }
 
+// execWaitDelay bounds how long a cancelled command, or a child it left
+// holding stdout, may keep secureExecCommandContext waiting
+const execWaitDelay = time.Second
+
 // sanitizeCommandArg validates and sanitizes command arguments
 func sanitizeCommandArg(arg string) string {
 	// Remove any shell metacharacters and limit to alphanumeric, dash, underscore, dot, slash
@@ -51,6 +57,43 @@ func sanitizeCommandArg(arg string) string {
 
 // secureExecCommand executes a command with sanitized arguments
 func secureExecCommand(command string, args ...string) ([]byte, error) {
+	sanitizedArgs, err := sanitizeCommand(command, args)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(command, sanitizedArgs...).Output()
+}
+
+// secureExecCommandContext is secureExecCommand, killing the command and its
+// process group once ctx is done and keeping at most maxOutput bytes of stdout
+func secureExecCommandContext(ctx context.Context, maxOutput int64, command string, args ...string) ([]byte, error) {
+	sanitizedArgs, err := sanitizeCommand(command, args)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, command, sanitizedArgs...)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = execWaitDelay
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	out, readErr := io.ReadAll(io.LimitReader(stdout, maxOutput))
+	if readErr == nil {
+		_, readErr = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return out, err
+	}
+	return out, readErr
+}
+
+// sanitizeCommand checks the command name and returns the arguments that are
+// safe to pass on, dropping empty ones
+func sanitizeCommand(command string, args []string) ([]string, error) {
 	// Validate command name
 	if sanitizeCommandArg(command) == "" {
 		return nil, fmt.Errorf("invalid command: %s", command)
@@ -73,8 +116,7 @@ func secureExecCommand(command string, args ...string) ([]byte, error) {
 			return nil, fmt.Errorf("invalid argument: %s", arg)
 		}
 	}
-
-	return exec.Command(command, sanitizedArgs...).Output()
+	return sanitizedArgs, nil
 }
 
 // WiFiInterface mirrors each element of "wifi_interfaces" in the JSON.
@@ -168,20 +210,23 @@ type NetworkSpeed struct {
 	DownloadMbps float64
 }
 
-func collectBatteryData() {
-	var err error
-	if battSOC, err = getBatterySoc(); err != nil {
-		fmt.Printf("Could not get battery soc: %v\n", err)
-		globalData.Store("BatterySoc", -1)
+// collectBatteryData fails when the state of charge can't be read, i.e. there is
+// no usable battery driver.
+func collectBatteryData() error {
+	var err, socErr error
+	data := globalData.Source("battery")
+	if battSOC, socErr = getBatterySoc(); socErr != nil {
+		fmt.Printf("Could not get battery soc: %v\n", socErr)
+		data.StoreError("BatterySoc", socErr)
 	} else {
-		globalData.Store("BatterySoc", battSOC)
+		data.Store("BatterySoc", battSOC)
 	}
 
 	if battChargingStatus, err = getBatteryCharging(); err != nil {
 		fmt.Printf("Could not get battery charging: %v\n", err)
-		globalData.Store("BatteryCharging", false)
+		data.StoreError("BatteryCharging", err)
 	} else {
-		globalData.Store("BatteryCharging", battChargingStatus)
+		data.Store("BatteryCharging", battChargingStatus)
 	}
 
 	//if charging status change, we trigger lastActivity
@@ -201,57 +246,93 @@ func collectBatteryData() {
 	} else {
 		idleTimeout = time.Duration(cfg.ScreenDimmerTimeOnBatterySeconds) * time.Second
 	}
+	return socErr
+}
+
+// Keys filled from each pcat-manager endpoint, flagged as failed when it can't be reached
+var (
+	pcatDashboardKeys = []string{
+		"BoardTemperature", "Carrier", "GatewayDevice", "DHCPClientsCount", "FirmwareVersion",
+		"ISPName", "Model", "ModemModel", "ModemSignalStrength", "SdState", "ServerLocation",
+		"SimNumber", "SimState", "WiFiClientsCount", "WiFiInterfaces", "PublicIP",
+		"UpSpeedBps", "DownSpeedBps", "OSVersion", "WiFiSSIDs",
+	}
+	pcatDataStatsKeys  = []string{"DailyDataUsage", "WeeklyDataUsage", "MonthlyDataUsage", "LastMonthUsage"}
+	pcatModemBasicKeys = []string{
+		"CellCarrierInfo", "ModemFirmwareVer", "IMEINum", "ModemCellID", "ModemCellInfo",
+		"ModemSignals", "ModemISPDetails", "ModemNetworkInfo", "ModemRoamPref", "ModemServingInfo",
+		"ModemServingQual", "ModemUSBSpeed", "ModemUSBNetMode", "ModemValid", "PolicyLTEBands",
+		"PolicyNR5GBands", "SelectedLTEBands", "SelectedNR5GBands", "SMSCheckInterval",
+		"SMSForward", "SMSForwardTo", "ModemTemperature",
+	}
+)
+
+// pcatWebGet fetches one pcat-manager endpoint, giving up when ctx is done
+func pcatWebGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return localHTTPClient.Do(req)
 }
 
-func getInfoFromPcatWeb() {
+// getInfoFromPcatWeb reads pcat-manager's dashboard, data usage and modem info.
+// It fails only when none of the endpoints could be reached.
+func getInfoFromPcatWeb(ctx context.Context) error {
 	dashbarodURL := "http://localhost:80/api/v1/dashboard.json"
 	networkStatsURL := "http://localhost:80/api/v1/data_stats.json?network_type=mobile"
 	basicURL := "http://localhost:80/api/v1/modem/basic.json"
 
 	var info DashboardInfo
+	data := globalData.Source("pcat_web")
 
 	// === 1) Fetch dashboard.json ===
-	resp, err := localHTTPClient.Get(dashbarodURL)
+	var reachErrs []error
+	resp, err := pcatWebGet(ctx, dashbarodURL)
 	if err != nil {
+		reachErrs = append(reachErrs, err)
 		fmt.Println("Could not get dashboard info:", err)
+		data.StoreErrors(err, pcatDashboardKeys...)
 	} else {
 		defer resp.Body.Close()
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			fmt.Println("Failed to read dashboard response body:", err)
+			data.StoreErrors(err, pcatDashboardKeys...)
 		} else {
 			if err2 := secureUnmarshal(body, &info); err2 != nil {
 				fmt.Println("Could not unmarshal dashboard info:", err2)
+				data.StoreErrors(err2, pcatDashboardKeys...)
 			} else {
 				// Store each field into globalData under a sensible key.
-				globalData.Store("BoardTemperature", info.BoardTemperature)
-				globalData.Store("Carrier", info.Carrier)
-				globalData.Store("GatewayDevice", info.Connection)
-				globalData.Store("DHCPClientsCount", info.DHCPClientsCount)
-				globalData.Store("FirmwareVersion", info.FirmwareVersion)
-				globalData.Store("ISPName", info.ISPName)
-				globalData.Store("Model", info.Model)
-				globalData.Store("ModemModel", info.ModemModel)
-				globalData.Store("ModemSignalStrength", info.ModemSignalStrength)
+				data.Store("BoardTemperature", info.BoardTemperature)
+				data.Store("Carrier", info.Carrier)
+				data.Store("GatewayDevice", info.Connection)
+				data.Store("DHCPClientsCount", info.DHCPClientsCount)
+				data.Store("FirmwareVersion", info.FirmwareVersion)
+				data.Store("ISPName", info.ISPName)
+				data.Store("Model", info.Model)
+				data.Store("ModemModel", info.ModemModel)
+				data.Store("ModemSignalStrength", info.ModemSignalStrength)
 				if info.SdState == 0 {
-					globalData.Store("SdState", "No")
+					data.Store("SdState", "No")
 				} else {
-					globalData.Store("SdState", "Yes")
+					data.Store("SdState", "Yes")
 				}
-				globalData.Store("ServerLocation", info.ServerLocation)
-				globalData.Store("SimNumber", info.SimNumber)
+				data.Store("ServerLocation", info.ServerLocation)
+				data.Store("SimNumber", info.SimNumber)
 
 				if info.SimState == "ready" {
-					globalData.Store("SimState", "Yes")
+					data.Store("SimState", "Yes")
 				} else {
-					globalData.Store("SimState", "No")
+					data.Store("SimState", "No")
 				}
 
-				globalData.Store("WiFiClientsCount", info.WiFiClientsCount)
-				globalData.Store("WiFiInterfaces", info.WiFiInterfaces)
-				globalData.Store("PublicIP", info.PublicIP)
-				globalData.Store("UpSpeedBps", info.UpSpeedBps)
-				globalData.Store("DownSpeedBps", info.DownSpeedBps)
+				data.Store("WiFiClientsCount", info.WiFiClientsCount)
+				data.Store("WiFiInterfaces", info.WiFiInterfaces)
+				data.Store("PublicIP", info.PublicIP)
+				data.Store("UpSpeedBps", info.UpSpeedBps)
+				data.Store("DownSpeedBps", info.DownSpeedBps)
 				theOS := ""
 				raw := info.OpenWRTVersion // e.g. "R25.02.0 / r7465-d1ccd1687"
 				parts := strings.SplitN(raw, "/", 2)
@@ -269,31 +350,35 @@ func getInfoFromPcatWeb() {
 				} else {
 					theOS = raw
 				}
-				globalData.Store("OSVersion", theOS)
+				data.Store("OSVersion", theOS)
 
 				// Build a slice of SSIDs for convenience
 				var ssids []string
 				for _, iface := range info.WiFiInterfaces {
 					ssids = append(ssids, iface.SSID)
 				}
-				globalData.Store("WiFiSSIDs", ssids)
+				data.Store("WiFiSSIDs", ssids)
 			}
 		}
 	}
 
 	// === 2) Fetch data_stats.json ===
-	resp2, err := localHTTPClient.Get(networkStatsURL)
+	resp2, err := pcatWebGet(ctx, networkStatsURL)
 	if err != nil {
+		reachErrs = append(reachErrs, err)
 		fmt.Println("Could not get network stats:", err)
+		data.StoreErrors(err, pcatDataStatsKeys...)
 	} else {
 		defer resp2.Body.Close()
 		body2, err := io.ReadAll(resp2.Body)
 		if err != nil {
 			fmt.Println("Failed to read network stats body:", err)
+			data.StoreErrors(err, pcatDataStatsKeys...)
 		} else {
 			var stats NetworkStats
 			if err3 := secureUnmarshal(body2, &stats); err3 != nil {
 				fmt.Println("Could not unmarshal network stats:", err3)
+				data.StoreErrors(err3, pcatDataStatsKeys...)
 			} else {
 				// Now store exactly the fields you want:
 				strTodayUsed := fmt.Sprintf("%0.2f", stats.TodayUsed/1024/1024/1024)
@@ -301,58 +386,67 @@ func getInfoFromPcatWeb() {
 				strMonthUsed := fmt.Sprintf("%0.2f", stats.MonthUsed/1024/1024/1024)
 				strLastMonthUsed := fmt.Sprintf("%0.2f", stats.LastMonthUsed/1024/1024/1024)
 
-				globalData.Store("DailyDataUsage", strTodayUsed)
-				globalData.Store("WeeklyDataUsage", strWeekUsed)
-				globalData.Store("MonthlyDataUsage", strMonthUsed)
-				globalData.Store("LastMonthUsage", strLastMonthUsed)
+				data.Store("DailyDataUsage", strTodayUsed)
+				data.Store("WeeklyDataUsage", strWeekUsed)
+				data.Store("MonthlyDataUsage", strMonthUsed)
+				data.Store("LastMonthUsage", strLastMonthUsed)
 			}
 		}
 	}
 
 	// 3) Modem basic
-	if resp, err := localHTTPClient.Get(basicURL); err != nil {
+	if resp, err := pcatWebGet(ctx, basicURL); err != nil {
+		reachErrs = append(reachErrs, err)
 		fmt.Println("Could not get modem basic info:", err)
+		data.StoreErrors(err, pcatModemBasicKeys...)
 	} else {
 		defer resp.Body.Close()
 		if body, err := io.ReadAll(resp.Body); err != nil {
 			fmt.Println("Failed to read modem basic body:", err)
+			data.StoreErrors(err, pcatModemBasicKeys...)
 		} else {
 			var mb ModemBasicInfo
 			if err := secureUnmarshal(body, &mb); err != nil {
 				fmt.Println("Could not unmarshal modem basic info:", err)
+				data.StoreErrors(err, pcatModemBasicKeys...)
 			} else {
-				globalData.Store("CellCarrierInfo", mb.CellCarrierInfo)
-				globalData.Store("ModemFirmwareVer", mb.FirmwareVersion)
-				globalData.Store("IMEINum", mb.IMEINum)
-				globalData.Store("ModemCellID", mb.ModemCellID)
-				globalData.Store("ModemCellInfo", mb.ModemCellInfo)
-				globalData.Store("ModemSignals", mb.ModemCellSignals)
-				globalData.Store("ModemISPDetails", mb.ModemIspDetails)
+				data.Store("CellCarrierInfo", mb.CellCarrierInfo)
+				data.Store("ModemFirmwareVer", mb.FirmwareVersion)
+				data.Store("IMEINum", mb.IMEINum)
+				data.Store("ModemCellID", mb.ModemCellID)
+				data.Store("ModemCellInfo", mb.ModemCellInfo)
+				data.Store("ModemSignals", mb.ModemCellSignals)
+				data.Store("ModemISPDetails", mb.ModemIspDetails)
 
 				networkInfo := mb.ModemNetworkInfo
 				if strings.Contains(networkInfo, "BAND ") {
 					networkInfo = strings.ReplaceAll(networkInfo, "BAND ", "B.")
 				}
 
-				globalData.Store("ModemNetworkInfo", networkInfo)
-
-				globalData.Store("ModemRoamPref", mb.ModemRoamPref)
-				globalData.Store("ModemServingInfo", mb.ModemServingInfo)
-				globalData.Store("ModemServingQual", mb.ModemServingQuality)
-				globalData.Store("ModemUSBSpeed", mb.ModemUSBSpeed)
-				globalData.Store("ModemUSBNetMode", mb.ModemUSBNetMode)
-				globalData.Store("ModemValid", mb.ModemValid)
-				globalData.Store("PolicyLTEBands", mb.PolicyLTEBands)
-				globalData.Store("PolicyNR5GBands", mb.PolicyNR5GBands)
-				globalData.Store("SelectedLTEBands", mb.SelectedLTEBands)
-				globalData.Store("SelectedNR5GBands", mb.SelectedNR5GBands)
-				globalData.Store("SMSCheckInterval", mb.SMSCheckInterval)
-				globalData.Store("SMSForward", mb.SMSForward)
-				globalData.Store("SMSForwardTo", mb.SMSForwardTo)
-				globalData.Store("ModemTemperature", mb.ModemTemperature)
+				data.Store("ModemNetworkInfo", networkInfo)
+
+				data.Store("ModemRoamPref", mb.ModemRoamPref)
+				data.Store("ModemServingInfo", mb.ModemServingInfo)
+				data.Store("ModemServingQual", mb.ModemServingQuality)
+				data.Store("ModemUSBSpeed", mb.ModemUSBSpeed)
+				data.Store("ModemUSBNetMode", mb.ModemUSBNetMode)
+				data.Store("ModemValid", mb.ModemValid)
+				data.Store("PolicyLTEBands", mb.PolicyLTEBands)
+				data.Store("PolicyNR5GBands", mb.PolicyNR5GBands)
+				data.Store("SelectedLTEBands", mb.SelectedLTEBands)
+				data.Store("SelectedNR5GBands", mb.SelectedNR5GBands)
+				data.Store("SMSCheckInterval", mb.SMSCheckInterval)
+				data.Store("SMSForward", mb.SMSForward)
+				data.Store("SMSForwardTo", mb.SMSForwardTo)
+				data.Store("ModemTemperature", mb.ModemTemperature)
 			}
 		}
 	}
+
+	if len(reachErrs) == 3 {
+		return fmt.Errorf("pcat-manager unreachable: %w", reachErrs[0])
+	}
+	return nil
 }
 
 // formatSpeed formats speed into value and units as Mbps
@@ -388,25 +482,26 @@ func getWANInterface() (string, error) {
 	return "", fmt.Errorf("WAN interface not found")
 }
 
-func collectWANNetworkSpeed() {
+// collectWANNetworkSpeed fails when no speed could be worked out this round
+func collectWANNetworkSpeed() error {
 	var err error
+	data := globalData.Source("wan_speed")
 	if isOpenWRT() {
-		upSpeed, ok1 := globalData.Load("UpSpeedBps")
-		downSpeed, ok2 := globalData.Load("DownSpeedBps")
+		upSpeed, ok1 := globalData.Float("UpSpeedBps")
+		downSpeed, ok2 := globalData.Float("DownSpeedBps")
 		if !ok1 || !ok2 {
 			log.Printf("Could not get WAN network speed data\n")
-			globalData.Store("WanUP", "-")
-			globalData.Store("WanDOWN", "-")
-			globalData.Store("WanUP_Unit", "")
-			globalData.Store("WanDOWN_Unit", "")
+			err = errors.New("no speed data from pcat-manager")
+			data.StoreErrors(err, "WanUP", "WanDOWN")
+			return err
 		} else {
-			wanUPVal, wanUPUnit := formatSpeed(upSpeed.(float64) / 1024 / 1024 * 8)
-			wanDOWNVal, wanDOWNUnit := formatSpeed(downSpeed.(float64) / 1024 / 1024 * 8)
+			wanUPVal, wanUPUnit := formatSpeed(upSpeed / 1024 / 1024 * 8)
+			wanDOWNVal, wanDOWNUnit := formatSpeed(downSpeed / 1024 / 1024 * 8)
 
-			globalData.Store("WanUP", wanUPVal)
-			globalData.Store("WanDOWN", wanDOWNVal)
-			globalData.Store("WanUP_Unit", wanUPUnit)
-			globalData.Store("WanDOWN_Unit", wanDOWNUnit)
+			data.Store("WanUP", wanUPVal)
+			data.Store("WanDOWN", wanDOWNVal)
+			data.Store("WanUP_Unit", wanUPUnit)
+			data.Store("WanDOWN_Unit", wanDOWNUnit)
 		}
 	} else {
 		// Cache WAN interface to avoid repeated lookups
@@ -414,123 +509,135 @@ func collectWANNetworkSpeed() {
 			wanInterface, err = getWANInterface()
 			if err != nil {
 				log.Printf("Could not get WAN interface: %v\n", err)
-				globalData.Store("WanUP", "0")
-				globalData.Store("WanDOWN", "0")
-				time.Sleep(5 * time.Second) // prevent infinite loop
-				return
+				data.StoreErrors(err, "WanUP", "WanDOWN")
+				return err // the scheduler backs off
 			}
 		}
 
 		netData, err := getNetworkSpeed(wanInterface)
 		if err != nil {
 			log.Printf("Could not get network speed: %v\n", err)
-			globalData.Store("WanUP", "0")
-			globalData.Store("WanDOWN", "0")
-			return
+			data.StoreErrors(err, "WanUP", "WanDOWN")
+			return err
 		}
 		wanUPVal, wanUPUnit := formatSpeed(netData.UploadMbps)
 		wanDOWNVal, wanDOWNUnit := formatSpeed(netData.DownloadMbps)
-		globalData.Store("WanUP", wanUPVal)
-		globalData.Store("WanDOWN", wanDOWNVal)
-		globalData.Store("WanUP_Unit", wanUPUnit)
-		globalData.Store("WanDOWN_Unit", wanDOWNUnit)
+		data.Store("WanUP", wanUPVal)
+		data.Store("WanDOWN", wanDOWNVal)
+		data.Store("WanUP_Unit", wanUPUnit)
+		data.Store("WanDOWN_Unit", wanDOWNUnit)
 	}
+	return nil
 }
 
 func collectFixedData() {
-	kernelDate, _ := getKernelDate()
-	globalData.Store("Kernel", kernelDate)
-	sn, _ := getSN()
-	globalData.Store("SN", sn)
+	data := globalData.Source("fixed")
+	if kernelDate, err := getKernelDate(); err != nil {
+		data.StoreError("Kernel", err)
+	} else {
+		data.Store("Kernel", kernelDate)
+	}
+	if sn, err := getSN(); err != nil {
+		data.StoreError("SN", err)
+	} else {
+		data.Store("SN", sn)
+	}
 }
 
 // collectData gathers several pieces of system and network information and stores them in globalData.
 func collectLinuxData(cfg Config) {
+	data := globalData.Source("linux")
 	if uptime, err := getUptime(); err != nil {
 		fmt.Printf("Could not get uptime: %v\n", err)
-		globalData.Store("Uptime", "N/A")
+		data.StoreError("Uptime", err)
 	} else {
-		globalData.Store("Uptime", uptime)
+		data.Store("Uptime", uptime)
 	}
 
 	// Battery voltage.
 	voltageUV, err := getBatteryVoltageUV()
 	if err != nil {
 		fmt.Printf("Could not get battery voltage: %v\n", err)
-		globalData.Store("BatteryVoltage", "N/A")
+		data.StoreError("BatteryVoltage", err)
 	} else {
 		voltage_2digit := fmt.Sprintf("%0.2f", voltageUV/1000/1000)
-		globalData.Store("BatteryVoltage", voltage_2digit)
+		data.Store("BatteryVoltage", voltage_2digit)
 	}
 
 	// Battery current.
-	currentUA, err := getBatteryCurrentUA()
-	if err != nil {
-		fmt.Printf("Could not get battery current: %v\n", err)
-		globalData.Store("BatteryCurrent", -9999)
+	currentUA, currentErr := getBatteryCurrentUA()
+	if currentErr != nil {
+		fmt.Printf("Could not get battery current: %v\n", currentErr)
+		data.StoreError("BatteryCurrent", currentErr)
 	} else {
 		current_2digit := fmt.Sprintf("%0.2f", currentUA/1000/1000)
-		globalData.Store("BatteryCurrent", current_2digit)
+		data.Store("BatteryCurrent", current_2digit)
 	}
 
-	// Battery wattage.
-	wattage := float64(voltageUV) * float64(currentUA) / 1000 / 1000 / 1000 / 1000
-	globalData.Store("BatteryWattage", fmt.Sprintf("%0.1f", wattage))
+	// Battery wattage, only meaningful when both readings succeeded.
+	if err != nil {
+		data.StoreError("BatteryWattage", err)
+	} else if currentErr != nil {
+		data.StoreError("BatteryWattage", currentErr)
+	} else {
+		wattage := float64(voltageUV) * float64(currentUA) / 1000 / 1000 / 1000 / 1000
+		data.Store("BatteryWattage", fmt.Sprintf("%0.1f", wattage))
+	}
 
 	// DC voltage.
 	dcVoltageUV, err := getDCVoltageUV()
 	if err != nil {
 		fmt.Printf("Could not get DC voltage: %v\n", err)
-		globalData.Store("DCVoltage", -9999)
+		data.StoreError("DCVoltage", err)
 	} else {
-		globalData.Store("DCVoltage", fmt.Sprintf("%0.1f", dcVoltageUV/1000/1000))
+		data.Store("DCVoltage", fmt.Sprintf("%0.1f", dcVoltageUV/1000/1000))
 	}
 
 	// CPU temperature.
 	if cpuTemp, err := getCpuTemp(); err != nil {
 		fmt.Printf("Could not get CPU temperature: %v\n", err)
-		globalData.Store("CpuTemp", -9999)
+		data.StoreError("CpuTemp", err)
 	} else {
 		cpuTemp_1digit := fmt.Sprintf("%0.1f", cpuTemp/1000)
-		globalData.Store("CpuTemp", cpuTemp_1digit)
+		data.Store("CpuTemp", cpuTemp_1digit)
 	}
 
 	// CPU usage.
 	cpuUsage, err := getCPUUsage()
 	if err != nil {
 		fmt.Printf("Could not get CPU usage: %v\n", err)
-		globalData.Store("CpuUsage", 0)
+		data.StoreError("CpuUsage", err)
 	} else {
 		cpuUsageInt := int(cpuUsage)
-		globalData.Store("CpuUsage", cpuUsageInt)
+		data.Store("CpuUsage", cpuUsageInt)
 	}
 
 	// Memory usage.
 	if memUsed, memTotal, err := getMemUsedAndTotalGB(); err != nil {
 		fmt.Printf("Could not get memory usage: %v\n", err)
-		globalData.Store("MemUsage", nil)
+		data.StoreError("MemUsage", err)
 	} else {
 		memUsed_1digit := fmt.Sprintf("%0.1f", memUsed)
 		memTotal_ceilInt := int(math.Ceil(memTotal))
 		memString := fmt.Sprintf("%s/%d", memUsed_1digit, memTotal_ceilInt)
-		globalData.Store("MemUsage", memString)
+		data.Store("MemUsage", memString)
 	}
 
 	// Disk usage.
 	if diskData, err := getDiskUsage(); err != nil {
 		fmt.Printf("Could not get disk usage: %v\n", err)
-		globalData.Store("DiskData", nil)
+		data.StoreError("DiskData", err)
 	} else {
-		globalData.Store("DiskData", diskData)
+		data.Store("DiskData", diskData)
 	}
 
 	//Fan speed
 	fanSpeed, err := getFanSpeed()
 	if err != nil {
 		fmt.Printf("Could not get fan speed: %v\n", err)
-		globalData.Store("FanRPM", "N/A")
+		data.StoreError("FanRPM", err)
 	} else {
-		globalData.Store("FanRPM", fanSpeed)
+		data.Store("FanRPM", fanSpeed)
 	}
 }
 
@@ -538,7 +645,7 @@ func collectLinuxData(cfg Config) {
 // valid integer it reads.
 func getFanSpeed() (int, error) {
 	// Glob all fan1_input files in hwmon directories
-	paths, err := filepath.Glob("/sys/class/hwmon/hwmon*/fan1_input")
+	paths, err := filepath.Glob(sysPath("/sys/class/hwmon/hwmon*/fan1_input"))
 	if err != nil {
 		return 0, fmt.Errorf("failed to glob hwmon paths: %w", err)
 	}
@@ -565,80 +672,81 @@ func getFanSpeed() (int, error) {
 }
 
 func collectNetworkData(cfg Config) {
+	data := globalData.Source("network")
 	if isOpenWRT() {
 		//we have aonther func to get data from pcat-manager-web
 	} else {
 		if sessionDataUsage, err := getSessionDataUsageGB(wanInterface); err != nil {
 			fmt.Printf("Could not get session data usage: %v\n", err)
-			globalData.Store("SessionDataUsage", nil)
+			data.StoreError("SessionDataUsage", err)
 		} else {
 			sessionDataUsage_1digit := fmt.Sprintf("%0.1f", sessionDataUsage)
-			globalData.Store("SessionDataUsage", sessionDataUsage_1digit)
+			data.Store("SessionDataUsage", sessionDataUsage_1digit)
 		}
 
 		if monthlyDataUsage, err := getDataUsageMonthlyGB(wanInterface); err != nil {
 			fmt.Printf("Could not get monthly data usage: %v\n", err)
-			globalData.Store("MonthlyDataUsage", nil)
+			data.StoreError("MonthlyDataUsage", err)
 		} else {
 			monthlyDataUsage_1digit := fmt.Sprintf("%0.1f", monthlyDataUsage)
-			globalData.Store("MonthlyDataUsage", monthlyDataUsage_1digit)
+			data.Store("MonthlyDataUsage", monthlyDataUsage_1digit)
 		}
 	}
 
 	// Local IP address.
 	if localIP, err := getLocalIPv4(); err != nil {
 		fmt.Printf("Could not get local IP: %v\n", err)
-		globalData.Store("LAN_IP", "N/A")
+		data.StoreError("LAN_IP", err)
 	} else {
-		globalData.Store("LAN_IP", localIP)
+		data.Store("LAN_IP", localIP)
 	}
 
 	// WAN IP address (local WAN interface IP)
 	if wanIP, err := getWanIPv4(); err != nil {
 		fmt.Printf("Could not get WAN IP: %v\n", err)
-		globalData.Store("WAN_IP", "N/A")
+		data.StoreError("WAN_IP", err)
 	} else {
-		globalData.Store("WAN_IP", wanIP)
+		data.Store("WAN_IP", wanIP)
 	}
 
 	// Public IP address.
 	if publicIP, err := getPublicIPv4(); err != nil {
 		fmt.Printf("Could not get public IP: %v\n", err)
-		globalData.Store("PUBLIC_IP", "N/A")
+		data.StoreError("PUBLIC_IP", err)
 	} else {
-		globalData.Store("PUBLIC_IP", publicIP)
+		data.Store("PUBLIC_IP", publicIP)
 	}
 
 	// SSID.
 	if ssid, err := getSSID(); err != nil {
 		//fmt.Printf("Could not get SSID: %v\n", err)
-		globalData.Store("SSID", "N/A")
+		data.StoreError("SSID", err)
 	} else {
-		globalData.Store("SSID", ssid)
+		data.Store("SSID", ssid)
 	}
 
 	// SSID.
 	if ssid2, err := getSSID2(); err != nil {
 		//fmt.Printf("Could not get SSID: %v\n", err)
-		globalData.Store("SSID2", "N/A")
+		data.StoreError("SSID2", err)
 	} else {
-		globalData.Store("SSID2", ssid2)
+		data.Store("SSID2", ssid2)
 	}
 
 	// DHCP clients (OpenWrt).
 	if dhcpClients, err := getDHCPClients(); err != nil {
 		fmt.Printf("Could not get DHCP clients: %v\n", err)
-		globalData.Store("DHCPClients", nil)
+		data.StoreError("DHCPClients", err)
 	} else {
-		globalData.Store("DHCPClients", dhcpClients)
+		data.Store("DHCPClients", dhcpClients)
 	}
 
 	// WiFi clients (OpenWrt).
 	if wifiClients, err := getWifiClients(); err != nil {
 		fmt.Printf("Could not get WiFi clients: %v\n", err)
-		globalData.Store("WifiClients", nil)
+		data.StoreError("WifiClients", err)
 	} else {
-		globalData.Store("WifiClients", wifiClients)
+		data.Store("WifiClients", wifiClients)
 	}
 
 	// Ping Site0 using ICMP with statistics tracking
@@ -647,29 +755,29 @@ func collectNetworkData(cfg Config) {
 	if ping0, err := pingICMP(cfg.PingSite0); err != nil {
 		// Keep showing last successful ping value, or -1 if never succeeded
 		if ping0Stats.lastSuccess > 0 {
-			globalData.Store("Ping0", ping0Stats.lastSuccess)
+			data.Store("Ping0", ping0Stats.lastSuccess)
 		} else {
-			globalData.Store("Ping0", int64(-1))
+			data.Store("Ping0", int64(-1))
 		}
 	} else if ping0 == -2 {
 		// Timeout case - show red X
-		globalData.Store("Ping0", int64(-2))
+		data.Store("Ping0", int64(-2))
 	} else if ping0 > 0 {
 		// Successful ping - update last success and display it
 		ping0Stats.successful++
 		ping0Stats.lastSuccess = ping0
-		globalData.Store("Ping0", ping0)
+		data.Store("Ping0", ping0)
 	} else {
 		// Other error case
 		if ping0Stats.lastSuccess > 0 {
-			globalData.Store("Ping0", ping0Stats.lastSuccess)
+			data.Store("Ping0", ping0Stats.lastSuccess)
 		} else {
-			globalData.Store("Ping0", int64(-1))
+			data.Store("Ping0", int64(-1))
 		}
 	}
 	// Calculate and store success rate
 	successRate0 := float64(ping0Stats.successful) / float64(ping0Stats.total) * 100
-	globalData.Store("Ping0Rate", fmt.Sprintf("%.0f", successRate0))
+	data.Store("Ping0Rate", fmt.Sprintf("%.0f", successRate0))
 	ping0Stats.mu.Unlock()
 
 	// Ping Site1 using ICMP with statistics tracking
@@ -678,29 +786,29 @@ func collectNetworkData(cfg Config) {
 	if ping1, err := pingICMP(cfg.PingSite1); err != nil {
 		// Keep showing last successful ping value, or -1 if never succeeded
 		if ping1Stats.lastSuccess > 0 {
-			globalData.Store("Ping1", ping1Stats.lastSuccess)
+			data.Store("Ping1", ping1Stats.lastSuccess)
 		} else {
-			globalData.Store("Ping1", int64(-1))
+			data.Store("Ping1", int64(-1))
 		}
 	} else if ping1 == -2 {
 		// Timeout case - show red X
-		globalData.Store("Ping1", int64(-2))
+		data.Store("Ping1", int64(-2))
 	} else if ping1 > 0 {
 		// Successful ping - update last success and display it
 		ping1Stats.successful++
 		ping1Stats.lastSuccess = ping1
-		globalData.Store("Ping1", ping1)
+		data.Store("Ping1", ping1)
 	} else {
 		// Other error case
 		if ping1Stats.lastSuccess > 0 {
-			globalData.Store("Ping1", ping1Stats.lastSuccess)
+			data.Store("Ping1", ping1Stats.lastSuccess)
 		} else {
-			globalData.Store("Ping1", int64(-1))
+			data.Store("Ping1", int64(-1))
 		}
 	}
 	// Calculate and store success rate
 	successRate1 := float64(ping1Stats.successful) / float64(ping1Stats.total) * 100
-	globalData.Store("Ping1Rate", fmt.Sprintf("%.0f", successRate1))
+	data.Store("Ping1Rate", fmt.Sprintf("%.0f", successRate1))
 	ping1Stats.mu.Unlock()
 
 	/*
@@ -715,9 +823,9 @@ func collectNetworkData(cfg Config) {
 	// IPv6 public IP.
 	if ipv6, err := getIPv6Public(); err != nil {
 		//fmt.Printf("Could not get IPv6 public IP: %v\n", err)
-		globalData.Store("PublicIPv6", "0.0.0.0")
+		data.StoreError("PublicIPv6", err)
 	} else {
-		globalData.Store("PublicIPv6", ipv6)
+		data.Store("PublicIPv6", ipv6)
 	}
 }
 
@@ -763,7 +871,7 @@ func getSN() (string, error) {
 // getUptimeSeconds returns system uptime in seconds
 func getUptimeSeconds() (float64, error) {
 	// Read /proc/uptime
-	data, err := os.ReadFile("/proc/uptime")
+	data, err := os.ReadFile(sysPath("/proc/uptime"))
 	if err != nil {
 		return 0, fmt.Errorf("error reading /proc/uptime: %v", err)
 	}
@@ -834,7 +942,7 @@ func getKernelDate() (string, error) {
 
 // getDCVoltageUV reads DC voltage from the system.
 func getDCVoltageUV() (float64, error) {
-	file, err := os.Open("/sys/class/power_supply/charger/voltage_now")
+	file, err := os.Open(sysPath("/sys/class/power_supply/charger/voltage_now"))
 	if err != nil {
 		return 0, err
 	}
@@ -852,7 +960,7 @@ func getDCVoltageUV() (float64, error) {
 
 // getInterfaceBytes reads rx and tx bytes for a given interface.
 func getInterfaceBytes(iface string) (rxBytes, txBytes uint64, err error) {
-	basePath := "/sys/class/net/" + iface + "/statistics/"
+	basePath := sysPath("/sys/class/net/"+iface) + "/statistics/"
 	rxPath := basePath + "rx_bytes"
 	txPath := basePath + "tx_bytes"
 
@@ -874,7 +982,7 @@ func getInterfaceBytes(iface string) (rxBytes, txBytes uint64, err error) {
 }
 
 func isOpenWRT() bool {
-	if _, err := os.Stat("/etc/openwrt_release"); err == nil {
+	if _, err := os.Stat(sysPath("/etc/openwrt_release")); err == nil {
 		return true
 	}
 	return false
@@ -928,7 +1036,7 @@ func getSSID() (string, error) {
 // getSSID returns connected SSID on Debian or broadcasting SSID on OpenWrt.
 func getSSID2() (string, error) {
 	// OpenWrt detection
-	if _, err := os.Stat("/etc/openwrt_release"); err == nil {
+	if _, err := os.Stat(sysPath("/etc/openwrt_release")); err == nil {
 		// OpenWrt: Use uci command
 		out, err := secureExecCommand("uci", "get", "wireless.@wifi-iface[1].ssid")
 		if err != nil {
@@ -1001,7 +1109,7 @@ func getSessionDataUsageGB(iface string) (float64, error) {
 
 	for _, stat := range stats {
 		// build path: /sys/class/net/<iface>/statistics/<stat>
-		path := filepath.Join("/sys/class/net", iface, "statistics", stat)
+		path := sysPath(filepath.Join("/sys/class/net", iface, "statistics", stat))
 
 		// read the file
 		data, err := os.ReadFile(path)
@@ -1102,7 +1210,7 @@ type CPUStats struct {
 }
 
 func readCPUStats() ([]CPUStats, error) {
-	data, err := os.ReadFile("/proc/stat")
+	data, err := os.ReadFile(sysPath("/proc/stat"))
 	if err != nil {
 		return nil, err
 	}
@@ -1224,7 +1332,7 @@ func pingICMP(host string) (int64, error) {
 
 // getBatterySoc returns the battery soc from /sys/class/power_supply/battery/capacity.
 func getBatterySoc() (int, error) {
-	file, err := os.Open("/sys/class/power_supply/battery/capacity")
+	file, err := os.Open(sysPath("/sys/class/power_supply/battery/capacity"))
 	if err != nil {
 		return -1, err
 	}
@@ -1250,7 +1358,7 @@ func getBatteryCharging() (bool, error) {
 		}
 		return current > 0, nil
 	} else {
-		file, err := os.Open("/sys/class/power_supply/battery/status")
+		file, err := os.Open(sysPath("/sys/class/power_supply/battery/status"))
 		if err != nil {
 			return false, err
 		}
@@ -1270,7 +1378,7 @@ func getBatteryCharging() (bool, error) {
 }
 
 func getBatteryVoltageUV() (float64, error) {
-	file, err := os.Open("/sys/class/power_supply/battery/voltage_now")
+	file, err := os.Open(sysPath("/sys/class/power_supply/battery/voltage_now"))
 	if err != nil {
 		return 0, err
 	}
@@ -1283,7 +1391,7 @@ func getBatteryVoltageUV() (float64, error) {
 }
 
 func getBatteryCurrentUA() (float64, error) {
-	file, err := os.Open("/sys/class/power_supply/battery/current_now")
+	file, err := os.Open(sysPath("/sys/class/power_supply/battery/current_now"))
 	if err != nil {
 		return 0, err
 	}
@@ -1445,7 +1553,7 @@ func getIPv6Public() (string, error) {
 
 // getCpuTemp returns CPU temperature from /sys/class/thermal/thermal_zone0/temp.
 func getCpuTemp() (float64, error) {
-	file, err := os.Open("/sys/class/thermal/thermal_zone0/temp")
+	file, err := os.Open(sysPath("/sys/class/thermal/thermal_zone0/temp"))
 	if err != nil {
 		return 0, err
 	}
@@ -1459,7 +1567,7 @@ func getCpuTemp() (float64, error) {
 
 // getMemUsedAndTotalGB returns used and total memory in GB.
 func getMemUsedAndTotalGB() (usedGB float64, totalGB float64, err error) {
-	data, err := os.ReadFile("/proc/meminfo")
+	data, err := os.ReadFile(sysPath("/proc/meminfo"))
 	if err != nil {
 		return 0, 0, err
 	}
@@ -1504,7 +1612,7 @@ func getMemUsedAndTotalGB() (usedGB float64, totalGB float64, err error) {
 // getDiskUsage returns disk usage stats (total and free space in MB) for the current partition.
 func getDiskUsage() (map[string]interface{}, error) {
 	var stat syscall.Statfs_t
-	err := syscall.Statfs("/", &stat)
+	err := syscall.Statfs(sysPath("/"), &stat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat filesystem: %v", err)
 	}
@@ -1562,7 +1670,7 @@ type networkStats struct {
 
 // readNetworkStats reads current network stats from /proc/net/dev.
 func readNetworkStats() (map[string]networkStats, error) {
-	file, err := os.Open("/proc/net/dev")
+	file, err := os.Open(sysPath("/proc/net/dev"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open /proc/net/dev: %v", err)
 	}
@@ -41,6 +41,12 @@ var (
 	lastSmsJsonContent string
 	lastNumPages       int
 	lastSuccessfulSmsJsonContent string
+
+	// messages already announced as sms events; nil until the first real list
+	seenSms map[string]bool
+
+	// font file under assets/fonts used for SMS pages
+	smsFontFile = "NotoSansMonoCJK-VF.ttf.ttc"
 	
 	// Memory pool for SMS images to reduce allocations
 	smsImagePool = sync.Pool{
@@ -53,7 +59,8 @@ var (
 func collectAndDrawSms(cfg *Config) int {
 	jsonContent := getJsonContent(cfg)
 
-	if len(jsonContent) < 50 { //dummy message
+	isDummy := len(jsonContent) < 50
+	if isDummy { //dummy message
 		jsonContent = fmt.Sprintf("{\"msg\":[{\"sender\":\"System\",\"timestamp\":\"%s\",\"content\":\"No SMS - 无消息\"}]}", time.Now().Format("2006-01-02 15:04:05"))
 	}
 
@@ -64,6 +71,9 @@ func collectAndDrawSms(cfg *Config) int {
 
 	lastSmsJsonContent = jsonContent
 	lastNumPages = 0
+	if !isDummy {
+		announceNewSms(jsonContent)
+	}
 
 	rawImgs, err := drawSmsFrJson(jsonContent, false, false)
 	if err != nil {
@@ -101,6 +111,30 @@ func collectAndDrawSms(cfg *Config) int {
 	return numPages
 }
 
+// announceNewSms publishes an sms event for every message that wasn't in the
+// previous list. The first list after startup only sets the baseline.
+func announceNewSms(jsonContent string) {
+	var smsData struct {
+		Msg []SMS `json:"msg"`
+	}
+	if err := secureUnmarshal([]byte(jsonContent), &smsData); err != nil {
+		return
+	}
+	seen := make(map[string]bool, len(smsData.Msg))
+	var fresh []SMS
+	for _, msg := range smsData.Msg {
+		id := msg.Sender + "\x00" + msg.Timestamp + "\x00" + msg.Content
+		seen[id] = true
+		if seenSms != nil && !seenSms[id] {
+			fresh = append(fresh, msg)
+		}
+	}
+	seenSms = seen
+	for _, msg := range fresh {
+		events.Publish(EventSMS, msg)
+	}
+}
+
 func getJsonContent(_ *Config) string {
 	// 1. Make the request
 	resp, err := localHTTPClient.Get("http://localhost/api/v2/sms/list.json?n=10")
@@ -158,7 +192,7 @@ func drawSmsFrJson(jsonContent string, savePng bool, drawPageNum bool) (imgs []i
 	}
 
 	// Load font
-	fontPath := assetsPrefix + "/assets/fonts/NotoSansMonoCJK-VF.ttf.ttc"
+	fontPath := assetsPrefix + "/assets/fonts/" + smsFontFile
 	log.Println("sms using font:", fontPath)
 	fontBytes, err := os.ReadFile(fontPath)
 	if err != nil {
@@ -314,7 +348,7 @@ func drawSmsFrJson(jsonContent string, savePng bool, drawPageNum bool) (imgs []i
 				sender := lineTitle[0]
 				dateStr := strings.Split(lineTitle[1], " ")[0]
 				timeStr := strings.Split(lineTitle[1], " ")[1]
-				today := time.Now()
+				today := timeNow()
 				yesterday := today.AddDate(0, 0, -1)
 
 				if dateStr == today.Format("2006-01-02") {
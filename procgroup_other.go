@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+// killProcessGroup leaves the default cancel, which kills cmd alone; WaitDelay
+// still unblocks the caller when an orphan holds stdout open
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// profileSwitchHold is how long the button is held to switch to the next
+// profile
+const profileSwitchHold = 3 * time.Second
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// profileState is the profile layered between the default and the user
+// config. A zero profileState is no profile.
+type profileState struct {
+	name    string
+	conf    Config
+	showSms bool // the profile sets show_sms
+}
+
+var (
+	profileMu     sync.RWMutex
+	activeProfile profileState
+)
+
+// profilesDir holds one <name>.json per profile and the name of the active
+// one in "active", next to the user config: /etc/pcat2_mini_display-profiles
+func profilesDir() string {
+	path := userConfigFile
+	if strings.HasSuffix(path, "user_config.json") {
+		return strings.TrimSuffix(path, "user_config.json") + "profiles"
+	}
+	return filepath.Join(filepath.Dir(path), "profiles")
+}
+
+func profilePath(name string) string {
+	return filepath.Join(profilesDir(), name+".json")
+}
+
+func activeProfileFile() string {
+	return filepath.Join(profilesDir(), "active")
+}
+
+func validateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) || name == "active" {
+		return fmt.Errorf("profile name %q must be 1-32 letters, digits, _ or -", name)
+	}
+	return nil
+}
+
+// baseConfig is dft with the active profile laid over it, what the user
+// config overrides
+func baseConfig(dft Config) Config {
+	profileMu.RLock()
+	defer profileMu.RUnlock()
+	if activeProfile.name == "" {
+		return dft
+	}
+	return overlayConfig(dft, activeProfile.conf, activeProfile.showSms)
+}
+
+// setProfile makes p the active profile and returns the previous one. The
+// caller merges the configs again.
+func setProfile(p profileState) profileState {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	prev := activeProfile
+	activeProfile = p
+	return prev
+}
+
+func activeProfileName() string {
+	profileMu.RLock()
+	defer profileMu.RUnlock()
+	return activeProfile.name
+}
+
+// listProfiles returns the saved profile names, sorted
+func listProfiles() ([]string, error) {
+	entries, err := os.ReadDir(profilesDir())
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if !e.IsDir() && name != e.Name() && validateProfileName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readProfile loads a saved profile
+func readProfile(name string) (profileState, error) {
+	if err := validateProfileName(name); err != nil {
+		return profileState{}, err
+	}
+	conf, raw, err := readConfigFile(profilePath(name), false)
+	if os.IsNotExist(err) {
+		return profileState{}, fmt.Errorf("no profile %q", name)
+	} else if err != nil {
+		return profileState{}, err
+	}
+	var keys map[string]interface{}
+	json.Unmarshal(raw, &keys)
+	_, showSms := keys["show_sms"]
+	return profileState{name: name, conf: conf, showSms: showSms}, nil
+}
+
+// readActiveProfile loads the profile named in the active file, if any
+func readActiveProfile() (profileState, error) {
+	raw, err := os.ReadFile(activeProfileFile())
+	if os.IsNotExist(err) {
+		return profileState{}, nil
+	} else if err != nil {
+		return profileState{}, err
+	}
+	name := strings.TrimSpace(string(raw))
+	if name == "" {
+		return profileState{}, nil
+	}
+	return readProfile(name)
+}
+
+// writeProfileFile replaces path atomically
+func writeProfileFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create profiles dir: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// switchProfile applies the named profile, "" for none, and remembers it
+// across restarts. A profile that doesn't validate is not applied.
+func switchProfile(name string) error {
+	next := profileState{}
+	if name != "" {
+		var err error
+		if next, err = readProfile(name); err != nil {
+			return err
+		}
+	}
+
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	prev := setProfile(next)
+	if err := mergeConfigs(); err != nil {
+		setProfile(prev)
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	var err error
+	if name == "" {
+		if err = os.Remove(activeProfileFile()); os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = writeProfileFile(activeProfileFile(), []byte(name+"\n"))
+	}
+	if err != nil {
+		setProfile(prev)
+		mergeConfigs()
+		return fmt.Errorf("could not save the active profile: %w", err)
+	}
+	invalidateRenderCaches()
+	log.Printf("switched to config profile %q", name)
+	return nil
+}
+
+// cycleProfile switches to the next saved profile, after the last one back
+// to none. It is the long button press.
+func cycleProfile() {
+	names, err := listProfiles()
+	if err != nil || len(names) == 0 {
+		log.Printf("no config profiles to switch to: %v", err)
+		return
+	}
+	order := append([]string{""}, names...)
+	curr := activeProfileName()
+	next := order[0]
+	for i, name := range order {
+		if name == curr {
+			next = order[(i+1)%len(order)]
+			break
+		}
+	}
+	if err := switchProfile(next); err != nil {
+		log.Printf("profile switch failed: %v", err)
+	}
+}
+
+// loadActiveProfile applies the profile that was active before the restart
+func loadActiveProfile() {
+	p, err := readActiveProfile()
+	if err != nil {
+		log.Printf("config profile not applied: %v", err)
+		return
+	}
+	if p.name == "" {
+		return
+	}
+	if err := switchProfile(p.name); err != nil {
+		log.Printf("config profile not applied: %v", err)
+	}
+}
+
+// isProfileFileName tells which entries of the profiles dir the config
+// watcher reloads for: saved profiles and the active file
+func isProfileFileName(name string) bool {
+	if name == "active" {
+		return true
+	}
+	base := strings.TrimSuffix(name, ".json")
+	return base != name && validateProfileName(base) == nil
+}
+
+func profilesState() (fiber.Map, error) {
+	names, err := listProfiles()
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{"active": activeProfileName(), "profiles": names}, nil
+}
+
+// GET /api/v2/profiles
+func getProfiles(c *fiber.Ctx) error {
+	state, err := profilesState()
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(state)
+}
+
+// PUT /api/v2/profiles/active
+// Body: {"name": "vehicle"}, "" for no profile
+func putActiveProfile(c *fiber.Ctx) error {
+	if err := validateJSON(c.Body()); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	var body struct {
+		Name *string `json:"name"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil || body.Name == nil {
+		return apiError(c, fiber.StatusBadRequest, `body must be {"name": "<profile>"}`)
+	}
+	if name := *body.Name; name != "" {
+		if validateProfileName(name) != nil {
+			return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no profile %q", name))
+		}
+		if _, err := os.Stat(profilePath(name)); err != nil {
+			return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no profile %q", name))
+		}
+	}
+	if err := switchProfile(*body.Name); err != nil {
+		return apiConfigError(c, err, nil)
+	}
+	return getProfiles(c)
+}
+
+// GET /api/v2/profiles/:name
+func getProfile(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if validateProfileName(name) != nil {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no profile %q", name))
+	}
+	raw, err := os.ReadFile(profilePath(name))
+	if os.IsNotExist(err) {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no profile %q", name))
+	} else if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(raw)
+}
+
+// PUT /api/v2/profiles/:name
+// Body: the config fields the profile sets. The active profile applies at once.
+func putProfile(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if err := validateProfileName(name); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := validateJSON(c.Body()); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	payload, err := bodyObject(c)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	p, pretty, err := decodeProfile(name, payload)
+	if err != nil {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	userConfigMu.Lock()
+	defer userConfigMu.Unlock()
+	if err := checkProfileLocked(p); err != nil {
+		return apiConfigError(c, err, c.Body())
+	}
+	if err := writeProfileFile(profilePath(name), pretty); err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	if err := applyProfileLocked(p); err != nil {
+		return apiConfigError(c, err, c.Body())
+	}
+	return c.JSON(payload)
+}
+
+// readProfileOverrides returns a saved profile as raw keys, so fields the
+// Config struct doesn't know survive a rewrite
+func readProfileOverrides(name string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(profilePath(name))
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[string]interface{}{}
+	if err := secureUnmarshal(raw, &overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", profilePath(name), err)
+	}
+	return overrides, nil
+}
+
+// decodeProfile turns a profile's keys into the profile and the file to save
+func decodeProfile(name string, overrides map[string]interface{}) (profileState, []byte, error) {
+	if err := checkNoExternalCollectors(overrides); err != nil {
+		return profileState{}, nil, err
+	}
+	pretty, err := json.MarshalIndent(overrides, "", "    ")
+	if err != nil {
+		return profileState{}, nil, err
+	}
+	p := profileState{name: name}
+	if err := json.Unmarshal(pretty, &p.conf); err != nil {
+		return profileState{}, nil, err
+	}
+	_, p.showSms = overrides["show_sms"]
+	return p, pretty, nil
+}
+
+// checkProfileLocked validates p under the current user config, as
+// switching to it would. The caller holds userConfigMu.
+func checkProfileLocked(p profileState) error {
+	base := overlayConfig(dftCfg, p.conf, p.showSms)
+	_, err := buildConfig(base, userCfg, hasShowSmsInUserConfig())
+	return err
+}
+
+// applyProfileLocked applies a saved profile at once when it is the active
+// one. The caller holds userConfigMu.
+func applyProfileLocked(p profileState) error {
+	if activeProfileName() != p.name {
+		return nil
+	}
+	prev := setProfile(p)
+	if err := mergeConfigs(); err != nil {
+		setProfile(prev)
+		return err
+	}
+	invalidateRenderCaches()
+	return nil
+}
+
+// saveProfileLocked validates, writes and applies the profile's keys. The
+// caller holds userConfigMu.
+func saveProfileLocked(name string, overrides map[string]interface{}) error {
+	p, pretty, err := decodeProfile(name, overrides)
+	if err != nil {
+		return err
+	}
+	if err := checkProfileLocked(p); err != nil {
+		return err
+	}
+	if err := writeProfileFile(profilePath(name), pretty); err != nil {
+		return err
+	}
+	return applyProfileLocked(p)
+}
+
+// DELETE /api/v2/profiles/:name
+func deleteProfile(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if validateProfileName(name) != nil {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no profile %q", name))
+	}
+	if activeProfileName() == name {
+		return apiError(c, fiber.StatusConflict, fmt.Sprintf("profile %q is active, switch to another one first", name))
+	}
+	if err := os.Remove(profilePath(name)); os.IsNotExist(err) {
+		return apiError(c, fiber.StatusNotFound, fmt.Sprintf("no profile %q", name))
+	} else if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
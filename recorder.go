@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"sync"
+	"time"
+)
+
+const (
+	maxRecordSeconds = 30
+	// hard cap on stored frames, about 55KB each once quantized
+	maxRecordFrames = 1500
+	// GIF delays are in 1/100s and browsers clamp anything below 2 to 10, so
+	// transition frames that hit the panel faster play back at 20ms each
+	recordMinDelay = 2
+)
+
+var (
+	errRecordingBusy = errors.New("a recording is already in progress")
+	errNoScreenCopy  = errors.New("display keeps no screen copy to record from")
+
+	recordingMu sync.Mutex
+
+	// 6 red x 7 green x 6 blue levels; quantizing against a fixed cube is a few
+	// integer ops per pixel, cheap enough to do while the transition is running
+	recordPalette = func() color.Palette {
+		p := make(color.Palette, 0, 6*7*6)
+		for r := 0; r < 6; r++ {
+			for g := 0; g < 7; g++ {
+				for b := 0; b < 6; b++ {
+					p = append(p, color.RGBA{uint8(r * 255 / 5), uint8(g * 255 / 6), uint8(b * 255 / 5), 255})
+				}
+			}
+		}
+		return p
+	}()
+)
+
+// screenRecording collects quantized screen frames and the time each one appeared
+type screenRecording struct {
+	mu     sync.Mutex
+	frames []*image.Paletted
+	stamps []time.Time
+	last   *image.RGBA
+}
+
+// capture is registered as a display observer. Every distinct screen state is
+// kept, so each transition frame shows up; redraws that change nothing are dropped.
+func (r *screenRecording) capture(vd *VirtualDisplay) {
+	snap := vd.Snapshot()
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last != nil && bytes.Equal(r.last.Pix, snap.Pix) {
+		return
+	}
+	if len(r.frames) >= maxRecordFrames {
+		return
+	}
+	r.frames = append(r.frames, quantizeFrame(snap))
+	r.stamps = append(r.stamps, now)
+	r.last = snap
+}
+
+// toGIF turns the captured frames into a looping animation. Each frame stays up
+// until the next one appeared; the last one until end.
+func (r *screenRecording) toGIF(end time.Time) *gif.GIF {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	anim := &gif.GIF{}
+	for i, frame := range r.frames {
+		next := end
+		if i+1 < len(r.stamps) {
+			next = r.stamps[i+1]
+		}
+		delay := int(next.Sub(r.stamps[i]).Round(10*time.Millisecond) / (10 * time.Millisecond))
+		if delay < recordMinDelay {
+			delay = recordMinDelay
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return anim
+}
+
+// quantizeFrame maps src onto recordPalette without dithering
+func quantizeFrame(src *image.RGBA) *image.Paletted {
+	b := src.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), recordPalette)
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+b.Dx()*4]
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()]
+		for x := range out {
+			r := (int(row[x*4])*5 + 127) / 255
+			g := (int(row[x*4+1])*6 + 127) / 255
+			bl := (int(row[x*4+2])*5 + 127) / 255
+			out[x] = uint8((r*7+g)*6 + bl)
+		}
+	}
+	return dst
+}
+
+// recordScreen records everything written to screen for d, including page-change
+// transition frames, and returns it as an animated GIF. Only one recording runs at
+// a time; a second caller gets errRecordingBusy.
+func recordScreen(screen *VirtualDisplay, d time.Duration) (*gif.GIF, error) {
+	if screen == nil {
+		return nil, errNoScreenCopy
+	}
+	if !recordingMu.TryLock() {
+		return nil, errRecordingBusy
+	}
+	defer recordingMu.Unlock()
+
+	rec := &screenRecording{}
+	// start from what is already on screen, a static page still gives one frame
+	rec.capture(screen)
+	stop := screen.Observe(rec.capture)
+	time.Sleep(d)
+	stop()
+
+	return rec.toGIF(time.Now()), nil
+}
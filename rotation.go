@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultRotationDwell = 10 * time.Second
+	defaultRotationPause = 30 * time.Second
+	minRotationDwell     = time.Second // a slide has to finish before the next one
+	rotationSmsPage      = "sms"       // page_dwell_seconds key for the SMS pages
+)
+
+// RotationConfig is the "rotation" config section. While enabled the pages
+// advance on their own.
+type RotationConfig struct {
+	Enabled          *bool              `json:"enabled,omitempty"`
+	DwellSeconds     float64            `json:"dwell_seconds,omitempty"`      // default 10
+	PageDwellSeconds map[string]float64 `json:"page_dwell_seconds,omitempty"` // by page id, "sms" for the SMS pages
+	SkipSms          *bool              `json:"skip_sms,omitempty"`
+	SkipOnBattery    *bool              `json:"skip_on_battery,omitempty"` // hold the page while not charging
+	// seconds a button press holds rotation, default 30
+	PauseAfterButtonSeconds float64 `json:"pause_after_button_seconds,omitempty"`
+	// Kiosk is for vehicle mounts: pages rotate even when not enabled and the
+	// screen never dims
+	Kiosk *bool `json:"kiosk,omitempty"`
+}
+
+func (r RotationConfig) active() bool {
+	return r.kiosk() || r.Enabled != nil && *r.Enabled
+}
+
+func (r RotationConfig) skipSms() bool       { return r.SkipSms != nil && *r.SkipSms }
+func (r RotationConfig) skipOnBattery() bool { return r.SkipOnBattery != nil && *r.SkipOnBattery }
+func (r RotationConfig) kiosk() bool         { return r.Kiosk != nil && *r.Kiosk }
+
+// dwell is how long page idx stays before rotation moves on
+func (r RotationConfig) dwell(idx int) time.Duration {
+	id := rotationSmsPage
+	if idx < cfgNumPages {
+		if ids := cfg.DisplayTemplate.shownPages(); idx < len(ids) {
+			id = ids[idx]
+		}
+	}
+	secs, ok := r.PageDwellSeconds[id]
+	if !ok {
+		secs = r.DwellSeconds
+	}
+	if secs <= 0 {
+		return defaultRotationDwell
+	}
+	return secondsToDuration(secs)
+}
+
+func (r RotationConfig) pause() time.Duration {
+	if r.PauseAfterButtonSeconds > 0 {
+		return secondsToDuration(r.PauseAfterButtonSeconds)
+	}
+	return defaultRotationPause
+}
+
+// mergeRotationConfig overlays the user's rotation section field by field,
+// so the API can switch rotation on without restating the dwell times
+func mergeRotationConfig(dft, user RotationConfig) RotationConfig {
+	merged := dft
+	if user.Enabled != nil {
+		merged.Enabled = user.Enabled
+	}
+	if user.DwellSeconds != 0 {
+		merged.DwellSeconds = user.DwellSeconds
+	}
+	if user.PauseAfterButtonSeconds != 0 {
+		merged.PauseAfterButtonSeconds = user.PauseAfterButtonSeconds
+	}
+	if user.SkipSms != nil {
+		merged.SkipSms = user.SkipSms
+	}
+	if user.SkipOnBattery != nil {
+		merged.SkipOnBattery = user.SkipOnBattery
+	}
+	if user.Kiosk != nil {
+		merged.Kiosk = user.Kiosk
+	}
+	merged.PageDwellSeconds = make(map[string]float64, len(dft.PageDwellSeconds)+len(user.PageDwellSeconds))
+	for id, secs := range dft.PageDwellSeconds {
+		merged.PageDwellSeconds[id] = secs
+	}
+	for id, secs := range user.PageDwellSeconds {
+		merged.PageDwellSeconds[id] = secs
+	}
+	return merged
+}
+
+// validateRotationConfig reports the first problem with a rotation section
+func validateRotationConfig(r RotationConfig) error {
+	if r.DwellSeconds != 0 && secondsToDuration(r.DwellSeconds) < minRotationDwell {
+		return fmt.Errorf("rotation.dwell_seconds must be ≥ %v, got %v", minRotationDwell.Seconds(), r.DwellSeconds)
+	}
+	for id, secs := range r.PageDwellSeconds {
+		if secs != 0 && secondsToDuration(secs) < minRotationDwell {
+			return fmt.Errorf("rotation.page_dwell_seconds[%s] must be ≥ %v, got %v", id, minRotationDwell.Seconds(), secs)
+		}
+	}
+	if r.PauseAfterButtonSeconds < 0 {
+		return fmt.Errorf("rotation.pause_after_button_seconds must be ≥ 0, got %v", r.PauseAfterButtonSeconds)
+	}
+	return nil
+}
+
+// pageRotator decides when auto rotation moves on. The main loop asks it
+// once per frame.
+type pageRotator struct {
+	mu          sync.Mutex
+	page        int       // page on screen at the last check
+	shownSince  time.Time // when that page came on screen
+	pausedUntil time.Time // set by button presses
+}
+
+var rotator = &pageRotator{}
+
+// pauseFor holds rotation for d from now
+func (r *pageRotator) pauseFor(d time.Duration) {
+	r.mu.Lock()
+	r.pausedUntil = time.Now().Add(d)
+	r.mu.Unlock()
+}
+
+// pausedFor is what is left of a pause
+func (r *pageRotator) pausedFor(now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Before(r.pausedUntil) {
+		return r.pausedUntil.Sub(now)
+	}
+	return 0
+}
+
+// next returns the step to take from page curr, once it has been on screen
+// for its dwell time counted from the end of any pause
+func (r *pageRotator) next(conf RotationConfig, curr int, now time.Time) (pageTarget, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if curr != r.page || r.shownSince.IsZero() {
+		r.page, r.shownSince = curr, now
+		return pageTarget{}, false
+	}
+	if !conf.active() || totalNumPages <= 1 {
+		return pageTarget{}, false
+	}
+	if conf.skipOnBattery() && !battChargingStatus {
+		return pageTarget{}, false
+	}
+	since := r.shownSince
+	if r.pausedUntil.After(since) {
+		since = r.pausedUntil
+	}
+	if now.Sub(since) < conf.dwell(curr) {
+		return pageTarget{}, false
+	}
+
+	next := (curr + 1) % totalNumPages
+	if conf.skipSms() && next >= cfgNumPages {
+		next = 0
+	}
+	if next == curr {
+		return pageTarget{}, false
+	}
+	// count again from now, so a slide that is still queued isn't asked for twice
+	r.shownSince = now
+	return pageTarget{step: (next - curr + totalNumPages) % totalNumPages, auto: true}, true
+}
+
+// pauseRotationForButton is called on every button press
+func pauseRotationForButton() {
+	if cfg.Rotation.active() {
+		rotator.pauseFor(cfg.Rotation.pause())
+	}
+}
+
+// rotationState is the rotation config plus what the rotator is doing
+func rotationState() fiber.Map {
+	configMutex.RLock()
+	conf := cfg.Rotation
+	configMutex.RUnlock()
+	paused := rotator.pausedFor(time.Now())
+	return fiber.Map{
+		"config":         conf,
+		"rotating":       conf.active() && !isPagePinned() && !(conf.skipOnBattery() && !battChargingStatus),
+		"paused_seconds": paused.Seconds(),
+		"pinned":         isPagePinned(),
+	}
+}
+
+// GET /api/v2/display/rotation
+func getRotation(c *fiber.Ctx) error {
+	return c.JSON(rotationState())
+}
+
+// PATCH /api/v2/display/rotation
+// Body: the fields of the rotation section to change, saved to the user config
+func patchRotation(c *fiber.Ctx) error {
+	if err := validateJSON(c.Body()); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	payload, err := bodyObject(c)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := patchUserOverrides(map[string]interface{}{"rotation": payload}); err != nil {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+	return c.JSON(rotationState())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	mjpegBoundary = "pcat2frame"
+	// the main loop can push far more frames than a browser mirror needs
+	maxStreamFPS      = 30
+	maxStreamClients  = 8
+	streamJPEGQuality = 85
+)
+
+// static screens produce no writes; resend the last frame this often so dead
+// connections are noticed and released
+var streamKeepAlive = 5 * time.Second
+
+var errTooManyStreamClients = errors.New("too many stream clients")
+
+// frameStream encodes the screen mirror to JPEG off the main loop and fans each
+// frame out to every connected MJPEG client. Encoding only happens while at
+// least one client is connected, and at most once per frame for all of them.
+type frameStream struct {
+	screen *VirtualDisplay
+	dirty  chan struct{}
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	last    []byte
+}
+
+var liveStream *frameStream
+
+// newFrameStream hooks into screen and starts the encoder goroutine
+func newFrameStream(screen *VirtualDisplay) *frameStream {
+	fs := &frameStream{
+		screen:  screen,
+		dirty:   make(chan struct{}, 1),
+		clients: make(map[chan []byte]struct{}),
+	}
+	screen.Observe(func(*VirtualDisplay) {
+		// runs on the main loop: just flag the change, never block
+		select {
+		case fs.dirty <- struct{}{}:
+		default:
+		}
+	})
+	go fs.run()
+	return fs
+}
+
+func (fs *frameStream) run() {
+	minInterval := time.Second / maxStreamFPS
+	for range fs.dirty {
+		if fs.numClients() > 0 {
+			start := time.Now()
+			fs.publish()
+			// writes that arrive meanwhile leave dirty set and are picked up next round
+			if wait := minInterval - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+}
+
+// publish encodes the current screen and hands it to every client. A client that
+// hasn't consumed its previous frame gets it replaced, so slow clients skip frames
+// instead of holding up the others.
+func (fs *frameStream) publish() {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, fs.screen.Snapshot(), &jpeg.Options{Quality: streamJPEGQuality}); err != nil {
+		log.Printf("❌ stream: jpeg encode: %v", err)
+		return
+	}
+	frame := buf.Bytes()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.last = frame
+	for ch := range fs.clients {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- frame
+	}
+}
+
+func (fs *frameStream) numClients() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.clients)
+}
+
+// subscribe registers a client. Its channel starts out holding the current screen
+// so a new viewer doesn't wait for the next redraw.
+func (fs *frameStream) subscribe() (chan []byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(fs.clients) >= maxStreamClients {
+		return nil, errTooManyStreamClients
+	}
+	ch := make(chan []byte, 1)
+	fs.clients[ch] = struct{}{}
+
+	if fs.last == nil {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fs.screen.Snapshot(), &jpeg.Options{Quality: streamJPEGQuality}); err == nil {
+			fs.last = buf.Bytes()
+		}
+	}
+	if fs.last != nil {
+		ch <- fs.last
+	}
+	return ch, nil
+}
+
+func (fs *frameStream) unsubscribe(ch chan []byte) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.clients, ch)
+	// a frame encoded while nobody watched may be stale, re-encode on next subscribe
+	if len(fs.clients) == 0 {
+		fs.last = nil
+	}
+}
+
+// serve writes frames from ch as multipart/x-mixed-replace parts until the client
+// goes away.
+func (fs *frameStream) serve(w *bufio.Writer, ch chan []byte) {
+	defer fs.unsubscribe(ch)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	var frame []byte
+	for {
+		select {
+		case frame = <-ch:
+		case <-keepAlive.C:
+			if frame == nil {
+				continue
+			}
+		}
+		fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, len(frame))
+		w.Write(frame)
+		w.WriteString("\r\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
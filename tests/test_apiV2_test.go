@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiV2TestApp serves the v2 routes without auth, with the user config in a
+// temp dir
+func apiV2TestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	savedCfg, savedDft, savedUser, savedFile := cfg, dftCfg, userCfg, userConfigFile
+	t.Cleanup(func() {
+		cfg, dftCfg, userCfg, userConfigFile = savedCfg, savedDft, savedUser, savedFile
+	})
+	initFonts()
+	dftCfg = Config{ScreenMaxBrightness: 100, PingSite0: "default.example"}
+	userCfg = Config{}
+	userConfigFile = filepath.Join(t.TempDir(), "user_config.json")
+	mergeConfigs()
+
+	pass := func(c *fiber.Ctx) error { return c.Next() }
+	app := fiber.New(fiber.Config{ErrorHandler: apiErrorHandler})
+	registerAPIv2(app, pass, pass, pass)
+	app.Post("/api/v1/go_set_user_config.json", setUserConfig)
+	return app
+}
+
+func apiCall(t *testing.T, app *fiber.App, method, target, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return resp.StatusCode, out
+}
+
+func TestAPIv2Errors(t *testing.T) {
+	app := apiV2TestApp(t)
+	globalData.Reset()
+	t.Cleanup(globalData.Reset)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{"unknown route", "GET", "/api/v2/nothing", "", 404, "not_found"},
+		{"wrong verb", "POST", "/api/v2/config", "", 405, "method_not_allowed"},
+		{"unknown data key", "GET", "/api/v2/data/Nope", "", 404, "not_found"},
+		{"body not an object", "PATCH", "/api/v2/data", "[1, 2]", 400, "bad_request"},
+		{"collector without enabled", "PATCH", "/api/v2/collectors/battery", "{}", 400, "bad_request"},
+		{"config fails validation", "PATCH", "/api/v2/config/user", `{"screen_max_brightness": 150}`, 422, "unprocessable_entity"},
+		{"config with wrong type", "PUT", "/api/v2/config/user", `{"show_sms": "yes"}`, 422, "unprocessable_entity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := apiCall(t, app, tt.method, tt.target, tt.body)
+			if status != tt.wantCode || body["status"] != "error" || body["code"] != tt.want || body["message"] == "" {
+				t.Errorf("got %d %v, want %d with code %s", status, body, tt.wantCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIv2UserConfig(t *testing.T) {
+	app := apiV2TestApp(t)
+	onDisk := func() map[string]interface{} {
+		raw, err := os.ReadFile(userConfigFile)
+		if err != nil {
+			return nil
+		}
+		var m map[string]interface{}
+		json.Unmarshal(raw, &m)
+		return m
+	}
+
+	if status, _ := apiCall(t, app, "PUT", "/api/v2/config/user", `{"ping_site0": "a.example", "custom": 1}`); status != 200 {
+		t.Fatalf("PUT = %d", status)
+	}
+	if cfg.PingSite0 != "a.example" {
+		t.Errorf("cfg.PingSite0 = %q after PUT", cfg.PingSite0)
+	}
+
+	status, body := apiCall(t, app, "PATCH", "/api/v2/config/user", `{"ping_site1": "b.example"}`)
+	if status != 200 || body["ping_site0"] != "a.example" || body["ping_site1"] != "b.example" || body["custom"] == nil {
+		t.Errorf("PATCH = %d %v, want both sites and unknown keys kept", status, body)
+	}
+
+	// a rejected change leaves file and cfg alone
+	apiCall(t, app, "PATCH", "/api/v2/config/user", `{"screen_max_brightness": 150}`)
+	if cfg.ScreenMaxBrightness != 100 || onDisk()["screen_max_brightness"] != nil {
+		t.Errorf("invalid patch applied: brightness %d, file %v", cfg.ScreenMaxBrightness, onDisk())
+	}
+
+	// v1 writes the same file
+	apiCall(t, app, "POST", "/api/v1/go_set_user_config.json", `{"ping_site1": "c.example"}`)
+	if onDisk()["ping_site1"] != "c.example" || cfg.PingSite1 != "c.example" {
+		t.Errorf("v1 set_user_config: file %v, cfg %q", onDisk(), cfg.PingSite1)
+	}
+
+	if status, _ := apiCall(t, app, "DELETE", "/api/v2/config/user", ""); status != 200 || len(onDisk()) != 0 {
+		t.Errorf("DELETE = %d, file %v", status, onDisk())
+	}
+	if cfg.PingSite0 != "default.example" {
+		t.Errorf("cfg.PingSite0 = %q after reset", cfg.PingSite0)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	routes := apiV2Routes()
+	doc := openAPIDocument(routes)
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "/:") {
+		t.Error("fiber path parameters must be written as {name}")
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	ids := map[string]bool{}
+	for _, r := range routes {
+		path := fiberPathParam.ReplaceAllString(API_V2_PREFIX+r.Path, "{$1}")
+		op, ok := paths[path].(map[string]interface{})[strings.ToLower(r.Method)].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s missing from the document", r.Method, path)
+			continue
+		}
+		id := op["operationId"].(string)
+		if ids[id] {
+			t.Errorf("duplicate operationId %s", id)
+		}
+		ids[id] = true
+		for _, name := range []string{r.Body, r.Response} {
+			if name != "" && name != "object" && !strings.Contains(name, "/") && schemas[name] == nil {
+				t.Errorf("%s %s refers to unknown schema %s", r.Method, path, name)
+			}
+		}
+	}
+}
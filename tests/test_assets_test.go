@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gomono"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z"/></svg>`
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		dropped string
+	}{
+		{"script", `<svg><script>alert(1)</script><path d="M0 0"/></svg>`, "alert"},
+		{"handler", `<svg onload="alert(1)"><path d="M0 0"/></svg>`, "onload"},
+		{"external href", `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="http://evil.example/x.svg#a"/></svg>`, "evil"},
+		{"javascript href", `<svg><a href="javascript:alert(1)"><path d="M0 0"/></a></svg>`, "javascript"},
+		{"external url", `<svg><path fill="url(http://evil.example/p)" d="M0 0"/></svg>`, "evil"},
+		{"foreignObject", `<svg><foreignObject><iframe src="x"/></foreignObject></svg>`, "iframe"},
+		{"style", `<svg><style>@import url(x)</style></svg>`, "import"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := sanitizeSVG([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(out), tt.dropped) || !strings.Contains(string(out), "<svg") {
+				t.Errorf("sanitizeSVG = %s", out)
+			}
+		})
+	}
+
+	kept, _ := sanitizeSVG([]byte(`<svg><defs><linearGradient id="g"/></defs><path fill="url(#g)" d="M0 0"/></svg>`))
+	if !strings.Contains(string(kept), `fill="url(#g)"`) {
+		t.Errorf("references inside the document should stay: %s", kept)
+	}
+	bomb := `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY a "aaaa">]><svg>&a;</svg>`
+	if _, err := sanitizeSVG([]byte(bomb)); err == nil {
+		t.Error("SVGs with entities should be refused")
+	}
+}
+
+func TestCheckUserAsset(t *testing.T) {
+	tests := []struct {
+		kind, name string
+		data       []byte
+		wantErr    string
+	}{
+		{"icons", "logo.svg", []byte(testSVG), ""},
+		{"icons", "logo.png", pngBytes(t, 32, 32), ""},
+		{"icons", "logo.jpg", pngBytes(t, 32, 32), "holds a png image"},
+		{"icons", "huge.png", pngBytes(t, maxIconDimension+1, 1), "pixels"},
+		{"icons", "logo.png", []byte("not an image"), "not an image"},
+		{"icons", "logo.sh", []byte("#!/bin/sh"), "must end in"},
+		{"icons", "../logo.svg", []byte(testSVG), "asset name"},
+		{"fonts", "mono.ttf", gomono.TTF, ""},
+		{"fonts", "mono.ttf", []byte("not a font"), "not a usable font"},
+		{"images", "logo.png", pngBytes(t, 1, 1), "icons or fonts"},
+	}
+	for _, tt := range tests {
+		_, err := checkUserAsset(tt.kind, tt.name, tt.data)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("checkUserAsset(%s, %s) = %v, want %q", tt.kind, tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAssetsAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	t.Cleanup(initFonts)
+
+	tests := []struct {
+		method, target, body string
+		wantStatus           int
+	}{
+		{"PUT", "/api/v2/assets/icons/logo.svg", `<svg onload="x()" viewBox="0 0 24 24"><path d="M0 0h24v24H0z"/></svg>`, 200},
+		{"PUT", "/api/v2/assets/icons/logo.png", "not a png", 422},
+		{"PUT", "/api/v2/assets/icons/run.sh", "", 400},
+		{"PUT", "/api/v2/assets/fonts/reg.ttf", string(gomono.TTF), 409},
+		{"PUT", "/api/v2/assets/fonts/mono.ttf", string(gomono.TTF), 200},
+		{"GET", "/api/v2/assets/icons/missing.svg", "", 404},
+		{"GET", "/api/v2/assets?kind=images", "", 400},
+	}
+	for _, tt := range tests {
+		status, body := apiCall(t, app, tt.method, tt.target, tt.body)
+		if status != tt.wantStatus {
+			t.Errorf("%s %s = %d %v, want %d", tt.method, tt.target, status, body, tt.wantStatus)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(userAssetsDir(), "icons", "logo.svg")); strings.Contains(string(data), "onload") {
+		t.Errorf("the uploaded SVG was stored unsanitised: %s", data)
+	}
+
+	status, body := apiCall(t, app, "GET", "/api/v2/assets", "")
+	assets, _ := body["assets"].([]interface{})
+	if status != 200 || len(assets) != 2 {
+		t.Fatalf("GET /assets = %d %v", status, body)
+	}
+	if font, _ := assets[0].(map[string]interface{}); font["font"] != "mono" || font["path"] != "user/fonts/mono.ttf" {
+		t.Errorf("font asset = %v", font)
+	}
+
+	// the layout can use both, and then they can't be deleted
+	layout := `{"display_template": {"elements": {"page0": [
+		{"type": "icon", "icon_path": "user/icons/logo.svg", "position": {"x": 10, "y": 10}, "size": {"width": 24, "height": 24}, "enable": 1},
+		{"type": "fixed_text", "label": "hi", "font": "mono", "position": {"x": 10, "y": 50}, "enable": 1}]}}}`
+	if status, body := apiCall(t, app, "PUT", "/api/v2/config/user", layout); status != 200 {
+		t.Fatalf("layout with uploads = %d %v", status, body)
+	}
+	imageCache = make(map[string]*image.RGBA)
+	if img, _, _, err := loadImage(assetPath("user/icons/logo.svg")); err != nil || img == nil {
+		t.Errorf("uploaded icon doesn't load: %v", err)
+	}
+	for _, target := range []string{"/api/v2/assets/icons/logo.svg", "/api/v2/assets/fonts/mono.ttf"} {
+		if status, body := apiCall(t, app, "DELETE", target, ""); status != 409 {
+			t.Errorf("DELETE %s in use = %d %v", target, status, body)
+		}
+	}
+
+	apiCall(t, app, "PUT", "/api/v2/config/user", `{}`)
+	if status, _ := apiCall(t, app, "DELETE", "/api/v2/assets/fonts/mono.ttf", ""); status != 200 {
+		t.Errorf("DELETE an unused font = %d", status)
+	}
+	// a saved profile would bring the icon back when switched to
+	writeTestProfile(t, "night", `{"display_template": {"elements": {"page0": [
+		{"type": "icon", "icon_path": "user/icons/logo.svg", "position": {"x": 10, "y": 10}, "enable": 1}]}}}`)
+	status, body = apiCall(t, app, "DELETE", "/api/v2/assets/icons/logo.svg", "")
+	if msg, _ := body["message"].(string); status != 409 || !strings.Contains(msg, "profiles.night.display_template.elements.page0[0]") {
+		t.Errorf("DELETE an icon a profile uses = %d %v", status, body)
+	}
+	if _, ok := lookupFont("mono"); ok {
+		t.Error("the deleted font is still registered")
+	}
+}
+
+func TestBundleUserAssets(t *testing.T) {
+	apiV2TestApp(t)
+	bundleTestAssets(t, nil)
+	t.Cleanup(initFonts)
+	os.MkdirAll(filepath.Join(userAssetsDir(), "icons"), 0755)
+	os.WriteFile(filepath.Join(userAssetsDir(), "icons", "logo.svg"), []byte(testSVG), 0644)
+
+	user := `{"display_template": {"elements": {"page0": [
+		{"type": "icon", "icon_path": "user/icons/logo.svg", "position": {"x": 10, "y": 10}, "enable": 1}]}}}`
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, []byte(user)); err != nil {
+		t.Fatal(err)
+	}
+	_, files, err := readBundle(buf.Bytes())
+	if err != nil || files["user/icons/logo.svg"] == nil {
+		t.Fatalf("bundle files = %v, %v", files, err)
+	}
+
+	// an uploaded icon in a bundle gets the upload checks
+	bad := zipFiles(t, map[string]string{bundleConfigName: "{}", "user/icons/x.svg": `<svg viewBox="0 0 24 24"><script>x()</script><path d="M0 0h1"/></svg>`})
+	if _, files, err := readBundle(bad); err != nil || strings.Contains(string(files["user/icons/x.svg"]), "script") {
+		t.Errorf("bundled SVG = %q, %v", files["user/icons/x.svg"], err)
+	}
+	if _, _, err := readBundle(zipFiles(t, map[string]string{bundleConfigName: "{}", "user/fonts/x.ttf": "nope"})); err == nil {
+		t.Error("a broken bundled font should be refused")
+	}
+}
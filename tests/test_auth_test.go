@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// authTestApp serves one read and one admin route with the given auth config
+func authTestApp(t *testing.T, conf AuthConfig) *fiber.App {
+	t.Helper()
+	savedCfg, savedTokens := cfg, authTokens
+	t.Cleanup(func() { cfg, authTokens = savedCfg, savedTokens })
+	cfg.Auth = conf
+	authTokens = AuthTokens{Admin: "admin-secret", Read: "read-secret"}
+
+	ok := func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"status": "ok"}) }
+	app := fiber.New()
+	app.Get("/read", requireScope(scopeRead), ok)
+	app.Post("/admin", requireScope(scopeAdmin), adminRateLimiter(), ok)
+	app.Get("/admin", requireScope(scopeAdmin), ok)
+	return app
+}
+
+func authStatus(t *testing.T, app *fiber.App, method, target, body string, header map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestRequireScope(t *testing.T) {
+	bearer := func(token string) map[string]string { return map[string]string{"Authorization": "Bearer " + token} }
+	on, off := true, false
+
+	tests := []struct {
+		name   string
+		conf   AuthConfig
+		method string
+		target string
+		header map[string]string
+		want   int
+	}{
+		{"no token", AuthConfig{}, "GET", "/read", nil, 401},
+		{"read token reads", AuthConfig{}, "GET", "/read", bearer("read-secret"), 200},
+		{"admin token reads", AuthConfig{}, "GET", "/read", bearer("admin-secret"), 200},
+		{"read token can't write", AuthConfig{}, "POST", "/admin", bearer("read-secret"), 403},
+		{"admin token writes", AuthConfig{}, "POST", "/admin", bearer("admin-secret"), 200},
+		{"wrong token", AuthConfig{}, "GET", "/read", bearer("guess"), 401},
+		{"query token on GET", AuthConfig{}, "GET", "/read?token=read-secret", nil, 200},
+		{"query token not on POST", AuthConfig{}, "POST", "/admin?token=admin-secret", nil, 401},
+		{"admin query token reads", AuthConfig{}, "GET", "/read?token=admin-secret", nil, 200},
+		{"admin query token only reads", AuthConfig{}, "GET", "/admin?token=admin-secret", nil, 403},
+		{"admin bearer on GET admin route", AuthConfig{}, "GET", "/admin", bearer("admin-secret"), 200},
+		{"public read", AuthConfig{PublicRead: &on}, "GET", "/read", nil, 200},
+		{"public read still guards writes", AuthConfig{PublicRead: &on}, "POST", "/admin", nil, 401},
+		{"disabled", AuthConfig{Enabled: &off}, "POST", "/admin", nil, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := authTestApp(t, tt.conf)
+			if got := authStatus(t, app, tt.method, tt.target, "", tt.header); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicReadOverlay(t *testing.T) {
+	on, off := true, false
+	dft := Config{Auth: AuthConfig{PublicRead: &on}}
+	if !overlayConfig(dft, Config{}, false).Auth.publicRead() {
+		t.Error("public read from the default config should stay on without a user setting")
+	}
+	if overlayConfig(dft, Config{Auth: AuthConfig{PublicRead: &off}}, false).Auth.publicRead() {
+		t.Error("the user config should be able to turn public read off")
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	app := authTestApp(t, AuthConfig{})
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	body := `{"BatterySoc": 50}`
+
+	tests := []struct {
+		name      string
+		token     string
+		timestamp string
+		signed    string // body the signature covers
+		want      int
+	}{
+		{"admin signature", "admin-secret", now, body, 200},
+		{"read signature on admin route", "read-secret", now, body, 403},
+		{"stale timestamp", "admin-secret", old, body, 401},
+		{"body changed after signing", "admin-secret", now, `{"BatterySoc": 5}`, 401},
+		{"unknown secret", "guess", now, body, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := requestSignature(tt.token, "POST", "/admin", tt.timestamp, []byte(tt.signed))
+			header := map[string]string{headerTimestamp: tt.timestamp, headerSignature: sig}
+			if got := authStatus(t, app, "POST", "/admin", body, header); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminRateLimit(t *testing.T) {
+	app := authTestApp(t, AuthConfig{RateLimitPerMinute: 2})
+	header := map[string]string{"Authorization": "Bearer admin-secret"}
+
+	var got []int
+	for i := 0; i < 3; i++ {
+		got = append(got, authStatus(t, app, "POST", "/admin", "", header))
+	}
+	if got[0] != 200 || got[1] != 200 || got[2] != 429 {
+		t.Errorf("statuses = %v, want [200 200 429]", got)
+	}
+	// reads aren't limited
+	if s := authStatus(t, app, "GET", "/read", "", header); s != 200 {
+		t.Errorf("read after limit = %d", s)
+	}
+}
+
+func TestLoadOrCreateAuthTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+
+	first, err := loadOrCreateAuthTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Admin) != 64 || len(first.Read) != 64 || first.Admin == first.Read {
+		t.Errorf("generated tokens = %+v", first)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	again, _ := loadOrCreateAuthTokens(path)
+	if again != first {
+		t.Error("tokens must survive restarts")
+	}
+
+	// a hand-written file with only an admin token gets a read token added
+	os.WriteFile(path, []byte(`{"admin_token": "mine"}`), 0600)
+	filled, _ := loadOrCreateAuthTokens(path)
+	var onDisk AuthTokens
+	raw, _ := os.ReadFile(path)
+	json.Unmarshal(raw, &onDisk)
+	if filled.Admin != "mine" || filled.Read == "" || onDisk != filled {
+		t.Errorf("filled = %+v, on disk %+v", filled, onDisk)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bundleTestAssets points assetsPrefix at a fresh temp dir holding files
+func bundleTestAssets(t *testing.T, files map[string]string) string {
+	t.Helper()
+	saved := assetsPrefix
+	t.Cleanup(func() { assetsPrefix = saved })
+	assetsPrefix = t.TempDir()
+	for rel, content := range files {
+		dst := filepath.Join(assetsPrefix, rel)
+		os.MkdirAll(filepath.Dir(dst), 0755)
+		os.WriteFile(dst, []byte(content), 0644)
+	}
+	return assetsPrefix
+}
+
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, _ := zw.Create(name)
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bundleSVG is a valid SVG, as sanitizeSVG writes it, told apart by its width
+func bundleSVG(width int) string {
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 8 8"><rect width="%d" height="8"></rect></svg>`, width)
+}
+
+const bundleTestConfig = `{"ping_site0": "bundle.example", "display_template": {"elements": {"page0": [
+	{"type": "icon", "icon_path": "assets/svg/custom.svg", "position": {"x": 10, "y": 10}, "enable": 1}]}}}`
+
+func TestBundleRoundTrip(t *testing.T) {
+	apiV2TestApp(t)
+	bundleTestAssets(t, map[string]string{"assets/svg/custom.svg": bundleSVG(1), "assets/svg/unused.svg": bundleSVG(2)})
+
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, []byte(bundleTestConfig)); err != nil {
+		t.Fatal(err)
+	}
+	_, files, err := readBundle(buf.Bytes())
+	if err != nil || len(files) != 1 || string(files["assets/svg/custom.svg"]) != bundleSVG(1) {
+		t.Fatalf("bundle files = %v, %v", files, err)
+	}
+
+	// another device
+	dir := bundleTestAssets(t, nil)
+	result, err := importBundle(buf.Bytes(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Written) != 1 || cfg.PingSite0 != "bundle.example" {
+		t.Errorf("import = %+v, ping_site0 %q", result, cfg.PingSite0)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "assets/svg/custom.svg")); string(data) != bundleSVG(1) {
+		t.Errorf("icon not written: %q", data)
+	}
+
+	// importing again finds the same file
+	if result, err := importBundle(buf.Bytes(), ""); err != nil || len(result.Skipped) != 1 || len(result.Written) != 0 {
+		t.Errorf("second import = %+v, %v", result, err)
+	}
+}
+
+func TestBundleConflicts(t *testing.T) {
+	bundle := zipFiles(t, map[string]string{bundleConfigName: bundleTestConfig, "assets/svg/custom.svg": bundleSVG(4)})
+
+	tests := []struct {
+		mode        string
+		wantErr     bool
+		wantOnDisk  string
+		wantIconRef string
+	}{
+		{conflictFail, true, bundleSVG(3), ""},
+		{conflictKeep, false, bundleSVG(3), "assets/svg/custom.svg"},
+		// files under assets/ ship with the display
+		{conflictOverwrite, true, bundleSVG(3), ""},
+		{conflictRename, false, bundleSVG(3), "assets/svg/custom-2.svg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			apiV2TestApp(t)
+			dir := bundleTestAssets(t, map[string]string{"assets/svg/custom.svg": bundleSVG(3)})
+			_, err := importBundle(bundle, tt.mode)
+			var conflicts bundleConflicts
+			if tt.wantErr != (err != nil) || tt.wantErr && !errors.As(err, &conflicts) {
+				t.Fatalf("import = %v", err)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "assets/svg/custom.svg")); string(data) != tt.wantOnDisk {
+				t.Errorf("custom.svg = %q, want %q", data, tt.wantOnDisk)
+			}
+			if tt.wantIconRef == "" {
+				return
+			}
+			if got := cfg.DisplayTemplate.Elements["page0"][0].IconPath; got != tt.wantIconRef {
+				t.Errorf("icon_path = %q, want %q", got, tt.wantIconRef)
+			}
+		})
+	}
+}
+
+func TestReadBundleRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"path escape", map[string]string{bundleConfigName: "{}", "assets/../../etc/passwd.svg": ""}, "not a path under assets/"},
+		{"outside assets", map[string]string{bundleConfigName: "{}", "bin/tool.svg": ""}, "not a path under assets/"},
+		{"executable", map[string]string{bundleConfigName: "{}", "assets/svg/run.sh": ""}, "only"},
+		{"no config", map[string]string{"assets/svg/a.svg": bundleSVG(1)}, "no user_config.json"},
+		{"fake font", map[string]string{bundleConfigName: "{}", "assets/fonts/x.ttf": "junk"}, "not a usable font"},
+		{"fake image", map[string]string{bundleConfigName: "{}", "assets/img/x.png": "junk"}, "not an image"},
+		{"bad config", map[string]string{bundleConfigName: "{"}, "user_config.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readBundle(zipFiles(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readBundle = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, _, err := readBundle([]byte("not a zip")); err == nil {
+		t.Error("readBundle should refuse what isn't a zip")
+	}
+	unsafe := zipFiles(t, map[string]string{bundleConfigName: "{}", "assets/svg/x.svg": `<svg viewBox="0 0 8 8" onload="x()"><script>x()</script><path d="M0 0h1"/></svg>`})
+	if _, files, err := readBundle(unsafe); err != nil || strings.Contains(string(files["assets/svg/x.svg"]), "x()") {
+		t.Errorf("bundled stock-path SVG = %q, %v", files["assets/svg/x.svg"], err)
+	}
+}
+
+func TestBundleImportRollsBack(t *testing.T) {
+	apiV2TestApp(t)
+	dir := bundleTestAssets(t, nil)
+	bad := `{"display_template": {"elements": {"page0": [
+		{"type": "icon", "icon_path": "assets/svg/missing.svg", "enable": 1}]}}}`
+	bundle := zipFiles(t, map[string]string{bundleConfigName: bad, "assets/svg/custom.svg": bundleSVG(2)})
+
+	_, err := importBundle(bundle, "")
+	var configErr bundleConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), "user_config.json:2:") {
+		t.Errorf("import of an invalid config = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets/svg/custom.svg")); !os.IsNotExist(err) {
+		t.Errorf("the icon should have been removed again: %v", err)
+	}
+}
+
+func TestBundleAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	bundleTestAssets(t, map[string]string{"assets/svg/custom.svg": bundleSVG(1)})
+	if status, body := apiCall(t, app, "PUT", "/api/v2/config/user", bundleTestConfig); status != 200 {
+		t.Fatalf("PUT /config/user = %d %v", status, body)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v2/config/export", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("GET /config/export = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	bundleTestAssets(t, map[string]string{"assets/svg/custom.svg": bundleSVG(5)})
+	status, body := apiCall(t, app, "POST", "/api/v2/config/import", string(exported))
+	if status != 409 || body["conflicts"] == nil {
+		t.Errorf("import over a different icon = %d %v", status, body)
+	}
+	status, body = apiCall(t, app, "POST", "/api/v2/config/import?on_conflict=rename", string(exported))
+	if renamed, _ := body["renamed"].(map[string]interface{}); status != 200 || renamed["assets/svg/custom.svg"] != "assets/svg/custom-2.svg" {
+		t.Errorf("import with rename = %d %v", status, body)
+	}
+	if status, _ := apiCall(t, app, "POST", "/api/v2/config/import?on_conflict=merge", string(exported)); status != 400 {
+		t.Errorf("unknown on_conflict = %d, want 400", status)
+	}
+}
+
+func TestBundleFontsWithoutElements(t *testing.T) {
+	bundleTestAssets(t, map[string]string{"assets/fonts/Extra.ttf": "font"})
+	files, err := bundleAssets(Config{Fonts: map[string]FontDef{"extra": {Path: "assets/fonts/Extra.ttf", Size: 14}}})
+	if err != nil || len(files) != 1 || files[0] != "assets/fonts/Extra.ttf" {
+		t.Errorf("bundleAssets = %v, %v, want the font no element uses", files, err)
+	}
+}
+
+func TestBundleExportsActiveProfile(t *testing.T) {
+	app := apiV2TestApp(t)
+	profileTestApp(t)
+	bundleTestAssets(t, map[string]string{"assets/svg/custom.svg": bundleSVG(1)})
+	writeTestProfile(t, "vehicle", `{"ping_site0": "profile.example", "display_template": {"elements": {"page0": [
+		{"type": "icon", "icon_path": "assets/svg/custom.svg", "position": {"x": 10, "y": 10}, "enable": 1}]}}}`)
+	if err := switchProfile("vehicle"); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyUserOverrides(map[string]interface{}{"ping_site1": "user.example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/v2/config/export", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := io.ReadAll(resp.Body)
+	userRaw, files, err := readBundle(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"profile.example", "user.example", "custom.svg"} {
+		if !strings.Contains(string(userRaw), want) {
+			t.Errorf("exported config lacks %s: %s", want, userRaw)
+		}
+	}
+	if _, ok := files["assets/svg/custom.svg"]; !ok {
+		t.Errorf("the profile's icon isn't bundled: %v", files)
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apiErrorHandler, StreamRequestBody: true})
+	app.Use(limitBody)
+	size := func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"size": len(c.Body())}) }
+	app.Post("/api/v2/config/import", size)
+	app.Put("/api/v2/assets/:kind/:name", size)
+	app.Put("/api/v2/config/user", size)
+
+	tests := []struct {
+		method, target string
+		size           int
+		want           int
+	}{
+		{"PUT", "/api/v2/config/user", 1 << 20, 200},
+		{"PUT", "/api/v2/config/user", fiber.DefaultBodyLimit + 1, 413},
+		{"PUT", "/api/v2/assets/fonts/big.ttf", 8 << 20, 200},
+		{"POST", "/api/v2/config/import", 8 << 20, 200},
+		{"POST", "/api/v2/config/import", maxBundleSize + 1, 413},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(make([]byte, tt.size)))
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s with %d bytes = %d, want %d", tt.method, tt.target, tt.size, resp.StatusCode, tt.want)
+		}
+	}
+
+	// without a length up front the body is cut off at the limit too
+	req := httptest.NewRequest("PUT", "/api/v2/config/user", io.MultiReader(bytes.NewReader(make([]byte, fiber.DefaultBodyLimit)), strings.NewReader("x")))
+	req.ContentLength, req.TransferEncoding = -1, []string{"chunked"}
+	if resp, err := app.Test(req, -1); err != nil || resp.StatusCode != 413 {
+		t.Errorf("chunked body over the limit = %v, %v", resp, err)
+	}
+}
+
+func TestBundleOverwritesOnlyUploads(t *testing.T) {
+	apiV2TestApp(t)
+	bundleTestAssets(t, nil)
+	dst := filepath.Join(userAssetsDir(), "icons", "logo.svg")
+	os.MkdirAll(filepath.Dir(dst), 0755)
+	os.WriteFile(dst, []byte(bundleSVG(3)), 0644)
+	config := `{"display_template": {"elements": {"page0": [
+		{"type": "icon", "icon_path": "user/icons/logo.svg", "position": {"x": 10, "y": 10}, "enable": 1}]}}}`
+	bundle := zipFiles(t, map[string]string{bundleConfigName: config, "user/icons/logo.svg": bundleSVG(4)})
+
+	if _, err := importBundle(bundle, conflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != bundleSVG(4) {
+		t.Errorf("logo.svg = %q, want the bundled one", data)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDataSnapshot(t *testing.T) {
+	snapshot, err := loadDataSnapshot("fixtures/golden_data.json")
+	if err != nil {
+		t.Fatalf("loadDataSnapshot: %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"BatterySoc", 76},
+		{"BatteryCharging", false},
+		{"BatteryWattage", "3.2"},
+		{"Ping0", 23},
+		{"Ping1", -2},
+	}
+	for _, tt := range tests {
+		if got := snapshot[tt.key]; got != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.key, got, tt.want)
+		}
+	}
+
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"x": 1.5, "y": `), 0644)
+	if _, err := loadDataSnapshot(bad); err == nil {
+		t.Error("truncated JSON should fail")
+	}
+
+	floats := filepath.Join(dir, "floats.json")
+	os.WriteFile(floats, []byte(`{"UpSpeedBps": 1234.5}`), 0644)
+	snapshot, err = loadDataSnapshot(floats)
+	if err != nil || snapshot["UpSpeedBps"] != 1234.5 {
+		t.Errorf("fractional numbers should stay float64, got %#v, %v", snapshot["UpSpeedBps"], err)
+	}
+}
+
+func TestRunRenderCommand(t *testing.T) {
+	repoRoot := "."
+	if _, err := os.Stat("../assets"); err == nil {
+		repoRoot = ".."
+	}
+	savedPrefix, savedCfg := assetsPrefix, cfg
+	defer func() { assetsPrefix, cfg = savedPrefix, savedCfg }()
+
+	out := filepath.Join(t.TempDir(), "page1.png")
+	err := runRenderCommand([]string{
+		"--assets", repoRoot,
+		"--config", filepath.Join(repoRoot, "config.json"),
+		"--data", "fixtures/golden_data.json",
+		"--page", "1",
+		"--out", out,
+	})
+	if err != nil {
+		t.Fatalf("runRenderCommand: %v", err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("output not written: %v", err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("output is not a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != PCAT2_LCD_WIDTH || b.Dy() != PCAT2_LCD_HEIGHT {
+		t.Errorf("composite is %dx%d, want %dx%d", b.Dx(), b.Dy(), PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"page out of range", []string{"--assets", repoRoot, "--config", filepath.Join(repoRoot, "config.json"), "--page", "99", "--out", out}},
+		{"missing config", []string{"--assets", repoRoot, "--config", "does-not-exist.json", "--out", out}},
+		{"missing data", []string{"--assets", repoRoot, "--config", filepath.Join(repoRoot, "config.json"), "--data", "nope.json", "--out", out}},
+		{"unknown flag", []string{"--bogus"}},
+		{"unwritable output", []string{"--assets", repoRoot, "--config", filepath.Join(repoRoot, "config.json"), "--out", filepath.Join(out, "nested.png")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runRenderCommand(tt.args); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
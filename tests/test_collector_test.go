@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCollector counts its runs and fails while fail is set
+type fakeCollector struct {
+	name     string
+	interval time.Duration
+	block    time.Duration // ignore ctx and sleep this long on every run
+
+	runs    atomic.Int32
+	fail    atomic.Bool
+	active  atomic.Int32
+	overlap atomic.Bool
+}
+
+func (f *fakeCollector) Name() string            { return f.name }
+func (f *fakeCollector) Interval() time.Duration { return f.interval }
+func (f *fakeCollector) Collect(ctx context.Context) error {
+	if f.active.Add(1) > 1 {
+		f.overlap.Store(true)
+	}
+	defer f.active.Add(-1)
+	f.runs.Add(1)
+	time.Sleep(f.block)
+	if f.fail.Load() {
+		return errors.New("source down")
+	}
+	return nil
+}
+
+// runScheduler starts a scheduler for fc with the given config entry and stops it
+// when the test ends
+func runScheduler(t *testing.T, fc *fakeCollector, cc CollectorConfig) *CollectorScheduler {
+	t.Helper()
+	savedCfg := cfg
+	cfg.Collectors = map[string]CollectorConfig{fc.name: cc}
+
+	s := NewCollectorScheduler()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		s.Wait()
+		cfg = savedCfg
+	})
+
+	s.Add(fc)
+	s.Start(ctx)
+	return s
+}
+
+func healthOf(s *CollectorScheduler, name string) CollectorHealth {
+	for _, h := range s.Health() {
+		if h.Name == name {
+			return h
+		}
+	}
+	return CollectorHealth{}
+}
+
+func TestCollectorBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := collectorBackoff(time.Second, tt.failures, 30*time.Second); got != tt.want {
+			t.Errorf("collectorBackoff(1s, %d, 30s) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+	// an interval above max_backoff: failures don't poll faster than success
+	for _, failures := range []int{0, 1, 5} {
+		if got := collectorBackoff(5*time.Minute, failures, 2*time.Minute); got != 5*time.Minute {
+			t.Errorf("collectorBackoff(5m, %d, 2m) = %v, want 5m", failures, got)
+		}
+	}
+}
+
+func TestMergeCollectorConfigs(t *testing.T) {
+	off := false
+	base := map[string]CollectorConfig{
+		"battery":  {IntervalSeconds: 1},
+		"pcat_web": {IntervalSeconds: 10, TimeoutSeconds: 20},
+	}
+	user := map[string]CollectorConfig{
+		"pcat_web": {IntervalSeconds: 30},
+		"network":  {Enabled: &off},
+	}
+
+	got := mergeCollectorConfigs(base, user)
+	if got["battery"].IntervalSeconds != 1 {
+		t.Errorf("battery = %+v, want default kept", got["battery"])
+	}
+	if pw := got["pcat_web"]; pw.IntervalSeconds != 30 || pw.TimeoutSeconds != 20 {
+		t.Errorf("pcat_web = %+v, want user interval over default timeout", pw)
+	}
+	if n := got["network"]; n.Enabled == nil || *n.Enabled {
+		t.Errorf("network = %+v, want disabled", n)
+	}
+}
+
+func TestSchedulerRunsCollector(t *testing.T) {
+	fc := &fakeCollector{name: "fake_ok", interval: time.Hour}
+	s := runScheduler(t, fc, CollectorConfig{IntervalSeconds: 0.02, JitterSeconds: 0.001})
+
+	time.Sleep(200 * time.Millisecond)
+
+	if n := fc.runs.Load(); n < 4 {
+		t.Errorf("ran %d times in 200ms at a 20ms interval from config", n)
+	}
+	h := healthOf(s, "fake_ok")
+	if !h.Enabled || h.IntervalMs != 20 || h.LastSuccess.IsZero() || h.Failures != 0 {
+		t.Errorf("health = %+v", h)
+	}
+	if h.NextRun.Before(h.LastRun) {
+		t.Errorf("next run %v before last run %v", h.NextRun, h.LastRun)
+	}
+}
+
+func TestSchedulerSetsStaleAfter(t *testing.T) {
+	t.Cleanup(func() {
+		clearStaleAfter("fake_slow")
+		clearStaleAfter("battery")
+	})
+	runScheduler(t, &fakeCollector{name: "fake_slow", interval: time.Hour}, CollectorConfig{IntervalSeconds: 20, JitterSeconds: 0.001})
+	time.Sleep(50 * time.Millisecond)
+	if got := staleAfter("X", "fake_slow"); got != time.Minute {
+		t.Errorf("fake_slow at a 20s interval goes stale after %s, want three polls", got)
+	}
+
+	runScheduler(t, &fakeCollector{name: "battery", interval: time.Hour}, CollectorConfig{IntervalSeconds: 0.02, JitterSeconds: 0.001})
+	time.Sleep(50 * time.Millisecond)
+	if got := staleAfter("BatterySoc", "battery"); got != 30*time.Second {
+		t.Errorf("battery at a 20ms interval goes stale after %s, want the 30s floor", got)
+	}
+}
+
+func TestSchedulerBacksOffAndRecovers(t *testing.T) {
+	fc := &fakeCollector{name: "fake_flaky", interval: 10 * time.Millisecond}
+	fc.fail.Store(true)
+	s := runScheduler(t, fc, CollectorConfig{JitterSeconds: 0.001, MaxBackoffSeconds: 0.16})
+
+	// 10, 20, 40, 80, 160, 160ms... about 6 runs in 500ms instead of 50
+	time.Sleep(500 * time.Millisecond)
+	if n := fc.runs.Load(); n < 3 || n > 9 {
+		t.Errorf("failing collector ran %d times in 500ms, want backoff to about 6", n)
+	}
+	h := healthOf(s, "fake_flaky")
+	if h.ConsecutiveFailures < 3 || h.LastError != "source down" || !h.LastSuccess.IsZero() {
+		t.Errorf("health while failing = %+v", h)
+	}
+
+	fc.fail.Store(false)
+	time.Sleep(300 * time.Millisecond)
+	h = healthOf(s, "fake_flaky")
+	if h.ConsecutiveFailures != 0 || h.LastSuccess.IsZero() {
+		t.Errorf("health after recovery = %+v", h)
+	}
+	if h.LastError == "" {
+		t.Error("last error should stay visible after recovery")
+	}
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	fc := &fakeCollector{name: "fake_hung", interval: 10 * time.Millisecond, block: 150 * time.Millisecond}
+	s := runScheduler(t, fc, CollectorConfig{TimeoutSeconds: 0.02, JitterSeconds: 0.001})
+
+	time.Sleep(80 * time.Millisecond)
+	h := healthOf(s, "fake_hung")
+	if !strings.Contains(h.LastError, "timed out") || !h.Running {
+		t.Errorf("health during hung run = %+v, want timed out and still running", h)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if fc.overlap.Load() {
+		t.Error("a new run started while the timed out one was still going")
+	}
+}
+
+func TestSchedulerEnableDisable(t *testing.T) {
+	off := false
+	fc := &fakeCollector{name: "fake_off", interval: 10 * time.Millisecond}
+	s := runScheduler(t, fc, CollectorConfig{Enabled: &off, JitterSeconds: 0.001})
+
+	time.Sleep(100 * time.Millisecond)
+	if n := fc.runs.Load(); n != 0 {
+		t.Errorf("disabled collector ran %d times", n)
+	}
+	if h := healthOf(s, "fake_off"); h.Enabled {
+		t.Errorf("health = %+v, want disabled", h)
+	}
+
+	if err := s.SetEnabled("fake_off", true); err != nil {
+		t.Fatal(err)
+	}
+	// a disabled collector notices within disabledCollectorPoll
+	time.Sleep(disabledCollectorPoll + 200*time.Millisecond)
+	if n := fc.runs.Load(); n == 0 {
+		t.Error("collector didn't start after SetEnabled(true)")
+	}
+
+	if err := s.SetEnabled("no_such_collector", true); err == nil {
+		t.Error("SetEnabled on an unknown collector should fail")
+	}
+}
+
+func TestSchedulerRecoversPanic(t *testing.T) {
+	var once sync.Once
+	s := runScheduler(t, &fakeCollector{name: "unused", interval: time.Hour}, CollectorConfig{})
+	s.Add(collectorFunc{"fake_panic", 10 * time.Millisecond, func(context.Context) error {
+		once.Do(func() { panic("boom") })
+		return nil
+	}})
+
+	time.Sleep(150 * time.Millisecond)
+	h := healthOf(s, "fake_panic")
+	if h.Failures != 1 || !strings.Contains(h.LastError, "boom") || h.LastSuccess.IsZero() {
+		t.Errorf("health = %+v, want one recovered panic then successes", h)
+	}
+}
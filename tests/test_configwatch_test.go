@@ -0,0 +1,287 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reloadTestFiles points the config globals at a default and a user config in
+// a temp dir and restores them afterwards
+func reloadTestFiles(t *testing.T, dft, user string) (dftPath, userPath string) {
+	t.Helper()
+	savedCfg, savedDft, savedUser, savedFile, savedDftFile := cfg, dftCfg, userCfg, userConfigFile, defaultConfigFile
+	reloadMu.Lock()
+	savedStatus := reloadStatus
+	reloadStatus = ConfigReloadStatus{}
+	reloadMu.Unlock()
+	t.Cleanup(func() {
+		cfg, dftCfg, userCfg, userConfigFile, defaultConfigFile = savedCfg, savedDft, savedUser, savedFile, savedDftFile
+		reloadMu.Lock()
+		reloadStatus = savedStatus
+		reloadMu.Unlock()
+	})
+	initFonts()
+	dir := t.TempDir()
+	dftPath, userPath = filepath.Join(dir, "config.json"), filepath.Join(dir, "user_config.json")
+	os.WriteFile(dftPath, []byte(dft), 0644)
+	os.WriteFile(userPath, []byte(user), 0644)
+	defaultConfigFile, userConfigFile = dftPath, userPath
+	return dftPath, userPath
+}
+
+const reloadTestDefault = `{"screen_max_brightness": 100, "ping_site0": "default.example",
+	"display_template": {"elements": {"page0": [{"type": "text", "data_key": "A", "font": "reg", "units_font": "unit", "enable": 1}]}}}`
+
+func TestReloadConfigs(t *testing.T) {
+	_, userPath := reloadTestFiles(t, reloadTestDefault, `{"ping_site0": "user.example"}`)
+
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PingSite0 != "user.example" || cfg.ScreenMaxBrightness != 100 {
+		t.Errorf("after reload cfg = %q, %d", cfg.PingSite0, cfg.ScreenMaxBrightness)
+	}
+	if !renderCachesStale.Load() {
+		t.Error("a reload should mark the render caches stale")
+	}
+	dropStaleRenderCaches()
+
+	bad := []struct{ name, user, wantErr string }{
+		{"invalid value", `{"ping_site0": "other.example", "screen_min_brightness": 200}`, "screen_min_brightness"},
+		{"malformed JSON", `{"ping_site0": `, "user_config.json"},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			os.WriteFile(userPath, []byte(tt.user), 0644)
+			err := reloadConfigs()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("reloadConfigs() = %v, want %q", err, tt.wantErr)
+			}
+			if cfg.PingSite0 != "user.example" || cfg.ScreenMinBrightness != 0 {
+				t.Errorf("the last good config should stay, got %q, %d", cfg.PingSite0, cfg.ScreenMinBrightness)
+			}
+			if reloadStatus.LastError == "" || reloadStatus.Reloads != 1 {
+				t.Errorf("status = %+v", reloadStatus)
+			}
+			if renderCachesStale.Load() {
+				t.Error("a failed reload should keep the caches")
+			}
+		})
+	}
+
+	// a missing user config is an empty one
+	os.Remove(userPath)
+	if err := reloadConfigs(); err != nil || cfg.PingSite0 != "default.example" || reloadStatus.LastError != "" {
+		t.Errorf("reload without user config = %v, %q, %+v", err, cfg.PingSite0, reloadStatus)
+	}
+}
+
+func TestReloadKeepsSavedUserConfig(t *testing.T) {
+	reloadTestFiles(t, reloadTestDefault, `{}`)
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	// a user_config.json in the working directory that isn't userConfigFile
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "user_config.json"), []byte(`{"ping_site0": "stray.example"}`), 0644)
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := patchUserOverrides(map[string]interface{}{"ping_site0": "saved.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PingSite0 != "saved.example" {
+		t.Errorf("ping_site0 = %q after a save and a reload", cfg.PingSite0)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	_, userPath := reloadTestFiles(t, reloadTestDefault, `{}`)
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := watchConfigFiles([]string{defaultConfigFile, userPath}, nil)
+	if err != nil {
+		t.Skipf("inotify not available: %v", err)
+	}
+	defer stop()
+
+	// replace the file the way editors and writeUserConfigFile do
+	tmp := userPath + ".tmp"
+	os.WriteFile(tmp, []byte(`{"ping_site1": "watched.example"}`), 0644)
+	os.Rename(tmp, userPath)
+
+	// wait for the status, which is written last, so the reload is over
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		reloadMu.Lock()
+		status := reloadStatus
+		reloadMu.Unlock()
+		if status.Reloads >= 2 {
+			if !status.Watching {
+				t.Errorf("status = %+v", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("config not reloaded after the user config changed, status = %+v", status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if cfg.PingSite1 != "watched.example" {
+		t.Errorf("ping_site1 = %q after the reload", cfg.PingSite1)
+	}
+}
+
+// waitForReloads polls the reload status until it counts n reloads
+func waitForReloads(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		reloadMu.Lock()
+		status := reloadStatus
+		reloadMu.Unlock()
+		if status.Reloads >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no reload %d, status = %+v", n, status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestConfigWatcherProfiles(t *testing.T) {
+	profileTestApp(t)
+	reloadTestFiles(t, reloadTestDefault, `{}`)
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(profilesDir(), 0755)
+	stop, err := watchConfigFiles([]string{defaultConfigFile, userConfigFile},
+		map[string]func(string) bool{profilesDir(): isProfileFileName})
+	if err != nil {
+		t.Skipf("inotify not available: %v", err)
+	}
+	defer stop()
+
+	// a profile saved after the watch started, then made active
+	writeTestProfile(t, "late", `{"ping_site1": "late.example"}`)
+	writeProfileFile(activeProfileFile(), []byte("late\n"))
+	waitForReloads(t, 2)
+	if cfg.PingSite1 != "late.example" {
+		t.Fatalf("ping_site1 = %q with the late profile active", cfg.PingSite1)
+	}
+
+	writeTestProfile(t, "late", `{"ping_site1": "edited.example"}`)
+	waitForReloads(t, 3)
+	if cfg.PingSite1 != "edited.example" {
+		t.Errorf("ping_site1 = %q after editing the late profile", cfg.PingSite1)
+	}
+}
+
+func TestConfigReloadAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	_, userPath := reloadTestFiles(t, reloadTestDefault, `{"ping_site0": "api.example"}`)
+
+	status, body := apiCall(t, app, "POST", "/api/v2/config/reload", "")
+	if status != 200 || cfg.PingSite0 != "api.example" {
+		t.Errorf("POST /config/reload = %d %v, ping_site0 %q", status, body, cfg.PingSite0)
+	}
+
+	os.WriteFile(userPath, []byte(`{"screen_max_brightness": 101}`), 0644)
+	status, _ = apiCall(t, app, "POST", "/api/v2/config/reload", "")
+	if status != 422 {
+		t.Errorf("POST /config/reload with a bad config = %d, want 422", status)
+	}
+	_, body = apiCall(t, app, "GET", "/api/v2/config/reload", "")
+	if msg, _ := body["last_error"].(string); !strings.Contains(msg, "screen_max_brightness") {
+		t.Errorf("GET /config/reload = %v", body)
+	}
+}
+
+func TestReloadReappliesRuntimeConfig(t *testing.T) {
+	dftPath, _ := reloadTestFiles(t, `{"auth": {"enabled": false}}`, `{}`)
+	savedCollectors, savedTokens, savedTokensPath := collectors, authTokens, authTokensPath
+	externalMu.Lock()
+	savedExternal := externalApplied
+	externalMu.Unlock()
+	t.Cleanup(func() {
+		runtimeConfigStarted.Store(false)
+		stopMQTT()
+		mqttMu.Lock()
+		mqttApplied = nil
+		mqttMu.Unlock()
+		collectors, authTokens, authTokensPath = savedCollectors, savedTokens, savedTokensPath
+		externalMu.Lock()
+		externalApplied = savedExternal
+		externalMu.Unlock()
+	})
+	collectors = NewCollectorScheduler()
+	authTokens = AuthTokens{}
+	authTokensPath = filepath.Join(t.TempDir(), "auth.json")
+	externalMu.Lock()
+	externalApplied.done = false
+	externalMu.Unlock()
+
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	startRuntimeConfig()
+	if currentAuthTokens() != (AuthTokens{}) {
+		t.Error("tokens loaded with auth off")
+	}
+	names := func() string {
+		var out []string
+		for _, h := range collectors.Health() {
+			out = append(out, h.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	os.WriteFile(dftPath, []byte(`{"auth": {"enabled": true},
+		"external_collectors": [{"data_key": "Vpn", "file": "/run/vpn"}],
+		"mqtt": {"enabled": true, "broker": "tcp://127.0.0.1:1"}}`), 0644)
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := currentAuthTokens(); tokens.Admin == "" || tokens.Read == "" {
+		t.Errorf("turning auth on by a reload left tokens %+v", tokens)
+	}
+	if got := names(); got != "Vpn" {
+		t.Errorf("scheduled %q after adding an external collector", got)
+	}
+	mqttMu.Lock()
+	started := mqttPublisher != nil
+	mqttMu.Unlock()
+	if !started {
+		t.Error("enabling mqtt by a reload didn't start the publisher")
+	}
+
+	// what the loop sets once the collector runs
+	setStaleAfter("Vpn", time.Minute)
+	os.WriteFile(dftPath, []byte(`{"auth": {"enabled": true},
+		"external_collectors": [{"data_key": "Wifi", "file": "/run/wifi"}]}`), 0644)
+	if err := reloadConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); got != "Wifi" {
+		t.Errorf("scheduled %q after replacing the external collector", got)
+	}
+	if got := staleAfter("Vpn", "Vpn"); got != 0 {
+		t.Errorf("removed collector Vpn still goes stale after %s", got)
+	}
+	mqttMu.Lock()
+	stopped := mqttPublisher == nil
+	mqttMu.Unlock()
+	if !stopped {
+		t.Error("disabling mqtt by a reload left the publisher running")
+	}
+}
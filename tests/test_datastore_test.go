@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDataStoreConvertsToDeclaredType(t *testing.T) {
+	ds := NewDataStore()
+
+	tests := []struct {
+		key       string
+		in        interface{}
+		wantValue interface{}
+		wantText  string
+	}{
+		{"BatterySoc", 76, 76, "76"},
+		{"BatterySoc", "55", 55, "55"},
+		{"BatterySoc", float64(40), 40, "40"},
+		{"Ping0", int64(23), 23, "23"},
+		{"BatteryVoltage", "7.70", 7.7, "7.70"},
+		{"BatteryWattage", 3.25, 3.25, "3.25"},
+		{"UpSpeedBps", 1024, float64(1024), "1024"},
+		{"BatteryCharging", true, true, "true"},
+		{"BatteryCharging", "false", false, "false"},
+		{"Carrier", "5G", "5G", "5G"},
+		{"SN", 12345, "12345", "12345"},
+		{"MyCustomKey", 7, 7, "7"},
+	}
+
+	for _, tt := range tests {
+		ds.Store(tt.key, tt.in)
+		entry, ok := ds.Get(tt.key)
+		if !ok {
+			t.Fatalf("%s missing after Store", tt.key)
+		}
+		if entry.Value != tt.wantValue || entry.Text != tt.wantText || entry.Error != "" {
+			t.Errorf("Store(%q, %#v): value=%#v text=%q err=%q; want %#v %q", tt.key, tt.in, entry.Value, entry.Text, entry.Error, tt.wantValue, tt.wantText)
+		}
+	}
+
+	if entry, _ := ds.Get("BatteryVoltage"); entry.Type != DataFloat || entry.Unit != "V" {
+		t.Errorf("BatteryVoltage declared as %s %q", entry.Type, entry.Unit)
+	}
+	if entry, _ := ds.Get("MyCustomKey"); entry.Type != DataInt {
+		t.Errorf("undeclared key type = %s, want inferred int", entry.Type)
+	}
+}
+
+func TestDataStoreRejectsWrongType(t *testing.T) {
+	ds := NewDataStore()
+	ds.Store("BatteryWattage", "1.5")
+	ds.Store("BatteryWattage", "invalid")
+
+	// the failed conversion is recorded like a failed reading
+	if v, ok := ds.Float("BatteryWattage"); !ok || v != 1.5 {
+		t.Errorf("Float() = %v, %v; want the last good 1.5", v, ok)
+	}
+	entry, _ := ds.Get("BatteryWattage")
+	if entry.Error == "" || entry.ErrorAt.IsZero() {
+		t.Error("conversion failure should be recorded as an error")
+	}
+
+	ds.Store("ModemSignalStrength", "strong")
+	if v, ok := ds.Int("ModemSignalStrength"); ok || v != 0 {
+		t.Errorf("Int() = %d, %v; want 0, false", v, ok)
+	}
+}
+
+func TestDataStoreErrorKeepsLastValue(t *testing.T) {
+	ds := NewDataStore()
+	src := ds.Source("linux")
+
+	src.Store("CpuTemp", "48.6")
+	before, _ := ds.Get("CpuTemp")
+
+	src.StoreError("CpuTemp", errors.New("thermal zone missing"))
+	entry, _ := ds.Get("CpuTemp")
+	if entry.Error != "thermal zone missing" || entry.ErrorAt.IsZero() {
+		t.Errorf("error not recorded: %+v", entry)
+	}
+	if entry.Value != 48.6 || !entry.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("last good value and its time should be kept, got %v at %v", entry.Value, entry.UpdatedAt)
+	}
+	if entry.Source != "linux" {
+		t.Errorf("source = %q, want linux", entry.Source)
+	}
+
+	src.Store("CpuTemp", "50.1")
+	if entry, _ := ds.Get("CpuTemp"); entry.Error != "" || entry.Value != 50.1 {
+		t.Errorf("a successful reading should clear the error, got %+v", entry)
+	}
+
+	// a key that never had a reading
+	src.StoreErrors(errors.New("unreachable"), "Carrier", "ISPName")
+	if _, ok := ds.Load("Carrier"); ok {
+		t.Error("Load should report no value for a key that only ever failed")
+	}
+	if entry, ok := ds.Get("ISPName"); !ok || entry.Error != "unreachable" || entry.Type != DataString {
+		t.Errorf("ISPName entry = %+v", entry)
+	}
+}
+
+func TestDataEntryJSON(t *testing.T) {
+	ds := NewDataStore()
+	ds.Source("battery").Store("BatterySoc", 76)
+	ds.StoreError("FanRPM", errors.New("no fan"))
+
+	raw, err := json.Marshal(ds.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	soc := got["BatterySoc"]
+	if soc["value"] != float64(76) || soc["type"] != "int" || soc["unit"] != "%" || soc["source"] != "battery" || soc["updated_at"] == nil {
+		t.Errorf("BatterySoc JSON = %v", soc)
+	}
+	if _, ok := soc["error"]; ok {
+		t.Error("healthy entry should have no error field")
+	}
+	fan := got["FanRPM"]
+	if fan["value"] != nil || fan["error"] != "no fan" || fan["error_at"] == nil {
+		t.Errorf("FanRPM JSON = %v", fan)
+	}
+	if _, ok := fan["updated_at"]; ok {
+		t.Error("updated_at should be omitted when there was never a reading")
+	}
+
+	values := ds.Values()
+	if values["BatterySoc"] != 76 || values["FanRPM"] != nil {
+		t.Errorf("Values() = %v", values)
+	}
+}
+
+func TestCollectorsRecordErrorsInsteadOfSentinels(t *testing.T) {
+	root := useFixtureSysRoot(t)
+	globalData.Reset()
+
+	os.Remove(filepath.Join(root, "sys/class/power_supply/battery/current_now"))
+	os.Remove(filepath.Join(root, "sys/class/thermal/thermal_zone0/temp"))
+	collectLinuxData(cfg)
+
+	for _, key := range []string{"BatteryCurrent", "BatteryWattage", "CpuTemp"} {
+		entry, ok := globalData.Get(key)
+		if !ok || entry.Error == "" || entry.Value != nil {
+			t.Errorf("%s = %+v, want an error and no value", key, entry)
+		}
+		if entry.Source != "linux" {
+			t.Errorf("%s source = %q", key, entry.Source)
+		}
+	}
+	if v, ok := globalData.Float("BatteryVoltage"); !ok || v != 7.71 {
+		t.Errorf("BatteryVoltage = %v, %v; want 7.71", v, ok)
+	}
+	if v, ok := globalData.Int("FanRPM"); !ok || v != 2950 {
+		t.Errorf("FanRPM = %v, %v; want 2950", v, ok)
+	}
+}
+
+// roundTripFunc answers HTTP requests without a server
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestPcatWebBadResponsesRecordErrors(t *testing.T) {
+	saved := localHTTPClient
+	t.Cleanup(func() { localHTTPClient = saved; globalData.Reset() })
+	localHTTPClient = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("<html>login</html>"))}, nil
+	})}
+	globalData.Reset()
+	globalData.Source("pcat_web").Store("Carrier", "Vodafone")
+
+	if err := getInfoFromPcatWeb(context.Background()); err != nil {
+		t.Fatalf("pcat-manager answered, got %v", err)
+	}
+	for _, key := range []string{"Carrier", "DailyDataUsage", "ModemTemperature"} {
+		if entry, _ := globalData.Get(key); entry.Error == "" {
+			t.Errorf("%s = %+v, want the parse error recorded", key, entry)
+		}
+	}
+	if v, _ := globalData.String("Carrier"); v != "Vodafone" {
+		t.Errorf("Carrier = %q, want the last good value kept", v)
+	}
+}
+
+func TestDrawTopBarWithBadTypes(t *testing.T) {
+	setupGolden(t)
+
+	// these used to panic on a failed type assertion
+	globalData.Store("GatewayDevice", "mobile")
+	globalData.Store("Carrier", "5G")
+	globalData.Store("ModemSignalStrength", "n/a")
+	globalData.Delete("BatterySoc")
+	globalData.Store("BatteryCharging", "maybe")
+	cacheTopBarStr = ""
+
+	frame := image.NewRGBA(image.Rect(0, 0, topBarFrameWidth, topBarFrameHeight))
+	drawTopBar(NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT), frame)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestVirtualDisplayFillRectangleWithImage(t *testing.T) {
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+
+	red := color.RGBA{255, 0, 0, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 10, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 10; x++ {
+			src.SetRGBA(x, y, red)
+		}
+	}
+
+	if err := vd.FillRectangleWithImage(20, 30, 10, 5, src); err != nil {
+		t.Fatalf("FillRectangleWithImage returned error: %v", err)
+	}
+
+	snap := vd.Snapshot()
+	if got := snap.RGBAAt(20, 30); got != red {
+		t.Errorf("pixel (20,30) = %v, want %v", got, red)
+	}
+	if got := snap.RGBAAt(29, 34); got != red {
+		t.Errorf("pixel (29,34) = %v, want %v", got, red)
+	}
+	if got := snap.RGBAAt(30, 35); got != PCAT_BLACK {
+		t.Errorf("pixel (30,35) outside rectangle = %v, want black", got)
+	}
+	if vd.Writes() != 1 {
+		t.Errorf("Writes() = %d, want 1", vd.Writes())
+	}
+
+	// Snapshot must be a copy, not a view of the live framebuffer
+	snap.SetRGBA(0, 0, red)
+	if got := vd.Snapshot().RGBAAt(0, 0); got == red {
+		t.Error("modifying a snapshot should not change the virtual display")
+	}
+}
+
+func TestVirtualDisplayRejectsBadRectangles(t *testing.T) {
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	tests := []struct {
+		name                string
+		x, y, width, height int16
+		img                 *image.RGBA
+	}{
+		{"nil image", 0, 0, 10, 10, nil},
+		{"negative x", -1, 0, 10, 10, img},
+		{"past right edge", PCAT2_LCD_WIDTH - 5, 0, 10, 10, img},
+		{"past bottom edge", 0, PCAT2_LCD_HEIGHT - 5, 10, 10, img},
+		{"size mismatch", 0, 0, 20, 10, img},
+		{"zero width", 0, 0, 0, 10, img},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := vd.FillRectangleWithImage(tt.x, tt.y, tt.width, tt.height, tt.img); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if vd.Writes() != 0 {
+		t.Errorf("rejected writes should not be counted, got %d", vd.Writes())
+	}
+}
+
+func TestSendFunctionsWithVirtualDisplay(t *testing.T) {
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	savedWrapper := displayWrapper
+	displayWrapper = nil
+	defer func() { displayWrapper = savedWrapper }()
+
+	fill := func(w, h int, c color.RGBA) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		return img
+	}
+
+	sendTopBar(vd, fill(PCAT2_LCD_WIDTH, PCAT2_TOP_BAR_HEIGHT, PCAT_YELLOW))
+	sendMiddle(vd, fill(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT-PCAT2_TOP_BAR_HEIGHT-PCAT2_FOOTER_HEIGHT, PCAT_GREEN))
+	sendFooter(vd, fill(PCAT2_LCD_WIDTH, PCAT2_FOOTER_HEIGHT, PCAT_RED))
+
+	snap := vd.Snapshot()
+	checks := []struct {
+		name string
+		y    int
+		want color.RGBA
+	}{
+		{"top bar", 0, PCAT_YELLOW},
+		{"middle", PCAT2_TOP_BAR_HEIGHT, PCAT_GREEN},
+		{"footer", PCAT2_LCD_HEIGHT - 1, PCAT_RED},
+	}
+	for _, c := range checks {
+		if got := snap.RGBAAt(PCAT2_LCD_WIDTH/2, c.y); got != c.want {
+			t.Errorf("%s pixel = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// countingSink stands in for the SPI panel
+type countingSink struct {
+	calls int
+	err   error
+}
+
+func (s *countingSink) FillRectangleWithImage(x, y, width, height int16, fb *image.RGBA) error {
+	s.calls++
+	return s.err
+}
+
+func TestMirrorDisplay(t *testing.T) {
+	panel := &countingSink{}
+	md := NewMirrorDisplay(panel, PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+
+	observed := 0
+	stop := md.Observe(func(*VirtualDisplay) { observed++ })
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	if err := md.FillRectangleWithImage(10, 10, 4, 4, img); err != nil {
+		t.Fatalf("FillRectangleWithImage: %v", err)
+	}
+	if panel.calls != 1 {
+		t.Errorf("panel got %d writes, want 1", panel.calls)
+	}
+	if got := md.Snapshot().RGBAAt(11, 11); got != PCAT_WHITE {
+		t.Errorf("mirror pixel = %v, want white", got)
+	}
+	if observed != 1 {
+		t.Errorf("observer ran %d times, want 1", observed)
+	}
+
+	stop()
+	panel.err = errors.New("spi failure")
+	if err := md.FillRectangleWithImage(0, 0, 4, 4, img); err == nil {
+		t.Error("panel errors should be returned")
+	}
+	if observed != 1 {
+		t.Errorf("observer ran after being removed")
+	}
+	if md.Writes() != 2 {
+		t.Errorf("mirror should be updated even when the panel write fails, writes = %d", md.Writes())
+	}
+
+	savedDisplay := display
+	defer func() { display = savedDisplay }()
+	display = md
+	if screenMirror() != md.VirtualDisplay {
+		t.Error("screenMirror() should return the mirror's copy")
+	}
+	display = panel
+	if screenMirror() != nil {
+		t.Error("screenMirror() should be nil for a bare panel")
+	}
+}
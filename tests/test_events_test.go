@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDataStoreObserve(t *testing.T) {
+	ds := NewDataStore()
+	var got []string
+	stop := ds.Observe(func(key string, e DataEntry) {
+		got = append(got, key+"="+e.Text+"/"+e.Error)
+	})
+
+	ds.Store("BatterySoc", 76)
+	ds.Store("BatterySoc", 76) // same reading, only the timestamp moves
+	ds.Store("BatterySoc", 75)
+	ds.StoreError("BatterySoc", errors.New("i2c"))
+	ds.StoreError("BatterySoc", errors.New("i2c"))
+	ds.Store("BatterySoc", 75) // clears the error
+	stop()
+	ds.Store("BatterySoc", 74)
+
+	want := []string{"BatterySoc=76/", "BatterySoc=75/", "BatterySoc=75/i2c", "BatterySoc=75/"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("notified %v, want %v", got, want)
+	}
+}
+
+// nextEvent waits briefly for the client's next event
+func nextEvent(t *testing.T, ec *eventClient) (Event, bool) {
+	t.Helper()
+	select {
+	case ev, ok := <-ec.ch:
+		return ev, ok
+	case <-time.After(2 * eventDataWindow):
+		return Event{}, false
+	}
+}
+
+func TestEventHub(t *testing.T) {
+	globalData.Reset()
+	t.Cleanup(globalData.Reset)
+	globalData.Store("BatterySoc", 80)
+
+	h := NewEventHub()
+	stop := globalData.Observe(h.dataChanged)
+	t.Cleanup(stop)
+	h.Publish(EventPage, pageEvent(2, 5, false))
+
+	all, err := h.subscribe(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pagesOnly, _ := h.subscribe([]string{EventPage}, false)
+
+	t.Run("snapshot first", func(t *testing.T) {
+		for _, ec := range []*eventClient{all, pagesOnly} {
+			ev, _ := nextEvent(t, ec)
+			snap, _ := ev.Data.(map[string]interface{})
+			if ev.Type != EventSnapshot || snap["page"] == nil {
+				t.Fatalf("first event = %s %v", ev.Type, ev.Data)
+			}
+			if data, _ := snap["data"].(map[string]DataEntry); data["BatterySoc"].Value != 80 {
+				t.Errorf("snapshot data = %v", snap["data"])
+			}
+		}
+	})
+
+	t.Run("data changes are batched", func(t *testing.T) {
+		globalData.Store("BatterySoc", 79)
+		globalData.Store("CpuUsage", 12)
+		ev, ok := nextEvent(t, all)
+		delta, _ := ev.Data.(map[string]DataEntry)
+		if !ok || ev.Type != EventData || len(delta) != 2 || delta["BatterySoc"].Value != 79 {
+			t.Fatalf("delta = %s %v", ev.Type, ev.Data)
+		}
+		if ev, ok := nextEvent(t, pagesOnly); ok {
+			t.Errorf("page-only client got %s", ev.Type)
+		}
+	})
+
+	t.Run("filtered types", func(t *testing.T) {
+		h.Publish(EventPage, pageEvent(3, 5, false))
+		for _, ec := range []*eventClient{all, pagesOnly} {
+			if ev, _ := nextEvent(t, ec); ev.Type != EventPage {
+				t.Errorf("got %q, want page", ev.Type)
+			}
+		}
+	})
+
+	t.Run("slow client is dropped", func(t *testing.T) {
+		for i := 0; i <= eventClientBuffer; i++ {
+			h.Publish(EventIdle, map[string]string{"state": "ACTIVE"})
+		}
+		closed := false
+		for i := 0; i <= eventClientBuffer && !closed; i++ {
+			_, ok := <-all.ch
+			closed = !ok
+		}
+		if !closed {
+			t.Error("a client that stops reading should be disconnected")
+		}
+		h.unsubscribe(all) // must not close twice
+	})
+}
+
+func TestWriteEvent(t *testing.T) {
+	delta := map[string]DataEntry{"BatterySoc": {Value: 76, Text: "76", Type: DataInt, Unit: "%"}}
+	tests := []struct {
+		name string
+		meta bool
+		want string
+	}{
+		{"values", false, "id: 7\nevent: data\ndata: {\"BatterySoc\":76}\n\n"},
+		{"meta", true, "id: 7\nevent: data\ndata: {\"BatterySoc\":{\"text\":\"76\",\"type\":\"int\",\"unit\":\"%\",\"value\":76}}\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			if err := writeEvent(w, Event{ID: 7, Type: EventData, Data: delta}, tt.meta); err != nil {
+				t.Fatal(err)
+			}
+			w.Flush()
+			if buf.String() != tt.want {
+				t.Errorf("got %q\nwant %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEventTypes(t *testing.T) {
+	if types, err := parseEventTypes("data, sms"); err != nil || len(types) != 2 {
+		t.Errorf("types = %v, err %v", types, err)
+	}
+	if types, err := parseEventTypes(""); err != nil || types != nil {
+		t.Errorf("empty filter = %v, err %v", types, err)
+	}
+	if _, err := parseEventTypes("data,frames"); err == nil {
+		t.Error("unknown type should be rejected")
+	}
+}
+
+func TestAnnounceNewSms(t *testing.T) {
+	saved, savedSeen := events, seenSms
+	t.Cleanup(func() { events, seenSms = saved, savedSeen })
+	events, seenSms = NewEventHub(), nil
+	ec, _ := events.subscribe([]string{EventSMS}, false)
+	nextEvent(t, ec) // snapshot
+
+	list := func(msgs ...string) string {
+		return `{"msg":[` + strings.Join(msgs, ",") + `]}`
+	}
+	first := `{"sender":"10086","timestamp":"2025-01-01 10:00:00","content":"balance low"}`
+	second := `{"sender":"Mum","timestamp":"2025-01-01 11:00:00","content":"call me"}`
+
+	announceNewSms(list(first))
+	if ev, ok := nextEvent(t, ec); ok {
+		t.Errorf("startup list announced %v", ev.Data)
+	}
+	announceNewSms(list(second, first))
+	ev, ok := nextEvent(t, ec)
+	if msg, _ := ev.Data.(SMS); !ok || msg.Sender != "Mum" {
+		t.Errorf("new sms event = %v", ev.Data)
+	}
+	if ev, ok := nextEvent(t, ec); ok {
+		t.Errorf("old message announced again: %v", ev.Data)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"vpn": map[string]interface{}{
+			"state": "up",
+			"peers": []interface{}{
+				map[string]interface{}{"rx": "1024"},
+			},
+		},
+	}
+
+	tests := []struct {
+		path    string
+		want    interface{}
+		wantErr bool
+	}{
+		{"vpn.state", "up", false},
+		{"vpn.peers.0.rx", "1024", false},
+		{"vpn.peers.1.rx", nil, true},
+		{"vpn.missing", nil, true},
+		{"vpn.state.deeper", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := lookupJSONPath(doc, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// externalCommandTestDir points externalCommandDir at a temp dir holding
+// links to the named system programs
+func externalCommandTestDir(t *testing.T, programs ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range programs {
+		target, err := exec.LookPath(name)
+		if err != nil {
+			t.Skipf("%s not found: %v", name, err)
+		}
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := externalCommandDir
+	externalCommandDir = dir
+	t.Cleanup(func() { externalCommandDir = prev })
+	return dir
+}
+
+func TestValidateExternalCollector(t *testing.T) {
+	dir := externalCommandTestDir(t)
+	wg := filepath.Join(dir, "wg")
+	tests := []struct {
+		name    string
+		def     ExternalCollectorConfig
+		wantErr string
+	}{
+		{"plain file", ExternalCollectorConfig{DataKey: "A", File: "/tmp/a"}, ""},
+		{"json command", ExternalCollectorConfig{DataKey: "A", Command: wg, Args: []string{"show", "wg0", "--json"}, Parser: "json", Path: "x"}, ""},
+		{"unsafe arg", ExternalCollectorConfig{DataKey: "A", Command: wg, Args: []string{"show", "$(reboot)"}}, "invalid argument"},
+		{"no data_key", ExternalCollectorConfig{File: "/tmp/a"}, "data_key"},
+		{"no source", ExternalCollectorConfig{DataKey: "A"}, "exactly one"},
+		{"both sources", ExternalCollectorConfig{DataKey: "A", File: "/tmp/a", Command: wg}, "exactly one"},
+		{"relative command", ExternalCollectorConfig{DataKey: "A", Command: "wg"}, "must be a program in"},
+		{"outside the dir", ExternalCollectorConfig{DataKey: "A", Command: "/bin/sh", Args: []string{"-c", "reboot"}}, "must be a program in"},
+		{"escapes the dir", ExternalCollectorConfig{DataKey: "A", Command: dir + "/../sh"}, "must be a program in"},
+		{"in a subdir", ExternalCollectorConfig{DataKey: "A", Command: filepath.Join(dir, "bin", "wg")}, "must be a program in"},
+		{"json without path", ExternalCollectorConfig{DataKey: "A", File: "/tmp/a", Parser: "json"}, "path"},
+		{"bad regex", ExternalCollectorConfig{DataKey: "A", File: "/tmp/a", Parser: "regex", Regex: "("}, "regex"},
+		{"unknown parser", ExternalCollectorConfig{DataKey: "A", File: "/tmp/a", Parser: "xml"}, "parser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExternalCollector(tt.def)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExternalCollectorParsers(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	state := write("state", "  connected\n")
+	status := write("status.json", `{"wg0": {"peers": [{"latency_ms": 42, "loss": 0.5}]}}`)
+	log := write("daemon.log", "uptime=12h restarts=3\n")
+
+	tests := []struct {
+		name     string
+		def      ExternalCollectorConfig
+		wantText string
+	}{
+		{"plain", ExternalCollectorConfig{DataKey: "ExtVpnState", File: state}, "connected"},
+		{"json int", ExternalCollectorConfig{DataKey: "ExtLatency", File: status, Parser: "json", Path: "wg0.peers.0.latency_ms"}, "42"},
+		{"json float", ExternalCollectorConfig{DataKey: "ExtLoss", File: status, Parser: "json", Path: "wg0.peers.0.loss"}, "0.5"},
+		{"regex group", ExternalCollectorConfig{DataKey: "ExtRestarts", File: log, Parser: "regex", Regex: `restarts=(\d+)`}, "3"},
+		{"regex match", ExternalCollectorConfig{DataKey: "ExtUptime", File: log, Parser: "regex", Regex: `\d+h`}, "12h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec, err := newExternalCollector(tt.def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ec.Collect(context.Background()); err != nil {
+				t.Fatalf("Collect: %v", err)
+			}
+			entry, ok := globalData.Get(tt.def.DataKey)
+			if !ok || entry.Text != tt.wantText || entry.Source != tt.def.DataKey {
+				t.Errorf("stored %+v, want text %q from source %q", entry, tt.wantText, tt.def.DataKey)
+			}
+		})
+	}
+
+	if v, _ := globalData.Int("ExtLatency"); v != 42 {
+		t.Errorf("json numbers should keep their type, got %v", v)
+	}
+}
+
+func TestExternalCollectorFailures(t *testing.T) {
+	bin := externalCommandTestDir(t, "sleep")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "up"), []byte("up"), 0644)
+
+	tests := []struct {
+		name    string
+		def     ExternalCollectorConfig
+		wantErr string
+	}{
+		{"missing file", ExternalCollectorConfig{DataKey: "ExtFail1", File: filepath.Join(dir, "nope")}, "no such file"},
+		{"regex miss", ExternalCollectorConfig{DataKey: "ExtFail2", File: filepath.Join(dir, "up"), Parser: "regex", Regex: "down"}, "did not match"},
+		{"not json", ExternalCollectorConfig{DataKey: "ExtFail3", File: filepath.Join(dir, "up"), Parser: "json", Path: "a"}, "parse json"},
+		{"timeout", ExternalCollectorConfig{DataKey: "ExtFail4", Command: filepath.Join(bin, "sleep"), Args: []string{"5"}, TimeoutSeconds: 0.1}, "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec, err := newExternalCollector(tt.def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ec.Collect(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Collect err = %v, want %q", err, tt.wantErr)
+			}
+			if entry, _ := globalData.Get(tt.def.DataKey); entry.Error == "" {
+				t.Error("failure not recorded in the data store")
+			}
+		})
+	}
+}
+
+func TestExternalCollectorCommand(t *testing.T) {
+	bin := externalCommandTestDir(t, "echo")
+	ec, err := newExternalCollector(ExternalCollectorConfig{DataKey: "ExtEcho", Command: filepath.Join(bin, "echo"), Args: []string{"vpn-up"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := globalData.String("ExtEcho"); got != "vpn-up" {
+		t.Errorf("ExtEcho = %q, want vpn-up", got)
+	}
+}
+
+func TestExternalCollectorKillsBackgroundChildren(t *testing.T) {
+	dir := externalCommandTestDir(t)
+	script := filepath.Join(dir, "fork")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 6 &\necho up\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := newExternalCollector(ExternalCollectorConfig{DataKey: "ExtFork", Command: script, TimeoutSeconds: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = ec.Collect(context.Background())
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("Collect blocked for %s on a child holding stdout", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Collect err = %v, want timed out", err)
+	}
+}
+
+func TestExternalCollectorsOnlyFromConfigJSON(t *testing.T) {
+	dft := Config{ExternalCollectors: []ExternalCollectorConfig{{DataKey: "VpnState", File: "/run/vpn"}}}
+	user := Config{ExternalCollectors: []ExternalCollectorConfig{{DataKey: "Extra", File: "/run/extra"}}}
+	got := overlayConfig(dft, user, false).ExternalCollectors
+	if len(got) != 1 || got[0].DataKey != "VpnState" {
+		t.Errorf("external collectors = %+v, want only config.json's", got)
+	}
+
+	app := apiV2TestApp(t)
+	body := `{"external_collectors": [{"data_key": "X", "command": "/bin/sh", "args": ["-c", "reboot"]}]}`
+	for _, method := range []string{"PUT", "PATCH"} {
+		if status, resp := apiCall(t, app, method, "/api/v2/config/user", body); status != 422 {
+			t.Errorf("%s /config/user = %d %v", method, status, resp)
+		}
+	}
+	if status, resp := apiCall(t, app, "PUT", "/api/v2/profiles/evil", body); status != 422 {
+		t.Errorf("PUT /profiles/evil = %d %v", status, resp)
+	}
+	if _, err := importBundle(zipFiles(t, map[string]string{bundleConfigName: body}), ""); err == nil {
+		t.Error("a bundle with external collectors was imported")
+	}
+	if _, err := validateUserConfig([]byte(body)); err == nil {
+		t.Error("the v1 save path would take external collectors")
+	}
+
+	// ones left in an older user config are dropped on the next write
+	os.WriteFile(userConfigFile, []byte(body), 0644)
+	if status, resp := apiCall(t, app, "PATCH", "/api/v2/config/user", `{"show_sms": false}`); status != 200 {
+		t.Errorf("PATCH over a legacy user config = %d %v", status, resp)
+	}
+}
+
+func TestAddExternalCollectorsSkipsBadAndDuplicate(t *testing.T) {
+	s := NewCollectorScheduler()
+	for _, c := range builtinCollectors() {
+		s.Add(c)
+	}
+	addExternalCollectors(s, []ExternalCollectorConfig{
+		{DataKey: "Good", File: "/run/good"},
+		{DataKey: "Bad"},
+		{Name: "battery", DataKey: "Clash", File: "/run/clash"},
+	})
+
+	var names []string
+	for _, h := range s.Health() {
+		names = append(names, h.Name)
+	}
+	if got := strings.Join(names, ","); got != "battery,linux,network,pcat_web,wan_speed,Good" {
+		t.Errorf("scheduled %s", got)
+	}
+}
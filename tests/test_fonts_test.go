@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+)
+
+// fontTestAssets is an assets dir with Orbitron, which has no Cyrillic, and
+// Go Mono, which has
+func fontTestAssets(t *testing.T) {
+	t.Helper()
+	repoRoot := "."
+	if _, err := os.Stat("../assets"); err == nil {
+		repoRoot = ".."
+	}
+	orbitron, err := os.ReadFile(filepath.Join(repoRoot, "assets/fonts/Orbitron-ExtraBold.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundleTestAssets(t, map[string]string{
+		"assets/fonts/Orbitron-ExtraBold.ttf": string(orbitron),
+		"assets/fonts/GoMono.ttf":             string(gomono.TTF),
+	})
+	t.Cleanup(initFonts)
+}
+
+func TestBuildFontTable(t *testing.T) {
+	fontTestAssets(t)
+	tests := []struct {
+		name    string
+		defs    map[string]FontDef
+		wantErr string
+	}{
+		{"new font", map[string]FontDef{"cyr": {Path: "assets/fonts/GoMono.ttf", Size: 16}}, ""},
+		{"extend a built-in", map[string]FontDef{"reg": {Fallback: []string{"cyr", "cjk"}}, "cyr": {Path: "assets/fonts/GoMono.ttf", Size: 16}}, ""},
+		{"weight", map[string]FontDef{"cyr": {Path: "assets/fonts/GoMono.ttf", Size: 16, Weight: "regular"}}, ""},
+		{"no size", map[string]FontDef{"cyr": {Path: "assets/fonts/GoMono.ttf"}}, "needs a path and a size"},
+		{"missing file", map[string]FontDef{"cyr": {Path: "assets/fonts/none.ttf", Size: 16}}, "not found"},
+		{"not a font", map[string]FontDef{"cyr": {Path: "assets/svg/x.svg", Size: 16}}, "must end in"},
+		{"unknown fallback", map[string]FontDef{"reg": {Fallback: []string{"comic"}}}, `"comic" is not another font`},
+		{"own fallback", map[string]FontDef{"reg": {Fallback: []string{"reg"}}}, "not another font"},
+		{"hinting", map[string]FontDef{"reg": {Hinting: "slight"}}, "full, vertical or none"},
+		{"missing weight", map[string]FontDef{"cyr": {Path: "assets/fonts/GoMono.ttf", Size: 16, Weight: "Bold"}}, "no Bold face"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := buildFontTable(tt.defs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("buildFontTable = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table["cyr"].FontSize != 16 || table["big"].FontSize != 25 {
+				t.Errorf("cyr = %+v, big = %+v", table["cyr"], table["big"])
+			}
+		})
+	}
+}
+
+func TestMergeFontDefs(t *testing.T) {
+	base := map[string]FontDef{"cyr": {Path: "assets/fonts/GoMono.ttf", Size: 16, Fallback: []string{"cjk"}}}
+	got := mergeFontDefs(base, map[string]FontDef{"cyr": {Size: 20}, "reg": {Hinting: "none"}})
+	if c := got["cyr"]; c.Path != "assets/fonts/GoMono.ttf" || c.Size != 20 || len(c.Fallback) != 1 {
+		t.Errorf("cyr = %+v", c)
+	}
+	if got["reg"].Hinting != "none" || base["cyr"].Size != 16 {
+		t.Errorf("merged = %+v, base = %+v", got, base)
+	}
+}
+
+func TestFontFallback(t *testing.T) {
+	fontTestAssets(t)
+	table, err := buildFontTable(map[string]FontDef{
+		"orb":     {Path: "assets/fonts/Orbitron-ExtraBold.ttf", Size: 18},
+		"cyr":     {Path: "assets/fonts/GoMono.ttf", Size: 10},
+		"orb_cyr": {Path: "assets/fonts/Orbitron-ExtraBold.ttf", Size: 18, Fallback: []string{"cyr"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFonts(table)
+
+	plain, _, err := getFontFace("orb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := plain.GlyphAdvance('Ж'); ok {
+		t.Fatal("Orbitron should have no Cyrillic for this test to mean anything")
+	}
+	face, height, err := getFontFace("orb_cyr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := face.GlyphAdvance('Ж'); !ok {
+		t.Error("the fallback should provide Cyrillic")
+	}
+	_, plainHeight, _ := getFontFace("orb")
+	if height != plainHeight {
+		t.Errorf("line height %d, want the primary font's %d", height, plainHeight)
+	}
+	// Latin stays Orbitron
+	if got, want := font.MeasureString(face, "ISP"), font.MeasureString(plain, "ISP"); got != want {
+		t.Errorf("ISP is %v wide, %v in Orbitron", got, want)
+	}
+	if font.MeasureString(face, "Билайн") <= font.MeasureString(plain, "Билайн")/2 {
+		t.Error("Cyrillic should be measured with the fallback glyphs")
+	}
+}
+
+func TestConfigFonts(t *testing.T) {
+	app := apiV2TestApp(t)
+	fontTestAssets(t)
+
+	user := `{"fonts": {"cyr": {"path": "assets/fonts/GoMono.ttf", "size": 14}, "reg": {"fallback": ["cyr"]}},
+		"display_template": {"elements": {"page0": [
+			{"type": "fixed_text", "label": "Билайн", "font": "cyr", "position": {"x": 10, "y": 10}, "enable": 1}]}}}`
+	if status, body := apiCall(t, app, "PUT", "/api/v2/config/user", user); status != 200 {
+		t.Fatalf("PUT /config/user = %d %v", status, body)
+	}
+	if f, ok := lookupFont("cyr"); !ok || f.FontSize != 14 {
+		t.Errorf("cyr = %+v, %v", f, ok)
+	}
+	if f, _ := lookupFont("reg"); len(f.Fallback) != 1 || f.Fallback[0] != "cyr" {
+		t.Errorf("reg fallback = %v", f.Fallback)
+	}
+
+	bad := `{"fonts": {"reg": {"fallback": ["comic"]}}}`
+	if status, body := apiCall(t, app, "PUT", "/api/v2/config/user", bad); status != 422 {
+		t.Errorf("unknown fallback = %d %v", status, body)
+	}
+	if _, ok := lookupFont("cyr"); !ok {
+		t.Error("a rejected config should leave the fonts alone")
+	}
+}
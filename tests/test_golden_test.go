@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/gomono"
+)
+
+// Golden-image tests render fixed data through the real drawing code and diff the
+// result against PNGs committed in golden/. After an intended visual change run
+//
+//	go test ./tests/ -run TestGolden -update-golden
+//
+// and review the rewritten PNGs before committing them.
+var updateGolden = flag.Bool("update-golden", false, "rewrite golden PNGs instead of comparing against them")
+
+const (
+	goldenDir = "golden"
+	// a pixel counts as different when any channel is off by more than this
+	goldenChannelTolerance = 24
+	// fraction of differing pixels allowed before a golden test fails
+	goldenMaxDiffRatio = 0.002
+)
+
+// goldenTime is the fixed clock for top bar and SMS timestamps
+var goldenTime = time.Date(2025, 6, 15, 14, 30, 0, 0, time.Local)
+
+// setupGolden points the renderer at the repo assets and config, loads the
+// fixture data snapshot into globalData and pins the clock.
+func setupGolden(t *testing.T) {
+	t.Helper()
+
+	repoRoot := "."
+	if _, err := os.Stat("../assets"); err == nil {
+		repoRoot = ".."
+	}
+
+	savedPrefix, savedCfg, savedNow := assetsPrefix, cfg, timeNow
+	t.Cleanup(func() {
+		assetsPrefix, cfg, timeNow = savedPrefix, savedCfg, savedNow
+		cacheTopBarStr, cacheFooterStr = "", ""
+	})
+
+	assetsPrefix = repoRoot
+	initFonts()
+	imageCache = make(map[string]*image.RGBA)
+	timeNow = func() time.Time { return goldenTime }
+	cacheTopBarStr, cacheFooterStr = "", ""
+
+	loaded, err := loadConfig(filepath.Join(repoRoot, "config.json"))
+	if err != nil {
+		t.Fatalf("load config.json: %v", err)
+	}
+	cfg = loaded
+
+	powerData.mu.Lock()
+	powerData.Samples = powerData.Samples[:0]
+	powerData.mu.Unlock()
+
+	loadGoldenData(t, "fixtures/golden_data.json")
+}
+
+// loadGoldenData replaces globalData with the snapshot in path.
+func loadGoldenData(t *testing.T, path string) {
+	t.Helper()
+	snapshot, err := loadDataSnapshot(path)
+	if err != nil {
+		t.Fatalf("load %s: %v", path, err)
+	}
+
+	globalData.Reset()
+	for key, value := range snapshot {
+		globalData.Store(key, value)
+	}
+}
+
+// compareGolden diffs img against golden/<name>.png, or rewrites it in update mode.
+func compareGolden(t *testing.T, name string, img image.Image) {
+	t.Helper()
+	path := filepath.Join(goldenDir, name+".png")
+
+	if *updateGolden {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("updated %s", path)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("missing golden %s (run with -update-golden to create it): %v", path, err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+
+	if want.Bounds().Size() != img.Bounds().Size() {
+		t.Fatalf("%s: size %v, golden is %v", name, img.Bounds().Size(), want.Bounds().Size())
+	}
+
+	diff := 0
+	total := img.Bounds().Dx() * img.Bounds().Dy()
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			r1, g1, b1, a1 := img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y).RGBA()
+			r2, g2, b2, a2 := want.At(want.Bounds().Min.X+x, want.Bounds().Min.Y+y).RGBA()
+			if channelDiff(r1, r2) || channelDiff(g1, g2) || channelDiff(b1, b2) || channelDiff(a1, a2) {
+				diff++
+			}
+		}
+	}
+
+	if ratio := float64(diff) / float64(total); ratio > goldenMaxDiffRatio {
+		actual := filepath.Join(os.TempDir(), "golden-actual-"+name+".png")
+		if out, err := os.Create(actual); err == nil {
+			png.Encode(out, img)
+			out.Close()
+		}
+		t.Errorf("%s: %d of %d pixels differ (%.2f%%), actual output written to %s",
+			name, diff, total, ratio*100, actual)
+	}
+}
+
+func channelDiff(a, b uint32) bool {
+	d := int(a>>8) - int(b>>8)
+	if d < 0 {
+		d = -d
+	}
+	return d > goldenChannelTolerance
+}
+
+func TestGoldenRenderMiddle(t *testing.T) {
+	setupGolden(t)
+
+	numPages := len(cfg.DisplayTemplate.Elements)
+	if numPages == 0 {
+		t.Fatal("config.json has no pages")
+	}
+
+	for i := 0; i < numPages; i++ {
+		t.Run(fmt.Sprintf("page%d", i), func(t *testing.T) {
+			frame := image.NewRGBA(image.Rect(0, 0, middleFrameWidth, middleFrameHeight))
+			clearFrame(frame, middleFrameWidth, middleFrameHeight)
+			renderMiddle(frame, &cfg, false, i)
+			compareGolden(t, fmt.Sprintf("middle_page%d", i), frame)
+		})
+	}
+}
+
+func TestGoldenTopBar(t *testing.T) {
+	setupGolden(t)
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"topbar_5g_battery", nil},
+		{"topbar_4g_weak_signal", map[string]interface{}{"Carrier": "4G", "ModemSignalStrength": 20, "BatterySoc": 15}},
+		{"topbar_wired_charging", map[string]interface{}{"GatewayDevice": "wired", "BatteryCharging": true, "BatterySoc": 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadGoldenData(t, "fixtures/golden_data.json")
+			for k, v := range tt.data {
+				globalData.Store(k, v)
+			}
+			cacheTopBarStr = ""
+
+			frame := image.NewRGBA(image.Rect(0, 0, topBarFrameWidth, topBarFrameHeight))
+			drawTopBar(NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT), frame)
+			compareGolden(t, tt.name, frame)
+		})
+	}
+}
+
+func TestGoldenFooter(t *testing.T) {
+	setupGolden(t)
+
+	tests := []struct {
+		name     string
+		currPage int
+		numPages int
+		isSMS    bool
+	}{
+		{"footer_page1_of_4", 0, 4, false},
+		{"footer_page3_of_4", 2, 4, false},
+		{"footer_sms_2_of_3", 1, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheFooterStr = ""
+			frame := image.NewRGBA(image.Rect(0, 0, footerFrameWidth, footerFrameHeight))
+			drawFooter(NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT), frame, tt.currPage, tt.numPages, tt.isSMS)
+			compareGolden(t, tt.name, frame)
+		})
+	}
+}
+
+func TestGoldenSmsPages(t *testing.T) {
+	setupGolden(t)
+
+	// The CJK font is installed on the device but not shipped in the repo, so the
+	// golden SMS pages are rendered with Go Mono; layout, paging and colours are
+	// what this test guards.
+	fontRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(fontRoot, "assets", "fonts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fontRoot, "assets", "fonts", "GoMono.ttf"), gomono.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	savedFont := smsFontFile
+	defer func() { smsFontFile = savedFont }()
+	assetsPrefix = fontRoot
+	smsFontFile = "GoMono.ttf"
+
+	raw, err := os.ReadFile("fixtures/golden_sms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imgs, err := drawSmsFrJson(string(raw), false, true)
+	if err != nil {
+		t.Fatalf("drawSmsFrJson: %v", err)
+	}
+	if len(imgs) < 2 {
+		t.Fatalf("expected the fixture to paginate over several pages, got %d", len(imgs))
+	}
+
+	for i, img := range imgs {
+		compareGolden(t, fmt.Sprintf("sms_page%d", i), img)
+	}
+}
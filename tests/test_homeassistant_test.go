@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func (f *fakeMQTTClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribed == nil {
+		f.subscribed = map[string]mqtt.MessageHandler{}
+	}
+	f.subscribed[topic] = callback
+	return &mqtt.DummyToken{}
+}
+
+// fakeMessage is an incoming message with just a topic and payload
+type fakeMessage struct {
+	mqtt.Message
+	topic   string
+	payload string
+}
+
+func (m fakeMessage) Topic() string   { return m.topic }
+func (m fakeMessage) Payload() []byte { return []byte(m.payload) }
+
+func TestHomeAssistantDiscovery(t *testing.T) {
+	p := newMQTTPublisher(MQTTConfig{ClientID: "pcat2.van", TopicPrefix: "pcat", HomeAssistant: true})
+	discovery := p.haDiscovery()
+
+	tests := []struct {
+		topic       string
+		stateTopic  string
+		deviceClass string
+		unit        string
+	}{
+		{"homeassistant/sensor/pcat2_van/batterysoc/config", "pcat/data/BatterySoc", "battery", "%"},
+		{"homeassistant/binary_sensor/pcat2_van/batterycharging/config", "pcat/data/BatteryCharging", "battery_charging", ""},
+		{"homeassistant/sensor/pcat2_van/batterywattage/config", "pcat/data/BatteryWattage", "power", "W"},
+		{"homeassistant/sensor/pcat2_van/modemsignalstrength/config", "pcat/data/ModemSignalStrength", "", "%"},
+		{"homeassistant/sensor/pcat2_van/dailydatausage/config", "pcat/data/DailyDataUsage", "data_size", "GB"},
+		{"homeassistant/sensor/pcat2_van/monthlydatausage/config", "pcat/data/MonthlyDataUsage", "data_size", "GB"},
+		{"homeassistant/sensor/pcat2_van/ping0/config", "pcat/data/Ping0", "duration", "ms"},
+		{"homeassistant/sensor/pcat2_van/ping1/config", "pcat/data/Ping1", "duration", "ms"},
+		{"homeassistant/sensor/pcat2_van/cputemp/config", "pcat/data/CpuTemp", "temperature", "°C"},
+		{"homeassistant/sensor/pcat2_van/fanrpm/config", "pcat/data/FanRPM", "", "RPM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stateTopic, func(t *testing.T) {
+			conf, ok := discovery[tt.topic]
+			if !ok {
+				t.Fatalf("no discovery payload on %s", tt.topic)
+			}
+			if conf["state_topic"] != tt.stateTopic {
+				t.Errorf("state_topic = %v", conf["state_topic"])
+			}
+			if dc, _ := conf["device_class"].(string); dc != tt.deviceClass {
+				t.Errorf("device_class = %q, want %q", dc, tt.deviceClass)
+			}
+			if unit, _ := conf["unit_of_measurement"].(string); unit != tt.unit {
+				t.Errorf("unit = %q, want %q", unit, tt.unit)
+			}
+			if conf["availability_topic"] != "pcat/status" {
+				t.Errorf("availability_topic = %v", conf["availability_topic"])
+			}
+		})
+	}
+
+	commands := map[string]string{
+		"homeassistant/button/pcat2_van/next_page/config":  "pcat/cmd/change_page",
+		"homeassistant/text/pcat2_van/show_text/config":    "pcat/cmd/show_text",
+		"homeassistant/button/pcat2_van/resume/config":     "pcat/cmd/resume",
+		"homeassistant/number/pcat2_van/brightness/config": "pcat/cmd/brightness",
+	}
+	for topic, cmd := range commands {
+		if got := discovery[topic]["command_topic"]; got != cmd {
+			t.Errorf("%s command_topic = %v, want %s", topic, got, cmd)
+		}
+	}
+}
+
+func TestHomeAssistantPublishAndSubscribe(t *testing.T) {
+	fake := newFakeMQTTClient()
+	p := newMQTTPublisher(MQTTConfig{ClientID: "pcat2-test", TopicPrefix: "pcat", DiscoveryPrefix: "ha/", HomeAssistant: true})
+	p.client = fake
+	p.publishDiscovery()
+	p.subscribeHomeAssistant(fake)
+
+	raw, ok := fake.retained["ha/sensor/pcat2-test/batterysoc/config"]
+	if !ok {
+		t.Fatal("discovery should be retained under the configured prefix")
+	}
+	var conf map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &conf); err != nil {
+		t.Fatalf("discovery payload: %v", err)
+	}
+	device, _ := conf["device"].(map[string]interface{})
+	if ids, _ := device["identifiers"].([]interface{}); len(ids) != 1 || ids[0] != "pcat2-test" {
+		t.Errorf("device identifiers = %v", device["identifiers"])
+	}
+	for _, topic := range []string{"pcat/cmd/+", "ha/status"} {
+		if _, ok := fake.subscribed[topic]; !ok {
+			t.Errorf("not subscribed to %s", topic)
+		}
+	}
+}
+
+func TestHomeAssistantBrightnessCommand(t *testing.T) {
+	virtualMode = true
+	c := cfg
+	t.Cleanup(func() { cfg = c })
+	cfg.ScreenMinBrightness = 10
+	cfg.ScreenMaxBrightness = 100
+
+	fake := newFakeMQTTClient()
+	p := newMQTTPublisher(MQTTConfig{ClientID: "pcat2-test", TopicPrefix: "pcat", HomeAssistant: true})
+	p.client = fake
+	p.subscribeHomeAssistant(fake)
+	handler := fake.subscribed["pcat/cmd/+"]
+
+	tests := []struct {
+		payload string
+		want    int
+	}{
+		{"55", 55},
+		{" 80.0 ", 80},
+		{"3", 10}, // clamped to the configured minimum
+		{"bright", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			handler(fake, fakeMessage{topic: "pcat/cmd/brightness", payload: tt.payload})
+			mu.Lock()
+			got := lastLogical
+			mu.Unlock()
+			if got != tt.want {
+				t.Errorf("backlight = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// unknown commands are logged and ignored
+	handler(fake, fakeMessage{topic: "pcat/cmd/reboot", payload: "now"})
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for topic := range fake.count {
+		if strings.Contains(topic, "reboot") {
+			t.Errorf("unexpected publish on %s", topic)
+		}
+	}
+}
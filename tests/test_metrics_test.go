@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram(0.1, 0.5, 1)
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		h.observe(v)
+	}
+	w := newMetricsWriter(false)
+	w.histogram("x_seconds", "", h)
+	out := string(w.bytes())
+
+	for _, want := range []string{
+		`x_seconds_bucket{le="0.1"} 2`,
+		`x_seconds_bucket{le="0.5"} 3`,
+		`x_seconds_bucket{le="1"} 3`,
+		`x_seconds_bucket{le="+Inf"} 4`,
+		"x_seconds_sum 2.45",
+		"x_seconds_count 4",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsWriterFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		openMetrics bool
+		want        []string
+		notWant     []string
+	}{
+		{"prometheus text", false,
+			[]string{"# TYPE pcat2_runs_total counter\n", "pcat2_runs_total 3\n", `pcat2_info{v="a\"b\\c"} 1`},
+			[]string{"# EOF"}},
+		{"openmetrics", true,
+			[]string{"# TYPE pcat2_runs counter\n", "pcat2_runs_total 3\n", "# EOF\n"},
+			[]string{"# TYPE pcat2_runs_total"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newMetricsWriter(tt.openMetrics)
+			w.counter("pcat2_runs", "Runs.", nil, 3)
+			w.gauge("pcat2_info", "", []string{"v", `a"b\c`}, 1)
+			out := string(w.bytes())
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in\n%s", want, out)
+				}
+			}
+			for _, bad := range tt.notWant {
+				if strings.Contains(out, bad) {
+					t.Errorf("unexpected %q in\n%s", bad, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDataMetrics(t *testing.T) {
+	globalData.Reset()
+	t.Cleanup(globalData.Reset)
+	globalData.Source("battery").Store("BatterySoc", 76)
+	globalData.Source("battery").Store("BatteryCharging", true)
+	globalData.Source("linux").Store("BatteryVoltage", "7.71")
+	globalData.Source("linux").Store("MemUsage", "1.5/4")
+	globalData.Source("linux").Store("DiskData", map[string]interface{}{"Total": 100, "Free": 60, "Used": 40})
+	globalData.Source("network").Store("Ping0", 25)
+	globalData.Source("network").Store("Ping1", int64(-1))
+	globalData.Source("network").Store("Ping0Rate", "90")
+	globalData.Source("network").Store("DailyDataUsage", "2.00")
+	globalData.Source("wan_speed").Store("WanDOWN", "12.5")
+	globalData.Source("api").Store("SolarWatts", 42.5)
+	globalData.Source("api").Store("Greeting", "hello")
+
+	// a reading older than its threshold is dropped, not exported as a flat line
+	globalData.Source("battery").Store("BatteryWattage", 3.2)
+	backdate(globalData, "BatteryWattage", time.Hour)
+
+	w := newMetricsWriter(false)
+	writeDataMetrics(w)
+	out := string(w.bytes())
+
+	tests := []struct {
+		sample string
+		want   bool
+	}{
+		{"pcat2_battery_soc_percent 76", true},
+		{"pcat2_battery_charging 1", true},
+		{"pcat2_battery_voltage_volts 7.71", true},
+		{"pcat2_memory_used_bytes 1.610612736e+09", true},
+		{"pcat2_memory_total_bytes 4.294967296e+09", true},
+		{`pcat2_disk_bytes{kind="free"} 6.291456e+07`, true},
+		{`pcat2_ping_rtt_seconds{site="0"} 0.025`, true},
+		{`pcat2_ping_rtt_seconds{site="1"}`, false},
+		{`pcat2_ping_success_ratio{site="0"} 0.9`, true},
+		{`pcat2_data_usage_bytes{period="day"} 2.147483648e+09`, true},
+		{`pcat2_wan_speed_bits_per_second{direction="down"} 1.25e+07`, true},
+		{`pcat2_data{key="SolarWatts",unit=""} 42.5`, true},
+		{`key="Greeting"`, false},
+		{"pcat2_battery_power_watts 3.2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sample, func(t *testing.T) {
+			if got := strings.Contains(out, tt.sample); got != tt.want {
+				t.Errorf("contains = %v, want %v\n%s", got, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestRenderStatsButtonLatency(t *testing.T) {
+	s := NewRenderStats()
+	base := time.Now()
+
+	// the press belongs to the first change only
+	s.observePageChange(base.Add(50*time.Millisecond), base.Add(250*time.Millisecond), base, []int{10000, 12000})
+	s.observePageChange(base.Add(time.Second), base.Add(1200*time.Millisecond), base, nil)
+
+	if s.pageChanges != 2 || s.pageChange.count != 2 {
+		t.Errorf("page changes = %d, histogram count %d", s.pageChanges, s.pageChange.count)
+	}
+	if s.buttonLatency.count != 1 || s.buttonLatency.sum != 0.25 {
+		t.Errorf("button latency count %d sum %v, want 1 and 0.25", s.buttonLatency.count, s.buttonLatency.sum)
+	}
+	if s.transitionFrame.count != 2 {
+		t.Errorf("transition frames = %d", s.transitionFrame.count)
+	}
+}
+
+func TestDisplayMetrics(t *testing.T) {
+	saved := displayWrapper
+	t.Cleanup(func() { displayWrapper = saved })
+	displayWrapper = NewDisplayWrapper(NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT))
+
+	w := newMetricsWriter(false)
+	writeDisplayMetrics(w)
+	out := string(w.bytes())
+	if !strings.Contains(out, "# TYPE pcat2_display_spi_config gauge\n") || !strings.Contains(out, `pcat2_display_spi_config{transfer_strategy=`) {
+		t.Errorf("no SPI config gauge in\n%s", out)
+	}
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "# TYPE pcat2_display_") {
+			continue
+		}
+		name := strings.Fields(line)[2]
+		if i == 0 || !strings.HasPrefix(lines[i-1], "# HELP "+name+" ") {
+			t.Errorf("%s has no HELP", name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeMQTTClient records retained publishes and subscriptions; everything else is left unimplemented
+type fakeMQTTClient struct {
+	mqtt.Client
+
+	mu       sync.Mutex
+	retained map[string]string
+	count    map[string]int
+	qos      map[string]byte
+
+	subscribed map[string]mqtt.MessageHandler
+}
+
+func newFakeMQTTClient() *fakeMQTTClient {
+	return &fakeMQTTClient{retained: map[string]string{}, count: map[string]int{}, qos: map[string]byte{}}
+}
+
+func (f *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if retained {
+		f.retained[topic] = payload.(string)
+	}
+	f.count[topic]++
+	f.qos[topic] = qos
+	return &mqtt.DummyToken{}
+}
+
+func (f *fakeMQTTClient) IsConnectionOpen() bool { return true }
+
+func TestValidateMQTTConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    MQTTConfig
+		wantErr bool
+	}{
+		{"disabled needs nothing", MQTTConfig{}, false},
+		{"enabled", MQTTConfig{Enabled: true, Broker: "tcp://127.0.0.1:1883", QoS: 1}, false},
+		{"no broker", MQTTConfig{Enabled: true}, true},
+		{"bad qos", MQTTConfig{Enabled: true, Broker: "tcp://b:1883", QoS: 3}, true},
+		{"wildcard prefix", MQTTConfig{Enabled: true, Broker: "tcp://b:1883", TopicPrefix: "pcat/#"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMQTTConfig(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMQTTPublisherTopics(t *testing.T) {
+	p := newMQTTPublisher(MQTTConfig{ClientID: "pcat2-test"})
+	if got := p.keyTopic("BatterySoc"); got != "photonicat2/pcat2-test/data/BatterySoc" {
+		t.Errorf("default key topic = %s", got)
+	}
+
+	p = newMQTTPublisher(MQTTConfig{TopicPrefix: "site/van1/"})
+	tests := map[string]string{
+		"BatterySoc": "site/van1/data/BatterySoc",
+		"a/b":        "site/van1/data/a_b",
+		"x+#":        "site/van1/data/x__",
+	}
+	for key, want := range tests {
+		if got := p.keyTopic(key); got != want {
+			t.Errorf("keyTopic(%q) = %s, want %s", key, got, want)
+		}
+	}
+	if p.statusTopic() != "site/van1/status" || p.bundleTopic() != "site/van1/data" {
+		t.Errorf("status %s, bundle %s", p.statusTopic(), p.bundleTopic())
+	}
+}
+
+func TestMQTTPublishData(t *testing.T) {
+	globalData.Reset()
+	t.Cleanup(globalData.Reset)
+	globalData.Store("BatterySoc", 76)
+	globalData.Store("BatteryVoltage", "7.71")
+	globalData.Store("DHCPClients", []string{"phone", "laptop"})
+	globalData.StoreError("CpuTemp", errors.New("no sensor"))
+
+	fake := newFakeMQTTClient()
+	p := newMQTTPublisher(MQTTConfig{TopicPrefix: "pcat", QoS: 1})
+	p.client = fake
+	p.publishData()
+
+	want := map[string]string{
+		"pcat/data/BatterySoc":     "76",
+		"pcat/data/BatteryVoltage": "7.71",
+		"pcat/data/DHCPClients":    `["phone","laptop"]`,
+	}
+	for topic, payload := range want {
+		if got := fake.retained[topic]; got != payload {
+			t.Errorf("%s = %q, want %q", topic, got, payload)
+		}
+		if fake.qos[topic] != 1 {
+			t.Errorf("%s published with qos %d", topic, fake.qos[topic])
+		}
+	}
+	if _, ok := fake.retained["pcat/data/CpuTemp"]; ok {
+		t.Error("a key without a reading should not be published")
+	}
+
+	var bundle map[string]interface{}
+	if err := json.Unmarshal([]byte(fake.retained["pcat/data"]), &bundle); err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+	if bundle["BatterySoc"] != float64(76) || bundle["BatteryVoltage"] != 7.71 {
+		t.Errorf("bundle = %v", bundle)
+	}
+	if v, ok := bundle["CpuTemp"]; !ok || v != nil {
+		t.Errorf("bundle CpuTemp = %v, want null", v)
+	}
+
+	// only changed keys are sent again; the bundle always is
+	globalData.Store("BatterySoc", 75)
+	p.publishData()
+	if fake.count["pcat/data/BatterySoc"] != 2 || fake.retained["pcat/data/BatterySoc"] != "75" {
+		t.Errorf("changed key: %d publishes, last %q", fake.count["pcat/data/BatterySoc"], fake.retained["pcat/data/BatterySoc"])
+	}
+	if fake.count["pcat/data/BatteryVoltage"] != 1 {
+		t.Errorf("unchanged key published %d times", fake.count["pcat/data/BatteryVoltage"])
+	}
+	if fake.count["pcat/data"] != 2 {
+		t.Errorf("bundle published %d times", fake.count["pcat/data"])
+	}
+}
+
+func TestMQTTClientOptions(t *testing.T) {
+	p := newMQTTPublisher(MQTTConfig{Broker: "tcp://127.0.0.1:1883", Username: "u", Password: "p", TopicPrefix: "pcat", QoS: 2})
+	opts := p.clientOptions()
+
+	if !opts.WillEnabled || opts.WillTopic != "pcat/status" || string(opts.WillPayload) != "offline" || !opts.WillRetained || opts.WillQos != 2 {
+		t.Errorf("last will = %v %s %q retained=%v qos=%d", opts.WillEnabled, opts.WillTopic, opts.WillPayload, opts.WillRetained, opts.WillQos)
+	}
+	if opts.Username != "u" || opts.Password != "p" || !strings.HasPrefix(opts.ClientID, "pcat2-") {
+		t.Errorf("auth %s/%s, client id %s", opts.Username, opts.Password, opts.ClientID)
+	}
+	if !opts.AutoReconnect || !opts.ConnectRetry {
+		t.Error("the publisher must keep retrying an unreachable broker")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPageTargetResolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      pageTarget
+		curr, total int
+		wantNext    int
+		wantReverse bool
+	}{
+		{"next", pageTarget{step: 1}, 1, 4, 2, false},
+		{"next wraps", pageTarget{step: 1}, 3, 4, 0, false},
+		{"previous", pageTarget{step: -1}, 2, 4, 1, true},
+		{"previous wraps", pageTarget{step: -1}, 0, 4, 3, true},
+		{"jump forward", pageTarget{index: 3}, 1, 4, 3, false},
+		{"jump back", pageTarget{index: 0}, 2, 4, 0, true},
+		{"no pages", pageTarget{step: 1}, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, reverse := tt.target.resolve(tt.curr, tt.total)
+			if next != tt.wantNext || reverse != tt.wantReverse {
+				t.Errorf("resolve(%d, %d) = %d, %t, want %d, %t", tt.curr, tt.total, next, reverse, tt.wantNext, tt.wantReverse)
+			}
+		})
+	}
+}
+
+func TestPinnedPage(t *testing.T) {
+	t.Cleanup(func() { setPagePinned(false); takePageTarget(false) })
+
+	setPagePinned(true)
+	if _, ok := takePageTarget(true); ok {
+		t.Error("a button press should not move a pinned page")
+	}
+	requestPage(pageTarget{index: 2})
+	if target, ok := takePageTarget(true); !ok || target.index != 2 {
+		t.Errorf("an API jump should go through while pinned, got %+v, %t", target, ok)
+	}
+	if pageChangePending() {
+		t.Error("the jump should be taken only once")
+	}
+
+	setPagePinned(false)
+	if target, ok := takePageTarget(true); !ok || target.step != 1 {
+		t.Errorf("a button press should step forward, got %+v, %t", target, ok)
+	}
+}
+
+func TestDisplayPageAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	savedCurr, savedTotal, savedCfgPages := currPageIdx, totalNumPages, cfgNumPages
+	t.Cleanup(func() {
+		currPageIdx, totalNumPages, cfgNumPages = savedCurr, savedTotal, savedCfgPages
+		setPagePinned(false)
+		takePageTarget(false)
+	})
+	text := func(key string) DisplayElement {
+		return DisplayElement{Type: "text", DataKey: key, Font: "reg", UnitsFont: "unit", Enable: 1}
+	}
+	dftCfg.DisplayTemplate.Elements = map[string][]DisplayElement{
+		"page0": {text("A")},
+		"page1": {text("B")},
+		"page2": {text("C")},
+	}
+	dftCfg.DisplayTemplate.Pages = []PageMeta{{ID: "page2"}, {ID: "page0"}, {ID: "page1"}}
+	mergeConfigs()
+	currPageIdx, totalNumPages = 0, cfgNumPages
+
+	steps := []struct {
+		method, target, body string
+		wantStatus           int
+		wantIndex            float64 // -1 when no jump is queued
+	}{
+		{"PUT", "/api/v2/display/page", `{"id": "page0"}`, 200, 1},
+		{"PUT", "/api/v2/display/page", `{"index": 2}`, 200, 2},
+		{"PUT", "/api/v2/display/page", `{"index": 7}`, 404, -1},
+		{"PUT", "/api/v2/display/page", `{"id": "page9"}`, 404, -1},
+		{"PUT", "/api/v2/display/page", `{"sms": true}`, 409, -1},
+		{"PUT", "/api/v2/display/page", `{}`, 400, -1},
+		{"PUT", "/api/v2/display/page", `{"index": 0}`, 200, -1}, // already there
+	}
+	for _, s := range steps {
+		status, body := apiCall(t, app, s.method, s.target, s.body)
+		if status != s.wantStatus {
+			t.Errorf("%s %s %s = %d %v, want %d", s.method, s.target, s.body, status, body, s.wantStatus)
+		}
+		target, ok := takePageTarget(false)
+		if s.wantIndex < 0 && ok || s.wantIndex >= 0 && (!ok || float64(target.index) != s.wantIndex) {
+			t.Errorf("%s %s %s queued %+v, %t, want index %v", s.method, s.target, s.body, target, ok, s.wantIndex)
+		}
+	}
+
+	status, body := apiCall(t, app, "GET", "/api/v2/display/page", "")
+	if status != 200 || body["id"] != "page2" || body["pinned"] != false {
+		t.Errorf("GET /api/v2/display/page = %d %v", status, body)
+	}
+	apiCall(t, app, "PUT", "/api/v2/display/pin", "")
+	if !isPagePinned() {
+		t.Error("PUT /api/v2/display/pin should pin the page")
+	}
+	apiCall(t, app, "DELETE", "/api/v2/display/pin", "")
+	if isPagePinned() {
+		t.Error("DELETE /api/v2/display/pin should unpin the page")
+	}
+
+	apiCall(t, app, "POST", "/api/v2/display/previous-page", "")
+	if target, ok := takePageTarget(false); !ok || target.step != -1 {
+		t.Errorf("previous-page queued %+v, %t", target, ok)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageOrder(t *testing.T) {
+	off := false
+	elems := map[string][]DisplayElement{"page0": nil, "page2": nil, "page10": nil, "extra": nil, "page1": nil}
+
+	tests := []struct {
+		name  string
+		pages []PageMeta
+		want  string
+	}{
+		{"number order without a list", nil, "page0 page1 page2 page10 extra"},
+		{"list order", []PageMeta{{ID: "page2"}, {ID: "extra"}, {ID: "page0"}}, "page2 extra page0"},
+		{"disabled pages are skipped", []PageMeta{{ID: "page0"}, {ID: "page1", Enabled: &off}, {ID: "page2"}}, "page0 page2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DisplayTemplate{Elements: elems, Pages: tt.pages}.shownPages()
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("shownPages() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePages(t *testing.T) {
+	off := false
+	elems := map[string][]DisplayElement{"page0": nil, "page1": nil}
+
+	tests := []struct {
+		name    string
+		pages   []PageMeta
+		wantErr string
+	}{
+		{"no list", nil, ""},
+		{"valid", []PageMeta{{ID: "page1", Title: "Network"}, {ID: "page0"}}, ""},
+		{"duplicate", []PageMeta{{ID: "page0"}, {ID: "page0"}}, "duplicate"},
+		{"missing elements", []PageMeta{{ID: "page7"}}, "no elements"},
+		{"bad id", []PageMeta{{ID: "page 0"}}, "must be"},
+		{"all disabled", []PageMeta{{ID: "page0", Enabled: &off}}, "at least one"},
+		{"empty list", []PageMeta{}, "at least one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePages(DisplayTemplate{Elements: elems, Pages: tt.pages})
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validatePages() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPagesAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	text := func(key string) DisplayElement {
+		return DisplayElement{Type: "text", DataKey: key, Font: "reg", UnitsFont: "unit", Enable: 1}
+	}
+	dftCfg.DisplayTemplate.Elements = map[string][]DisplayElement{
+		"page0": {text("A")},
+		"page1": {text("B")},
+		"page2": {text("C")},
+	}
+	mergeConfigs()
+
+	shownKeys := func() string {
+		var keys []string
+		for i := 0; i < cfgNumPages; i++ {
+			elems, _ := cfg.DisplayTemplate.pageElements(i)
+			for _, e := range elems {
+				keys = append(keys, e.DataKey)
+			}
+		}
+		return strings.Join(keys, " ")
+	}
+
+	steps := []struct {
+		method, target, body string
+		wantStatus           int
+		wantShown            string
+	}{
+		// deleting page1 no longer breaks the pages after it
+		{"DELETE", "/api/v2/pages/page1", "", 200, "A C"},
+		{"POST", "/api/v2/pages", `{"title": "New", "position": 0, "elements": [{"type": "text", "data_key": "D", "font": "reg", "units_font": "unit", "enable": 1}]}`, 201, "D A C"},
+		{"POST", "/api/v2/pages", `{"id": "page0"}`, 409, "D A C"},
+		{"PUT", "/api/v2/pages/order", `{"order": ["page2", "page3", "page0"]}`, 200, "C D A"},
+		{"PUT", "/api/v2/pages/order", `{"order": ["page2"]}`, 400, "C D A"},
+		{"PATCH", "/api/v2/pages/page3", `{"enabled": false}`, 200, "C A"},
+		{"POST", "/api/v2/pages/page2/elements?index=0", `{"type": "text", "data_key": "E", "font": "reg", "units_font": "unit"}`, 201, "E C A"},
+		{"POST", "/api/v2/pages/page2/elements", `{"type": "text"}`, 422, "E C A"},
+		{"PATCH", "/api/v2/pages/page2/elements/1", `{"data_key": "F"}`, 200, "E F A"},
+		{"DELETE", "/api/v2/pages/page2/elements/0", "", 200, "F A"},
+		{"DELETE", "/api/v2/pages/page2/elements/5", "", 404, "F A"},
+		{"PATCH", "/api/v2/pages/page0", `{"enabled": false}`, 200, "F"},
+		{"PATCH", "/api/v2/pages/page2", `{"enabled": false}`, 422, "F"},
+		{"GET", "/api/v2/pages/page1", "", 404, "F"},
+		{"DELETE", "/api/v2/pages/page2", "", 409, "F"},
+		{"PUT", "/api/v2/config/user", `{"display_template": {"pages": []}}`, 422, "F"},
+	}
+	for _, s := range steps {
+		status, body := apiCall(t, app, s.method, s.target, s.body)
+		if status != s.wantStatus {
+			t.Errorf("%s %s = %d %v, want %d", s.method, s.target, status, body, s.wantStatus)
+		}
+		if got := shownKeys(); got != s.wantShown {
+			t.Errorf("after %s %s pages show %q, want %q", s.method, s.target, got, s.wantShown)
+		}
+	}
+
+	// only edited pages are copied into the user config
+	raw, _ := os.ReadFile(userConfigFile)
+	var saved struct {
+		DisplayTemplate DisplayTemplate `json:"display_template"`
+	}
+	json.Unmarshal(raw, &saved)
+	if len(saved.DisplayTemplate.Pages) != 3 {
+		t.Errorf("saved pages = %+v", saved.DisplayTemplate.Pages)
+	}
+	if _, ok := saved.DisplayTemplate.Elements["page0"]; ok {
+		t.Error("unedited page0 should keep following the defaults")
+	}
+	if len(saved.DisplayTemplate.Elements["page2"]) != 1 || len(saved.DisplayTemplate.Elements["page3"]) != 1 {
+		t.Errorf("saved elements = %+v", saved.DisplayTemplate.Elements)
+	}
+}
+
+func TestPagesConcurrentEdits(t *testing.T) {
+	apiV2TestApp(t)
+	dftCfg.DisplayTemplate.Elements = map[string][]DisplayElement{"page0": {}}
+	mergeConfigs()
+	add := func(key string) func([]Page) ([]Page, []string, error) {
+		return func(pages []Page) ([]Page, []string, error) {
+			e := DisplayElement{Type: "text", DataKey: key, Font: "reg", UnitsFont: "unit", Enable: 1}
+			pages[0].Elements = append(pages[0].Elements, e)
+			return pages, []string{pages[0].ID}, nil
+		}
+	}
+
+	// the second edit starts while the first is between its read and write
+	inside, release := make(chan struct{}), make(chan struct{})
+	errs := make(chan error, 2)
+	go func() {
+		errs <- savePages(func(pages []Page) ([]Page, []string, error) {
+			close(inside)
+			<-release
+			return add("K0")(pages)
+		})
+	}()
+	<-inside
+	go func() { errs <- savePages(add("K1")) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []string
+	for _, e := range currentPages()[0].Elements {
+		keys = append(keys, e.DataKey)
+	}
+	if got := strings.Join(keys, " "); got != "K0 K1" {
+		t.Errorf("page0 = %q after two concurrent edits, want K0 K1", got)
+	}
+}
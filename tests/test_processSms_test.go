@@ -290,14 +290,8 @@ func TestGetSmsPages(t *testing.T) {
 		// but we can test the initial setup doesn't crash
 		
 		cfg.ShowSms = originalShowSms
-		done <- true
 	}()
 	
-	// Wait a short time to see if it crashes immediately
-	select {
-	case <-done:
-		// Function completed without panic
-	default:
-		// Function is running (expected for infinite loop)
-	}
+	// Join the goroutine before the test ends, it writes cfg
+	<-done
 }
\ No newline at end of file
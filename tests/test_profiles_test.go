@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// profileTestApp is apiV2TestApp with no profile active and the profiles
+// dir in a fresh temp dir, restoring the active profile and page counts
+// afterwards
+func profileTestApp(t *testing.T) {
+	t.Helper()
+	savedFile, savedCfgPages, savedTotal := userConfigFile, cfgNumPages, totalNumPages
+	saved := setProfile(profileState{})
+	t.Cleanup(func() {
+		setProfile(saved)
+		userConfigFile, cfgNumPages, totalNumPages = savedFile, savedCfgPages, savedTotal
+		initFonts()
+	})
+	userConfigFile = filepath.Join(t.TempDir(), "user_config.json")
+}
+
+func writeTestProfile(t *testing.T, name, body string) {
+	t.Helper()
+	if err := writeProfileFile(profilePath(name), []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileLayering(t *testing.T) {
+	apiV2TestApp(t)
+	profileTestApp(t)
+	userCfg = Config{PingSite0: "user.example"}
+	writeTestProfile(t, "vehicle", `{"ping_site0": "profile.example", "ping_site1": "profile.example", "screen_max_brightness": 60}`)
+
+	if err := switchProfile("vehicle"); err != nil {
+		t.Fatal(err)
+	}
+	// default → profile → user
+	if cfg.PingSite0 != "user.example" || cfg.PingSite1 != "profile.example" || cfg.ScreenMaxBrightness != 60 {
+		t.Errorf("cfg = %q, %q, %d", cfg.PingSite0, cfg.PingSite1, cfg.ScreenMaxBrightness)
+	}
+	if p, err := readActiveProfile(); err != nil || p.name != "vehicle" {
+		t.Errorf("persisted profile = %q, %v", p.name, err)
+	}
+
+	if err := switchProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PingSite1 != "" || cfg.ScreenMaxBrightness != 100 {
+		t.Errorf("without a profile cfg = %q, %d", cfg.PingSite1, cfg.ScreenMaxBrightness)
+	}
+	if _, err := os.Stat(activeProfileFile()); !os.IsNotExist(err) {
+		t.Errorf("the active file should be gone, %v", err)
+	}
+
+	writeTestProfile(t, "broken", `{"screen_min_brightness": 101}`)
+	if err := switchProfile("broken"); err == nil || activeProfileName() != "" {
+		t.Errorf("switching to an invalid profile = %v, active %q", err, activeProfileName())
+	}
+	if err := switchProfile("missing"); err == nil {
+		t.Error("switching to a missing profile should fail")
+	}
+}
+
+func TestCycleProfile(t *testing.T) {
+	apiV2TestApp(t)
+	profileTestApp(t)
+	cycleProfile() // nothing to switch to
+	if activeProfileName() != "" {
+		t.Fatalf("active = %q", activeProfileName())
+	}
+
+	writeTestProfile(t, "field", `{"ping_site0": "field.example"}`)
+	writeTestProfile(t, "router", `{"ping_site0": "router.example"}`)
+	for _, want := range []string{"field", "router", "", "field"} {
+		cycleProfile()
+		if got := activeProfileName(); got != want {
+			t.Errorf("after a long press active = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestProfilesAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	profileTestApp(t)
+
+	tests := []struct {
+		method, target, body string
+		wantStatus           int
+	}{
+		{"PUT", "/api/v2/profiles/vehicle", `{"ping_site0": "vehicle.example"}`, 200},
+		{"PUT", "/api/v2/profiles/bad", `{"screen_max_brightness": 101}`, 422},
+		{"PUT", "/api/v2/profiles/no%20spaces", `{}`, 400},
+		{"GET", "/api/v2/profiles/vehicle", "", 200},
+		{"GET", "/api/v2/profiles/bad", "", 404},
+		{"PUT", "/api/v2/profiles/active", `{"name": "nope"}`, 404},
+		{"PUT", "/api/v2/profiles/active", `{}`, 400},
+		{"PUT", "/api/v2/profiles/active", `{"name": "vehicle"}`, 200},
+		{"DELETE", "/api/v2/profiles/vehicle", "", 409},
+	}
+	for _, tt := range tests {
+		status, body := apiCall(t, app, tt.method, tt.target, tt.body)
+		if status != tt.wantStatus {
+			t.Errorf("%s %s = %d %v, want %d", tt.method, tt.target, status, body, tt.wantStatus)
+		}
+	}
+	if cfg.PingSite0 != "vehicle.example" {
+		t.Errorf("ping_site0 = %q with the vehicle profile active", cfg.PingSite0)
+	}
+
+	// editing the active profile applies it
+	apiCall(t, app, "PUT", "/api/v2/profiles/vehicle", `{"ping_site0": "edited.example"}`)
+	if cfg.PingSite0 != "edited.example" {
+		t.Errorf("ping_site0 = %q after editing the active profile", cfg.PingSite0)
+	}
+
+	status, body := apiCall(t, app, "GET", "/api/v2/profiles", "")
+	names, _ := body["profiles"].([]interface{})
+	if status != 200 || body["active"] != "vehicle" || len(names) != 1 {
+		t.Errorf("GET /profiles = %d %v", status, body)
+	}
+
+	apiCall(t, app, "PUT", "/api/v2/profiles/active", `{"name": ""}`)
+	status, body = apiCall(t, app, "DELETE", "/api/v2/profiles/vehicle", "")
+	if status != 200 || !strings.Contains(cfg.PingSite0, "default") {
+		t.Errorf("DELETE = %d %v, ping_site0 %q", status, body, cfg.PingSite0)
+	}
+}
+
+func TestPageEditsUnderProfile(t *testing.T) {
+	app := apiV2TestApp(t)
+	profileTestApp(t)
+	text := func(key string) DisplayElement {
+		return DisplayElement{Type: "text", DataKey: key, Font: "reg", UnitsFont: "unit", Enable: 1}
+	}
+	dftCfg.DisplayTemplate.Elements = map[string][]DisplayElement{"page0": {text("A")}}
+	mergeConfigs()
+	writeTestProfile(t, "vehicle", `{"display_template": {"pages": [{"id": "veh"}], "elements": {"veh": [{"type": "text", "data_key": "V", "font": "reg", "units_font": "unit", "enable": 1}]}}}`)
+	if err := switchProfile("vehicle"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, body := apiCall(t, app, "PATCH", "/api/v2/pages/veh", `{"title": "Car"}`); status != 200 {
+		t.Fatalf("PATCH under a profile = %d %v", status, body)
+	}
+	if pages := currentPages(); len(pages) != 1 || pages[0].Title != "Car" {
+		t.Errorf("pages = %+v", pages)
+	}
+	if raw, err := os.ReadFile(userConfigFile); err == nil && strings.Contains(string(raw), "veh") {
+		t.Errorf("the profile's pages leaked into the user config: %s", raw)
+	}
+
+	// the edit stays with the profile rather than pinning its pages
+	if err := switchProfile(""); err != nil {
+		t.Fatalf("switching away after a page edit: %v", err)
+	}
+	if pages := currentPages(); len(pages) != 1 || pages[0].ID != "page0" {
+		t.Errorf("without the profile pages = %+v", pages)
+	}
+	if err := switchProfile("vehicle"); err != nil {
+		t.Fatal(err)
+	}
+	if pages := currentPages(); len(pages) != 1 || pages[0].Title != "Car" {
+		t.Errorf("back on the profile pages = %+v", pages)
+	}
+
+	// a page list in the user config would hide a list edit made in the profile
+	if err := applyUserOverrides(map[string]interface{}{
+		"display_template": map[string]interface{}{"pages": []PageMeta{{ID: "page0", Title: "Home"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := apiCall(t, app, "PATCH", "/api/v2/pages/page0", `{"title": "Other"}`); status != 409 {
+		t.Errorf("list edit hidden by the user config = %d %v, want 409", status, body)
+	}
+}
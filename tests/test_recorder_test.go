@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func solidFrame(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestQuantizeFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		in   color.RGBA
+	}{
+		{"black", PCAT_BLACK},
+		{"white", PCAT_WHITE},
+		{"red", PCAT_RED},
+		{"green", PCAT_GREEN},
+		{"yellow", PCAT_YELLOW},
+		{"grey", PCAT_GREY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quantizeFrame(solidFrame(4, 2, tt.in))
+			if got.Bounds().Dx() != 4 || got.Bounds().Dy() != 2 {
+				t.Fatalf("bounds = %v", got.Bounds())
+			}
+			r, g, b, _ := got.At(3, 1).RGBA()
+			for i, pair := range [][2]uint32{{r >> 8, uint32(tt.in.R)}, {g >> 8, uint32(tt.in.G)}, {b >> 8, uint32(tt.in.B)}} {
+				d := int(pair[0]) - int(pair[1])
+				if d < -26 || d > 26 {
+					t.Errorf("channel %d = %d, want within 26 of %d", i, pair[0], pair[1])
+				}
+			}
+		})
+	}
+
+	if got := quantizeFrame(solidFrame(1, 1, PCAT_BLACK)).At(0, 0); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("black should map exactly, got %v", got)
+	}
+}
+
+func TestRecordScreen(t *testing.T) {
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	w, h := PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT
+
+	go func() {
+		for _, c := range []color.RGBA{PCAT_RED, PCAT_RED, PCAT_GREEN, PCAT_YELLOW} {
+			time.Sleep(40 * time.Millisecond)
+			vd.FillRectangleWithImage(0, 0, int16(w), int16(h), solidFrame(w, h, c))
+		}
+	}()
+
+	anim, err := recordScreen(vd, 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("recordScreen: %v", err)
+	}
+
+	// initial black screen + red + green + yellow; the repeated red adds nothing
+	if len(anim.Image) != 4 {
+		t.Fatalf("recorded %d frames, want 4", len(anim.Image))
+	}
+	total := 0
+	for i, d := range anim.Delay {
+		if d < recordMinDelay {
+			t.Errorf("frame %d delay %d below minimum", i, d)
+		}
+		total += d
+	}
+	if total < 25 || total > 40 {
+		t.Errorf("total delay %d (1/100s), want about 30", total)
+	}
+	if r, _, _, _ := anim.Image[1].At(0, 0).RGBA(); r>>8 < 200 {
+		t.Errorf("second frame should be red, got r=%d", r>>8)
+	}
+
+	// the observer is removed once the recording ends
+	vd.FillRectangleWithImage(0, 0, int16(w), int16(h), solidFrame(w, h, PCAT_WHITE))
+	if len(anim.Image) != 4 {
+		t.Errorf("frames added after the recording finished")
+	}
+}
+
+func TestRecordScreenErrors(t *testing.T) {
+	if _, err := recordScreen(nil, time.Millisecond); !errors.Is(err, errNoScreenCopy) {
+		t.Errorf("nil screen: err = %v, want errNoScreenCopy", err)
+	}
+
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	done := make(chan struct{})
+	go func() {
+		recordScreen(vd, 200*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := recordScreen(vd, time.Millisecond); !errors.Is(err, errRecordingBusy) {
+		t.Errorf("concurrent recording: err = %v, want errRecordingBusy", err)
+	}
+	<-done
+}
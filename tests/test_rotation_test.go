@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rotationPages sets up three config pages, ordered page2 page0 page1, and
+// two SMS pages
+func rotationPages(t *testing.T) {
+	t.Helper()
+	savedCfg, savedTotal, savedCfgPages, savedCharging := cfg, totalNumPages, cfgNumPages, battChargingStatus
+	t.Cleanup(func() {
+		cfg, totalNumPages, cfgNumPages, battChargingStatus = savedCfg, savedTotal, savedCfgPages, savedCharging
+	})
+	cfg.ShowSms = true
+	cfg.DisplayTemplate = DisplayTemplate{
+		Elements: map[string][]DisplayElement{"page0": nil, "page1": nil, "page2": nil},
+		Pages:    []PageMeta{{ID: "page2"}, {ID: "page0"}, {ID: "page1"}},
+	}
+	cfgNumPages, totalNumPages = 3, 5
+	battChargingStatus = true
+}
+
+func TestRotationDwell(t *testing.T) {
+	rotationPages(t)
+	on := true
+	conf := RotationConfig{Enabled: &on, DwellSeconds: 5, PageDwellSeconds: map[string]float64{"page0": 20, "sms": 2}}
+
+	tests := []struct {
+		idx  int
+		want time.Duration
+	}{
+		{0, 5 * time.Second},  // page2
+		{1, 20 * time.Second}, // page0
+		{3, 2 * time.Second},  // SMS
+	}
+	for _, tt := range tests {
+		if got := conf.dwell(tt.idx); got != tt.want {
+			t.Errorf("dwell(%d) = %v, want %v", tt.idx, got, tt.want)
+		}
+	}
+	if got := (RotationConfig{}).dwell(0); got != defaultRotationDwell {
+		t.Errorf("default dwell = %v, want %v", got, defaultRotationDwell)
+	}
+}
+
+func TestRotatorNext(t *testing.T) {
+	rotationPages(t)
+	on := true
+	start := time.Now()
+	at := func(secs float64) time.Time { return start.Add(secondsToDuration(secs)) }
+
+	tests := []struct {
+		name     string
+		conf     RotationConfig
+		curr     int
+		charging bool
+		pause    bool
+		checkAt  float64
+		wantStep int // 0 for no rotation
+	}{
+		{"disabled", RotationConfig{}, 0, true, false, 60, 0},
+		{"too early", RotationConfig{Enabled: &on}, 0, true, false, 5, 0},
+		{"next page", RotationConfig{Enabled: &on}, 0, true, false, 10, 1},
+		{"into SMS", RotationConfig{Enabled: &on}, 2, true, false, 10, 1},
+		{"skip SMS wraps to the first page", RotationConfig{Enabled: &on, SkipSms: &on}, 2, true, false, 10, 3},
+		{"leave an SMS page when skipping them", RotationConfig{Enabled: &on, SkipSms: &on}, 4, true, false, 10, 1},
+		{"on battery", RotationConfig{Enabled: &on, SkipOnBattery: &on}, 0, false, false, 60, 0},
+		{"charging", RotationConfig{Enabled: &on, SkipOnBattery: &on}, 0, true, false, 60, 1},
+		{"kiosk without enabled", RotationConfig{Kiosk: &on}, 0, true, false, 10, 1},
+		{"paused by the button", RotationConfig{Enabled: &on, PauseAfterButtonSeconds: 30}, 0, true, true, 35, 0},
+		{"dwell after the pause", RotationConfig{Enabled: &on, PauseAfterButtonSeconds: 30}, 0, true, true, 41, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			battChargingStatus = tt.charging
+			r := &pageRotator{}
+			r.next(tt.conf, tt.curr, start) // page comes on screen
+			if tt.pause {
+				r.pausedUntil = start.Add(tt.conf.pause())
+			}
+			target, ok := r.next(tt.conf, tt.curr, at(tt.checkAt))
+			if tt.wantStep == 0 && ok || tt.wantStep != 0 && (!ok || target.step != tt.wantStep || !target.auto) {
+				t.Errorf("next() = %+v, %t, want step %d", target, ok, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestRotatorRestartsOnPageChange(t *testing.T) {
+	rotationPages(t)
+	on := true
+	conf := RotationConfig{Enabled: &on}
+	start := time.Now()
+	r := &pageRotator{}
+	r.next(conf, 0, start)
+	if _, ok := r.next(conf, 1, start.Add(9*time.Second)); ok {
+		t.Error("a new page should start its own dwell")
+	}
+	if _, ok := r.next(conf, 1, start.Add(15*time.Second)); ok {
+		t.Error("page 1 has only been shown for 6s")
+	}
+	if _, ok := r.next(conf, 1, start.Add(19*time.Second)); !ok {
+		t.Error("page 1 should rotate after 10s")
+	}
+	if _, ok := r.next(conf, 1, start.Add(20*time.Second)); ok {
+		t.Error("a queued rotation should not be asked for again")
+	}
+}
+
+func TestRotationConfig(t *testing.T) {
+	on, off := true, false
+	dft := RotationConfig{Enabled: &off, DwellSeconds: 10, PageDwellSeconds: map[string]float64{"page0": 20}}
+	merged := mergeRotationConfig(dft, RotationConfig{Enabled: &on, PageDwellSeconds: map[string]float64{"sms": 3}})
+	if !merged.active() || merged.DwellSeconds != 10 || merged.PageDwellSeconds["page0"] != 20 || merged.PageDwellSeconds["sms"] != 3 {
+		t.Errorf("merged = %+v", merged)
+	}
+	if mergeRotationConfig(dft, RotationConfig{}).active() {
+		t.Error("rotation should stay off without a user override")
+	}
+
+	// each flag set below can be turned off again by the user
+	lower := RotationConfig{SkipSms: &on, SkipOnBattery: &on, Kiosk: &on}
+	if merged := mergeRotationConfig(lower, RotationConfig{}); !merged.skipSms() || !merged.skipOnBattery() || !merged.kiosk() {
+		t.Errorf("unset user flags should keep the lower ones, merged = %+v", merged)
+	}
+	merged = mergeRotationConfig(lower, RotationConfig{SkipSms: &off, SkipOnBattery: &off, Kiosk: &off})
+	if merged.skipSms() || merged.skipOnBattery() || merged.kiosk() || merged.active() {
+		t.Errorf("user false should turn the flags off, merged = %+v", merged)
+	}
+
+	for _, bad := range []RotationConfig{
+		{DwellSeconds: 0.5},
+		{PageDwellSeconds: map[string]float64{"page0": -1}},
+		{PauseAfterButtonSeconds: -1},
+	} {
+		if validateRotationConfig(bad) == nil {
+			t.Errorf("validateRotationConfig(%+v) should fail", bad)
+		}
+	}
+}
+
+func TestRotationAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+
+	status, body := apiCall(t, app, "PATCH", "/api/v2/display/rotation", `{"enabled": true, "dwell_seconds": 15}`)
+	if status != 200 || body["rotating"] != true {
+		t.Errorf("PATCH rotation = %d %v", status, body)
+	}
+	if !cfg.Rotation.active() || cfg.Rotation.DwellSeconds != 15 {
+		t.Errorf("cfg.Rotation = %+v", cfg.Rotation)
+	}
+
+	status, _ = apiCall(t, app, "PATCH", "/api/v2/display/rotation", `{"dwell_seconds": 0.1}`)
+	if status != 422 || cfg.Rotation.DwellSeconds != 15 {
+		t.Errorf("invalid PATCH = %d, dwell %v", status, cfg.Rotation.DwellSeconds)
+	}
+
+	// enabled survives a later change of another field
+	apiCall(t, app, "PATCH", "/api/v2/display/rotation", `{"skip_sms": true}`)
+	status, body = apiCall(t, app, "GET", "/api/v2/display/rotation", "")
+	conf, _ := body["config"].(map[string]interface{})
+	if status != 200 || conf["enabled"] != true || conf["skip_sms"] != true {
+		t.Errorf("GET rotation = %d %v", status, body)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+// backdate makes key look like it was last updated age ago
+func backdate(ds *DataStore, key string, age time.Duration) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.entries[key].UpdatedAt = time.Now().Add(-age)
+}
+
+func TestDataStoreStaleness(t *testing.T) {
+	t.Cleanup(func() { setStaleThresholds(cfg.StaleData.Thresholds) })
+	setStaleThresholds(map[string]int{"CpuTemp": 5, "Ping0": 0})
+
+	tests := []struct {
+		name   string
+		source string
+		key    string
+		value  interface{}
+		age    time.Duration
+		want   bool
+	}{
+		{"fresh battery", "battery", "BatterySoc", 80, time.Second, false},
+		{"old battery", "battery", "BatterySoc", 80, time.Minute, true},
+		{"pcat-manager within default", "pcat_web", "ModemSignalStrength", 60, 50 * time.Second, false},
+		{"pcat-manager past default", "pcat_web", "ModemSignalStrength", 60, 2 * time.Minute, true},
+		{"config threshold overrides default", "linux", "CpuTemp", 45.5, 10 * time.Second, true},
+		{"zero threshold never stale", "network", "Ping0", 20, time.Hour, false},
+		{"fixed values never stale", "fixed", "SN", "abc", 24 * time.Hour, false},
+		{"api values never stale", "api", "MyKey", "x", 24 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := NewDataStore()
+			ds.Source(tt.source).Store(tt.key, tt.value)
+			backdate(ds, tt.key, tt.age)
+
+			entry, _ := ds.Get(tt.key)
+			if entry.Stale != tt.want {
+				t.Errorf("Get(%s).Stale = %v, want %v", tt.key, entry.Stale, tt.want)
+			}
+			if snap := ds.Snapshot()[tt.key]; snap.Stale != tt.want {
+				t.Errorf("Snapshot()[%s].Stale = %v, want %v", tt.key, snap.Stale, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataStoreFailedReadStaysStale(t *testing.T) {
+	ds := NewDataStore()
+	data := ds.Source("pcat_web")
+	data.Store("DailyDataUsage", "1.25")
+	backdate(ds, "DailyDataUsage", 5*time.Minute)
+
+	// pcat-manager being down must not refresh the age of the old value
+	data.StoreError("DailyDataUsage", errors.New("connection refused"))
+	entry, _ := ds.Get("DailyDataUsage")
+	if !entry.Stale || entry.Text != "1.25" {
+		t.Errorf("got stale=%v text=%q, want the old value marked stale", entry.Stale, entry.Text)
+	}
+}
+
+func TestRenderMiddleStaleStyles(t *testing.T) {
+	setupGolden(t)
+
+	const key = "StaleTestValue"
+	white := []int{255, 255, 255}
+	grey := []int{int(PCAT_GREY.R), int(PCAT_GREY.G), int(PCAT_GREY.B)}
+
+	render := func(style, text string, stale bool, clr []int) *image.RGBA {
+		c := cfg
+		c.StaleData = StaleDataConfig{Style: style, Thresholds: map[string]int{key: 5}}
+		c.DisplayTemplate.Elements = map[string][]DisplayElement{
+			"page0": {{
+				Type: "text", DataKey: key, Position: Position{X: 10, Y: 10},
+				Font: "reg", UnitsFont: "unit", Units: "V", Color: clr, Enable: 1,
+			}},
+		}
+		saved := cfg
+		cfg = c
+		setStaleThresholds(c.StaleData.Thresholds)
+		defer func() {
+			cfg = saved
+			setStaleThresholds(saved.StaleData.Thresholds)
+		}()
+
+		globalData.Store(key, text)
+		if stale {
+			backdate(globalData, key, time.Minute)
+		}
+		frame := image.NewRGBA(image.Rect(0, 0, PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT))
+		renderMiddle(frame, &c, false, 0)
+		return frame
+	}
+
+	tests := []struct {
+		name  string
+		style string
+		want  *image.RGBA
+	}{
+		{"grey is the default", "", render("", "7.71", false, grey)},
+		{"grey", "grey", render("", "7.71", false, grey)},
+		{"marker", "marker", render("", "7.71*", false, white)},
+		{"placeholder", "placeholder", render("", "--", false, grey)},
+		{"off", "off", render("", "7.71", false, white)},
+	}
+
+	fresh := render("grey", "7.71", false, white)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := render(tt.style, "7.71", true, white)
+			if !bytes.Equal(got.Pix, tt.want.Pix) {
+				t.Errorf("stale value with style %q doesn't render as expected", tt.style)
+			}
+			if tt.style != "off" && bytes.Equal(got.Pix, fresh.Pix) {
+				t.Errorf("stale value with style %q renders like a fresh one", tt.style)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameStreamSubscribe(t *testing.T) {
+	vd := NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT)
+	fs := newFrameStream(vd)
+
+	ch, err := fs.subscribe()
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer fs.unsubscribe(ch)
+
+	// a new client gets the current screen without waiting for a redraw
+	select {
+	case frame := <-ch:
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatalf("initial frame is not a JPEG: %v", err)
+		}
+		if img.Bounds().Dx() != PCAT2_LCD_WIDTH || img.Bounds().Dy() != PCAT2_LCD_HEIGHT {
+			t.Errorf("frame is %v", img.Bounds())
+		}
+	default:
+		t.Fatal("no initial frame queued")
+	}
+
+	w, h := PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT
+	vd.FillRectangleWithImage(0, 0, int16(w), int16(h), solidFrame(w, h, PCAT_RED))
+	select {
+	case frame := <-ch:
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, g, _, _ := img.At(w/2, h/2).RGBA(); r>>8 < 200 || g>>8 > 100 {
+			t.Errorf("streamed frame should be PCAT_RED, got r=%d g=%d", r>>8, g>>8)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no frame pushed after a display write")
+	}
+}
+
+func TestFrameStreamClientLimit(t *testing.T) {
+	fs := newFrameStream(NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT))
+
+	var chans []chan []byte
+	for i := 0; i < maxStreamClients; i++ {
+		ch, err := fs.subscribe()
+		if err != nil {
+			t.Fatalf("client %d: %v", i, err)
+		}
+		chans = append(chans, ch)
+	}
+	if _, err := fs.subscribe(); !errors.Is(err, errTooManyStreamClients) {
+		t.Errorf("err = %v, want errTooManyStreamClients", err)
+	}
+
+	fs.unsubscribe(chans[0])
+	if _, err := fs.subscribe(); err != nil {
+		t.Errorf("a slot should free up after unsubscribe: %v", err)
+	}
+}
+
+// failAfter accepts n writes, then reports the client as gone
+type failAfter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (f *failAfter) Write(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, errors.New("connection closed")
+	}
+	f.n--
+	return f.buf.Write(p)
+}
+
+func TestFrameStreamServe(t *testing.T) {
+	// the new frame may replace the first one before serve picks it up, and
+	// then only the keepalive writes again
+	saved := streamKeepAlive
+	streamKeepAlive = 20 * time.Millisecond
+	t.Cleanup(func() { streamKeepAlive = saved })
+
+	fs := newFrameStream(NewVirtualDisplay(PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT))
+	ch, err := fs.subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &failAfter{n: 1}
+	done := make(chan struct{})
+	go func() {
+		fs.serve(bufio.NewWriterSize(out, 256*1024), ch)
+		close(done)
+	}()
+
+	w, h := PCAT2_LCD_WIDTH, PCAT2_LCD_HEIGHT
+	fs.screen.FillRectangleWithImage(0, 0, int16(w), int16(h), solidFrame(w, h, PCAT_GREEN))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve did not return after the client went away")
+	}
+
+	part := out.buf.String()
+	if !strings.HasPrefix(part, "--"+mjpegBoundary+"\r\nContent-Type: image/jpeg\r\nContent-Length: ") {
+		t.Errorf("unexpected part header: %q", part[:min(len(part), 80)])
+	}
+	if fs.numClients() != 0 {
+		t.Errorf("client not released, %d still connected", fs.numClients())
+	}
+}
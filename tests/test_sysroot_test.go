@@ -0,0 +1,240 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useFixtureSysRoot copies fixtures/sysroot into a temp dir and points sysRoot at it,
+// so tests can mutate files without touching the committed fixture tree.
+func useFixtureSysRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	err := filepath.Walk("fixtures/sysroot", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel("fixtures/sysroot", path)
+		dst := filepath.Join(root, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("copy fixture tree: %v", err)
+	}
+
+	saved := sysRoot
+	sysRoot = root
+	t.Cleanup(func() { sysRoot = saved })
+	return root
+}
+
+func writeFixture(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSysPath(t *testing.T) {
+	saved := sysRoot
+	defer func() { sysRoot = saved }()
+
+	tests := []struct {
+		root string
+		path string
+		want string
+	}{
+		{"/", "/proc/stat", "/proc/stat"},
+		{"", "/proc/stat", "/proc/stat"},
+		{"/tmp/fake", "/proc/stat", "/tmp/fake/proc/stat"},
+		{"fixtures/sysroot", "/sys/class/hwmon/hwmon*/fan1_input", "fixtures/sysroot/sys/class/hwmon/hwmon*/fan1_input"},
+	}
+
+	for _, tt := range tests {
+		sysRoot = tt.root
+		if got := sysPath(tt.path); got != tt.want {
+			t.Errorf("sysPath(%q) with root %q = %q, want %q", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestCollectorsReadFixtureRoot(t *testing.T) {
+	useFixtureSysRoot(t)
+
+	if soc, err := getBatterySoc(); err != nil || soc != 76 {
+		t.Errorf("getBatterySoc() = %d, %v; want 76", soc, err)
+	}
+	if charging, err := getBatteryCharging(); err != nil || charging {
+		t.Errorf("getBatteryCharging() = %v, %v; want false", charging, err)
+	}
+	if uv, err := getBatteryVoltageUV(); err != nil || uv != 7712000 {
+		t.Errorf("getBatteryVoltageUV() = %v, %v; want 7712000", uv, err)
+	}
+	if ua, err := getBatteryCurrentUA(); err != nil || ua != 412000 {
+		t.Errorf("getBatteryCurrentUA() = %v, %v; want 412000", ua, err)
+	}
+	if uv, err := getDCVoltageUV(); err != nil || uv != 0 {
+		t.Errorf("getDCVoltageUV() = %v, %v; want 0 (no charger)", uv, err)
+	}
+	if temp, err := getCpuTemp(); err != nil || temp != 48650 {
+		t.Errorf("getCpuTemp() = %v, %v; want 48650", temp, err)
+	}
+	if rpm, err := getFanSpeed(); err != nil || rpm != 2950 {
+		t.Errorf("getFanSpeed() = %d, %v; want 2950", rpm, err)
+	}
+	if up, err := getUptimeSeconds(); err != nil || up != 93721.54 {
+		t.Errorf("getUptimeSeconds() = %v, %v; want 93721.54", up, err)
+	}
+
+	stats, err := readCPUStats()
+	if err != nil || len(stats) != 8 {
+		t.Fatalf("readCPUStats() returned %d cpus, %v; want 8", len(stats), err)
+	}
+	if stats[0].User != 52304 || stats[0].Softirq != 4302 {
+		t.Errorf("cpu0 stats = %+v", stats[0])
+	}
+
+	used, total, err := getMemUsedAndTotalGB()
+	if err != nil {
+		t.Fatalf("getMemUsedAndTotalGB() error: %v", err)
+	}
+	if math.Abs(total-7.655) > 0.01 || math.Abs(used-1.655) > 0.01 {
+		t.Errorf("getMemUsedAndTotalGB() = %.3f/%.3f, want ~1.655/7.655", used, total)
+	}
+
+	rx, tx, err := getInterfaceBytes("eth1")
+	if err != nil || rx != 1532900412 || tx != 204118733 {
+		t.Errorf("getInterfaceBytes(eth1) = %d, %d, %v", rx, tx, err)
+	}
+	if isOpenWRT() {
+		t.Error("fixture tree has no /etc/openwrt_release, isOpenWRT() should be false")
+	}
+}
+
+func TestBatteryChargingTransition(t *testing.T) {
+	root := useFixtureSysRoot(t)
+
+	savedCfg, savedTimeout, savedLast := cfg, idleTimeout, lastChargingStatus
+	defer func() { cfg, idleTimeout, lastChargingStatus = savedCfg, savedTimeout, savedLast }()
+	cfg.ScreenDimmerTimeOnBatterySeconds = 60
+	cfg.ScreenDimmerTimeOnDCSeconds = 3600
+	lastChargingStatus = false
+
+	tests := []struct {
+		status       string
+		wantCharging bool
+		wantTimeout  time.Duration
+	}{
+		{"Discharging", false, 60 * time.Second},
+		{"Charging", true, 3600 * time.Second},
+		{"Full", true, 3600 * time.Second},
+		{"Not charging", false, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			writeFixture(t, root, "sys/class/power_supply/battery/status", tt.status+"\n")
+			collectBatteryData()
+
+			got, ok := globalData.Load("BatteryCharging")
+			if !ok || got != tt.wantCharging {
+				t.Errorf("BatteryCharging = %v, want %v", got, tt.wantCharging)
+			}
+			if lastChargingStatus != tt.wantCharging {
+				t.Errorf("lastChargingStatus = %v, want %v", lastChargingStatus, tt.wantCharging)
+			}
+			if idleTimeout != tt.wantTimeout {
+				t.Errorf("idleTimeout = %v, want %v", idleTimeout, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestMissingAndOddSysfsValues(t *testing.T) {
+	root := useFixtureSysRoot(t)
+
+	// Fan: hwmon nodes without fan1_input must be skipped, garbage too
+	os.Remove(filepath.Join(root, "sys/class/hwmon/hwmon1/fan1_input"))
+	if _, err := getFanSpeed(); err == nil {
+		t.Error("getFanSpeed() should fail when no hwmon exposes fan1_input")
+	}
+	writeFixture(t, root, "sys/class/hwmon/hwmon1/fan1_input", "not-a-number\n")
+	writeFixture(t, root, "sys/class/hwmon/hwmon2/fan1_input", "1800\n")
+	if rpm, err := getFanSpeed(); err != nil || rpm != 1800 {
+		t.Errorf("getFanSpeed() = %d, %v; want 1800 from the next valid hwmon", rpm, err)
+	}
+
+	// Odd values in single-value attributes
+	writeFixture(t, root, "sys/class/power_supply/battery/capacity", "abc\n")
+	if _, err := getBatterySoc(); err == nil {
+		t.Error("getBatterySoc() should fail on non-numeric capacity")
+	}
+	writeFixture(t, root, "sys/class/power_supply/charger/voltage_now", "5100000\n")
+	if uv, err := getDCVoltageUV(); err != nil || uv != 5100000 {
+		t.Errorf("getDCVoltageUV() = %v, %v; want 5100000", uv, err)
+	}
+	writeFixture(t, root, "sys/class/power_supply/charger/voltage_now", "300000\n")
+	if uv, err := getDCVoltageUV(); err != nil || uv != 0 {
+		t.Errorf("getDCVoltageUV() below 1V = %v, %v; want 0", uv, err)
+	}
+
+	// meminfo without MemTotal
+	writeFixture(t, root, "proc/meminfo", "MemFree: 1024 kB\n")
+	if _, _, err := getMemUsedAndTotalGB(); err == nil {
+		t.Error("getMemUsedAndTotalGB() should fail without MemTotal")
+	}
+
+	// Missing files
+	os.Remove(filepath.Join(root, "sys/class/thermal/thermal_zone0/temp"))
+	if _, err := getCpuTemp(); err == nil {
+		t.Error("getCpuTemp() should fail when thermal_zone0 is missing")
+	}
+	os.Remove(filepath.Join(root, "proc/uptime"))
+	if _, err := getUptimeSeconds(); err == nil {
+		t.Error("getUptimeSeconds() should fail when /proc/uptime is missing")
+	}
+
+	// OpenWrt detection follows the root as well
+	writeFixture(t, root, "etc/openwrt_release", "DISTRIB_ID='OpenWrt'\n")
+	if !isOpenWRT() {
+		t.Error("isOpenWRT() should see etc/openwrt_release under sysRoot")
+	}
+}
+
+func TestSetBacklightWritesUnderSysRoot(t *testing.T) {
+	root := useFixtureSysRoot(t)
+
+	savedCfg, savedLogical, savedVirtual := cfg, lastLogical, virtualMode
+	defer func() { cfg, lastLogical, virtualMode = savedCfg, savedLogical, savedVirtual }()
+	cfg.ScreenMinBrightness = 0
+	cfg.ScreenMaxBrightness = 100
+	lastLogical = -1
+	virtualMode = false
+
+	setBacklight(42)
+
+	data, err := os.ReadFile(filepath.Join(root, "sys/class/backlight/backlight/brightness"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "42" {
+		t.Errorf("brightness file = %q, want %q", data, "42")
+	}
+	if got := getBacklight(); got != 42 {
+		t.Errorf("getBacklight() = %d, want 42", got)
+	}
+}
@@ -81,29 +81,6 @@ func TestStateName(t *testing.T) {
 	}
 }
 
-func TestContainsChinese(t *testing.T) {
-	tests := []struct {
-		text     string
-		expected bool
-	}{
-		{"Hello World", false},
-		{"测试", true},
-		{"Test 测试 Text", true},
-		{"こんにちは", true}, // Japanese Hiragana
-		{"안녕하세요", true},   // Korean
-		{"", false},
-		{"123456", false},
-		{"English中文", true},
-	}
-	
-	for _, tt := range tests {
-		result := containsChinese(tt.text)
-		if result != tt.expected {
-			t.Errorf("containsChinese(%s) = %t; want %t", tt.text, result, tt.expected)
-		}
-	}
-}
-
 func TestPreCalculateEasing(t *testing.T) {
 	numFrames := 10
 	frameWidth := 100
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	repoRoot := "."
+	if _, err := os.Stat("../assets"); err == nil {
+		repoRoot = ".."
+	}
+	savedPrefix := assetsPrefix
+	defer func() { assetsPrefix = savedPrefix }()
+	assetsPrefix = repoRoot
+	initFonts()
+
+	keys := map[string]bool{"BatterySoc": true}
+	tests := []struct {
+		name     string
+		elem     DisplayElement
+		wantPath string // "" for no issues
+		severity string
+	}{
+		{"valid text", DisplayElement{Type: "text", DataKey: "BatterySoc", Font: "reg", UnitsFont: "unit"}, "", ""},
+		{"unknown type", DisplayElement{Type: "label"}, "type", "error"},
+		{"text without data_key", DisplayElement{Type: "text", Font: "reg", UnitsFont: "unit"}, "data_key", "error"},
+		{"unknown data_key", DisplayElement{Type: "text", DataKey: "Nope", Font: "reg", UnitsFont: "unit"}, "data_key", "warning"},
+		{"unknown font", DisplayElement{Type: "fixed_text", Font: "comic"}, "font", "error"},
+		{"icon", DisplayElement{Type: "icon", IconPath: "assets/svg/up_trig.svg"}, "", ""},
+		{"missing icon", DisplayElement{Type: "icon", IconPath: "assets/svg/nope.svg"}, "icon_path", "error"},
+		{"icon extension", DisplayElement{Type: "icon", IconPath: "assets/svg/up_trig.gif"}, "icon_path", "error"},
+		{"graph without config", DisplayElement{Type: "graph"}, "graph_config", "error"},
+		{"color value", DisplayElement{Type: "fixed_text", Font: "reg", Color: []int{0, 300, 0}}, "color[1]", "error"},
+		{"off screen", DisplayElement{Type: "fixed_text", Font: "reg", Position: Position{X: 172}}, "position.x", "error"},
+		{"too big", DisplayElement{Type: "fixed_text", Font: "reg", Position: Position{X: 100}, Size: &Size{Width: 80, Height: 10}}, "size", "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := DisplayTemplate{Elements: map[string][]DisplayElement{"page0": {tt.elem}}}
+			issues := validateTemplate(tmpl, keys, builtinFonts())
+			if tt.wantPath == "" {
+				if len(issues) != 0 {
+					t.Errorf("issues = %v, want none", issues)
+				}
+				return
+			}
+			want := "display_template.elements.page0[0]." + tt.wantPath
+			if len(issues) != 1 || issues[0].Path != want || issues[0].Severity != tt.severity {
+				t.Errorf("issues = %v, want one %s at %s", issues, tt.severity, want)
+			}
+		})
+	}
+}
+
+func TestLocateIssues(t *testing.T) {
+	raw := []byte(`{
+  "display_template": {
+    "elements": {
+      "page1": [
+        {"type": "text", "data_key": "A"},
+        {"type": "fixed_text",
+         "font": "comic"}
+      ]
+    }
+  }
+}`)
+	issues := []TemplateIssue{
+		{Path: "display_template.elements.page1[1].font"},
+		{Path: "display_template.elements.page1[0].font"},     // missing, points at the element
+		{Path: "display_template.elements.page0[0].data_key"}, // in the other file
+	}
+	locateIssues(issues, raw, "user.json")
+
+	want := []struct{ line, col int }{{7, 18}, {5, 9}, {0, 0}}
+	for i, w := range want {
+		if issues[i].Line != w.line || issues[i].Column != w.col {
+			t.Errorf("%s at %d:%d, want %d:%d", issues[i].Path, issues[i].Line, issues[i].Column, w.line, w.col)
+		}
+	}
+	if got := issues[0].String(); !strings.HasPrefix(got, "user.json:7:18: display_template.elements.page1[1].font") {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestRunValidateCommand(t *testing.T) {
+	repoRoot := "."
+	if _, err := os.Stat("../assets"); err == nil {
+		repoRoot = ".."
+	}
+	savedPrefix := assetsPrefix
+	defer func() { assetsPrefix = savedPrefix }()
+	config := filepath.Join(repoRoot, "config.json")
+
+	if err := runValidateCommand([]string{"--assets", repoRoot, "--config", config}); err != nil {
+		t.Errorf("the default config should validate: %v", err)
+	}
+
+	user := filepath.Join(t.TempDir(), "user_config.json")
+	os.WriteFile(user, []byte(`{"display_template": {"elements": {"page0": [{"type": "fixed_text", "font": "comic"}]}}}`), 0644)
+	err := runValidateCommand([]string{"--assets", repoRoot, "--config", config, "--user", user})
+	if err == nil || !strings.Contains(err.Error(), "errors in the display template") {
+		t.Errorf("validate with a bad user config = %v", err)
+	}
+	err = runValidateCommand([]string{"--assets", repoRoot, "--config", config, user})
+	if err == nil || !strings.Contains(err.Error(), "--user") {
+		t.Errorf("validate with the user config as an argument = %v", err)
+	}
+}
+
+func TestValidateConfigAPI(t *testing.T) {
+	app := apiV2TestApp(t)
+	app.Post("/api/v1/go_save_user_config.json", saveUserConfigFromWeb)
+	bad := `{"display_template": {"elements": {"page0": [
+		{"type": "text", "data_key": "BatterySoc", "font": "comic", "units_font": "unit"}]}}}`
+
+	status, body := apiCall(t, app, "POST", "/api/v2/config/validate", bad)
+	issues, _ := body["issues"].([]interface{})
+	if status != 200 || body["valid"] != false || len(issues) == 0 {
+		t.Fatalf("POST /config/validate = %d %v", status, body)
+	}
+	first, _ := issues[0].(map[string]interface{})
+	if first["path"] != "display_template.elements.page0[0].font" || first["line"] != float64(2) {
+		t.Errorf("first issue = %v", first)
+	}
+
+	status, body = apiCall(t, app, "PUT", "/api/v2/config/user", bad)
+	if status != 422 || body["issues"] == nil {
+		t.Errorf("PUT /config/user = %d %v", status, body)
+	}
+	status, _ = apiCall(t, app, "POST", "/api/v1/go_save_user_config.json", bad)
+	if _, err := os.Stat(userConfigFile); status != 400 || err == nil {
+		t.Errorf("v1 save = %d, file written: %t", status, err == nil)
+	}
+	status, body = apiCall(t, app, "POST", "/api/v1/go_save_user_config.json", `{"ping_site0": "web.example"}`)
+	if status != 200 || cfg.PingSite0 != "web.example" {
+		t.Errorf("v1 save = %d %v, ping_site0 %q", status, body, cfg.PingSite0)
+	}
+
+	status, body = apiCall(t, app, "GET", "/api/v2/config/schema", "")
+	if status != 200 || body["$schema"] == nil {
+		t.Errorf("GET /config/schema = %d", status)
+	}
+}
+
+func TestLoadingToleratesMissingIcons(t *testing.T) {
+	apiV2TestApp(t)
+	t.Cleanup(func() { mergeConfigs() })
+	dftCfg.DisplayTemplate.Elements = map[string][]DisplayElement{
+		"page0": {{Type: "text", DataKey: "BatterySoc", Font: "reg", UnitsFont: "unit", Enable: 1}},
+	}
+	removed := DisplayElement{Type: "icon", IconPath: "assets/svg/removed.svg", Enable: 1}
+
+	// saving a config with a missing icon is refused ...
+	err := applyUserOverrides(map[string]interface{}{"display_template": map[string]interface{}{
+		"elements": map[string]interface{}{"page1": []DisplayElement{removed}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "removed.svg") {
+		t.Errorf("saving a missing icon = %v", err)
+	}
+	// ... but one saved before the icon went away still loads
+	userCfg = Config{DisplayTemplate: DisplayTemplate{Elements: map[string][]DisplayElement{"page1": {removed}}}}
+	if err := mergeConfigs(); err != nil || cfgNumPages != 2 {
+		t.Errorf("loading a missing icon = %v, %d pages", err, cfgNumPages)
+	}
+
+	// a user config that doesn't validate leaves the default config alone
+	userCfg = Config{ScreenMinBrightness: 101}
+	if err := mergeConfigs(); err == nil {
+		t.Fatal("an invalid user config merged")
+	}
+	if err := mergeDefaultConfig(); err != nil || cfgNumPages != 1 || totalNumPages == 0 || cfg.ScreenMinBrightness != 0 {
+		t.Errorf("default config alone = %v, %d/%d pages, min brightness %d", err, cfgNumPages, totalNumPages, cfg.ScreenMinBrightness)
+	}
+}
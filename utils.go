@@ -6,11 +6,11 @@ import (
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 
 	evdev "github.com/holoplot/go-evdev"
 
@@ -26,6 +26,15 @@ var (
 	wasConsoleScreenIdle bool // Track if screen was idle for console input
 )
 
+// sysPath resolves an absolute system path such as /sys/class/... against
+// sysRoot, so collectors can be pointed at a fixture tree instead of the host.
+func sysPath(path string) string {
+	if sysRoot == "" || sysRoot == "/" {
+		return path
+	}
+	return filepath.Join(sysRoot, path)
+}
+
 // loadConfig reads and unmarshals the config file.
 func loadConfig(path string) (Config, error) {
 	data, err := os.ReadFile(path)
@@ -36,12 +45,69 @@ func loadConfig(path string) (Config, error) {
 	return cfg, err
 }
 
+// resolveAssetsPrefix picks the directory holding assets/: the working
+// directory during development, otherwise the installed share directory.
+func resolveAssetsPrefix() {
+	//if assetsFolder not exists, use /usr/local/share/pcat2_mini_display
+	if _, err := os.Stat("assets"); os.IsNotExist(err) {
+		assetsPrefix = "/usr/local/share/pcat2_mini_display"
+	}
+
+	if _, err := os.Stat(assetsPrefix + "/assets"); os.IsNotExist(err) {
+		assetsPrefix = "/usr/share/pcat2_mini_display"
+	}
+}
+
+// initFonts maps font names used in config.json to font files: the built-in
+// fonts under assetsPrefix, the uploaded ones and the fonts section of cfg.
+func initFonts() {
+	configMutex.RLock()
+	defs := cfg.Fonts
+	configMutex.RUnlock()
+	table, err := buildFontTable(defs)
+	if err != nil {
+		log.Printf("config fonts not loaded: %v", err)
+		table, _ = buildFontTable(nil)
+	}
+	setFonts(table)
+}
+
+// lookupFont returns the file and size behind a font name
+func lookupFont(name string) (FontConfig, bool) {
+	fontsMu.RLock()
+	defer fontsMu.RUnlock()
+	f, ok := fonts[name]
+	return f, ok
+}
+
+// builtinFonts are the fonts shipped in assets/fonts. Orbitron has no CJK
+// glyphs, those come from the CJK font installed with the package.
+func builtinFonts() map[string]FontConfig {
+	cjk := []string{"cjk"}
+	return map[string]FontConfig{
+		"clock":     {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Medium.ttf", FontSize: 20, Fallback: cjk},
+		"clockBold": {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 17, Fallback: cjk},
+		"reg":       {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 18, Fallback: cjk},
+		"big":       {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 25, Fallback: cjk},
+		"unit":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Medium.ttf", FontSize: 15, Fallback: cjk},
+		"tiny":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Regular.ttf", FontSize: 12, Fallback: cjk},
+		"micro":     {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Regular.ttf", FontSize: 10, Fallback: cjk},
+		"thin":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-Regular.ttf", FontSize: 18, Fallback: cjk},
+		"huge":      {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 34, Fallback: cjk},
+		"gigantic":  {FontPath: assetsPrefix + "/assets/fonts/Orbitron-ExtraBold.ttf", FontSize: 48, Fallback: cjk},
+		// Chinese font variants
+		"cjk":      {FontPath: assetsPrefix + "/assets/fonts/NotoSansMonoCJK-VF.ttf.ttc", FontSize: 18},
+		"unit_cjk": {FontPath: assetsPrefix + "/assets/fonts/NotoSansMonoCJK-VF.ttf.ttc", FontSize: 15},
+	}
+}
+
 var (
 	fontCache = make(map[string]struct {
 		face       font.Face
 		fontHeight int
 	})
 	fontCacheMu sync.Mutex
+	fontsMu     sync.RWMutex // guards fonts, which uploads and config reloads change
 )
 
 // getFontFace loads (or returns cached) font.Face + its height.
@@ -55,45 +121,35 @@ func getFontFace(fontName string) (font.Face, int, error) {
 	fontCacheMu.Unlock()
 
 	// 2) Not cached: load config
-	cfg, ok := fonts[fontName]
+	cfg, ok := lookupFont(fontName)
 	if !ok {
 		return nil, 0, fmt.Errorf("font %s not found in mapping", fontName)
 	}
 
 	// 3) Read & parse the TTF/TTC
-	fontBytes, err := os.ReadFile(cfg.FontPath)
+	face, err := newFontFace(cfg, cfg.FontSize)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error reading font file: %v", err)
+		return nil, 0, err
 	}
 
-	var ttfFont *opentype.Font
-	// Handle TrueType Collections (.ttc files)
-	if strings.HasSuffix(cfg.FontPath, ".ttc") {
-		collection, err := opentype.ParseCollection(fontBytes)
-		if err != nil {
-			return nil, 0, fmt.Errorf("error parsing font collection: %v", err)
+	// 4) Characters the font lacks come from its fallbacks, at its size
+	if len(cfg.Fallback) > 0 {
+		chain := fallbackFace{face}
+		for _, name := range cfg.Fallback {
+			fb, ok := lookupFont(name)
+			if !ok {
+				continue
+			}
+			fbFace, err := newFontFace(fb, cfg.FontSize)
+			if err != nil {
+				log.Printf("font %s: fallback %s not loaded: %v", fontName, name, err)
+				continue
+			}
+			chain = append(chain, fbFace)
 		}
-		// Get the first font from the collection
-		ttfFont, err = collection.Font(0)
-		if err != nil {
-			return nil, 0, fmt.Errorf("error getting font from collection: %v", err)
+		if len(chain) > 1 {
+			face = chain
 		}
-	} else {
-		// Handle single font files (.ttf, .otf)
-		ttfFont, err = opentype.Parse(fontBytes)
-		if err != nil {
-			return nil, 0, fmt.Errorf("error parsing font: %v", err)
-		}
-	}
-
-	// 4) Create the face
-	face, err := opentype.NewFace(ttfFont, &opentype.FaceOptions{
-		Size:    cfg.FontSize,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-	if err != nil {
-		return nil, 0, err
 	}
 
 	// 5) Measure height
@@ -111,25 +167,17 @@ func getFontFace(fontName string) (font.Face, int, error) {
 	return face, fontHeight, nil
 }
 
-// containsChinese checks if a string contains Chinese characters
-func containsChinese(text string) bool {
-	for _, r := range text {
-		if unicode.In(r, unicode.Han) {
-			return true
-		}
-	}
-	return false
-}
-
-// getFontFaceForText returns the appropriate font face based on text content
-func getFontFaceForText(baseFontName string, text string) (font.Face, int, error) {
-	if containsChinese(text) {
-		// Use Chinese font variant if available
-		cjkFontName := baseFontName + "_cjk"
-		return getFontFace(cjkFontName)
+// newFontFace opens the font f at size points
+func newFontFace(f FontConfig, size float64) (font.Face, error) {
+	ttfFont, err := loadFontFile(f.FontPath, f.Weight)
+	if err != nil {
+		return nil, err
 	}
-	// Use regular font for non-Chinese text
-	return getFontFace(baseFontName)
+	return opentype.NewFace(ttfFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: fontHintings[f.Hinting],
+	})
 }
 
 // Pre-allocated clear buffer for efficient frame clearing
@@ -204,6 +252,11 @@ func setBacklight(brightness int) {
 		offTimer = nil
 	}
 
+	// no panel backlight to drive in virtual mode
+	if virtualMode {
+		return
+	}
+
 	// choose what to write right now:
 	phys := brightness
 	if brightness == 0 {
@@ -211,7 +264,7 @@ func setBacklight(brightness int) {
 	}
 
 	// perform the write
-	if err := os.WriteFile("/sys/class/backlight/backlight/brightness", []byte(strconv.Itoa(phys)), 0644); err != nil {
+	if err := os.WriteFile(sysPath(BACKLIGHT_BRIGHTNESS_PATH), []byte(strconv.Itoa(phys)), 0644); err != nil {
 		log.Printf("backlight write error: %v", err)
 	} else {
 		//log.Printf("→ physical backlight %d", phys)
@@ -224,7 +277,7 @@ func setBacklight(brightness int) {
 			defer mu.Unlock()
 			if lastLogical == 0 {
 				// still supposed to be off, so write 0 now
-				if err := os.WriteFile("/sys/class/backlight/backlight/brightness", []byte("1"), 0644); err != nil {
+				if err := os.WriteFile(sysPath(BACKLIGHT_BRIGHTNESS_PATH), []byte("1"), 0644); err != nil {
 					log.Printf("backlight final-off error: %v", err)
 				} else {
 					log.Println("→ physical backlight OFF")
@@ -290,16 +343,16 @@ func monitorKeyboard(changePageTriggered *bool) {
 				lastActivityMu.Lock()
 				lastActivity = now
 				lastActivityMu.Unlock()
+				pauseRotationForButton()
 
 				if idleState == STATE_IDLE || idleState == STATE_OFF || idleState == STATE_FADE_OUT {
 					log.Println("Screen is idle/fading/off, preparing to wake up without changing page")
 					wasScreenIdle = true
 				} else if idleState == STATE_ACTIVE || idleState == STATE_FADE_IN {
+					// the page changes on release, so a long press can switch
+					// profiles without sliding the page first
 					log.Println("Screen is active, preparing for page change")
 					wasScreenIdle = false
-					swippingScreen = true
-					*changePageTriggered = true
-					signalPageChange()
 				}
 
 			case 0: // key release
@@ -315,8 +368,13 @@ func monitorKeyboard(changePageTriggered *bool) {
 				if wasScreenIdle {
 					log.Println("Screen was idle when key was pressed, waking up without changing page")
 					wasScreenIdle = false // Reset flag
+				} else if !buttonKeydownTime.IsZero() && now.Sub(buttonKeydownTime) >= profileSwitchHold {
+					log.Println("Long press, switching to the next config profile")
+					go cycleProfile()
 				} else if idleState == STATE_ACTIVE || idleState == STATE_FADE_IN {
-					//*changePageTriggered = true
+					swippingScreen = true
+					*changePageTriggered = true
+					signalPageChange()
 				}
 				// just update lastActivity
 				lastActivityMu.Lock()
@@ -369,6 +427,7 @@ func monitorConsoleInput(changePageTriggered *bool) {
 		// Trigger on any input (including empty/just Enter key)
 		now := time.Now()
 		log.Printf("⌨️  KEYBOARD ENTER HIT (state: %s)", stateName(idleState))
+		pauseRotationForButton()
 		
 		if idleState == STATE_IDLE || idleState == STATE_OFF || idleState == STATE_FADE_OUT {
 			log.Println("Screen waking up")
@@ -391,7 +450,10 @@ func monitorConsoleInput(changePageTriggered *bool) {
 }
 
 func getBacklight() int {
-	data, err := os.ReadFile("/sys/class/backlight/backlight/brightness")
+	if virtualMode {
+		return lastLogical
+	}
+	data, err := os.ReadFile(sysPath(BACKLIGHT_BRIGHTNESS_PATH))
 	if err != nil {
 		log.Printf("getBacklight error: %v", err)
 		return 0
@@ -452,7 +514,7 @@ func idleDimmer() {
 
 	for range ticker.C {
 		// 1) Movement/keypress detection
-		data, err := os.ReadFile("/sys/kernel/photonicat-pm/movement_trigger")
+		data, err := os.ReadFile(sysPath(MOVEMENT_TRIGGER_PATH))
 		if err == nil && strings.TrimSpace(string(data)) == "1" {
 			// Reset idle timer, treat screen as already “on”
 			now := time.Now()
@@ -480,7 +542,7 @@ func idleDimmer() {
 			} else {
 				newState = STATE_FADE_IN
 			}
-		case idle < idleTimeout:
+		case idle < idleTimeout || cfg.Rotation.kiosk():
 			newState = STATE_ACTIVE
 			swippingScreen = false
 		case idle < idleTimeout+fadeDuration:
@@ -491,6 +553,7 @@ func idleDimmer() {
 
 		if prevState != newState {
 			log.Printf("STATE CHANGED: %s -> %s", stateName(prevState), stateName(newState))
+			events.Publish(EventIdle, map[string]string{"state": stateName(newState), "previous": stateName(prevState)})
 			idleState = newState
 			prevState = newState
 
@@ -546,81 +609,235 @@ func stateName(s int) string {
 	}
 }
 
-// mergeConfigs rebuilds `cfg` by overlaying userCfg on top of dftCfg.
-// It returns an error if any validation fails.
+// mergeConfigs rebuilds `cfg` by overlaying the active profile and then
+// userCfg on top of dftCfg, then reapplies the sections main only reads when
+// starting services (see applyRuntimeConfig).
+// It returns an error if any validation fails, and then leaves cfg as it was.
+//
+// Configs are being loaded here rather than saved, so icon files that went
+// missing since are only warnings; saves check with buildConfig first.
 func mergeConfigs() error {
+	next := overlayConfig(baseConfig(dftCfg), userCfg, hasShowSmsInUserConfig())
+	if err := checkConfig(next, "warning"); err != nil {
+		return err
+	}
+	return applyMergedConfig(next)
+}
+
+// mergeDefaultConfig applies dftCfg alone, for when the profile or user
+// config on top of it doesn't validate
+func mergeDefaultConfig() error {
+	next := overlayConfig(dftCfg, Config{}, false)
+	if err := checkConfig(next, "warning"); err != nil {
+		return err
+	}
+	return applyMergedConfig(next)
+}
+
+// applyMergedConfig makes next, a validated config, the one in use
+func applyMergedConfig(next Config) error {
+	fontTable, err := buildFontTable(next.Fonts)
+	if err != nil {
+		return err
+	}
+	setFonts(fontTable)
+
 	configMutex.Lock()
-	defer configMutex.Unlock()
+	cfg = next
+	cfgNumPages = len(cfg.DisplayTemplate.shownPages())
+	setStaleThresholds(cfg.StaleData.Thresholds)
+
+	// Initialize totalNumPages based on ShowSms setting
+	if cfg.ShowSms {
+		// Will be updated by getSmsPages() goroutine
+		totalNumPages = cfgNumPages + 1 // temporary, will be corrected when SMS data is loaded
+	} else {
+		totalNumPages = cfgNumPages
+	}
+	configMutex.Unlock()
 
-	// 1. Shallow copy defaults into cfg
-	cfg = dftCfg
+	if runtimeConfigStarted.Load() {
+		applyRuntimeConfig(next)
+	}
+	return nil
+}
 
-	// 2. Deep-copy the default template map so we don't mutate dftCfg
-	newElems := make(map[string][]DisplayElement, len(dftCfg.DisplayTemplate.Elements))
-	for page, elems := range dftCfg.DisplayTemplate.Elements {
+// buildConfig overlays user on dft and validates the result without
+// applying it. userShowSms tells whether the user config sets show_sms.
+func buildConfig(dft, user Config, userShowSms bool) (Config, error) {
+	next := overlayConfig(dft, user, userShowSms)
+	return next, validateConfig(next)
+}
+
+// overlayConfig lays the fields user sets over dft
+func overlayConfig(dft, user Config, userShowSms bool) Config {
+	// 1. Shallow copy defaults into the new config
+	next := dft
+
+	// 2. Deep-copy the default template map so we don't mutate dft
+	newElems := make(map[string][]DisplayElement, len(dft.DisplayTemplate.Elements))
+	for page, elems := range dft.DisplayTemplate.Elements {
 		copySlice := make([]DisplayElement, len(elems))
 		copy(copySlice, elems)
 		newElems[page] = copySlice
 	}
 
 	// 3. Overlay any user-provided pages/elements
-	if userCfg.DisplayTemplate.Elements != nil {
-		for page, elems := range userCfg.DisplayTemplate.Elements {
+	if user.DisplayTemplate.Elements != nil {
+		for page, elems := range user.DisplayTemplate.Elements {
 			copySlice := make([]DisplayElement, len(elems))
 			copy(copySlice, elems)
 			newElems[page] = copySlice
 		}
 	}
-	cfg.DisplayTemplate.Elements = newElems
+	next.DisplayTemplate.Elements = newElems
+	// the user's page list replaces the default one as a whole
+	pages := dft.DisplayTemplate.Pages
+	if user.DisplayTemplate.Pages != nil {
+		pages = user.DisplayTemplate.Pages
+	}
+	// an empty list stays empty, for validatePages to refuse, rather than
+	// turning into "every page"
+	next.DisplayTemplate.Pages = nil
+	if pages != nil {
+		next.DisplayTemplate.Pages = append([]PageMeta{}, pages...)
+	}
 
-	// 4. Override scalar fields if userCfg set them
-	if userCfg.ScreenDimmerTimeOnBatterySeconds != 0 {
-		cfg.ScreenDimmerTimeOnBatterySeconds = userCfg.ScreenDimmerTimeOnBatterySeconds
+	// 4. Override scalar fields if user set them
+	if user.ScreenDimmerTimeOnBatterySeconds != 0 {
+		next.ScreenDimmerTimeOnBatterySeconds = user.ScreenDimmerTimeOnBatterySeconds
 	}
-	if userCfg.ScreenDimmerTimeOnDCSeconds != 0 {
-		cfg.ScreenDimmerTimeOnDCSeconds = userCfg.ScreenDimmerTimeOnDCSeconds
+	if user.ScreenDimmerTimeOnDCSeconds != 0 {
+		next.ScreenDimmerTimeOnDCSeconds = user.ScreenDimmerTimeOnDCSeconds
 	}
-	if userCfg.ScreenMaxBrightness != 0 {
-		cfg.ScreenMaxBrightness = userCfg.ScreenMaxBrightness
+	if user.ScreenMaxBrightness != 0 {
+		next.ScreenMaxBrightness = user.ScreenMaxBrightness
 	}
-	if userCfg.ScreenMinBrightness != 0 {
-		cfg.ScreenMinBrightness = userCfg.ScreenMinBrightness
+	if user.ScreenMinBrightness != 0 {
+		next.ScreenMinBrightness = user.ScreenMinBrightness
 	}
-	if userCfg.PingSite0 != "" {
-		cfg.PingSite0 = userCfg.PingSite0
+	if user.PingSite0 != "" {
+		next.PingSite0 = user.PingSite0
 	}
-	if userCfg.PingSite1 != "" {
-		cfg.PingSite1 = userCfg.PingSite1
+	if user.PingSite1 != "" {
+		next.PingSite1 = user.PingSite1
 	}
 	// Override ShowSms only if explicitly set in user config
 	// We need to check if the user config file actually contains show_sms field
-	if hasShowSmsInUserConfig() {
-		cfg.ShowSms = userCfg.ShowSms
+	if userShowSms {
+		next.ShowSms = user.ShowSms
+	}
+	if user.StaleData.Style != "" {
+		next.StaleData.Style = user.StaleData.Style
+	}
+	if user.StaleData.Placeholder != "" {
+		next.StaleData.Placeholder = user.StaleData.Placeholder
 	}
+	if user.StaleData.Marker != "" {
+		next.StaleData.Marker = user.StaleData.Marker
+	}
+	thresholds := make(map[string]int, len(dft.StaleData.Thresholds)+len(user.StaleData.Thresholds))
+	for key, secs := range dft.StaleData.Thresholds {
+		thresholds[key] = secs
+	}
+	for key, secs := range user.StaleData.Thresholds {
+		thresholds[key] = secs
+	}
+	next.StaleData.Thresholds = thresholds
+	next.Collectors = mergeCollectorConfigs(dft.Collectors, user.Collectors)
+	// external collectors run as root, so only config.json declares them
+	next.ExternalCollectors = dft.ExternalCollectors
+	if user.MQTT != (MQTTConfig{}) {
+		// the user's mqtt section replaces the default one as a whole
+		next.MQTT = user.MQTT
+	}
+	if user.Auth.Enabled != nil {
+		next.Auth.Enabled = user.Auth.Enabled
+	}
+	if user.Auth.AllowLocalhost != nil {
+		next.Auth.AllowLocalhost = user.Auth.AllowLocalhost
+	}
+	if user.Auth.PublicRead != nil {
+		next.Auth.PublicRead = user.Auth.PublicRead
+	}
+	if user.Auth.RateLimitPerMinute != 0 {
+		next.Auth.RateLimitPerMinute = user.Auth.RateLimitPerMinute
+	}
+	next.Rotation = mergeRotationConfig(dft.Rotation, user.Rotation)
+	next.Fonts = mergeFontDefs(dft.Fonts, user.Fonts)
+	return next
+}
+
+// validateConfig reports the first problem with a merged config
+func validateConfig(next Config) error {
+	return checkConfig(next, "error")
+}
 
-	// 5. Validation
-	if cfg.ScreenDimmerTimeOnBatterySeconds < 0 {
+// checkConfig is validateConfig with the severity of icon files that don't
+// exist
+func checkConfig(next Config, missingIcon string) error {
+	if next.ScreenDimmerTimeOnBatterySeconds < 0 {
 		return fmt.Errorf("screen_dimmer_time_on_battery_seconds must be ≥ 0, got %d",
-			cfg.ScreenDimmerTimeOnBatterySeconds)
+			next.ScreenDimmerTimeOnBatterySeconds)
 	}
-	if cfg.ScreenDimmerTimeOnDCSeconds < 0 {
+	if next.ScreenDimmerTimeOnDCSeconds < 0 {
 		return fmt.Errorf("screen_dimmer_time_on_dc_seconds must be ≥ 0, got %d",
-			cfg.ScreenDimmerTimeOnDCSeconds)
+			next.ScreenDimmerTimeOnDCSeconds)
 	}
-	if cfg.ScreenMinBrightness < 0 || cfg.ScreenMinBrightness > 100 {
+	if next.ScreenMinBrightness < 0 || next.ScreenMinBrightness > 100 {
 		return fmt.Errorf("screen_min_brightness must be in [0,100], got %d",
-			cfg.ScreenMinBrightness)
+			next.ScreenMinBrightness)
 	}
-	if cfg.ScreenMaxBrightness < 0 || cfg.ScreenMaxBrightness > 100 {
+	if next.ScreenMaxBrightness < 0 || next.ScreenMaxBrightness > 100 {
 		return fmt.Errorf("screen_max_brightness must be in [0,100], got %d",
-			cfg.ScreenMaxBrightness)
+			next.ScreenMaxBrightness)
 	}
-	if cfg.ScreenMinBrightness > cfg.ScreenMaxBrightness {
+	if next.ScreenMinBrightness > next.ScreenMaxBrightness {
 		return fmt.Errorf("screen_min_brightness (%d) cannot exceed screen_max_brightness (%d)",
-			cfg.ScreenMinBrightness, cfg.ScreenMaxBrightness)
+			next.ScreenMinBrightness, next.ScreenMaxBrightness)
+	}
+	switch next.StaleData.Style {
+	case "", "grey", "marker", "placeholder", "off":
+	default:
+		return fmt.Errorf("stale_data.style must be grey, marker, placeholder or off, got %q",
+			next.StaleData.Style)
+	}
+	for key, secs := range next.StaleData.Thresholds {
+		if secs < 0 {
+			return fmt.Errorf("stale_data.thresholds[%s] must be ≥ 0, got %d", key, secs)
+		}
+	}
+	for name, cc := range next.Collectors {
+		if cc.IntervalSeconds < 0 || cc.TimeoutSeconds < 0 || cc.JitterSeconds < 0 || cc.MaxBackoffSeconds < 0 {
+			return fmt.Errorf("collectors.%s: durations must be ≥ 0", name)
+		}
+	}
+	if err := validatePages(next.DisplayTemplate); err != nil {
+		return err
+	}
+	fontTable, err := buildFontTable(next.Fonts)
+	if err != nil {
+		return err
+	}
+	if issues := checkTemplate(next.DisplayTemplate, knownDataKeys(next), fontTable, missingIcon); hasTemplateErrors(issues) {
+		return TemplateErrors(issues)
+	}
+	if err := validateMQTTConfig(next.MQTT); err != nil {
+		return err
+	}
+	if next.Auth.RateLimitPerMinute < 0 {
+		return fmt.Errorf("auth.rate_limit_per_minute must be ≥ 0, got %d", next.Auth.RateLimitPerMinute)
+	}
+	for _, def := range next.ExternalCollectors {
+		if err := validateExternalCollector(def); err != nil {
+			return fmt.Errorf("external_collectors: %v", err)
+		}
+	}
+	if err := validateRotationConfig(next.Rotation); err != nil {
+		return err
 	}
 	/*
-	   for name, site := range map[string]string{"ping_site0": cfg.PingSite0, "ping_site1": cfg.PingSite1} {
+	   for name, site := range map[string]string{"ping_site0": next.PingSite0, "ping_site1": next.PingSite1} {
 	       if site != "" {
 	           if u, err := url.ParseRequestURI(site); err != nil || u.Scheme == "" && u.Host == "" {
 	               return fmt.Errorf("invalid %s: %q", name, site)
@@ -628,33 +845,13 @@ func mergeConfigs() error {
 	       }
 	   }*/
 
-	cfgNumPages = len(cfg.DisplayTemplate.Elements)
-
-	// Initialize totalNumPages based on ShowSms setting
-	if cfg.ShowSms {
-		// Will be updated by getSmsPages() goroutine
-		totalNumPages = cfgNumPages + 1 // temporary, will be corrected when SMS data is loaded
-	} else {
-		totalNumPages = cfgNumPages
-	}
-
 	return nil
 }
 
 // hasShowSmsInUserConfig checks if the user config file explicitly contains show_sms field
 func hasShowSmsInUserConfig() bool {
-	var userConfigPath string
-	localUserConfig := "user_config.json"
-
-	// Determine which user config file to check
-	if _, err := os.Stat(localUserConfig); err == nil {
-		userConfigPath = localUserConfig
-	} else {
-		userConfigPath = ETC_USER_CONFIG_PATH
-	}
-
 	// Read the raw JSON
-	raw, err := os.ReadFile(userConfigPath)
+	raw, err := os.ReadFile(userConfigFile)
 	if err != nil {
 		return false
 	}
@@ -682,12 +879,10 @@ func loadAllConfigsToVariables() {
 	}
 
 	if localConfigExists {
-		cfg, err = loadConfig(localConfig)
-		dftCfg, err = loadConfig(localConfig)
-	} else {
-		cfg, err = loadConfig(ETC_CONFIG_PATH)
-		dftCfg, err = loadConfig(ETC_CONFIG_PATH)
+		defaultConfigFile = localConfig
 	}
+	cfg, err = loadConfig(defaultConfigFile)
+	dftCfg, err = loadConfig(defaultConfigFile)
 
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -695,45 +890,37 @@ func loadAllConfigsToVariables() {
 		log.Println("CFG, DFTCFG: READ SUCCESS")
 	}
 
-	userConfigExists := false
+	// user_config.json in the working directory during development; from here
+	// on every read, save and reload of the user config uses userConfigFile
 	if _, err := os.Stat(userConfig); err == nil {
-		userConfigExists = true
+		userConfigFile = userConfig
 		log.Println("User config found at", userConfig)
 	} else {
-		log.Println("No user config found, try to use", ETC_USER_CONFIG_PATH)
+		log.Println("No user config found, try to use", userConfigFile)
 	}
 
-	if userConfigExists {
-		userCfg, err = loadConfig(userConfig)
-	} else {
-		userCfg, err = loadConfig(ETC_USER_CONFIG_PATH)
-	}
+	userCfg, err = loadConfig(userConfigFile)
 
 	if err != nil {
 		//create a empty json file
 		content := "{}"
-		if err := os.WriteFile(ETC_USER_CONFIG_PATH, []byte(content), 0644); err != nil {
+		if err := os.WriteFile(userConfigFile, []byte(content), 0644); err != nil {
 			log.Printf("could not write temp user config: %v", err)
 		}
-		log.Println("Created empty user config file at", ETC_USER_CONFIG_PATH)
-		userCfg, err = loadConfig(ETC_USER_CONFIG_PATH)
+		log.Println("Created empty user config file at", userConfigFile)
+		userCfg, err = loadConfig(userConfigFile)
 	} else {
 		log.Println("USER CFG: READ SUCCESS")
 	}
 
-	if userConfigExists && localConfigExists {
-		err = mergeConfigs()
-		if err != nil {
-			log.Fatalf("Failed to merge configs: %v, using default config", err)
-			cfg = dftCfg
-		} else {
-			log.Println("MERGE CFG: SUCCESS")
+	if err := mergeConfigs(); err != nil {
+		// a config that broke since it was saved must not leave the screen
+		// without pages; reloads and saves try the full config again
+		log.Printf("❌ config not applied, using %s alone: %v", defaultConfigFile, err)
+		if err := mergeDefaultConfig(); err != nil {
+			log.Fatalf("Failed to load default config %s: %v", defaultConfigFile, err)
 		}
 	} else {
-		cfg = dftCfg
-		log.Println("NO USER CFG, Not Merging, using default config")
+		log.Println("MERGE CFG: SUCCESS")
 	}
-
-	mergeConfigs()
-
 }
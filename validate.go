@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	iconExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".svg"}
+	graphTypes     = []string{"power"}
+)
+
+// TemplateIssue is one problem in a display template. File, Line and Column
+// point into the config it came from when the validator had the source.
+type TemplateIssue struct {
+	Path     string `json:"path"` // e.g. display_template.elements.page0[2].font
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"` // "error" or "warning"
+	Message  string `json:"message"`
+}
+
+func (i TemplateIssue) String() string {
+	where := i.Path
+	if i.Line > 0 {
+		where = fmt.Sprintf("line %d:%d: %s", i.Line, i.Column, i.Path)
+		if i.File != "" {
+			where = fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Path)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", where, i.Severity, i.Message)
+}
+
+// TemplateErrors is returned for a template with errors. It carries the
+// warnings too, so callers can show everything at once.
+type TemplateErrors []TemplateIssue
+
+func (e TemplateErrors) Error() string {
+	var errs []string
+	for _, issue := range e {
+		if issue.Severity == "error" {
+			errs = append(errs, issue.String())
+		}
+	}
+	if len(errs) > 3 {
+		errs = append(errs[:3], fmt.Sprintf("and %d more", len(errs)-3))
+	}
+	return strings.Join(errs, "; ")
+}
+
+func hasTemplateErrors(issues []TemplateIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTemplate checks every element against the schema and what the
+// device can draw: fonts in fontTable, icon files under assetsPrefix and
+// positions inside the middle area. Data keys nothing produces are only
+// warnings, since clients may post them through the API later.
+func validateTemplate(t DisplayTemplate, dataKeys map[string]bool, fontTable map[string]FontConfig) []TemplateIssue {
+	return checkTemplate(t, dataKeys, fontTable, "error")
+}
+
+// checkTemplate is validateTemplate with the severity of icon files that
+// don't exist: a warning when loading configs, so an icon removed after the
+// config was saved doesn't refuse the whole config
+func checkTemplate(t DisplayTemplate, dataKeys map[string]bool, fontTable map[string]FontConfig, missingIcon string) []TemplateIssue {
+	var issues []TemplateIssue
+	pageIDs := make([]string, 0, len(t.Elements))
+	for id := range t.Elements {
+		pageIDs = append(pageIDs, id)
+	}
+	sort.Strings(pageIDs)
+
+	for _, id := range pageIDs {
+		for i, e := range t.Elements[id] {
+			path := fmt.Sprintf("display_template.elements.%s[%d]", id, i)
+			add := func(field, severity, format string, args ...interface{}) {
+				p := path
+				if field != "" {
+					p += "." + field
+				}
+				issues = append(issues, TemplateIssue{Path: p, Severity: severity, Message: fmt.Sprintf(format, args...)})
+			}
+			validateTemplateElement(e, dataKeys, fontTable, missingIcon, add)
+		}
+	}
+	return issues
+}
+
+func validateTemplateElement(e DisplayElement, dataKeys map[string]bool, fontTable map[string]FontConfig, missingIcon string, add func(field, severity, format string, args ...interface{})) {
+	if !containsString(elementTypes, e.Type) {
+		add("type", "error", "type must be one of %s, got %q", strings.Join(elementTypes, ", "), e.Type)
+		return
+	}
+
+	switch e.Type {
+	case "text":
+		if e.DataKey == "" {
+			add("data_key", "error", "text elements need a data_key")
+		} else if !dataKeys[e.DataKey] {
+			add("data_key", "warning", "no collector provides %q; it shows \"-\" until a value is posted", e.DataKey)
+		}
+		checkFont(e.Font, "font", fontTable, add)
+		checkFont(e.UnitsFont, "units_font", fontTable, add)
+	case "fixed_text":
+		checkFont(e.Font, "font", fontTable, add)
+	case "icon":
+		checkIconPath(e.IconPath, missingIcon, add)
+	case "graph":
+		if e.GraphConfig == nil {
+			add("graph_config", "error", "graph elements need a graph_config")
+		} else {
+			if !containsString(graphTypes, e.GraphConfig.GraphType) {
+				add("graph_config.graph_type", "error", "graph_type must be one of %s, got %q", strings.Join(graphTypes, ", "), e.GraphConfig.GraphType)
+			}
+			if e.GraphConfig.TimeFrameMins < 0 {
+				add("graph_config.time_frame_mins", "error", "time_frame_mins must be ≥ 0, got %d", e.GraphConfig.TimeFrameMins)
+			}
+		}
+	}
+
+	if e.Color != nil {
+		if len(e.Color) != 3 {
+			add("color", "error", "color must be [r, g, b], got %d values", len(e.Color))
+		}
+		for i, c := range e.Color {
+			if c < 0 || c > 255 {
+				add(fmt.Sprintf("color[%d]", i), "error", "color values must be 0-255, got %d", c)
+			}
+		}
+	}
+
+	if e.Position.X < 0 || e.Position.X >= middleFrameWidth {
+		add("position.x", "error", "x must be within the %dx%d middle area, got %d", middleFrameWidth, middleFrameHeight, e.Position.X)
+	}
+	if e.Position.Y < 0 || e.Position.Y >= middleFrameHeight {
+		add("position.y", "error", "y must be within the %dx%d middle area, got %d", middleFrameWidth, middleFrameHeight, e.Position.Y)
+	}
+	for field, sz := range map[string]*Size{"size": e.Size, "_size": e.Size2} {
+		if sz == nil {
+			continue
+		}
+		if sz.Width <= 0 || sz.Height <= 0 {
+			add(field, "error", "width and height must be > 0, got %dx%d", sz.Width, sz.Height)
+		} else if e.Position.X+sz.Width > middleFrameWidth || e.Position.Y+sz.Height > middleFrameHeight {
+			add(field, "error", "a %dx%d element at %d,%d runs past the %dx%d middle area",
+				sz.Width, sz.Height, e.Position.X, e.Position.Y, middleFrameWidth, middleFrameHeight)
+		}
+	}
+}
+
+func checkFont(name, field string, fontTable map[string]FontConfig, add func(field, severity, format string, args ...interface{})) {
+	if name == "" {
+		add(field, "error", "%s is required", field)
+		return
+	}
+	if _, ok := fontTable[name]; !ok {
+		add(field, "error", "unknown font %q, fonts are %s", name, strings.Join(sortedFontNames(fontTable), ", "))
+	}
+}
+
+func checkIconPath(path, missingIcon string, add func(field, severity, format string, args ...interface{})) {
+	if path == "" {
+		add("icon_path", "error", "icon elements need an icon_path")
+		return
+	}
+	if !containsString(iconExtensions, strings.ToLower(filepath.Ext(path))) {
+		add("icon_path", "error", "icon_path must end in %s, got %q", strings.Join(iconExtensions, ", "), path)
+		return
+	}
+	if _, err := os.Stat(assetPath(path)); err != nil {
+		add("icon_path", missingIcon, "icon %q not found at %s", path, assetPath(path))
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fontNames are the fonts the screen draws with
+func fontNames() []string {
+	fontsMu.RLock()
+	defer fontsMu.RUnlock()
+	return sortedFontNames(fonts)
+}
+
+func sortedFontNames(fontTable map[string]FontConfig) []string {
+	names := make([]string, 0, len(fontTable))
+	for name := range fontTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownDataKeys is every key the collectors, external collectors and API
+// clients have produced or are declared to produce
+func knownDataKeys(conf Config) map[string]bool {
+	keys := make(map[string]bool, len(dataKeySpecs))
+	for key := range dataKeySpecs {
+		keys[key] = true
+	}
+	for _, def := range conf.ExternalCollectors {
+		keys[def.DataKey] = true
+	}
+	for key := range globalData.Values() {
+		keys[key] = true
+	}
+	return keys
+}
+
+// locateIssues fills in where each issue is in raw, the JSON it came from.
+// Issues about a missing field point at the enclosing element. Elements raw
+// doesn't have are left alone: pages overlay whole, so the element is in the
+// other config file.
+func locateIssues(issues []TemplateIssue, raw []byte, file string) {
+	offsets := jsonOffsets(raw)
+	for i := range issues {
+		if issues[i].Line > 0 {
+			continue
+		}
+		for path := issues[i].Path; strings.Contains(path, "["); path = parentPath(path) {
+			if off, ok := offsets[path]; ok {
+				issues[i].File = file
+				issues[i].Line, issues[i].Column = lineColumn(raw, off)
+				break
+			}
+		}
+	}
+}
+
+// jsonOffsets maps the path of every value in raw, written the way
+// validateTemplate writes them (a.b[2].c), to the offset where it starts
+func jsonOffsets(raw []byte) map[string]int {
+	offsets := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	valueStart := func() int {
+		off := int(dec.InputOffset())
+		for off < len(raw) && strings.IndexByte(" \t\r\n,:", raw[off]) >= 0 {
+			off++
+		}
+		return off
+	}
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		start := valueStart()
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if path != "" {
+			offsets[path] = start
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child := key.(string)
+				if path != "" {
+					child = path + "." + child
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+		return nil
+	}
+	walk("") // a syntax error only cuts the map short
+	return offsets
+}
+
+// parentPath drops the last .field or [index] of a path
+func parentPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i > 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+func lineColumn(raw []byte, off int) (line, col int) {
+	if off > len(raw) {
+		off = len(raw)
+	}
+	line = 1 + bytes.Count(raw[:off], []byte("\n"))
+	return line, off - bytes.LastIndexByte(raw[:off], '\n')
+}
+
+// templateSchema is a JSON Schema of display_template, for editors and the
+// web UI; validateTemplate applies the same rules plus the checks a schema
+// can't express, like icon files existing
+func templateSchema() map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	integer := func(min, max int) map[string]interface{} {
+		return map[string]interface{}{"type": "integer", "minimum": min, "maximum": max}
+	}
+	size := map[string]interface{}{
+		"type":     "object",
+		"required": []string{"width", "height"},
+		"properties": map[string]interface{}{
+			"width":  integer(1, middleFrameWidth),
+			"height": integer(1, middleFrameHeight),
+		},
+	}
+	fontName := map[string]interface{}{"type": "string", "enum": fontNames()}
+	requires := func(elementType, field string) map[string]interface{} {
+		return map[string]interface{}{
+			"if":   map[string]interface{}{"properties": map[string]interface{}{"type": map[string]interface{}{"const": elementType}}},
+			"then": map[string]interface{}{"required": []string{field}},
+		}
+	}
+
+	element := map[string]interface{}{
+		"type":     "object",
+		"required": []string{"type", "position"},
+		"properties": map[string]interface{}{
+			"type":  map[string]interface{}{"type": "string", "enum": elementTypes},
+			"label": str,
+			"position": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"x", "y"},
+				"properties": map[string]interface{}{
+					"x": integer(0, middleFrameWidth-1),
+					"y": integer(0, middleFrameHeight-1),
+				},
+			},
+			"font":       fontName,
+			"units_font": fontName,
+			"color": map[string]interface{}{
+				"type": "array", "minItems": 3, "maxItems": 3, "items": integer(0, 255),
+			},
+			"units":     str,
+			"data_key":  str,
+			"icon_path": map[string]interface{}{"type": "string", "pattern": `(?i)\.(png|jpe?g|gif|svg)$`},
+			"enable":    map[string]interface{}{"type": "integer", "description": "0 hides the element"},
+			"size":      size,
+			"_size":     size,
+			"graph_config": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"graph_type"},
+				"properties": map[string]interface{}{
+					"graph_type":      map[string]interface{}{"type": "string", "enum": graphTypes},
+					"time_frame_mins": map[string]interface{}{"type": "integer", "minimum": 0},
+				},
+			},
+		},
+		"allOf": []interface{}{
+			requires("text", "data_key"), requires("text", "font"), requires("text", "units_font"),
+			requires("fixed_text", "font"),
+			requires("icon", "icon_path"),
+			requires("graph", "graph_config"),
+		},
+	}
+
+	return map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "display_template",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"elements": map[string]interface{}{
+				"type":                 "object",
+				"propertyNames":        map[string]interface{}{"pattern": pageIDPattern.String()},
+				"additionalProperties": map[string]interface{}{"type": "array", "items": element},
+			},
+			"pages": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"id"},
+					"properties": map[string]interface{}{
+						"id":      map[string]interface{}{"type": "string", "pattern": pageIDPattern.String()},
+						"title":   str,
+						"enabled": map[string]interface{}{"type": "boolean"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// validateUserConfig checks raw as a user config on top of the current
+// defaults without applying it. Issues are located in raw.
+func validateUserConfig(raw []byte) ([]TemplateIssue, error) {
+	var user Config
+	if err := secureUnmarshal(raw, &user); err != nil {
+		return nil, err
+	}
+	var keys map[string]interface{}
+	json.Unmarshal(raw, &keys)
+	if err := checkNoExternalCollectors(keys); err != nil {
+		return nil, err
+	}
+	_, hasShowSms := keys["show_sms"]
+
+	merged, err := buildConfig(baseConfig(dftCfg), user, hasShowSms)
+	var templateErrs TemplateErrors
+	if errors.As(err, &templateErrs) {
+		locateIssues(templateErrs, raw, "")
+		return templateErrs, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	issues := templateIssues(merged)
+	locateIssues(issues, raw, "")
+	return issues, nil
+}
+
+// templateIssues are the warnings and errors of the template of a config that
+// passed validateConfig
+func templateIssues(c Config) []TemplateIssue {
+	fontTable, err := buildFontTable(c.Fonts)
+	if err != nil {
+		return []TemplateIssue{{Path: "fonts", Severity: "error", Message: err.Error()}}
+	}
+	return validateTemplate(c.DisplayTemplate, knownDataKeys(c), fontTable)
+}
+
+// apiConfigError answers 422, listing the template issues, with their place
+// in body, when there are any
+func apiConfigError(c *fiber.Ctx, err error, body []byte) error {
+	var templateErrs TemplateErrors
+	if !errors.As(err, &templateErrs) {
+		return apiError(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+	locateIssues(templateErrs, body, "")
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"status": "error", "code": "unprocessable_entity", "message": templateErrs.Error(), "issues": []TemplateIssue(templateErrs),
+	})
+}
+
+// GET /api/v2/config/schema
+func getTemplateSchema(c *fiber.Ctx) error {
+	return c.JSON(templateSchema())
+}
+
+// POST /api/v2/config/validate
+// Body: a user config. Nothing is saved.
+func postValidateConfig(c *fiber.Ctx) error {
+	if err := validateJSON(c.Body()); err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	issues, err := validateUserConfig(c.Body())
+	if err != nil && issues == nil {
+		return c.JSON(fiber.Map{"valid": false, "message": err.Error(), "issues": []TemplateIssue{}})
+	}
+	if issues == nil {
+		issues = []TemplateIssue{}
+	}
+	return c.JSON(fiber.Map{"valid": !hasTemplateErrors(issues), "issues": issues})
+}